@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/server"
@@ -9,13 +12,23 @@ import (
 
 func main() {
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
 
-	// Create and start the server
-	srv := server.New(cfg)
+	if cfg.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Error printing configuration: %v", err)
+		}
+		return
+	}
 
-	log.Printf("Starting HTTP server on %s", cfg.Address)
-	if err := srv.Start(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+	// Serve until a shutdown signal, or hand over on a restart signal
+	if err := server.Run(cfg); err != nil {
+		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Prefixes is a list of IP networks. It implements flag.Value, accepting a
+// CIDR such as 10.0.0.0/8, or a single address, once per flag occurrence.
+type Prefixes []netip.Prefix
+
+// String returns the networks comma-separated
+func (ps *Prefixes) String() string {
+	return strings.Join(ps.Values(), ",")
+}
+
+// Set parses and appends a network or address
+func (ps *Prefixes) Set(value string) error {
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(value)
+		if addrErr != nil {
+			return fmt.Errorf("expected a CIDR or IP address, got %q", value)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	*ps = append(*ps, prefix.Masked())
+	return nil
+}
+
+// Values returns the networks in CIDR notation
+func (ps *Prefixes) Values() []string {
+	values := make([]string, 0, len(*ps))
+	for _, prefix := range *ps {
+		values = append(values, prefix.String())
+	}
+	return values
+}
+
+// Reset removes every network
+func (ps *Prefixes) Reset() {
+	*ps = nil
+}
+
+// Contains reports whether addr is in one of the networks. IPv4-mapped
+// IPv6 addresses match IPv4 networks.
+func (ps Prefixes) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range ps {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Proxies are the peers trusted to forward requests: IP networks, as for
+// Prefixes, and with the value "unix" any peer on a Unix socket, which has
+// no address to match
+type Proxies struct {
+	Prefixes Prefixes
+	Unix     bool
+}
+
+// String returns the networks, and unix if set, comma-separated
+func (p *Proxies) String() string {
+	return strings.Join(p.Values(), ",")
+}
+
+// Set parses and appends a network, an address or "unix"
+func (p *Proxies) Set(value string) error {
+	if value == "unix" {
+		p.Unix = true
+		return nil
+	}
+	if err := p.Prefixes.Set(value); err != nil {
+		return fmt.Errorf("expected a CIDR, IP address or unix, got %q", value)
+	}
+	return nil
+}
+
+// Values returns the networks in CIDR notation, and unix if set
+func (p *Proxies) Values() []string {
+	values := p.Prefixes.Values()
+	if p.Unix {
+		values = append(values, "unix")
+	}
+	return values
+}
+
+// Reset removes every network and unix
+func (p *Proxies) Reset() {
+	*p = Proxies{}
+}
+
+// Trusts reports whether a peer is trusted; the zero address stands for a
+// peer on a Unix socket
+func (p *Proxies) Trusts(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return p.Unix
+	}
+	return p.Prefixes.Contains(addr)
+}
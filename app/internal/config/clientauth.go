@@ -0,0 +1,212 @@
+package config
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// Client certificate modes for TLS listeners
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequired = "required"
+)
+
+// Certificate attributes a policy can require
+const (
+	CertAttrCommonName = "CN"
+	CertAttrOrg        = "O"
+	CertAttrOrgUnit    = "OU"
+	CertAttrDNS        = "DNS"
+	CertAttrEmail      = "EMAIL"
+	CertAttrURI        = "URI"
+)
+
+// CertRequirement is a certificate attribute that must have a given value
+type CertRequirement struct {
+	Attr  string
+	Value string
+}
+
+// ClientCertPolicy requires a verified client certificate for requests
+// matching Method (empty for any) and Prefix, with every requirement met
+type ClientCertPolicy struct {
+	Method   string
+	Prefix   string
+	Requires []CertRequirement
+}
+
+// ParseClientCertPolicy parses a policy such as
+//
+//	/files/
+//	POST /files/ OU=uploader
+//	GET /admin/ O=example+OU=ops
+//
+// Requirements are joined with "+" and all must be met; without any, a
+// verified certificate is enough.
+func ParseClientCertPolicy(spec string) (ClientCertPolicy, error) {
+	fields := strings.Fields(spec)
+
+	var p ClientCertPolicy
+	if len(fields) > 0 && !strings.HasPrefix(fields[0], "/") {
+		p.Method = strings.ToUpper(fields[0])
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 || !strings.HasPrefix(fields[0], "/") {
+		return ClientCertPolicy{}, fmt.Errorf("expected [METHOD] /prefix [ATTR=value+...], got %q", spec)
+	}
+	p.Prefix = fields[0]
+
+	if len(fields) == 2 {
+		for _, requirement := range strings.Split(fields[1], "+") {
+			attr, value, found := strings.Cut(requirement, "=")
+			attr = strings.ToUpper(attr)
+			if !found || value == "" {
+				return ClientCertPolicy{}, fmt.Errorf("invalid requirement %q in %q", requirement, spec)
+			}
+
+			switch attr {
+			case CertAttrCommonName, CertAttrOrg, CertAttrOrgUnit, CertAttrDNS, CertAttrEmail, CertAttrURI:
+			default:
+				return ClientCertPolicy{}, fmt.Errorf("unknown certificate attribute %q in %q", attr, spec)
+			}
+			p.Requires = append(p.Requires, CertRequirement{Attr: attr, Value: value})
+		}
+	}
+
+	return p, nil
+}
+
+// String returns the policy as a spec accepted by ParseClientCertPolicy
+func (p ClientCertPolicy) String() string {
+	fields := make([]string, 0, 3)
+	if p.Method != "" {
+		fields = append(fields, p.Method)
+	}
+	fields = append(fields, p.Prefix)
+
+	if len(p.Requires) > 0 {
+		requirements := make([]string, 0, len(p.Requires))
+		for _, r := range p.Requires {
+			requirements = append(requirements, r.Attr+"="+r.Value)
+		}
+		fields = append(fields, strings.Join(requirements, "+"))
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// Applies reports whether the policy covers a request
+func (p ClientCertPolicy) Applies(method, path string) bool {
+	return (p.Method == "" || p.Method == method) && strings.HasPrefix(path, p.Prefix)
+}
+
+// Allows reports whether a verified client certificate meets the policy;
+// a nil certificate never does
+func (p ClientCertPolicy) Allows(cert *x509.Certificate) bool {
+	if cert == nil {
+		return false
+	}
+
+	for _, r := range p.Requires {
+		if !certHas(cert, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// certHas reports whether a certificate has the required attribute value
+func certHas(cert *x509.Certificate, r CertRequirement) bool {
+	var values []string
+	switch r.Attr {
+	case CertAttrCommonName:
+		values = []string{cert.Subject.CommonName}
+	case CertAttrOrg:
+		values = cert.Subject.Organization
+	case CertAttrOrgUnit:
+		values = cert.Subject.OrganizationalUnit
+	case CertAttrDNS:
+		values = cert.DNSNames
+	case CertAttrEmail:
+		values = cert.EmailAddresses
+	case CertAttrURI:
+		for _, uri := range cert.URIs {
+			values = append(values, uri.String())
+		}
+	}
+
+	for _, value := range values {
+		if value == r.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientCertPolicies is a list of policies. It implements flag.Value,
+// accepting one policy per flag occurrence.
+type ClientCertPolicies []ClientCertPolicy
+
+// String returns the policies comma-separated
+func (cp *ClientCertPolicies) String() string {
+	return strings.Join(cp.Values(), ",")
+}
+
+// Set parses and appends a policy
+func (cp *ClientCertPolicies) Set(spec string) error {
+	p, err := ParseClientCertPolicy(spec)
+	if err != nil {
+		return err
+	}
+
+	*cp = append(*cp, p)
+	return nil
+}
+
+// Values returns the policy specs
+func (cp *ClientCertPolicies) Values() []string {
+	values := make([]string, 0, len(*cp))
+	for _, p := range *cp {
+		values = append(values, p.String())
+	}
+	return values
+}
+
+// Reset removes every policy
+func (cp *ClientCertPolicies) Reset() {
+	*cp = nil
+}
+
+// ClientCertAllowed reports whether every policy covering a request is met
+// by its verified client certificate, which is nil if there is none
+func (c *Config) ClientCertAllowed(method, path string, cert *x509.Certificate) bool {
+	for _, p := range c.ClientCertPolicies {
+		if p.Applies(method, path) && !p.Allows(cert) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateClientAuth checks the client certificate settings
+func (c *Config) validateClientAuth() []error {
+	var errs []error
+
+	switch c.TLSClientAuth {
+	case ClientAuthNone:
+		if len(c.ClientCertPolicies) > 0 {
+			errs = append(errs, fmt.Errorf("client-cert-policy: needs -tls-client-auth %s or %s", ClientAuthOptional, ClientAuthRequired))
+		}
+	case ClientAuthOptional, ClientAuthRequired:
+		if c.TLSClientCA == "" {
+			errs = append(errs, fmt.Errorf("tls-client-auth: %s needs -tls-client-ca", c.TLSClientAuth))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls-client-auth: unknown mode %q, want %s, %s or %s",
+			c.TLSClientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequired))
+	}
+
+	return errs
+}
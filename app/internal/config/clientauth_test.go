@@ -0,0 +1,156 @@
+package config
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseClientCertPolicy(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ClientCertPolicy
+		str  string // String of the result, "" if the same as spec
+	}{
+		{spec: "/files/", want: ClientCertPolicy{Prefix: "/files/"}},
+		{spec: "POST /files/", want: ClientCertPolicy{Method: "POST", Prefix: "/files/"}},
+		{
+			spec: "POST /files/ OU=uploader",
+			want: ClientCertPolicy{Method: "POST", Prefix: "/files/", Requires: []CertRequirement{{CertAttrOrgUnit, "uploader"}}},
+		},
+		{
+			spec: "GET /admin/ O=example+OU=ops+DNS=a.example",
+			want: ClientCertPolicy{Method: "GET", Prefix: "/admin/", Requires: []CertRequirement{
+				{CertAttrOrg, "example"}, {CertAttrOrgUnit, "ops"}, {CertAttrDNS, "a.example"},
+			}},
+		},
+		// Methods and attribute names are case-insensitive, values are not
+		{
+			spec: "  post   /files/   ou=Uploader+email=a@example.com+uri=spiffe://x/y+cn=c ",
+			want: ClientCertPolicy{Method: "POST", Prefix: "/files/", Requires: []CertRequirement{
+				{CertAttrOrgUnit, "Uploader"}, {CertAttrEmail, "a@example.com"}, {CertAttrURI, "spiffe://x/y"}, {CertAttrCommonName, "c"},
+			}},
+			str: "POST /files/ OU=Uploader+EMAIL=a@example.com+URI=spiffe://x/y+CN=c",
+		},
+		// Only the first "=" separates the value
+		{spec: "/x CN=a=b", want: ClientCertPolicy{Prefix: "/x", Requires: []CertRequirement{{CertAttrCommonName, "a=b"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseClientCertPolicy(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClientCertPolicy = %+v, want %+v", got, tt.want)
+			}
+			str := tt.str
+			if str == "" {
+				str = tt.spec
+			}
+			if got.String() != str {
+				t.Errorf("String = %q, want %q", got.String(), str)
+			}
+		})
+	}
+}
+
+func TestParseClientCertPolicyErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"POST",
+		"files/",
+		"POST files/ OU=x",
+		"POST /files/ OU=x extra",
+		"/files/ OU",
+		"/files/ OU=",
+		"/files/ OU=x+",
+		"/files/ SERIAL=1",
+	} {
+		if p, err := ParseClientCertPolicy(spec); err == nil {
+			t.Errorf("ParseClientCertPolicy(%q) = %+v, want an error", spec, p)
+		}
+	}
+}
+
+// testCert is a client certificate with one of each attribute
+var testCert = &x509.Certificate{
+	Subject: pkix.Name{
+		CommonName:         "svc",
+		Organization:       []string{"example"},
+		OrganizationalUnit: []string{"uploader", "ops"},
+	},
+	DNSNames:       []string{"svc.example"},
+	EmailAddresses: []string{"svc@example.com"},
+	URIs:           []*url.URL{{Scheme: "spiffe", Host: "example", Path: "/svc"}},
+}
+
+func TestClientCertPolicyAllows(t *testing.T) {
+	tests := []struct {
+		spec string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"/files/", testCert, true},
+		{"/files/", nil, false},
+		{"/files/ OU=uploader", nil, false},
+		{"/files/ CN=svc", testCert, true},
+		{"/files/ O=example", testCert, true},
+		{"/files/ OU=ops", testCert, true},
+		{"/files/ DNS=svc.example", testCert, true},
+		{"/files/ EMAIL=svc@example.com", testCert, true},
+		{"/files/ URI=spiffe://example/svc", testCert, true},
+		{"/files/ OU=uploader+O=example+CN=svc", testCert, true},
+		// Every requirement must be met
+		{"/files/ OU=uploader+O=other", testCert, false},
+		{"/files/ CN=other", testCert, false},
+		{"/files/ DNS=other.example", testCert, false},
+		// Values are compared exactly
+		{"/files/ OU=Uploader", testCert, false},
+		{"/files/ CN=sv", testCert, false},
+	}
+	for _, tt := range tests {
+		p, err := ParseClientCertPolicy(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Allows(tt.cert); got != tt.want {
+			t.Errorf("%q: Allows(%v) = %v, want %v", tt.spec, tt.cert != nil, got, tt.want)
+		}
+	}
+}
+
+func TestClientCertAllowed(t *testing.T) {
+	cfg := &Config{}
+	for _, spec := range []string{"POST /files/ OU=uploader", "/admin/ OU=ops", "DELETE /files/ OU=admin"} {
+		if err := cfg.ClientCertPolicies.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		method, path string
+		cert         *x509.Certificate
+		want         bool
+	}{
+		// No policy covers these
+		{"GET", "/files/a", nil, true},
+		{"POST", "/echo/x", nil, true},
+		{"POST", "/file", nil, true},
+		// Method and prefix must both match
+		{"POST", "/files/a", nil, false},
+		{"POST", "/files/a", testCert, true},
+		{"GET", "/admin/reload", nil, false},
+		{"POST", "/admin/reload", testCert, true},
+		// Every policy that applies must be met
+		{"DELETE", "/files/a", testCert, false},
+		{"DELETE", "/echo/a", testCert, true},
+	}
+	for _, tt := range tests {
+		if got := cfg.ClientCertAllowed(tt.method, tt.path, tt.cert); got != tt.want {
+			t.Errorf("ClientCertAllowed(%s %s, cert %v) = %v, want %v", tt.method, tt.path, tt.cert != nil, got, tt.want)
+		}
+	}
+}
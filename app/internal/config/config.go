@@ -1,7 +1,43 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultServerName is the Server header token used unless configured otherwise
+const DefaultServerName = "drizzle"
+
+// DefaultAddress is the listening address used unless configured otherwise
+const DefaultAddress = "0.0.0.0:4221"
+
+// Default timeouts
+const (
+	DefaultShutdownTimeout   = 30 * time.Second
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 60 * time.Second
+)
+
+// DefaultMaxRequestBodySize is the largest request body accepted unless
+// configured otherwise
+const DefaultMaxRequestBodySize = 10 << 20
+
+// Environment variables read by Load. Every flag can also be set with
+// EnvPrefix followed by its name in upper case with dashes as underscores,
+// e.g. DRIZZLE_READ_TIMEOUT for -read-timeout.
+const (
+	EnvPrefix = "DRIZZLE_"
+	EnvPort   = "PORT"
 )
 
 // Config holds the application configuration
@@ -9,19 +45,426 @@ type Config struct {
 	// FilesDirectory is the directory to serve files from
 	FilesDirectory string
 
-	// Address is the server's listening address
+	// Address is the server's listening address, used when no Listeners
+	// are configured
 	Address string
+
+	// Listeners are the sockets to serve on, each with its own settings
+	Listeners Listeners
+
+	// ServerName is sent in the Server response header; empty omits it
+	ServerName string
+
+	// ShutdownTimeout is how long in-flight requests may run after a
+	// shutdown signal before their connections are closed
+	ShutdownTimeout time.Duration
+
+	// ReadHeaderTimeout limits reading the request line and headers,
+	// measured from the first byte of the request. Zero uses ReadTimeout.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout limits reading the entire request including the body,
+	// measured from the first byte of the request. Zero means no limit.
+	ReadTimeout time.Duration
+
+	// WriteTimeout limits writing the response, measured from the end of
+	// the request. Zero means no limit.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is how long a keep-alive connection may wait for the
+	// next request. Zero uses ReadTimeout.
+	IdleTimeout time.Duration
+
+	// HandlerTimeout limits how long a handler may run before the client
+	// gets a 503. Zero means no limit.
+	HandlerTimeout time.Duration
+
+	// HandlerTimeouts overrides HandlerTimeout for paths starting with
+	// the given prefix; the longest matching prefix wins
+	HandlerTimeouts RouteTimeouts
+
+	// MaxRequestBodySize is the largest request body accepted over any
+	// protocol; larger ones get a 413
+	MaxRequestBodySize int64
+
+	// MaxConns limits the connections open at once across all
+	// listeners; further ones get a 503. Zero means no limit.
+	MaxConns int
+
+	// MaxConnsPerIP limits the connections open at once from a single
+	// client IP address. Zero means no limit.
+	MaxConnsPerIP int
+
+	// ProxyProtocol expects a PROXY protocol header on the default
+	// listener; listeners given with -listen take proxy=true instead
+	ProxyProtocol bool
+
+	// ProxyProtocolTrusted are the load balancer addresses whose
+	// connections must start with a PROXY header. Others on a PROXY
+	// protocol listener are served as they are.
+	ProxyProtocolTrusted Prefixes
+
+	// TrustedProxies are the reverse proxies whose Forwarded,
+	// X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies Proxies
+
+	// Sockets tunes TCP listening sockets and accepted connections
+	Sockets SocketOptions
+
+	// Engine is EngineGoroutine or EngineEpoll, choosing how connections
+	// wait for requests
+	Engine string
+
+	// Workers is the number of goroutines the epoll engine keeps for
+	// serving requests; zero uses GOMAXPROCS
+	Workers int
+
+	// HTTP2 enables HTTP/2, negotiated with ALPN on TLS listeners and by
+	// prior knowledge or Upgrade: h2c on plaintext ones
+	HTTP2 bool
+
+	// HTTP3 serves experimental HTTP/3 over QUIC on the UDP port matching
+	// each TLS listener's TCP port, advertised to clients with Alt-Svc
+	HTTP3 bool
+
+	// TLSCertificates are the certificates served on TLS listeners; the
+	// one matching the client's SNI name is chosen. Files are reloaded
+	// when they change on disk.
+	TLSCertificates CertPairs
+
+	// TLSMinVersion is the oldest TLS version accepted, e.g. "1.2"
+	TLSMinVersion string
+
+	// TLSCipherSuites restricts the cipher suites for TLS 1.2 and older;
+	// empty uses the Go defaults. TLS 1.3 suites are not configurable.
+	TLSCipherSuites CipherSuites
+
+	// DevTLS serves a self-signed certificate for localhost generated at
+	// startup, for local testing
+	DevTLS bool
+
+	// TLSClientAuth is ClientAuthNone, ClientAuthOptional or
+	// ClientAuthRequired, saying whether TLS clients are asked for a
+	// certificate and whether they must present one
+	TLSClientAuth string
+
+	// TLSClientCA is a PEM bundle of the CAs client certificates are
+	// verified against
+	TLSClientCA string
+
+	// ClientCertPolicies require verified client certificates with given
+	// attributes for matching requests
+	ClientCertPolicies ClientCertPolicies
+
+	// AdminToken enables the admin endpoints, such as POST /admin/reload,
+	// for requests with "Authorization: Bearer <token>". Empty disables them.
+	AdminToken string
+
+	// ConfigFile is the JSON or TOML file the configuration was read from
+	ConfigFile string
+
+	// PrintConfig asks for the effective configuration to be printed
+	// instead of starting the server
+	PrintConfig bool
+
+	// flags is the flag set bound to this config, used to print it
+	flags *flag.FlagSet
+}
+
+// defaults returns a config holding the built-in defaults
+func defaults() *Config {
+	return &Config{
+		Address:            DefaultAddress,
+		ServerName:         DefaultServerName,
+		ShutdownTimeout:    DefaultShutdownTimeout,
+		ReadHeaderTimeout:  DefaultReadHeaderTimeout,
+		ReadTimeout:        DefaultReadTimeout,
+		WriteTimeout:       DefaultWriteTimeout,
+		IdleTimeout:        DefaultIdleTimeout,
+		HandlerTimeouts:    make(RouteTimeouts),
+		MaxRequestBodySize: DefaultMaxRequestBodySize,
+		Sockets:            SocketOptions{TCPKeepAlive: DefaultTCPKeepAlive, TCPNoDelay: true},
+		Engine:             EngineGoroutine,
+		HTTP2:              true,
+		TLSMinVersion:      DefaultTLSMinVersion,
+		TLSClientAuth:      ClientAuthNone,
+	}
+}
+
+// newFlagSet registers every tunable as a flag bound to cfg. The flag set
+// is the single list of settings: config file keys and environment
+// variables are resolved against it too.
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	fs.StringVar(&cfg.ConfigFile, "config", cfg.ConfigFile, "JSON or TOML configuration file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", cfg.PrintConfig, "Print the effective configuration and exit")
+
+	fs.StringVar(&cfg.FilesDirectory, "directory", cfg.FilesDirectory, "Directory to serve files from")
+	fs.StringVar(&cfg.Address, "address", cfg.Address, "Address to listen on when no -listen is given")
+	fs.Var(&cfg.Listeners, "listen", "Listener spec such as tcp://host:port, unix:///path?mode=0660 or systemd://name (repeatable)")
+	fs.StringVar(&cfg.ServerName, "server-name", cfg.ServerName, "Server response header value (empty to omit)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "Time allowed for in-flight requests on shutdown")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", cfg.ReadHeaderTimeout, "Time allowed to read request headers (0 uses -read-timeout)")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "Time allowed to read a whole request (0 for no limit)")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "Time allowed to write a response (0 for no limit)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "Time a keep-alive connection may wait for a request (0 uses -read-timeout)")
+	fs.DurationVar(&cfg.HandlerTimeout, "handler-timeout", cfg.HandlerTimeout, "Time a handler may run before a 503 is sent (0 for no limit)")
+	fs.Var(cfg.HandlerTimeouts, "route-timeout", "Handler timeout for a path prefix as prefix=duration (repeatable)")
+	fs.Int64Var(&cfg.MaxRequestBodySize, "max-request-body", cfg.MaxRequestBodySize, "Largest request body accepted in bytes")
+	fs.IntVar(&cfg.MaxConns, "max-conns", cfg.MaxConns, "Connections open at once across all listeners (0 for no limit)")
+	fs.IntVar(&cfg.MaxConnsPerIP, "max-conns-per-ip", cfg.MaxConnsPerIP, "Connections open at once from one client IP (0 for no limit)")
+	fs.BoolVar(&cfg.ProxyProtocol, "proxy-protocol", cfg.ProxyProtocol, "Expect PROXY protocol headers on the default listener (use proxy=true with -listen)")
+	fs.Var(&cfg.ProxyProtocolTrusted, "proxy-protocol-trusted", "CIDR or address of a load balancer that sends PROXY headers (repeatable)")
+	fs.Var(&cfg.TrustedProxies, "trusted-proxy", "CIDR or address of a reverse proxy whose forwarding headers are believed, or unix for Unix socket peers (repeatable)")
+	fs.IntVar(&cfg.Sockets.ReusePort, "reuseport", cfg.Sockets.ReusePort, "SO_REUSEPORT sockets per TCP listener, accepted in parallel (Linux; 0 or 1 for one socket)")
+	fs.DurationVar(&cfg.Sockets.TCPKeepAlive, "tcp-keepalive", cfg.Sockets.TCPKeepAlive, "Interval of TCP keepalive probes on accepted connections (0 disables)")
+	fs.BoolVar(&cfg.Sockets.TCPNoDelay, "tcp-nodelay", cfg.Sockets.TCPNoDelay, "Disable Nagle's algorithm on accepted connections")
+	fs.IntVar(&cfg.Sockets.TCPFastOpen, "tcp-fastopen", cfg.Sockets.TCPFastOpen, "TCP Fast Open queue length (Linux; 0 disables)")
+	fs.DurationVar(&cfg.Sockets.TCPDeferAccept, "tcp-defer-accept", cfg.Sockets.TCPDeferAccept, "Wait up to this long for data before accepting a connection (Linux; 0 disables)")
+	fs.IntVar(&cfg.Sockets.ReadBuffer, "socket-read-buffer", cfg.Sockets.ReadBuffer, "Kernel receive buffer of TCP sockets in bytes (0 for the system default)")
+	fs.IntVar(&cfg.Sockets.WriteBuffer, "socket-write-buffer", cfg.Sockets.WriteBuffer, "Kernel send buffer of TCP sockets in bytes (0 for the system default)")
+	fs.StringVar(&cfg.Engine, "engine", cfg.Engine, "Connection engine: goroutine, or epoll to park idle connections without a goroutine (Linux)")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "Worker goroutines for the epoll engine (0 uses GOMAXPROCS)")
+	fs.BoolVar(&cfg.HTTP2, "http2", cfg.HTTP2, "Serve HTTP/2 via ALPN, prior knowledge and h2c upgrades")
+	fs.BoolVar(&cfg.HTTP3, "http3", cfg.HTTP3, "Serve experimental HTTP/3 over QUIC on the UDP port of TLS listeners")
+	fs.Var(&cfg.TLSCertificates, "tls-cert", "TLS certificate and key files as cert.pem:key.pem (repeatable)")
+	fs.StringVar(&cfg.TLSMinVersion, "tls-min-version", cfg.TLSMinVersion, "Oldest TLS version accepted (1.0, 1.1, 1.2 or 1.3)")
+	fs.Var(&cfg.TLSCipherSuites, "tls-cipher", "Cipher suite allowed for TLS 1.2 and older (repeatable, default Go's list)")
+	fs.BoolVar(&cfg.DevTLS, "dev-tls", cfg.DevTLS, "Serve a generated self-signed certificate for localhost")
+	fs.StringVar(&cfg.TLSClientAuth, "tls-client-auth", cfg.TLSClientAuth, "Client certificates: none, optional or required")
+	fs.StringVar(&cfg.TLSClientCA, "tls-client-ca", cfg.TLSClientCA, "PEM bundle of CAs to verify client certificates against")
+	fs.Var(&cfg.ClientCertPolicies, "client-cert-policy", "Client certificate needed for a route, as \"[METHOD] /prefix [ATTR=value+...]\" (repeatable)")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "Bearer token for admin endpoints (empty disables them)")
+
+	return fs
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// built-in defaults, a config file, environment variables and command line
+// flags, and validates the result
+func Load() (*Config, error) {
+	return LoadArgs(os.Args[1:])
+}
+
+// LoadArgs is Load with explicit command line arguments
+func LoadArgs(args []string) (*Config, error) {
+	// A first pass over the flags finds the config file, which has to be
+	// applied before the flags themselves
+	probe := defaults()
+	probeFlags := newFlagSet(probe)
+	probeFlags.SetOutput(io.Discard)
+	if err := probeFlags.Parse(args); err != nil {
+		// Parse again with output enabled so the user sees the usage
+		return nil, newFlagSet(defaults()).Parse(args)
+	}
+
+	cfg := defaults()
+	fs := newFlagSet(cfg)
+	cfg.flags = fs
+
+	configFile := probe.ConfigFile
+	if configFile == "" {
+		configFile = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if configFile != "" {
+		if err := applyFile(fs, configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(fs); err != nil {
+		return nil, err
+	}
+
+	// Repeatable flags on the command line replace the earlier layers'
+	// values, which the probe tells apart
+	probeFlags.Visit(func(f *flag.Flag) {
+		resetList(fs.Lookup(f.Name))
+	})
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
 }
 
-// Load reads configuration from various sources and returns a config struct
-func Load() *Config {
-	cfg := &Config{
-		Address: "0.0.0.0:4221",
+// applyEnv sets flags from PORT and DRIZZLE_* environment variables
+func applyEnv(fs *flag.FlagSet) error {
+	// PORT keeps the configured host and replaces the port
+	if port := os.Getenv(EnvPort); port != "" {
+		host, _, err := net.SplitHostPort(fs.Lookup("address").Value.String())
+		if err != nil {
+			return fmt.Errorf("cannot apply %s: %w", EnvPort, err)
+		}
+		if err := fs.Set("address", net.JoinHostPort(host, port)); err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvPort, err)
+		}
 	}
 
-	// Parse command line flags
-	flag.StringVar(&cfg.FilesDirectory, "directory", "", "Directory to serve files from")
-	flag.Parse()
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+
+		// Repeatable flags take comma-separated values
+		values := []string{value}
+		if _, repeatable := f.Value.(listValue); repeatable {
+			values = strings.Split(value, ",")
+		}
+		resetList(f)
+
+		for _, v := range values {
+			if setErr := f.Value.Set(strings.TrimSpace(v)); setErr != nil {
+				err = fmt.Errorf("invalid %s: %w", name, setErr)
+				return
+			}
+		}
+	})
+
+	return err
+}
 
-	return cfg
+// envName returns the environment variable for a flag name
+func envName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// listValue is implemented by flags that may be given more than once. Set
+// appends, so each layer calls resetList before its first value to replace
+// what earlier layers set instead of adding to it.
+type listValue interface {
+	flag.Value
+	Values() []string
+	Reset()
+}
+
+// resetList clears a repeatable flag's values and does nothing for others
+func resetList(f *flag.Flag) {
+	if list, ok := f.Value.(listValue); ok {
+		list.Reset()
+	}
+}
+
+// Validate checks the configuration for values the server cannot use
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.FilesDirectory != "" {
+		info, err := os.Stat(c.FilesDirectory)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("directory: %w", err))
+		} else if !info.IsDir() {
+			errs = append(errs, fmt.Errorf("directory: %s is not a directory", c.FilesDirectory))
+		}
+	}
+
+	if _, port, err := net.SplitHostPort(c.Address); err != nil {
+		errs = append(errs, fmt.Errorf("address: %w", err))
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		errs = append(errs, fmt.Errorf("address: invalid port %q", port))
+	}
+
+	if strings.ContainsAny(c.ServerName, "\r\n") {
+		errs = append(errs, errors.New("server-name: must not contain line breaks"))
+	}
+
+	durations := map[string]time.Duration{
+		"shutdown-timeout":    c.ShutdownTimeout,
+		"read-header-timeout": c.ReadHeaderTimeout,
+		"read-timeout":        c.ReadTimeout,
+		"write-timeout":       c.WriteTimeout,
+		"idle-timeout":        c.IdleTimeout,
+		"handler-timeout":     c.HandlerTimeout,
+	}
+	for prefix, timeout := range c.HandlerTimeouts {
+		durations["route-timeout "+prefix] = timeout
+	}
+	for _, name := range sortedKeys(durations) {
+		if durations[name] < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative", name))
+		}
+	}
+
+	if c.MaxRequestBodySize <= 0 {
+		errs = append(errs, errors.New("max-request-body: must be positive"))
+	}
+	if c.MaxConns < 0 {
+		errs = append(errs, errors.New("max-conns: must not be negative"))
+	}
+	if c.MaxConnsPerIP < 0 {
+		errs = append(errs, errors.New("max-conns-per-ip: must not be negative"))
+	}
+
+	errs = append(errs, c.validateProxyProtocol()...)
+	errs = append(errs, c.validateSockets()...)
+	errs = append(errs, c.validateEngine()...)
+	errs = append(errs, c.validateTLS()...)
+	errs = append(errs, c.validateClientAuth()...)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Print writes the effective configuration in TOML, so it can be saved
+// and used as a config file
+func (c *Config) Print(w io.Writer) error {
+	fs := c.flags
+	if fs == nil {
+		fs = newFlagSet(c)
+	}
+
+	var b strings.Builder
+	fs.VisitAll(func(f *flag.Flag) {
+		// These only control how the config is loaded
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+
+		fmt.Fprintf(&b, "%s = %s\n", f.Name, tomlValue(f.Value))
+	})
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// tomlValue formats a flag value as a TOML value
+func tomlValue(value flag.Value) string {
+	if list, ok := value.(listValue); ok {
+		quoted := make([]string, 0, len(list.Values()))
+		for _, v := range list.Values() {
+			quoted = append(quoted, strconv.Quote(v))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+
+	if getter, ok := value.(flag.Getter); ok {
+		if b, isBool := getter.Get().(bool); isBool {
+			return strconv.FormatBool(b)
+		}
+	}
+
+	return strconv.Quote(value.String())
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadArgsLayers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(file, []byte(`
+read_timeout = "10s"
+trusted-proxy = ["10.0.0.0/8", "unix"]
+listen = ["tcp://127.0.0.1:8080"]
+
+[route-timeout]
+"/files/" = "1m"
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		env            map[string]string
+		args           []string
+		readTimeout    time.Duration
+		trustedProxies []string
+		listeners      []string
+		routeTimeouts  []string
+	}{
+		{
+			name:           "file",
+			readTimeout:    10 * time.Second,
+			trustedProxies: []string{"10.0.0.0/8", "unix"},
+			listeners:      []string{"tcp://127.0.0.1:8080"},
+			routeTimeouts:  []string{"/files/=1m0s"},
+		},
+		{
+			name:           "environment replaces the file",
+			env:            map[string]string{"DRIZZLE_TRUSTED_PROXY": "192.0.2.1, 192.0.2.2", "DRIZZLE_READ_TIMEOUT": "20s"},
+			readTimeout:    20 * time.Second,
+			trustedProxies: []string{"192.0.2.1/32", "192.0.2.2/32"},
+			listeners:      []string{"tcp://127.0.0.1:8080"},
+			routeTimeouts:  []string{"/files/=1m0s"},
+		},
+		{
+			name:           "flags replace the environment",
+			env:            map[string]string{"DRIZZLE_TRUSTED_PROXY": "192.0.2.1", "DRIZZLE_ROUTE_TIMEOUT": "/sse/=1h"},
+			args:           []string{"-trusted-proxy", "198.51.100.0/24", "-trusted-proxy", "198.51.100.7", "-read-timeout", "30s"},
+			readTimeout:    30 * time.Second,
+			trustedProxies: []string{"198.51.100.0/24", "198.51.100.7/32"},
+			listeners:      []string{"tcp://127.0.0.1:8080"},
+			routeTimeouts:  []string{"/sse/=1h0m0s"},
+		},
+		{
+			// The same listener again is not a duplicate of the file's
+			name:           "flags replace the file",
+			args:           []string{"-listen", "tcp://127.0.0.1:8080", "-route-timeout", "/echo/=1s"},
+			readTimeout:    10 * time.Second,
+			trustedProxies: []string{"10.0.0.0/8", "unix"},
+			listeners:      []string{"tcp://127.0.0.1:8080"},
+			routeTimeouts:  []string{"/echo/=1s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DRIZZLE_CONFIG", file)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			cfg, err := LoadArgs(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.ReadTimeout != tt.readTimeout {
+				t.Errorf("read-timeout = %v, want %v", cfg.ReadTimeout, tt.readTimeout)
+			}
+			if got := cfg.TrustedProxies.Values(); !reflect.DeepEqual(got, tt.trustedProxies) {
+				t.Errorf("trusted-proxy = %q, want %q", got, tt.trustedProxies)
+			}
+			if got := cfg.Listeners.Values(); !reflect.DeepEqual(got, tt.listeners) {
+				t.Errorf("listen = %q, want %q", got, tt.listeners)
+			}
+			if got := cfg.HandlerTimeouts.Values(); !reflect.DeepEqual(got, tt.routeTimeouts) {
+				t.Errorf("route-timeout = %q, want %q", got, tt.routeTimeouts)
+			}
+		})
+	}
+}
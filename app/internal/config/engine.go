@@ -0,0 +1,38 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// Connection engines
+const (
+	// EngineGoroutine serves each connection on a goroutine of its own
+	EngineGoroutine = "goroutine"
+
+	// EngineEpoll parks idle plaintext HTTP/1 connections in an epoll set,
+	// without a goroutine or read buffer, and serves readable ones on a
+	// worker pool. It is only available on Linux.
+	EngineEpoll = "epoll"
+)
+
+// validateEngine checks the connection engine settings
+func (c *Config) validateEngine() []error {
+	var errs []error
+
+	switch c.Engine {
+	case EngineGoroutine:
+	case EngineEpoll:
+		if runtime.GOOS != "linux" {
+			errs = append(errs, fmt.Errorf("engine: %s is only available on Linux", EngineEpoll))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("engine: unknown engine %q, want %s or %s", c.Engine, EngineGoroutine, EngineEpoll))
+	}
+
+	if c.Workers < 0 {
+		errs = append(errs, errors.New("workers: must not be negative"))
+	}
+	return errs
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// applyFile reads a JSON or TOML config file and sets the matching flags.
+// Keys are flag names, with underscores accepted in place of dashes.
+// Repeatable flags take an array of values or a table of prefix = value.
+func applyFile(fs *flag.FlagSet, path string) error {
+	settings, err := readFile(path)
+	if err != nil {
+		return err
+	}
+
+	reset := make(map[string]bool)
+	for _, key := range sortedKeys(settings) {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+
+		// trusted_proxy and trusted-proxy are the same list
+		if !reset[name] {
+			resetList(f)
+			reset[name] = true
+		}
+		for _, value := range fileValues(settings[key]) {
+			if err := f.Value.Set(value); err != nil {
+				return fmt.Errorf("%s: invalid %s: %w", path, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readFile parses a config file according to its extension
+func readFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	settings := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if settings, err = parseTOML(string(data)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: config file must end in .json or .toml", path)
+	}
+
+	return settings, nil
+}
+
+// fileValues flattens a parsed value into the strings passed to flag.Set
+func fileValues(value any) []string {
+	switch v := value.(type) {
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fileValues(item)...)
+		}
+		return values
+	case map[string]any:
+		values := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			for _, item := range fileValues(v[key]) {
+				values = append(values, key+"="+item)
+			}
+		}
+		return values
+	case string:
+		return []string{v}
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case nil:
+		return []string{""}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listener networks
+const (
+	NetworkTCP     = "tcp"
+	NetworkUnix    = "unix"
+	NetworkSystemd = "systemd"
+)
+
+// Listener describes one listening socket and the settings that apply to
+// connections accepted on it
+type Listener struct {
+	// Name identifies the listener in logs and across restarts
+	Name string
+
+	// Network is NetworkTCP, NetworkUnix or NetworkSystemd
+	Network string
+
+	// Address is host:port for TCP, the socket path for Unix sockets and
+	// the socket name (from LISTEN_FDNAMES) or index for systemd
+	Address string
+
+	// Mode sets the permissions of a Unix socket file; zero leaves the
+	// umask default
+	Mode os.FileMode
+
+	// TLS serves HTTPS on the listener
+	TLS bool
+
+	// ProxyProtocol expects a PROXY protocol header from load balancers
+	// at the start of each connection from a trusted address
+	ProxyProtocol bool
+
+	// Routes restricts the listener to paths starting with one of these
+	// prefixes; empty allows every path
+	Routes []string
+}
+
+// ParseListener parses a listener spec such as
+//
+//	tcp://0.0.0.0:4221
+//	0.0.0.0:8443?tls=true
+//	127.0.0.1:9000?routes=/admin/
+//	unix:///run/drizzle.sock?mode=0660
+//	0.0.0.0:80?proxy=true
+//	systemd://http
+//
+// Query parameters set name, mode, tls, proxy and routes (comma-separated
+// prefixes).
+func ParseListener(spec string) (Listener, error) {
+	if !strings.Contains(spec, "://") {
+		spec = NetworkTCP + "://" + spec
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return Listener{}, fmt.Errorf("invalid listener %q: %w", spec, err)
+	}
+
+	l := Listener{Network: u.Scheme}
+	switch u.Scheme {
+	case NetworkTCP:
+		l.Address = u.Host
+		if _, _, err := net.SplitHostPort(l.Address); err != nil {
+			return Listener{}, fmt.Errorf("invalid listener %q: %w", spec, err)
+		}
+	case NetworkUnix:
+		l.Address = u.Path
+		if l.Address == "" {
+			return Listener{}, fmt.Errorf("invalid listener %q: missing socket path", spec)
+		}
+	case NetworkSystemd:
+		l.Address = u.Host
+		if l.Address == "" {
+			return Listener{}, fmt.Errorf("invalid listener %q: missing socket name", spec)
+		}
+	default:
+		return Listener{}, fmt.Errorf("invalid listener %q: unknown network %q", spec, u.Scheme)
+	}
+
+	query := u.Query()
+	for key := range query {
+		switch key {
+		case "name", "mode", "tls", "proxy", "routes":
+		default:
+			return Listener{}, fmt.Errorf("invalid listener %q: unknown option %q", spec, key)
+		}
+	}
+
+	l.Name = query.Get("name")
+	if l.Name == "" {
+		l.Name = l.Network + "://" + l.Address
+	}
+
+	if mode := query.Get("mode"); mode != "" {
+		if l.Network != NetworkUnix {
+			return Listener{}, fmt.Errorf("invalid listener %q: mode only applies to unix sockets", spec)
+		}
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm > 0o777 {
+			return Listener{}, fmt.Errorf("invalid listener %q: bad mode %q", spec, mode)
+		}
+		l.Mode = os.FileMode(perm)
+	}
+
+	if value := query.Get("tls"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return Listener{}, fmt.Errorf("invalid listener %q: bad tls %q", spec, value)
+		}
+		l.TLS = enabled
+	}
+
+	if value := query.Get("proxy"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return Listener{}, fmt.Errorf("invalid listener %q: bad proxy %q", spec, value)
+		}
+		l.ProxyProtocol = enabled
+	}
+
+	if routes := query.Get("routes"); routes != "" {
+		for _, route := range strings.Split(routes, ",") {
+			if !strings.HasPrefix(route, "/") {
+				return Listener{}, fmt.Errorf("invalid listener %q: route %q must start with /", spec, route)
+			}
+			l.Routes = append(l.Routes, route)
+		}
+	}
+
+	return l, nil
+}
+
+// String returns the listener as a spec accepted by ParseListener
+func (l Listener) String() string {
+	spec := l.Network + "://" + l.Address
+	if l.Network == NetworkUnix {
+		spec = l.Network + "://" + (&url.URL{Path: l.Address}).EscapedPath()
+	}
+
+	query := url.Values{}
+	if l.Name != l.Network+"://"+l.Address {
+		query.Set("name", l.Name)
+	}
+	if l.Mode != 0 {
+		query.Set("mode", fmt.Sprintf("%04o", uint32(l.Mode)))
+	}
+	if l.TLS {
+		query.Set("tls", "true")
+	}
+	if l.ProxyProtocol {
+		query.Set("proxy", "true")
+	}
+	if len(l.Routes) > 0 {
+		query.Set("routes", strings.Join(l.Routes, ","))
+	}
+
+	if len(query) > 0 {
+		// Keep slashes and commas readable in routes
+		spec += "?" + strings.NewReplacer("%2F", "/", "%2C", ",").Replace(query.Encode())
+	}
+	return spec
+}
+
+// Allows reports whether the listener serves the given path
+func (l Listener) Allows(path string) bool {
+	if len(l.Routes) == 0 {
+		return true
+	}
+	for _, route := range l.Routes {
+		if strings.HasPrefix(path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// Listeners is a list of listeners. It implements flag.Value, accepting
+// one spec per flag occurrence.
+type Listeners []Listener
+
+// String returns the specs comma-separated
+func (ls *Listeners) String() string {
+	return strings.Join(ls.Values(), ",")
+}
+
+// Set parses and appends a listener spec
+func (ls *Listeners) Set(spec string) error {
+	l, err := ParseListener(spec)
+	if err != nil {
+		return err
+	}
+
+	for _, existing := range *ls {
+		if existing.Name == l.Name {
+			return fmt.Errorf("duplicate listener name %q", l.Name)
+		}
+	}
+
+	*ls = append(*ls, l)
+	return nil
+}
+
+// Values returns the listener specs
+func (ls *Listeners) Values() []string {
+	values := make([]string, 0, len(*ls))
+	for _, l := range *ls {
+		values = append(values, l.String())
+	}
+	return values
+}
+
+// Reset removes every listener
+func (ls *Listeners) Reset() {
+	*ls = nil
+}
+
+// EffectiveListeners returns the configured listeners, or a single TCP
+// listener on Address if none are configured. That listener serves TLS if
+// certificates are configured, and expects PROXY headers if ProxyProtocol
+// is set.
+func (c *Config) EffectiveListeners() []Listener {
+	if len(c.Listeners) > 0 {
+		return c.Listeners
+	}
+
+	return []Listener{{
+		Name:          NetworkTCP + "://" + c.Address,
+		Network:       NetworkTCP,
+		Address:       c.Address,
+		TLS:           c.TLSEnabled(),
+		ProxyProtocol: c.ProxyProtocol,
+	}}
+}
+
+// validateProxyProtocol checks the PROXY protocol settings
+func (c *Config) validateProxyProtocol() []error {
+	var errs []error
+
+	if c.ProxyProtocol && len(c.Listeners) > 0 {
+		errs = append(errs, errors.New("proxy-protocol: only applies to the default listener, set proxy=true on -listen specs instead"))
+	}
+
+	for _, l := range c.EffectiveListeners() {
+		if l.ProxyProtocol && l.Network != NetworkUnix && len(c.ProxyProtocolTrusted) == 0 {
+			errs = append(errs, fmt.Errorf("proxy-protocol-trusted: listener %s expects PROXY headers but no load balancer is trusted", l.Name))
+		}
+	}
+	return errs
+}
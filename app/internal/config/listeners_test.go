@@ -0,0 +1,135 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseListener(t *testing.T) {
+	tests := []struct {
+		spec string
+		want Listener
+		str  string // String of the result, "" if the same as spec
+	}{
+		{
+			spec: "tcp://0.0.0.0:4221",
+			want: Listener{Name: "tcp://0.0.0.0:4221", Network: NetworkTCP, Address: "0.0.0.0:4221"},
+		},
+		// TCP is the default network
+		{
+			spec: "127.0.0.1:8443?tls=true",
+			want: Listener{Name: "tcp://127.0.0.1:8443", Network: NetworkTCP, Address: "127.0.0.1:8443", TLS: true},
+			str:  "tcp://127.0.0.1:8443?tls=true",
+		},
+		{
+			spec: "tcp://[::1]:80?proxy=1&name=lb",
+			want: Listener{Name: "lb", Network: NetworkTCP, Address: "[::1]:80", ProxyProtocol: true},
+			str:  "tcp://[::1]:80?name=lb&proxy=true",
+		},
+		{
+			spec: "tcp://127.0.0.1:9000?routes=/admin/,/metrics",
+			want: Listener{Name: "tcp://127.0.0.1:9000", Network: NetworkTCP, Address: "127.0.0.1:9000", Routes: []string{"/admin/", "/metrics"}},
+		},
+		{
+			spec: "unix:///run/drizzle.sock?mode=0660",
+			want: Listener{Name: "unix:///run/drizzle.sock", Network: NetworkUnix, Address: "/run/drizzle.sock", Mode: 0o660},
+		},
+		{
+			spec: "unix:///run/my%20app.sock",
+			want: Listener{Name: "unix:///run/my app.sock", Network: NetworkUnix, Address: "/run/my app.sock"},
+		},
+		{
+			spec: "systemd://http",
+			want: Listener{Name: "systemd://http", Network: NetworkSystemd, Address: "http"},
+		},
+		{
+			spec: "systemd://0?tls=true&routes=/files/",
+			want: Listener{Name: "systemd://0", Network: NetworkSystemd, Address: "0", TLS: true, Routes: []string{"/files/"}},
+			str:  "systemd://0?routes=/files/&tls=true",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseListener(tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseListener = %+v, want %+v", got, tt.want)
+			}
+
+			str := tt.str
+			if str == "" {
+				str = tt.spec
+			}
+			if got.String() != str {
+				t.Errorf("String = %q, want %q", got.String(), str)
+			}
+			// String gives a spec that parses back to the same listener
+			again, err := ParseListener(got.String())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("ParseListener(%q) = %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseListenerErrors(t *testing.T) {
+	for _, spec := range []string{
+		"0.0.0.0",
+		"udp://0.0.0.0:53",
+		"unix://",
+		"systemd://",
+		"tcp://0.0.0.0:80?color=blue",
+		"tcp://0.0.0.0:80?mode=0600",
+		"unix:///run/a.sock?mode=999",
+		"unix:///run/a.sock?mode=01777",
+		"tcp://0.0.0.0:80?tls=maybe",
+		"tcp://0.0.0.0:80?proxy=maybe",
+		"tcp://0.0.0.0:80?routes=admin",
+		"tcp://0.0.0.0:80?routes=/a,",
+	} {
+		if l, err := ParseListener(spec); err == nil {
+			t.Errorf("ParseListener(%q) = %+v, want an error", spec, l)
+		}
+	}
+}
+
+func TestListenerAllows(t *testing.T) {
+	tests := []struct {
+		routes []string
+		path   string
+		want   bool
+	}{
+		{nil, "/anything", true},
+		{[]string{"/admin/"}, "/admin/reload", true},
+		{[]string{"/admin/"}, "/admin", false},
+		{[]string{"/admin/"}, "/echo/admin/", false},
+		{[]string{"/admin/", "/echo/"}, "/echo/x", true},
+		{[]string{"/admin/", "/echo/"}, "/", false},
+	}
+	for _, tt := range tests {
+		l := Listener{Routes: tt.routes}
+		if got := l.Allows(tt.path); got != tt.want {
+			t.Errorf("routes %q: Allows(%q) = %v, want %v", tt.routes, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestListenersSet(t *testing.T) {
+	var ls Listeners
+	for _, spec := range []string{"127.0.0.1:80", "127.0.0.1:81?name=admin"} {
+		if err := ls.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Names must be unique, whether given or derived from the address
+	for _, spec := range []string{"tcp://127.0.0.1:80", "127.0.0.1:82?name=admin"} {
+		if err := ls.Set(spec); err == nil {
+			t.Errorf("Set(%q) accepted a duplicate name", spec)
+		}
+	}
+	if got, want := ls.Values(), []string{"tcp://127.0.0.1:80", "tcp://127.0.0.1:81?name=admin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Values = %q, want %q", got, want)
+	}
+}
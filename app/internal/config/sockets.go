@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"runtime"
+	"time"
+)
+
+// DefaultTCPKeepAlive is the keepalive probe interval used unless
+// configured otherwise, matching the Go default
+const DefaultTCPKeepAlive = 15 * time.Second
+
+// SocketOptions tune the TCP sockets of every TCP listener and the
+// connections accepted on them. Unix and systemd sockets are left alone.
+type SocketOptions struct {
+	// ReusePort opens this many sockets with SO_REUSEPORT for each TCP
+	// listener, each with its own accept loop, so the kernel spreads new
+	// connections over them. 0 or 1 opens a single ordinary socket.
+	ReusePort int
+
+	// TCPKeepAlive is the interval of keepalive probes on accepted
+	// connections; zero disables them
+	TCPKeepAlive time.Duration
+
+	// TCPNoDelay disables Nagle's algorithm on accepted connections, so
+	// small writes are sent at once
+	TCPNoDelay bool
+
+	// TCPFastOpen is the queue length for TCP Fast Open, which lets a
+	// returning client send its request with the SYN; zero disables it
+	TCPFastOpen int
+
+	// TCPDeferAccept holds a new connection in the kernel until its first
+	// data arrives, for up to this long; zero disables it
+	TCPDeferAccept time.Duration
+
+	// ReadBuffer and WriteBuffer set the kernel buffer sizes of TCP
+	// sockets in bytes; zero keeps the system default
+	ReadBuffer  int
+	WriteBuffer int
+}
+
+// Listening reports whether any option applies to the listening sockets
+// themselves rather than to accepted connections
+func (o SocketOptions) Listening() bool {
+	return o.ReusePort > 1 || o.TCPFastOpen > 0 || o.TCPDeferAccept > 0 || o.ReadBuffer > 0 || o.WriteBuffer > 0
+}
+
+// validateSockets checks the socket options
+func (c *Config) validateSockets() []error {
+	var errs []error
+	o := c.Sockets
+
+	if o.ReusePort < 0 {
+		errs = append(errs, errors.New("reuseport: must not be negative"))
+	}
+	if o.TCPKeepAlive < 0 {
+		errs = append(errs, errors.New("tcp-keepalive: must not be negative"))
+	}
+	if o.TCPFastOpen < 0 {
+		errs = append(errs, errors.New("tcp-fastopen: must not be negative"))
+	}
+	if o.TCPDeferAccept < 0 {
+		errs = append(errs, errors.New("tcp-defer-accept: must not be negative"))
+	}
+	if o.ReadBuffer < 0 {
+		errs = append(errs, errors.New("socket-read-buffer: must not be negative"))
+	}
+	if o.WriteBuffer < 0 {
+		errs = append(errs, errors.New("socket-write-buffer: must not be negative"))
+	}
+
+	if runtime.GOOS != "linux" {
+		if o.ReusePort > 1 {
+			errs = append(errs, errors.New("reuseport: only available on Linux"))
+		}
+		if o.TCPFastOpen > 0 {
+			errs = append(errs, errors.New("tcp-fastopen: only available on Linux"))
+		}
+		if o.TCPDeferAccept > 0 {
+			errs = append(errs, errors.New("tcp-defer-accept: only available on Linux"))
+		}
+	}
+	switch runtime.GOOS {
+	case "js", "wasip1", "plan9":
+		if o.ReadBuffer > 0 || o.WriteBuffer > 0 {
+			errs = append(errs, errors.New("socket-read-buffer, socket-write-buffer: not available on "+runtime.GOOS))
+		}
+	}
+	return errs
+}
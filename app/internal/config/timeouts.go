@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RouteTimeouts maps a path prefix to a handler timeout. It implements
+// flag.Value, accepting "prefix=duration" once per flag occurrence.
+type RouteTimeouts map[string]time.Duration
+
+// String returns the timeouts as comma-separated prefix=duration pairs
+func (rt RouteTimeouts) String() string {
+	return strings.Join(rt.Values(), ",")
+}
+
+// Set parses a single prefix=duration pair
+func (rt RouteTimeouts) Set(value string) error {
+	prefix, durationStr, found := strings.Cut(value, "=")
+	if !found || !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("expected /prefix=duration, got %q", value)
+	}
+
+	duration, err := time.ParseDuration(durationStr)
+	if err != nil {
+		return fmt.Errorf("invalid duration for %s: %w", prefix, err)
+	}
+
+	rt[prefix] = duration
+	return nil
+}
+
+// HandlerTimeoutFor returns the handler timeout that applies to path
+func (c *Config) HandlerTimeoutFor(path string) time.Duration {
+	timeout := c.HandlerTimeout
+	longest := -1
+
+	for prefix, routeTimeout := range c.HandlerTimeouts {
+		if strings.HasPrefix(path, prefix) && len(prefix) > longest {
+			timeout = routeTimeout
+			longest = len(prefix)
+		}
+	}
+
+	return timeout
+}
+
+// Values returns the timeouts as prefix=duration pairs, sorted by prefix
+func (rt RouteTimeouts) Values() []string {
+	values := make([]string, 0, len(rt))
+	for _, prefix := range sortedKeys(rt) {
+		values = append(values, fmt.Sprintf("%s=%s", prefix, rt[prefix]))
+	}
+	return values
+}
+
+// Reset removes every timeout
+func (rt RouteTimeouts) Reset() {
+	clear(rt)
+}
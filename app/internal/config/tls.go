@@ -0,0 +1,142 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultTLSMinVersion is the oldest TLS version accepted unless configured otherwise
+const DefaultTLSMinVersion = "1.2"
+
+// tlsVersions maps configurable version names to their protocol values
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// CertPair is a certificate chain file and its private key file, both PEM
+type CertPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// CertPairs is a list of certificates. It implements flag.Value, accepting
+// "cert.pem:key.pem" once per flag occurrence.
+type CertPairs []CertPair
+
+// String returns the pairs comma-separated
+func (cp *CertPairs) String() string {
+	return strings.Join(cp.Values(), ",")
+}
+
+// Set parses and appends a cert:key pair
+func (cp *CertPairs) Set(value string) error {
+	certFile, keyFile, found := strings.Cut(value, ":")
+	if !found || certFile == "" || keyFile == "" {
+		return fmt.Errorf("expected cert.pem:key.pem, got %q", value)
+	}
+
+	*cp = append(*cp, CertPair{CertFile: certFile, KeyFile: keyFile})
+	return nil
+}
+
+// Values returns the pairs as cert:key strings
+func (cp *CertPairs) Values() []string {
+	values := make([]string, 0, len(*cp))
+	for _, pair := range *cp {
+		values = append(values, pair.CertFile+":"+pair.KeyFile)
+	}
+	return values
+}
+
+// Reset removes every pair
+func (cp *CertPairs) Reset() {
+	*cp = nil
+}
+
+// CipherSuites is a list of TLS cipher suite names as used by crypto/tls,
+// e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. It implements flag.Value.
+type CipherSuites []string
+
+// String returns the names comma-separated
+func (cs *CipherSuites) String() string {
+	return strings.Join(*cs, ",")
+}
+
+// Set checks and appends a cipher suite name
+func (cs *CipherSuites) Set(name string) error {
+	if _, ok := cipherSuiteID(name); !ok {
+		return fmt.Errorf("unknown or insecure cipher suite %q", name)
+	}
+
+	*cs = append(*cs, name)
+	return nil
+}
+
+// Values returns the names
+func (cs *CipherSuites) Values() []string {
+	return *cs
+}
+
+// Reset removes every name
+func (cs *CipherSuites) Reset() {
+	*cs = nil
+}
+
+// IDs returns the cipher suite values for a tls.Config
+func (cs CipherSuites) IDs() []uint16 {
+	ids := make([]uint16, 0, len(cs))
+	for _, name := range cs {
+		if id, ok := cipherSuiteID(name); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// cipherSuiteID looks up a secure cipher suite by name
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, true
+		}
+	}
+	return 0, false
+}
+
+// TLSEnabled reports whether certificates are available for TLS listeners
+func (c *Config) TLSEnabled() bool {
+	return len(c.TLSCertificates) > 0 || c.DevTLS
+}
+
+// TLSVersion returns the configured minimum TLS version
+func (c *Config) TLSVersion() uint16 {
+	return tlsVersions[c.TLSMinVersion]
+}
+
+// validateTLS checks the TLS settings
+func (c *Config) validateTLS() []error {
+	var errs []error
+
+	if _, ok := tlsVersions[c.TLSMinVersion]; !ok {
+		errs = append(errs, fmt.Errorf("tls-min-version: unknown version %q, want one of 1.0, 1.1, 1.2, 1.3", c.TLSMinVersion))
+	}
+
+	if c.TLSEnabled() {
+		return errs
+	}
+	if c.HTTP3 {
+		errs = append(errs, errors.New("http3: HTTP/3 needs -tls-cert or -dev-tls"))
+	}
+	for _, l := range c.Listeners {
+		if l.TLS {
+			errs = append(errs, fmt.Errorf("listen %s: TLS needs -tls-cert or -dev-tls", l.Name))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,524 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses the subset of TOML used by config files: comments,
+// [tables], [[arrays of tables]], bare, quoted and dotted keys, basic and
+// literal strings, integers, floats, booleans, arrays and inline tables.
+// Multi-line strings and dates are not supported.
+func parseTOML(input string) (map[string]any, error) {
+	p := &tomlParser{input: input, line: 1}
+	root := make(map[string]any)
+	current := root
+
+	for {
+		p.skipBlankLines()
+		if p.eof() {
+			return root, nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			current, err = p.parseTableHeader(root)
+		} else {
+			err = p.parseKeyValue(current)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line, err)
+		}
+
+		// Only a comment may follow on the same line
+		p.skipSpace()
+		p.skipComment()
+		if !p.eof() && p.peek() != '\n' && p.peek() != '\r' {
+			return nil, fmt.Errorf("line %d: unexpected %q", p.line, p.peek())
+		}
+	}
+}
+
+// tomlParser holds the parsing position
+type tomlParser struct {
+	input string
+	pos   int
+	line  int
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.input[p.pos]
+}
+
+func (p *tomlParser) next() byte {
+	c := p.input[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+// skipSpace skips spaces and tabs
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipComment skips a comment up to the end of the line
+func (p *tomlParser) skipComment() {
+	if !p.eof() && p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// skipBlankLines skips whitespace, newlines and comments
+func (p *tomlParser) skipBlankLines() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\r', '\n':
+			p.next()
+		case '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// expect consumes the given byte or fails
+func (p *tomlParser) expect(c byte) error {
+	if p.eof() || p.peek() != c {
+		return fmt.Errorf("expected %q", c)
+	}
+	p.next()
+	return nil
+}
+
+// parseTableHeader handles [a.b] and [[a.b]] and returns the table that
+// following keys belong to
+func (p *tomlParser) parseTableHeader(root map[string]any) (map[string]any, error) {
+	p.next()
+	isArray := !p.eof() && p.peek() == '['
+	if isArray {
+		p.next()
+	}
+
+	p.skipSpace()
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+
+	if err := p.expect(']'); err != nil {
+		return nil, err
+	}
+	if isArray {
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+	}
+
+	parent, err := descend(root, keys[:len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+
+	if isArray {
+		table := make(map[string]any)
+		existing, exists := parent[last]
+		if !exists {
+			parent[last] = []any{table}
+			return table, nil
+		}
+		array, ok := existing.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an array of tables", strings.Join(keys, "."))
+		}
+		parent[last] = append(array, table)
+		return table, nil
+	}
+
+	return descend(parent, []string{last})
+}
+
+// descend walks to the table at keys, creating tables as needed. For an
+// array of tables it continues in the last element.
+func descend(table map[string]any, keys []string) (map[string]any, error) {
+	for _, key := range keys {
+		switch existing := table[key].(type) {
+		case nil:
+			child := make(map[string]any)
+			table[key] = child
+			table = child
+		case map[string]any:
+			table = existing
+		case []any:
+			last, ok := existing[len(existing)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// parseKeyValue handles key = value
+func (p *tomlParser) parseKeyValue(table map[string]any) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+
+	p.skipSpace()
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	p.skipSpace()
+
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent, err := descend(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("duplicate key %s", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseKey parses a bare, quoted or dotted key
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, fmt.Errorf("expected key")
+		}
+
+		var key string
+		switch p.peek() {
+		case '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected key, found %q", p.peek())
+			}
+			key = p.input[start:p.pos]
+		}
+		keys = append(keys, key)
+
+		p.skipSpace()
+		if p.eof() || p.peek() != '.' {
+			return keys, nil
+		}
+		p.next()
+	}
+}
+
+// isBareKeyChar reports whether c may appear in a bare key
+func isBareKeyChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue parses any supported value
+func (p *tomlParser) parseValue() (any, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected value")
+	}
+
+	switch c := p.peek(); {
+	case c == '"':
+		if strings.HasPrefix(p.input[p.pos:], `"""`) {
+			return nil, fmt.Errorf("multi-line strings are not supported")
+		}
+		return p.parseBasicString()
+	case c == '\'':
+		if strings.HasPrefix(p.input[p.pos:], `'''`) {
+			return nil, fmt.Errorf("multi-line strings are not supported")
+		}
+		return p.parseLiteralString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseInlineTable()
+	default:
+		return p.parseScalar()
+	}
+}
+
+// parseBasicString parses a double-quoted string with escapes
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.next()
+	var b strings.Builder
+
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+
+		c := p.next()
+		switch c {
+		case '"':
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				return "", fmt.Errorf("unterminated string")
+			}
+			escape := p.next()
+			switch escape {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(escape)
+			case 'u', 'U':
+				size := 4
+				if escape == 'U' {
+					size = 8
+				}
+				if p.pos+size > len(p.input) {
+					return "", fmt.Errorf("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(p.input[p.pos:p.pos+size], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(code)) {
+					return "", fmt.Errorf("invalid unicode escape")
+				}
+				p.pos += size
+				b.WriteRune(rune(code))
+			default:
+				return "", fmt.Errorf("invalid escape \\%c", escape)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+// parseLiteralString parses a single-quoted string without escapes
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.next()
+	start := p.pos
+
+	for !p.eof() && p.peek() != '\'' {
+		if p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		p.pos++
+	}
+	if p.eof() {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	s := p.input[start:p.pos]
+	p.next()
+	return s, nil
+}
+
+// parseArray parses [a, b, c], which may span lines
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.next()
+	array := []any{}
+
+	for {
+		p.skipBlankLines()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.next()
+			return array, nil
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+
+		p.skipBlankLines()
+		if !p.eof() && p.peek() == ',' {
+			p.next()
+		} else if p.eof() || p.peek() != ']' {
+			return nil, fmt.Errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+// parseInlineTable parses {a = 1, b = "x"} on a single line
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.next()
+	table := make(map[string]any)
+
+	p.skipSpace()
+	if !p.eof() && p.peek() == '}' {
+		p.next()
+		return table, nil
+	}
+
+	for {
+		if err := p.parseKeyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		switch p.next() {
+		case ',':
+			p.skipSpace()
+		case '}':
+			return table, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+// parseScalar parses a boolean, integer or float
+func (p *tomlParser) parseScalar() (any, error) {
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	token := p.input[start:p.pos]
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return nil, fmt.Errorf("expected value")
+	}
+
+	if v, ok := parseNumber(token); ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("invalid value %q (strings must be quoted)", token)
+}
+
+// parseNumber parses an integer or float in the forms TOML allows, which
+// are stricter than strconv's: no leading zeros, underscores only between
+// digits, no sign on prefixed integers, no hex floats, digits on both
+// sides of a decimal point, and inf and nan only in lower case
+func parseNumber(token string) (any, bool) {
+	switch token {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	case "nan", "+nan", "-nan":
+		return math.NaN(), true
+	}
+
+	if len(token) > 2 && token[0] == '0' {
+		base := 0
+		switch token[1] {
+		case 'x':
+			base = 16
+		case 'o':
+			base = 8
+		case 'b':
+			base = 2
+		}
+		if base != 0 {
+			if !isDigits(token[2:], base) {
+				return nil, false
+			}
+			i, err := strconv.ParseInt(strings.ReplaceAll(token[2:], "_", ""), base, 64)
+			return i, err == nil
+		}
+	}
+
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(token), "e")
+	integer, fraction, hasFraction := strings.Cut(mantissa, ".")
+	if integer != "" && (integer[0] == '+' || integer[0] == '-') {
+		integer = integer[1:]
+	}
+	if !isDigits(integer, 10) || integer[0] == '0' && len(integer) > 1 {
+		return nil, false
+	}
+	if hasFraction && !isDigits(fraction, 10) {
+		return nil, false
+	}
+	if hasExponent {
+		if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+			exponent = exponent[1:]
+		}
+		if !isDigits(exponent, 10) {
+			return nil, false
+		}
+	}
+
+	number := strings.ReplaceAll(token, "_", "")
+	if !hasFraction && !hasExponent {
+		i, err := strconv.ParseInt(number, 10, 64)
+		return i, err == nil
+	}
+	f, err := strconv.ParseFloat(number, 64)
+	return f, err == nil
+}
+
+// isDigits reports whether s is digits in base with underscores only
+// between them
+func isDigits(s string, base int) bool {
+	if s == "" || s[0] == '_' || s[len(s)-1] == '_' || strings.Contains(s, "__") {
+		return false
+	}
+	digits := "0123456789abcdef"[:base]
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'F' {
+			c += 'a' - 'A'
+		}
+		if c != '_' && strings.IndexByte(digits, c) < 0 {
+			return false
+		}
+	}
+	return true
+}
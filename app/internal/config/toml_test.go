@@ -0,0 +1,233 @@
+package config
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]any
+	}{
+		{"empty", "", map[string]any{}},
+		{"comments and blank lines", "# comment\n\n  a = 1 # trailing\r\n\n", map[string]any{"a": int64(1)}},
+		{"booleans", "t = true\nf = false", map[string]any{"t": true, "f": false}},
+		{
+			"tables",
+			"top = 1\n[server]\nport = 80\n[server.tls]\ncert = 'c.pem'\n[ log ]\nlevel = 'info'",
+			map[string]any{
+				"top":    int64(1),
+				"server": map[string]any{"port": int64(80), "tls": map[string]any{"cert": "c.pem"}},
+				"log":    map[string]any{"level": "info"},
+			},
+		},
+		{
+			"dotted keys",
+			"a.b.c = 1\na . b . d = 2\n[t]\nx.y = 3",
+			map[string]any{
+				"a": map[string]any{"b": map[string]any{"c": int64(1), "d": int64(2)}},
+				"t": map[string]any{"x": map[string]any{"y": int64(3)}},
+			},
+		},
+		{
+			"quoted keys",
+			`"a.b" = 1` + "\n'c d'.e = 2\n[\"x y\"]\nz = 3",
+			map[string]any{
+				"a.b": int64(1),
+				"c d": map[string]any{"e": int64(2)},
+				"x y": map[string]any{"z": int64(3)},
+			},
+		},
+		{
+			"arrays of tables",
+			"[[listener]]\naddr = ':80'\n[[listener]]\naddr = ':443'\n[listener.tls]\ncert = 'c'",
+			map[string]any{"listener": []any{
+				map[string]any{"addr": ":80"},
+				map[string]any{"addr": ":443", "tls": map[string]any{"cert": "c"}},
+			}},
+		},
+		{
+			"nested arrays of tables",
+			"[[a]]\n[[a.b]]\nx = 1\n[[a.b]]\nx = 2",
+			map[string]any{"a": []any{map[string]any{"b": []any{
+				map[string]any{"x": int64(1)},
+				map[string]any{"x": int64(2)},
+			}}}},
+		},
+		{
+			"basic string escapes",
+			`s = "tab\there \"q\" back\\slash\b\f\n\r é \u00e9 \U0001F600"`,
+			map[string]any{"s": "tab\there \"q\" back\\slash\b\f\n\r é é 😀"},
+		},
+		{
+			"literal string",
+			`s = 'C:\path\n "x" # not a comment'`,
+			map[string]any{"s": `C:\path\n "x" # not a comment`},
+		},
+		{"empty strings", `a = ""` + "\nb = ''", map[string]any{"a": "", "b": ""}},
+		{
+			"arrays",
+			"a = [1, 'two', 3.5, true]\nb = []\nc = [[1, 2], ['x']]\nd = [ 1 , 2 , ]",
+			map[string]any{
+				"a": []any{int64(1), "two", 3.5, true},
+				"b": []any{},
+				"c": []any{[]any{int64(1), int64(2)}, []any{"x"}},
+				"d": []any{int64(1), int64(2)},
+			},
+		},
+		{
+			"multi-line array",
+			"a = [\n  1, # one\n\n  2,\n  # nothing\n  3\n]\nb = 4",
+			map[string]any{"a": []any{int64(1), int64(2), int64(3)}, "b": int64(4)},
+		},
+		{
+			"inline tables",
+			"a = {x = 1, y.z = 'w', n = {}}\nb = [{k = 1}, {k = 2}]",
+			map[string]any{
+				"a": map[string]any{"x": int64(1), "y": map[string]any{"z": "w"}, "n": map[string]any{}},
+				"b": []any{map[string]any{"k": int64(1)}, map[string]any{"k": int64(2)}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLNumbers(t *testing.T) {
+	tests := []struct {
+		token string
+		want  any
+	}{
+		{"0", int64(0)},
+		{"+0", int64(0)},
+		{"-0", int64(0)},
+		{"42", int64(42)},
+		{"+17", int64(17)},
+		{"-17", int64(-17)},
+		{"1_000_000", int64(1000000)},
+		{"9223372036854775807", int64(math.MaxInt64)},
+		{"-9223372036854775808", int64(math.MinInt64)},
+		{"0xDEAD_beef", int64(0xdeadbeef)},
+		{"0x00ff", int64(255)},
+		{"0o755", int64(0o755)},
+		{"0b1101_0110", int64(0b11010110)},
+		{"1.5", 1.5},
+		{"-0.25", -0.25},
+		{"+3.0", 3.0},
+		{"0.1", 0.1},
+		{"1e3", 1000.0},
+		{"1E-2", 0.01},
+		{"5e+22", 5e22},
+		{"6.626e-34", 6.626e-34},
+		{"2e05", 2e5},
+		{"224_617.445_991", 224617.445991},
+		{"1_0e1_0", 10e10},
+		{"inf", math.Inf(1)},
+		{"+inf", math.Inf(1)},
+		{"-inf", math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			got, err := parseTOML("v = " + tt.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got["v"] != tt.want {
+				t.Errorf("%s = %#v, want %#v", tt.token, got["v"], tt.want)
+			}
+		})
+	}
+
+	for _, token := range []string{"nan", "+nan", "-nan"} {
+		got, err := parseTOML("v = " + token)
+		if f, ok := got["v"].(float64); err != nil || !ok || !math.IsNaN(f) {
+			t.Errorf("%s = %#v, %v; want NaN", token, got["v"], err)
+		}
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"bare string", "a = hello", `line 1: invalid value "hello" (strings must be quoted)`},
+		{"missing value", "a =", "line 1: expected value"},
+		{"missing equals", "a 1", `line 1: expected '='`},
+		{"missing key", "= 1", `line 1: expected key, found '='`},
+		{"junk after value", "a = 1 2", `line 1: unexpected '2'`},
+		{"duplicate key", "a = 1\na = 2", "line 2: duplicate key a"},
+		{"duplicate dotted key", "a.b = 1\n[a]\nb = 2", "line 3: duplicate key b"},
+		{"value used as a table", "a = 1\n[a.b]", "line 2: a is not a table"},
+		{"dotted key through a value", "a = 1\na.b = 2", "line 2: a is not a table"},
+		{"table used as an array of tables", "[a]\n[[a]]", "line 2: a is not an array of tables"},
+		{"unclosed table header", "[a", `line 1: expected ']'`},
+		{"unclosed array of tables header", "[[a]", `line 1: expected ']'`},
+		{"unterminated basic string", `a = "abc`, "line 1: unterminated string"},
+		{"newline in basic string", "a = \"abc\nd\"", "line 1: unterminated string"},
+		{"unterminated literal string", "a = 'abc", "line 1: unterminated string"},
+		{"newline in literal string", "a = 'abc\nd'", "line 1: unterminated string"},
+		{"invalid escape", `a = "\x41"`, `line 1: invalid escape \x`},
+		{"short unicode escape", `a = "\u12"`, "line 1: invalid unicode escape"},
+		{"non-hex unicode escape", `a = "\u12g4"`, "line 1: invalid unicode escape"},
+		{"surrogate unicode escape", `a = "\uD800"`, "line 1: invalid unicode escape"},
+		{"out of range unicode escape", `a = "\U00110000"`, "line 1: invalid unicode escape"},
+		{"multi-line basic string", `a = """x"""`, "line 1: multi-line strings are not supported"},
+		{"multi-line literal string", "a = '''x'''", "line 1: multi-line strings are not supported"},
+		{"unterminated array", "a = [1, 2,", "line 1: unterminated array"},
+		{"array without commas", "a = [1 2]", `line 1: expected ',' or ']' in array`},
+		{"array with two commas", "a = [1,,2]", "line 1: expected value"},
+		{"unterminated inline table", "a = {x = 1", "line 1: unterminated inline table"},
+		{"inline table without commas", "a = {x = 1 y = 2}", `line 1: expected ',' or '}' in inline table`},
+		{"duplicate key in inline table", "a = {x = 1, x = 2}", "line 1: duplicate key x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML(tt.input)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("error = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestParseTOMLInvalidNumbers(t *testing.T) {
+	for _, token := range []string{
+		// Special floats are lower case only
+		"Inf", "INF", "Infinity", "infinity", "NaN", "NAN",
+		// Hex floats
+		"0x1p-2", "0x1.8p1",
+		// Digits on both sides of the decimal point
+		".5", "5.", "-.5", "1.e5",
+		// Exponents need digits
+		"1e", "1e+", "e5",
+		// Leading zeros
+		"010", "-01", "00", "01.5", "0_1",
+		// Underscores only between digits
+		"_1", "1_", "1__0", "1_.5", "1._5", "1e_5", "0x_ff", "0xff_",
+		// Prefixes are lower case, unsigned and need digits in their base
+		"0X1f", "0B1", "-0x1", "+0o7", "0x", "0xg", "0o8", "0b2",
+		// Out of range
+		"9223372036854775808", "0x8000000000000000", "1e400",
+		"1.5.2", "1-2", "+", "-", "tru",
+	} {
+		_, err := parseTOML("v = " + token)
+		if err == nil || !strings.Contains(err.Error(), "strings must be quoted") {
+			t.Errorf("%s: error = %v", token, err)
+		}
+	}
+}
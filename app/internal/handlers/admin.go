@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// handleAdminReload handles POST /admin/reload, which reloads the server
+// configuration. It only exists when an admin token is configured, and
+// requires it as a bearer token.
+func (h *Handlers) handleAdminReload(w *http.ResponseWriter, request *http.Request) {
+	if h.config.AdminToken == "" || h.reload == nil {
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
+		return
+	}
+
+	if !h.isAdmin(request) {
+		w.Header().Set(http.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+		h.writeResponse(w, http.StatusUnauthorized, "", nil, 0)
+		return
+	}
+
+	if err := h.reload(); err != nil {
+		body := []byte(err.Error() + "\n")
+		h.writeResponse(w, http.StatusInternalServerError, http.ContentTypePlain, body, len(body))
+		return
+	}
+
+	body := []byte("configuration reloaded\n")
+	h.writeResponse(w, http.StatusOK, http.ContentTypePlain, body, len(body))
+}
+
+// handleAdminMetrics handles GET /admin/metrics, which serves the
+// variables published through expvar, such as panics, as JSON in
+// the format of /debug/vars. Like reload it requires the admin token.
+func (h *Handlers) handleAdminMetrics(w *http.ResponseWriter, request *http.Request) {
+	if h.config.AdminToken == "" {
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
+		return
+	}
+
+	if !h.isAdmin(request) {
+		w.Header().Set(http.HeaderWWWAuthenticate, `Bearer realm="admin"`)
+		h.writeResponse(w, http.StatusUnauthorized, "", nil, 0)
+		return
+	}
+
+	var body bytes.Buffer
+	body.WriteString("{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			body.WriteString(",\n")
+		}
+		first = false
+		fmt.Fprintf(&body, "%q: %s", kv.Key, kv.Value)
+	})
+	body.WriteString("\n}\n")
+
+	h.writeResponse(w, http.StatusOK, http.ContentTypeJSON, body.Bytes(), body.Len())
+}
+
+// isAdmin reports whether the request carries the configured admin token
+func (h *Handlers) isAdmin(request *http.Request) bool {
+	token, found := strings.CutPrefix(request.Headers[http.HeaderAuthorization], "Bearer ")
+	if !found {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.config.AdminToken)) == 1
+}
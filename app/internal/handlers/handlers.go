@@ -1,9 +1,10 @@
 package handlers
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"log"
-	"net"
+	"strconv"
 	"strings"
 
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
@@ -13,6 +14,9 @@ import (
 // Handlers contains all the HTTP request handlers
 type Handlers struct {
 	config *config.Config
+
+	// reload re-reads and applies the configuration, see SetReloadFunc
+	reload func() error
 }
 
 // New creates a new handlers instance
@@ -22,106 +26,117 @@ func New(cfg *config.Config) *Handlers {
 	}
 }
 
+// SetReloadFunc sets the function the admin reload endpoint calls
+func (h *Handlers) SetReloadFunc(reload func() error) {
+	h.reload = reload
+}
+
 // HandleRequest routes and handles an HTTP request
-func (h *Handlers) HandleRequest(conn net.Conn, request *http.Request) {
+func (h *Handlers) HandleRequest(w *http.ResponseWriter, request *http.Request) {
 
 	switch request.Method {
 	case http.GET:
-		h.handleGet(conn, request)
+		h.handleGet(w, request)
 	case http.POST:
-		h.handlePost(conn, request)
+		h.handlePost(w, request)
 	default:
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 	}
 }
 
 // handleGet handles GET requests
-func (h *Handlers) handleGet(conn net.Conn, request *http.Request) {
+func (h *Handlers) handleGet(w *http.ResponseWriter, request *http.Request) {
 	switch {
 	case request.Path == "/":
-		h.handleRoot(conn)
+		h.handleRoot(w)
 	case strings.HasPrefix(request.Path, "/echo/"):
-		h.handleEcho(conn, request, request.Path[len("/echo/"):])
+		h.handleEcho(w, request, request.Path[len("/echo/"):])
 	case request.Path == "/user-agent":
-		h.handleUserAgent(conn, request, request.Headers[http.HeaderUserAgent])
+		h.handleUserAgent(w, request, request.Headers[http.HeaderUserAgent])
+	case request.Path == "/ws/echo":
+		h.handleWebSocketEcho(w, request)
+	case request.Path == "/sse/clock":
+		h.handleSSEClock(w, request)
+	case request.Path == "/admin/metrics":
+		h.handleAdminMetrics(w, request)
 	case strings.HasPrefix(request.Path, "/files/"):
 		filename := request.Path[len("/files/"):]
-		h.handleFilesGet(conn, filename)
+		h.handleFilesGet(w, request, filename)
 	default:
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 	}
 }
 
 // handlePost handles POST requests
-func (h *Handlers) handlePost(conn net.Conn, request *http.Request) {
+func (h *Handlers) handlePost(w *http.ResponseWriter, request *http.Request) {
 
 	switch {
 	case strings.HasPrefix(request.Path, "/files/"):
 		filename := request.Path[len("/files/"):]
-		h.handleFilesPost(conn, filename, request.Body)
+		h.handleFilesPost(w, filename, request.Body)
+	case request.Path == "/admin/reload":
+		h.handleAdminReload(w, request)
 	default:
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 	}
 }
 
 // writeResponse writes a response to the client
-func (h *Handlers) writeResponse(conn net.Conn, status, contentType string, body []byte, contentLength int) {
-	// Use the HTTP response formatter if no body is provided
-	if body == nil {
-		response := http.FormatResponse(status, contentType, nil)
-		if _, err := conn.Write([]byte(response)); err != nil {
-			log.Printf("Error writing headers: %v", err)
-		}
-		return
+func (h *Handlers) writeResponse(w *http.ResponseWriter, status http.Status, contentType string, body []byte, contentLength int) {
+	if contentType != "" {
+		w.Header().Set(http.HeaderContentType, contentType)
 	}
 
 	// Calculate content length if not provided
 	if contentLength <= 0 {
 		contentLength = len(body)
 	}
+	w.Header().Set(http.HeaderContentLength, strconv.Itoa(contentLength))
 
-	// Format the response with headers
-	var response string
-	if contentType != "" {
-		response = fmt.Sprintf(
-			"HTTP/1.1 %s\r\n"+
-				"Content-Type: %s\r\n"+
-				"Content-Length: %d\r\n\r\n",
-			status,
-			contentType,
-			contentLength,
-		)
-	} else {
-		response = fmt.Sprintf("HTTP/1.1 %s\r\n\r\n", status)
-	}
+	h.writeBody(w, status, body)
+}
 
-	// Write the response headers
-	_, err := conn.Write([]byte(response))
-	if err != nil {
-		log.Printf("Error writing headers: %v", err)
-		return
-	}
+// writeResponseWithEncoding writes a response with Content-Encoding header to the client
+func (h *Handlers) writeResponseWithEncoding(w *http.ResponseWriter, status http.Status, contentType, encoding string, body []byte) {
+	w.Header().Set(http.HeaderContentEncoding, encoding)
+	h.writeResponse(w, status, contentType, body, len(body))
+}
 
-	// Write the body
-	if _, err = conn.Write(body); err != nil {
+// writeBody sends the status line, any header fields already set on the
+// writer (such as Set-Cookie) and the body
+func (h *Handlers) writeBody(w *http.ResponseWriter, status http.Status, body []byte) {
+	w.WriteHeader(status)
+	if _, err := w.Write(body); err != nil {
 		log.Printf("Error writing body: %v", err)
 	}
 }
 
-// writeResponseWithEncoding writes a response with Content-Encoding header to the client
-func (h *Handlers) writeResponseWithEncoding(conn net.Conn, status, contentType, encoding string, body []byte) {
-	// Format response with encoding
-	response := http.FormatResponseWithEncoding(status, contentType, encoding, body)
-
-	// Write response headers
-	_, err := conn.Write([]byte(response))
-	if err != nil {
-		log.Printf("Error writing headers: %v", err)
-		return
-	}
+// copyBufferSize is the chunk size used when streaming bodies
+const copyBufferSize = 32 * 1024
 
-	// Write the body
-	if _, err = conn.Write(body); err != nil {
-		log.Printf("Error writing body: %v", err)
+// copyWithContext copies src to dst in chunks, stopping early if ctx is
+// cancelled, and returns the number of bytes copied
+func copyWithContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, writeErr := dst.Write(buf[:n]); writeErr != nil {
+				return written, writeErr
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
 	}
 }
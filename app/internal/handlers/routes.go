@@ -1,21 +1,23 @@
 package handlers
 
 import (
-	"net"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
 )
 
 // handleRoot handles requests to the root path
-func (h *Handlers) handleRoot(conn net.Conn) {
-	h.writeResponse(conn, http.StatusOK, "", nil, 0)
+func (h *Handlers) handleRoot(w *http.ResponseWriter) {
+	h.writeResponse(w, http.StatusOK, "", nil, 0)
 }
 
 // handleEcho handles requests to the /echo/ endpoint
-func (h *Handlers) handleEcho(conn net.Conn, request *http.Request, content string) {
+func (h *Handlers) handleEcho(w *http.ResponseWriter, request *http.Request, content string) {
 	bodyBytes := []byte(content)
 
 	// Check if client accepts gzip encoding
@@ -24,13 +26,13 @@ func (h *Handlers) handleEcho(conn net.Conn, request *http.Request, content stri
 		compressedBytes, err := http.CompressGzip(bodyBytes)
 		if err != nil {
 			// Fall back to uncompressed response if compression fails
-			h.writeResponse(conn, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
+			h.writeResponse(w, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
 			return
 		}
 
 		// Send response with Content-Encoding header and compressed body
 		h.writeResponseWithEncoding(
-			conn,
+			w,
 			http.StatusOK,
 			http.ContentTypePlain,
 			http.EncodingGzip,
@@ -39,7 +41,7 @@ func (h *Handlers) handleEcho(conn net.Conn, request *http.Request, content stri
 	} else {
 		// Standard response without encoding
 		h.writeResponse(
-			conn,
+			w,
 			http.StatusOK,
 			http.ContentTypePlain,
 			bodyBytes,
@@ -49,7 +51,7 @@ func (h *Handlers) handleEcho(conn net.Conn, request *http.Request, content stri
 }
 
 // handleUserAgent handles requests to the /user-agent endpoint
-func (h *Handlers) handleUserAgent(conn net.Conn, request *http.Request, userAgent string) {
+func (h *Handlers) handleUserAgent(w *http.ResponseWriter, request *http.Request, userAgent string) {
 	bodyBytes := []byte(userAgent)
 
 	// Check if client accepts gzip encoding
@@ -58,13 +60,13 @@ func (h *Handlers) handleUserAgent(conn net.Conn, request *http.Request, userAge
 		compressedBytes, err := http.CompressGzip(bodyBytes)
 		if err != nil {
 			// Fall back to uncompressed response if compression fails
-			h.writeResponse(conn, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
+			h.writeResponse(w, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
 			return
 		}
 
 		// Send response with Content-Encoding header and compressed body
 		h.writeResponseWithEncoding(
-			conn,
+			w,
 			http.StatusOK,
 			http.ContentTypePlain,
 			http.EncodingGzip,
@@ -72,46 +74,69 @@ func (h *Handlers) handleUserAgent(conn net.Conn, request *http.Request, userAge
 		)
 	} else {
 		// Standard response without encoding
-		h.writeResponse(conn, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
+		h.writeResponse(w, http.StatusOK, http.ContentTypePlain, bodyBytes, len(bodyBytes))
 	}
 }
 
 // handleFilesGet handles GET requests to the /files/{filename} endpoint
-func (h *Handlers) handleFilesGet(conn net.Conn, filename string) {
+func (h *Handlers) handleFilesGet(w *http.ResponseWriter, request *http.Request, filename string) {
 	if h.config.FilesDirectory == "" {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
 
 	// Prevent path traversal attacks by cleaning the path
 	cleanFilename := filepath.Clean(filename)
 	if strings.Contains(cleanFilename, "..") {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
 
 	filePath := filepath.Join(h.config.FilesDirectory, cleanFilename)
 
-	content, err := os.ReadFile(filePath)
+	file, err := os.Open(filePath)
 	if err != nil {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
+	defer file.Close()
 
-	h.writeResponse(conn, http.StatusOK, http.ContentTypeOctetStream, content, len(content))
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
+		return
+	}
+
+	// Stream the file so an abandoned request stops reading it
+	w.Header().Set(http.HeaderContentType, http.ContentTypeOctetStream)
+	w.Header().Set(http.HeaderContentLength, strconv.FormatInt(info.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+
+	// Stopping short of the Content-Length already sent would leave the
+	// client waiting for the rest, or reading the next response as it, so
+	// the connection is closed instead
+	ctx := request.Context()
+	n, err := copyWithContext(ctx, w, io.LimitReader(file, info.Size()))
+	if err == nil && n < info.Size() {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		log.Printf("Error sending %s (request %s): %v", cleanFilename, http.RequestIDFrom(ctx), err)
+		w.Abort(http.StatusInternalServerError)
+	}
 }
 
 // handleFilesPost handles POST requests to the /files/{filename} endpoint
-func (h *Handlers) handleFilesPost(conn net.Conn, filename string, body []byte) {
+func (h *Handlers) handleFilesPost(w *http.ResponseWriter, filename string, body []byte) {
 	if h.config.FilesDirectory == "" {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
 
 	// Prevent path traversal attacks by cleaning the path
 	cleanFilename := filepath.Clean(filename)
 	if strings.Contains(cleanFilename, "..") {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
 
@@ -120,10 +145,10 @@ func (h *Handlers) handleFilesPost(conn net.Conn, filename string, body []byte)
 	// Create the file and write the request body to it
 	err := os.WriteFile(filePath, body, 0644)
 	if err != nil {
-		h.writeResponse(conn, http.StatusNotFound, "", nil, 0)
+		h.writeResponse(w, http.StatusNotFound, "", nil, 0)
 		return
 	}
 
 	// Return 201 Created status code
-	h.writeResponse(conn, http.StatusCreated, "", nil, 0)
+	h.writeResponse(w, http.StatusCreated, "", nil, 0)
 }
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/sse"
+)
+
+// clockInterval is how often /sse/clock sends an event
+const clockInterval = time.Second
+
+// clockRetry is the reconnection delay /sse/clock asks clients for
+const clockRetry = 3 * time.Second
+
+// handleSSEClock handles GET /sse/clock, an event stream sending the time
+// every second as "tick" events numbered from 1. A reconnecting client
+// resumes after the Last-Event-ID it sends, and ?count=N ends the stream
+// after event N.
+func (h *Handlers) handleSSEClock(w *http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	limit, _ := strconv.Atoi(request.Query().Get("count"))
+
+	stream, err := sse.NewWriter(w, request, &sse.Options{WriteTimeout: h.config.WriteTimeout})
+	if err != nil {
+		log.Printf("Error starting event stream (request %s): %v", http.RequestIDFrom(ctx), err)
+		return
+	}
+	defer stream.Close()
+
+	next := 1
+	if last, err := strconv.Atoi(stream.LastEventID()); err == nil && last >= 0 {
+		next = last + 1
+	}
+
+	ticker := time.NewTicker(clockInterval)
+	defer ticker.Stop()
+
+	for ; limit <= 0 || next <= limit; next++ {
+		event := sse.Event{
+			ID:    strconv.Itoa(next),
+			Event: "tick",
+			Data:  time.Now().UTC().Format(time.RFC3339),
+		}
+		if next == 1 {
+			event.Retry = clockRetry
+		}
+		if err := stream.Send(event); err != nil {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
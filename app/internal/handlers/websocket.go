@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/websocket"
+)
+
+// handleWebSocketEcho handles GET /ws/echo, which opens a WebSocket and
+// sends every message back as it was received
+func (h *Handlers) handleWebSocketEcho(w *http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	conn, err := websocket.Accept(w, request, &websocket.Options{Compression: true})
+	if err != nil {
+		log.Printf("WebSocket handshake failed (request %s): %v", http.RequestIDFrom(ctx), err)
+		return
+	}
+	defer conn.Close()
+
+	// A cancelled request, such as at the shutdown deadline, ends the read
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	for {
+		typ, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err) && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("WebSocket closed (request %s): %v", http.RequestIDFrom(ctx), err)
+			}
+			return
+		}
+
+		if err := conn.WriteMessage(typ, data); err != nil {
+			log.Printf("Error writing WebSocket message (request %s): %v", http.RequestIDFrom(ctx), err)
+			return
+		}
+	}
+}
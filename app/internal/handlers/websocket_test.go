@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// wsClient is the client end of a connection to /ws/echo
+type wsClient struct {
+	t      *testing.T
+	conn   net.Conn
+	r      *bufio.Reader
+	status string
+	header map[string]string
+}
+
+// wsFrame is a frame received from the server
+type wsFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  byte
+	payload []byte
+}
+
+// serveConn serves one request on conn as the server does for an HTTP/1
+// connection, allowing it to be upgraded
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	request, err := http.ParseRequest(reader)
+	if err != nil {
+		return
+	}
+	w := http.NewResponseWriter(conn, request, "")
+	w.SetUpgrader(func(bool) (net.Conn, *bufio.Reader) { return conn, reader })
+	New(&config.Config{}).HandleRequest(w, request)
+	w.Finish()
+}
+
+// dial connects to a loopback listener serving one connection. A pipe
+// would not do: it has no buffer, so a pong the client has not read yet
+// would block the server.
+func dial(t *testing.T) net.Conn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			serveConn(conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// dialEcho sends an opening handshake for /ws/echo with extra header
+// lines and reads the response head
+func dialEcho(t *testing.T, extra ...string) *wsClient {
+	t.Helper()
+	lines := []string{
+		"GET /ws/echo HTTP/1.1",
+		"Host: localhost",
+		"Upgrade: websocket",
+		"Connection: Upgrade",
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==",
+		"Sec-WebSocket-Version: 13",
+	}
+	return handshake(t, dial(t), append(lines, extra...))
+}
+
+// handshake sends a request made of lines and reads the response head
+func handshake(t *testing.T, conn net.Conn, lines []string) *wsClient {
+	t.Helper()
+	if _, err := io.WriteString(conn, strings.Join(lines, "\r\n")+"\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &wsClient{t: t, conn: conn, r: bufio.NewReader(conn), header: make(map[string]string)}
+	status, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.status = strings.TrimSpace(status)
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			return c
+		}
+		name, value, _ := strings.Cut(line, ":")
+		c.header[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+}
+
+// writeRaw sends a frame with the given first byte, masked unless
+// unmasked is set
+func (c *wsClient) writeRaw(first byte, payload []byte, unmasked bool) {
+	c.t.Helper()
+	b := []byte{first}
+	maskBit := byte(0x80)
+	if unmasked {
+		maskBit = 0
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = binary.BigEndian.AppendUint16(append(b, maskBit|126), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint64(append(b, maskBit|127), uint64(n))
+	}
+
+	masked := bytes.Clone(payload)
+	if !unmasked {
+		var mask [4]byte
+		rand.Read(mask[:])
+		b = append(b, mask[:]...)
+		for i := range masked {
+			masked[i] ^= mask[i&3]
+		}
+	}
+	if _, err := c.conn.Write(append(b, masked...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// write sends a masked frame
+func (c *wsClient) write(fin, rsv1 bool, opcode byte, payload []byte) {
+	c.t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	if rsv1 {
+		first |= 0x40
+	}
+	c.writeRaw(first, payload, false)
+}
+
+// read reads a frame from the server, which must not be masked
+func (c *wsClient) read() wsFrame {
+	c.t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if h[1]&0x80 != 0 {
+		c.t.Fatal("server frame is masked")
+	}
+	length := uint64(h[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		io.ReadFull(c.r, b[:])
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(c.r, b[:])
+		length = binary.BigEndian.Uint64(b[:])
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return wsFrame{fin: h[0]&0x80 != 0, rsv1: h[0]&0x40 != 0, opcode: h[0] & 0x0f, payload: payload}
+}
+
+// readMessage reads the frames of a data message
+func (c *wsClient) readMessage() (opcode byte, compressed bool, data []byte) {
+	c.t.Helper()
+	for {
+		f := c.read()
+		if opcode == 0 {
+			opcode, compressed = f.opcode, f.rsv1
+		}
+		data = append(data, f.payload...)
+		if f.fin {
+			return opcode, compressed, data
+		}
+	}
+}
+
+// readClose reads the server's close frame and returns its status code
+func (c *wsClient) readClose() (code int, reason string) {
+	c.t.Helper()
+	f := c.read()
+	if f.opcode != 0x8 {
+		c.t.Fatalf("got opcode %#x, want a close frame", f.opcode)
+	}
+	if len(f.payload) < 2 {
+		return 0, ""
+	}
+	return int(binary.BigEndian.Uint16(f.payload)), string(f.payload[2:])
+}
+
+// closePayload builds the payload of a close frame
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	c := dialEcho(t)
+	if c.status != "HTTP/1.1 101 Switching Protocols" {
+		t.Fatalf("status %q", c.status)
+	}
+
+	// RFC 6455 Section 1.3
+	want := map[string]string{
+		"upgrade":              "websocket",
+		"connection":           "Upgrade",
+		"sec-websocket-accept": "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=",
+	}
+	for name, value := range want {
+		if got := c.header[name]; got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if ext, ok := c.header["sec-websocket-extensions"]; ok {
+		t.Errorf("extension %q negotiated without an offer", ext)
+	}
+}
+
+func TestWebSocketBadHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		status  string
+		version string
+	}{
+		{
+			"not an upgrade",
+			[]string{"GET /ws/echo HTTP/1.1", "Host: localhost", "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==", "Sec-WebSocket-Version: 13"},
+			"HTTP/1.1 426 Upgrade Required", "",
+		},
+		{
+			"old version",
+			[]string{"GET /ws/echo HTTP/1.1", "Host: localhost", "Upgrade: websocket", "Connection: Upgrade", "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==", "Sec-WebSocket-Version: 8"},
+			"HTTP/1.1 426 Upgrade Required", "13",
+		},
+		{
+			"missing key",
+			[]string{"GET /ws/echo HTTP/1.1", "Host: localhost", "Upgrade: websocket", "Connection: Upgrade", "Sec-WebSocket-Version: 13"},
+			"HTTP/1.1 400 Bad Request", "",
+		},
+		{
+			"short key",
+			[]string{"GET /ws/echo HTTP/1.1", "Host: localhost", "Upgrade: websocket", "Connection: Upgrade", "Sec-WebSocket-Key: c2hvcnQ=", "Sec-WebSocket-Version: 13"},
+			"HTTP/1.1 400 Bad Request", "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := handshake(t, dial(t), tt.lines)
+			if c.status != tt.status {
+				t.Errorf("status %q, want %q", c.status, tt.status)
+			}
+			if got := c.header["sec-websocket-version"]; got != tt.version {
+				t.Errorf("Sec-WebSocket-Version = %q, want %q", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestWebSocketEcho(t *testing.T) {
+	c := dialEcho(t)
+
+	tests := []struct {
+		name    string
+		opcode  byte
+		payload []byte
+	}{
+		{"text", 0x1, []byte("hello")},
+		{"empty", 0x1, nil},
+		{"binary", 0x2, []byte{0, 1, 2, 0xff}},
+		{"16-bit length", 0x2, bytes.Repeat([]byte{7}, 300)},
+		{"64-bit length", 0x1, bytes.Repeat([]byte("x"), 70000)},
+	}
+	for _, tt := range tests {
+		c.write(true, false, tt.opcode, tt.payload)
+		opcode, _, data := c.readMessage()
+		if opcode != tt.opcode || !bytes.Equal(data, tt.payload) {
+			t.Errorf("%s: echoed opcode %#x and %d bytes", tt.name, opcode, len(data))
+		}
+	}
+
+	// A fragmented message with a ping in the middle: the pong comes
+	// first, then the whole message
+	c.write(false, false, 0x1, []byte("frag"))
+	c.write(false, false, 0x0, []byte("men"))
+	c.write(true, false, 0x9, []byte("are you there"))
+	c.write(true, false, 0x0, []byte("ted"))
+	if f := c.read(); f.opcode != 0xa || string(f.payload) != "are you there" {
+		t.Errorf("got opcode %#x %q, want the pong", f.opcode, f.payload)
+	}
+	if _, _, data := c.readMessage(); string(data) != "fragmented" {
+		t.Errorf("echoed %q", data)
+	}
+
+	// Unsolicited pongs are ignored
+	c.write(true, false, 0xa, []byte("heartbeat"))
+	c.write(true, false, 0x1, []byte("after pong"))
+	if _, _, data := c.readMessage(); string(data) != "after pong" {
+		t.Errorf("echoed %q", data)
+	}
+
+	// The closing handshake echoes the status
+	c.write(true, false, 0x8, closePayload(1000, "bye"))
+	if code, reason := c.readClose(); code != 1000 || reason != "bye" {
+		t.Errorf("close %d %q", code, reason)
+	}
+}
+
+func TestWebSocketCloseCodes(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		code    int
+	}{
+		{"no status", nil, 0},
+		{"going away", closePayload(1001, ""), 1001},
+		{"registered after RFC 6455", closePayload(1012, "restart"), 1012},
+		{"application code", closePayload(4000, "app"), 4000},
+		{"reserved no status", closePayload(1005, ""), 1002},
+		{"reserved abnormal", closePayload(1006, ""), 1002},
+		{"unassigned", closePayload(2000, ""), 1002},
+		{"truncated", []byte{0x03}, 1002},
+		{"invalid UTF-8 reason", closePayload(1000, "\xff"), 1007},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dialEcho(t)
+			c.write(true, false, 0x8, tt.payload)
+			if code, _ := c.readClose(); code != tt.code {
+				t.Errorf("close code %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(c *wsClient)
+		code int
+	}{
+		{"unmasked frame", func(c *wsClient) { c.writeRaw(0x81, []byte("hi"), true) }, 1002},
+		{"reserved bit", func(c *wsClient) { c.writeRaw(0x80|0x20|0x1, []byte("hi"), false) }, 1002},
+		{"RSV1 without deflate", func(c *wsClient) { c.write(true, true, 0x1, []byte("hi")) }, 1002},
+		{"unknown opcode", func(c *wsClient) { c.write(true, false, 0x3, nil) }, 1002},
+		{"fragmented ping", func(c *wsClient) { c.write(false, false, 0x9, nil) }, 1002},
+		{"long ping", func(c *wsClient) { c.write(true, false, 0x9, make([]byte, 126)) }, 1002},
+		{"continuation outside a message", func(c *wsClient) { c.write(true, false, 0x0, []byte("x")) }, 1002},
+		{
+			"new message inside a fragmented one",
+			func(c *wsClient) {
+				c.write(false, false, 0x1, []byte("a"))
+				c.write(true, false, 0x1, []byte("b"))
+			},
+			1002,
+		},
+		{"invalid UTF-8", func(c *wsClient) { c.write(true, false, 0x1, []byte{0xc3, 0x28}) }, 1007},
+		{
+			"UTF-8 split across fragments",
+			func(c *wsClient) {
+				c.write(false, false, 0x1, []byte{0xc3})
+				c.write(true, false, 0x0, []byte{0xa9})
+				c.write(true, false, 0x8, closePayload(1000, ""))
+			},
+			// The message is valid, so it is echoed before the close
+			-1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := dialEcho(t)
+			tt.send(c)
+			if tt.code < 0 {
+				if _, _, data := c.readMessage(); string(data) != "é" {
+					t.Errorf("echoed %q", data)
+				}
+				tt.code = 1000
+			}
+			if code, _ := c.readClose(); code != tt.code {
+				t.Errorf("close code %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+// deflate compresses a message as permessage-deflate does, without the
+// trailing empty block
+func deflate(t *testing.T, fw *flate.Writer, buf *bytes.Buffer, data []byte) []byte {
+	t.Helper()
+	buf.Reset()
+	fw.Write(data)
+	if err := fw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.TrimSuffix(bytes.Clone(buf.Bytes()), []byte{0x00, 0x00, 0xff, 0xff})
+}
+
+// inflate decompresses a message sent with permessage-deflate
+func inflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+	out, err := io.ReadAll(flate.NewReader(io.MultiReader(
+		bytes.NewReader(data),
+		bytes.NewReader([]byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}),
+	)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestWebSocketDeflate(t *testing.T) {
+	c := dialEcho(t, "Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits")
+	if got := c.header["sec-websocket-extensions"]; got != "permessage-deflate; server_no_context_takeover" {
+		t.Fatalf("Sec-WebSocket-Extensions = %q", got)
+	}
+
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	message := []byte(strings.Repeat("compress me ", 100))
+
+	// The client keeps its context, so the second message refers back
+	// into the first
+	for i := 0; i < 2; i++ {
+		c.write(true, true, 0x1, deflate(t, fw, &buf, message))
+		opcode, compressed, data := c.readMessage()
+		if opcode != 0x1 || !compressed {
+			t.Fatalf("message %d: opcode %#x, compressed %v", i, opcode, compressed)
+		}
+		if got := inflate(t, data); !bytes.Equal(got, message) {
+			t.Errorf("message %d: echoed %q", i, got)
+		}
+	}
+
+	// A compressed message in fragments, with RSV1 on the first only
+	payload := deflate(t, fw, &buf, []byte("a short one"))
+	c.write(false, true, 0x1, payload[:3])
+	c.write(true, false, 0x0, payload[3:])
+	if _, compressed, data := c.readMessage(); compressed || string(data) != "a short one" {
+		// Small messages are sent back uncompressed
+		t.Errorf("echoed %q, compressed %v", data, compressed)
+	}
+
+	// RSV1 on a continuation frame is an error
+	c.write(false, true, 0x1, payload[:3])
+	c.write(true, true, 0x0, payload[3:])
+	if code, _ := c.readClose(); code != 1002 {
+		t.Errorf("close code %d, want 1002", code)
+	}
+}
+
+func TestWebSocketDeflateInvalid(t *testing.T) {
+	c := dialEcho(t, "Sec-WebSocket-Extensions: permessage-deflate")
+	c.write(true, true, 0x2, []byte{0xff, 0xff, 0xff})
+	if code, _ := c.readClose(); code != 1007 {
+		t.Errorf("close code %d, want 1007", code)
+	}
+}
+
+func TestWebSocketDeflateOffers(t *testing.T) {
+	tests := []struct {
+		offer  string
+		accept bool
+	}{
+		{"permessage-deflate", true},
+		{"permessage-deflate; server_no_context_takeover; client_no_context_takeover", true},
+		{"permessage-deflate; server_max_window_bits=15", true},
+		{"permessage-deflate; client_max_window_bits=9", true},
+		{`permessage-deflate; client_max_window_bits="10"`, true},
+		// Only the full window can be used for this side's messages
+		{"permessage-deflate; server_max_window_bits=10", false},
+		{"permessage-deflate; client_max_window_bits=16", false},
+		{"permessage-deflate; server_no_context_takeover=1", false},
+		{"permessage-deflate; unknown", false},
+		{"permessage-deflate; client_no_context_takeover; client_no_context_takeover", false},
+		{"x-webkit-deflate-frame", false},
+		// A later offer is used if an earlier one cannot be accepted
+		{"permessage-deflate; server_max_window_bits=10, permessage-deflate", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.offer, func(t *testing.T) {
+			c := dialEcho(t, "Sec-WebSocket-Extensions: "+tt.offer)
+			if _, ok := c.header["sec-websocket-extensions"]; ok != tt.accept {
+				t.Errorf("accepted %v, want %v", ok, tt.accept)
+			}
+		})
+	}
+}
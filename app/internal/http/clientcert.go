@@ -0,0 +1,14 @@
+package http
+
+import "crypto/x509"
+
+// ClientCertificate returns the client certificate verified during the TLS
+// handshake, or nil if the client did not present one or the connection
+// is not TLS. Its Subject and SANs (DNSNames, EmailAddresses, URIs)
+// identify the client.
+func (r *Request) ClientCertificate() *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
@@ -2,34 +2,55 @@ package http
 
 // HTTP Methods
 const (
-	GET  = "GET"
-	POST = "POST"
-)
-
-// HTTP Status Codes
-const (
-	StatusOK               = "200 OK"
-	StatusCreated          = "201 Created"
-	StatusNotFound         = "404 Not Found"
-	StatusMethodNotAllowed = "405 Method Not Allowed"
+	GET   = "GET"
+	POST  = "POST"
+	PUT   = "PUT"
+	PATCH = "PATCH"
 )
 
 // Content Types
 const (
 	ContentTypePlain       = "text/plain"
 	ContentTypeOctetStream = "application/octet-stream"
+	ContentTypeForm        = "application/x-www-form-urlencoded"
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeJSON        = "application/json"
 )
 
 // Header names
 const (
-	HeaderContentType     = "content-type"
-	HeaderContentLength   = "content-length"
-	HeaderUserAgent       = "user-agent"
-	HeaderAcceptEncoding  = "accept-encoding"
-	HeaderContentEncoding = "content-encoding"
+	HeaderContentType      = "content-type"
+	HeaderContentLength    = "content-length"
+	HeaderUserAgent        = "user-agent"
+	HeaderAcceptEncoding   = "accept-encoding"
+	HeaderContentEncoding  = "content-encoding"
+	HeaderCookie           = "cookie"
+	HeaderSetCookie        = "set-cookie"
+	HeaderDate             = "date"
+	HeaderServer           = "server"
+	HeaderConnection       = "connection"
+	HeaderTransferEncoding = "transfer-encoding"
+	HeaderHost             = "host"
+	HeaderRequestID        = "x-request-id"
+	HeaderAuthorization    = "authorization"
+	HeaderWWWAuthenticate  = "www-authenticate"
+	HeaderUpgrade          = "upgrade"
+	HeaderHTTP2Settings    = "http2-settings"
+	HeaderAltSvc           = "alt-svc"
+	HeaderCacheControl     = "cache-control"
+	HeaderLastEventID      = "last-event-id"
+	HeaderRetryAfter       = "retry-after"
+	HeaderForwarded        = "forwarded"
+	HeaderXForwardedFor    = "x-forwarded-for"
+	HeaderXForwardedProto  = "x-forwarded-proto"
+	HeaderXForwardedHost   = "x-forwarded-host"
+	HeaderXRealIP          = "x-real-ip"
 )
 
 // Compression encodings
 const (
 	EncodingGzip = "gzip"
 )
+
+// TimeFormat is the IMF-fixdate layout used in HTTP date fields
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// contextKey is the type of keys for request-scoped context values
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userKey
+)
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
+// Context returns the request's context. It is cancelled when the client
+// disconnects, the handler times out or the server shuts down.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of the request with its context
+// replaced by ctx
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	clone := *r
+	clone.ctx = ctx
+	return &clone
+}
+
+// WithRequestID returns a context carrying the given request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFrom returns the request ID carried by ctx, or ""
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFrom returns the authenticated user carried by ctx, or ""
+func UserFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey).(string)
+	return user
+}
+
+// RequestID returns the ID for a request: the client's X-Request-Id if it
+// is usable, and otherwise a new random ID
+func RequestID(r *Request) string {
+	if id := r.Headers[HeaderRequestID]; isRequestID(id) {
+		return id
+	}
+	return NewRequestID()
+}
+
+// NewRequestID returns a random 128-bit ID in hex
+func NewRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// isRequestID reports whether a client-supplied ID is safe to log and echo
+func isRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !isTokenChar(id[i]) {
+			return false
+		}
+	}
+	return true
+}
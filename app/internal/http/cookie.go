@@ -0,0 +1,261 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SameSite controls whether a cookie is sent with cross-site requests
+type SameSite int
+
+// SameSite attribute values
+const (
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie limits from RFC 6265bis
+const (
+	maxCookieNameValueSize = 4096
+	maxCookieAttributeSize = 1024
+)
+
+// ErrNoCookie is returned by Request.Cookie when the named cookie is absent
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookie represents an HTTP cookie as sent in a Cookie header or
+// a Set-Cookie response header
+type Cookie struct {
+	Name  string
+	Value string
+
+	// Attributes, only used in Set-Cookie
+	Path        string
+	Domain      string
+	Expires     time.Time
+	MaxAge      int // 0 means unset, negative means delete now ("Max-Age=0")
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Valid checks the cookie name, value and attributes against RFC 6265bis
+func (c *Cookie) Valid() error {
+	if c == nil {
+		return errors.New("cookie is nil")
+	}
+	if !isToken(c.Name) {
+		return fmt.Errorf("invalid cookie name %q", c.Name)
+	}
+	if !isCookieValue(c.Value) {
+		return fmt.Errorf("invalid value for cookie %q", c.Name)
+	}
+	if len(c.Name)+len(c.Value) > maxCookieNameValueSize {
+		return fmt.Errorf("cookie %q exceeds %d bytes", c.Name, maxCookieNameValueSize)
+	}
+	if !isCookieAttributeValue(c.Path) {
+		return fmt.Errorf("invalid path for cookie %q", c.Name)
+	}
+	if !isCookieDomain(c.Domain) {
+		return fmt.Errorf("invalid domain for cookie %q", c.Name)
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() < 1601 {
+		return fmt.Errorf("invalid expiry for cookie %q", c.Name)
+	}
+	if c.SameSite == SameSiteNone && !c.Secure {
+		return fmt.Errorf("cookie %q has SameSite=None without Secure", c.Name)
+	}
+	if c.Partitioned && !c.Secure {
+		return fmt.Errorf("cookie %q is Partitioned without Secure", c.Name)
+	}
+
+	// Name prefixes impose extra requirements on the attributes
+	if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+		return fmt.Errorf("cookie %q requires Secure", c.Name)
+	}
+	if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Path != "/" || c.Domain != "") {
+		return fmt.Errorf("cookie %q requires Secure, Path=/ and no Domain", c.Name)
+	}
+
+	return nil
+}
+
+// String returns the cookie serialized for a Set-Cookie header
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String()
+}
+
+// SetCookie validates the cookie and adds it as a Set-Cookie header field
+func SetCookie(h Header, cookie *Cookie) error {
+	if err := cookie.Valid(); err != nil {
+		return err
+	}
+
+	h.Add(HeaderSetCookie, cookie.String())
+	return nil
+}
+
+// Cookies returns the cookies sent in the request's Cookie header.
+// Malformed pairs are skipped.
+func (r *Request) Cookies() []*Cookie {
+	if r.cookies == nil {
+		r.cookies = parseCookies(r.Headers[HeaderCookie])
+	}
+	return r.cookies
+}
+
+// Cookie returns the first cookie with the given name
+func (r *Request) Cookie(name string) (*Cookie, error) {
+	for _, cookie := range r.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// parseCookies parses a Cookie header value such as "a=1; b=2"
+func parseCookies(line string) []*Cookie {
+	cookies := []*Cookie{}
+
+	for _, pair := range strings.Split(line, ";") {
+		pair = strings.TrimSpace(pair)
+		name, value, found := strings.Cut(pair, "=")
+		if !found || !isToken(name) {
+			continue
+		}
+
+		// Quoted values keep their quotes on the wire but not in the value
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if !isCookieValue(value) {
+			continue
+		}
+
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+
+	return cookies
+}
+
+// isToken reports whether s is a non-empty RFC 9110 token
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether c is a tchar
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// isCookieValue reports whether s is a valid cookie-value, optionally quoted
+func isCookieValue(s string) bool {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		// cookie-octet excludes CTLs, whitespace, DQUOTE, comma, semicolon and backslash
+		if c < 0x21 || c > 0x7e || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieAttributeValue reports whether s can be used as a Path value
+func isCookieAttributeValue(s string) bool {
+	if len(s) > maxCookieAttributeSize {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f || s[i] == ';' {
+			return false
+		}
+	}
+	return true
+}
+
+// isCookieDomain reports whether s is an acceptable Domain attribute value
+func isCookieDomain(s string) bool {
+	if s == "" {
+		return true
+	}
+	s = strings.TrimPrefix(s, ".")
+	if s == "" || len(s) > maxCookieAttributeSize {
+		return false
+	}
+
+	for _, label := range strings.Split(s, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			c := label[i]
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// Form parsing limits
+const (
+	// MaxFormBodySize is the largest urlencoded body that will be parsed
+	MaxFormBodySize = 10 << 20
+
+	// MaxFormParams is the largest number of parameters accepted from a
+	// single query string or body
+	MaxFormParams = 1000
+)
+
+// ErrFormTooLarge is returned when a form body exceeds MaxFormBodySize
+var ErrFormTooLarge = errors.New("form body too large")
+
+// ErrTooManyParams is returned when a query or body has more than MaxFormParams parameters
+var ErrTooManyParams = errors.New("too many form parameters")
+
+// Values maps a parameter name to its values in order of appearance
+type Values map[string][]string
+
+// Get returns the first value for the given key, or "" if there is none
+func (v Values) Get(key string) string {
+	values := v[key]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Has reports whether the given key is present
+func (v Values) Has(key string) bool {
+	_, exists := v[key]
+	return exists
+}
+
+// Add appends a value to the given key
+func (v Values) Add(key, value string) {
+	v[key] = append(v[key], value)
+}
+
+// ParseQuery parses a URL-encoded query string such as "a=1&b=2&a=3".
+// Pairs that cannot be decoded are skipped and the first error is returned
+// alongside whatever was parsed successfully.
+func ParseQuery(query string) (Values, error) {
+	values := make(Values)
+	var firstErr error
+	count := 0
+
+	for query != "" {
+		var pair string
+		pair, query, _ = strings.Cut(query, "&")
+		if pair == "" {
+			continue
+		}
+
+		count++
+		if count > MaxFormParams {
+			return values, ErrTooManyParams
+		}
+
+		rawKey, rawValue, _ := strings.Cut(pair, "=")
+		key, err := Unescape(rawKey)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		value, err := Unescape(rawValue)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		values.Add(key, value)
+	}
+
+	return values, firstErr
+}
+
+// Unescape decodes percent-encoded octets and turns '+' into a space, as
+// used by application/x-www-form-urlencoded
+func Unescape(s string) (string, error) {
+	// Fast path for strings with nothing to decode
+	if !strings.ContainsAny(s, "%+") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '+':
+			b.WriteByte(' ')
+		case '%':
+			if i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+				return "", fmt.Errorf("invalid escape sequence in %q", s)
+			}
+			b.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), nil
+}
+
+// isHex reports whether c is a hexadecimal digit
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// unhex returns the value of a hexadecimal digit
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// ParseForm parses the query string and, for POST, PUT and PATCH requests
+// with an urlencoded body, the request body. It is called lazily by Query,
+// Form and PostForm, so handlers only need to call it to inspect the error.
+func (r *Request) ParseForm() error {
+	if r.formParsed {
+		return r.formErr
+	}
+	r.formParsed = true
+
+	query, err := ParseQuery(r.RawQuery)
+	if err != nil {
+		r.formErr = fmt.Errorf("error parsing query: %w", err)
+	}
+	r.query = query
+
+	r.postForm = make(Values)
+	if r.hasFormBody() {
+		if len(r.Body) > MaxFormBodySize {
+			r.formErr = ErrFormTooLarge
+		} else {
+			postForm, err := ParseQuery(string(r.Body))
+			if err != nil && r.formErr == nil {
+				r.formErr = fmt.Errorf("error parsing form body: %w", err)
+			}
+			r.postForm = postForm
+		}
+	}
+
+	// Body values take precedence over query values
+	r.form = make(Values, len(r.postForm)+len(r.query))
+	for key, values := range r.postForm {
+		r.form[key] = append(r.form[key], values...)
+	}
+	for key, values := range r.query {
+		r.form[key] = append(r.form[key], values...)
+	}
+
+	return r.formErr
+}
+
+// hasFormBody reports whether the request body should be parsed as a form
+func (r *Request) hasFormBody() bool {
+	switch r.Method {
+	case POST, PUT, PATCH:
+	default:
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Headers[HeaderContentType])
+	return err == nil && mediaType == ContentTypeForm
+}
+
+// Query returns the parameters from the URL query string
+func (r *Request) Query() Values {
+	r.ParseForm()
+	return r.query
+}
+
+// PostForm returns the parameters from an urlencoded request body
+func (r *Request) PostForm() Values {
+	r.ParseForm()
+	return r.postForm
+}
+
+// Form returns the body and query parameters combined, with body values first
+func (r *Request) Form() Values {
+	r.ParseForm()
+	return r.form
+}
+
+// FormValue returns the first value for key from the body or the query string
+func (r *Request) FormValue(key string) string {
+	return r.Form().Get(key)
+}
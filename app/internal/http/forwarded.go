@@ -0,0 +1,211 @@
+package http
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// hop is one proxy's account of the client it received a request from
+type hop struct {
+	addr  netip.Addr // zero if unknown or obfuscated
+	proto string
+	host  string
+}
+
+// ResolveClient derives ClientIP, Scheme and Host from RemoteAddr and, if
+// the peer is trusted, from the forwarding headers. The Forwarded header
+// (RFC 7239) is preferred to X-Forwarded-For and X-Real-IP. The chain is
+// walked from the nearest proxy outwards, believing each hop only while
+// the address that reported it is trusted, so a client cannot forge its
+// address by sending the headers itself. trusted is also asked about the
+// zero address for peers without one, such as Unix socket clients.
+func (r *Request) ResolveClient(trusted func(netip.Addr) bool) {
+	r.ClientIP = parseNode(r.RemoteAddr)
+	r.Scheme = "http"
+	if r.TLS != nil {
+		r.Scheme = "https"
+	}
+	r.Host = r.Headers[HeaderHost]
+
+	hops := r.forwardedHops()
+	for i := len(hops) - 1; i >= 0 && trusted(r.ClientIP); i-- {
+		if hops[i].proto != "" {
+			r.Scheme = hops[i].proto
+		}
+		if hops[i].host != "" {
+			r.Host = hops[i].host
+		}
+		if !hops[i].addr.IsValid() {
+			break
+		}
+		r.ClientIP = hops[i].addr
+	}
+}
+
+// AbsoluteURL returns path as an absolute URL on the scheme and host the
+// client used
+func (r *Request) AbsoluteURL(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return r.Scheme + "://" + r.Host + path
+}
+
+// forwardedHops returns the hops named by the forwarding headers, the
+// client first and the nearest proxy last
+func (r *Request) forwardedHops() []hop {
+	if value, ok := r.Headers[HeaderForwarded]; ok {
+		return parseForwarded(value)
+	}
+
+	var hops []hop
+	if value, ok := r.Headers[HeaderXForwardedFor]; ok {
+		for _, node := range strings.Split(value, ",") {
+			hops = append(hops, hop{addr: parseNode(strings.TrimSpace(node))})
+		}
+	} else if value, ok := r.Headers[HeaderXRealIP]; ok {
+		hops = append(hops, hop{addr: parseNode(strings.TrimSpace(value))})
+	}
+
+	protos := splitList(r.Headers[HeaderXForwardedProto])
+	hosts := splitList(r.Headers[HeaderXForwardedHost])
+	if len(hops) == 0 && (len(protos) > 0 || len(hosts) > 0) {
+		// Only the scheme or host was forwarded
+		hops = append(hops, hop{})
+	}
+	for i := range hops {
+		hops[i].proto = validProto(pick(protos, i, len(hops)))
+		hops[i].host = validHost(pick(hosts, i, len(hops)))
+	}
+	return hops
+}
+
+// pick returns the value of an X-Forwarded-Proto or -Host list for hop i
+// of n. Proxies usually overwrite these headers rather than append to
+// them, so unless there is one value per hop the last one applies.
+func pick(values []string, i, n int) string {
+	if len(values) == n {
+		return values[i]
+	}
+	if len(values) > 0 {
+		return values[len(values)-1]
+	}
+	return ""
+}
+
+// parseForwarded parses a Forwarded header into hops, one per element
+func parseForwarded(value string) []hop {
+	var hops []hop
+	for _, element := range splitQuoted(value, ',') {
+		var h hop
+		for _, pair := range splitQuoted(element, ';') {
+			key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				continue
+			}
+			val = unquote(strings.TrimSpace(val))
+			switch strings.ToLower(strings.TrimSpace(key)) {
+			case "for":
+				h.addr = parseNode(val)
+			case "proto":
+				h.proto = validProto(val)
+			case "host":
+				h.host = validHost(val)
+			}
+		}
+		hops = append(hops, h)
+	}
+	return hops
+}
+
+// parseNode parses a node such as 192.0.2.1, 192.0.2.1:80, 2001:db8::1 or
+// [2001:db8::1]:80, returning the zero address for "unknown", obfuscated
+// identifiers and anything else
+func parseNode(node string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	if addr, err := netip.ParseAddr(node); err == nil && addr.Zone() == "" {
+		return addr.Unmap()
+	}
+	return netip.Addr{}
+}
+
+// validProto returns a forwarded scheme in lower case, or "" unless it is
+// http or https
+func validProto(proto string) string {
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto != "http" && proto != "https" {
+		return ""
+	}
+	return proto
+}
+
+// validHost returns a forwarded host, or "" if it could not be a host and
+// optional port, so it is safe to put in a URL
+func validHost(host string) string {
+	host = strings.TrimSpace(host)
+	if len(host) > 255 {
+		return ""
+	}
+	for _, c := range []byte(host) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == ':', c == '[', c == ']':
+		default:
+			return ""
+		}
+	}
+	return host
+}
+
+// splitList splits a comma-separated header value, trimming each item
+func splitList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// splitQuoted splits s at sep outside quoted strings
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped := false, false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote removes the quotes and escapes of a quoted string, returning
+// other values as they are
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var b strings.Builder
+	s = s[1 : len(s)-1]
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,272 @@
+package http
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestResolveClient(t *testing.T) {
+	trusted := func(addr netip.Addr) bool {
+		return netip.MustParsePrefix("10.0.0.0/8").Contains(addr)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		clientIP   string // "" for the zero address
+		scheme     string
+		host       string
+	}{
+		{
+			name:       "no headers",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{HeaderHost: "example.com"},
+			clientIP:   "192.0.2.1",
+			scheme:     "http",
+			host:       "example.com",
+		},
+		{
+			name:       "untrusted peer is not believed",
+			remoteAddr: "192.0.2.1:1234",
+			headers: map[string]string{
+				HeaderHost:            "example.com",
+				HeaderXForwardedFor:   "203.0.113.9",
+				HeaderXForwardedProto: "https",
+				HeaderXForwardedHost:  "evil.example",
+			},
+			clientIP: "192.0.2.1",
+			scheme:   "http",
+			host:     "example.com",
+		},
+		{
+			name:       "x-forwarded-for from trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderHost:            "internal",
+				HeaderXForwardedFor:   "203.0.113.9",
+				HeaderXForwardedProto: "https",
+				HeaderXForwardedHost:  "example.com",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "https",
+			host:     "example.com",
+		},
+		{
+			name:       "spoofed leftmost entry is ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderXForwardedFor: "1.2.3.4, 203.0.113.9",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "http",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderXForwardedFor: "1.2.3.4, 203.0.113.9, 10.0.0.2",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "http",
+		},
+		{
+			name:       "untrusted intermediate hop stops the walk",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderXForwardedFor: "10.9.9.9, 1.2.3.4, 198.51.100.7",
+			},
+			clientIP: "198.51.100.7",
+			scheme:   "http",
+		},
+		{
+			name:       "x-real-ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{HeaderXRealIP: "203.0.113.9"},
+			clientIP:   "203.0.113.9",
+			scheme:     "http",
+		},
+		{
+			name:       "forwarded preferred to x-forwarded-for",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded:     "for=198.51.100.7",
+				HeaderXForwardedFor: "203.0.113.9",
+			},
+			clientIP: "198.51.100.7",
+			scheme:   "http",
+		},
+		{
+			name:       "forwarded with proto and host",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderHost:      "internal",
+				HeaderForwarded: "for=203.0.113.9;proto=https;host=example.com",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "https",
+			host:     "example.com",
+		},
+		{
+			name:       "forwarded quoted ipv6 with port",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded: `For="[2001:db8:cafe::17]:4711"`,
+			},
+			clientIP: "2001:db8:cafe::17",
+			scheme:   "http",
+		},
+		{
+			name:       "forwarded quoted value containing separators",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded: `for=203.0.113.9;host="a,b;c", for=10.0.0.2`,
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "http",
+		},
+		{
+			name:       "forwarded spoofed leftmost element",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded: "for=1.2.3.4;proto=https, for=203.0.113.9",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "http",
+		},
+		{
+			name:       "forwarded unknown node",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded: "for=unknown;proto=https",
+			},
+			clientIP: "10.0.0.1",
+			scheme:   "https",
+		},
+		{
+			name:       "forwarded obfuscated node",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderForwarded: "for=1.2.3.4, for=_hidden",
+			},
+			clientIP: "10.0.0.1",
+			scheme:   "http",
+		},
+		{
+			name:       "invalid proto and host are dropped",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderHost:      "internal",
+				HeaderForwarded: `for=203.0.113.9;proto=javascript;host="ex ample/"`,
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "http",
+			host:     "internal",
+		},
+		{
+			name:       "proto per hop",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderXForwardedFor:   "203.0.113.9, 10.0.0.2",
+				HeaderXForwardedProto: "https, http",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "https",
+		},
+		{
+			name:       "single proto applies to every hop",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				HeaderXForwardedFor:   "203.0.113.9, 10.0.0.2",
+				HeaderXForwardedProto: "https",
+			},
+			clientIP: "203.0.113.9",
+			scheme:   "https",
+		},
+		{
+			name:       "only proto forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{HeaderXForwardedProto: "HTTPS"},
+			clientIP:   "10.0.0.1",
+			scheme:     "https",
+		},
+		{
+			name:       "ipv4-mapped addresses are unmapped",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			headers:    map[string]string{HeaderXForwardedFor: "::ffff:203.0.113.9"},
+			clientIP:   "203.0.113.9",
+			scheme:     "http",
+		},
+		{
+			name:       "unix socket peer is not trusted by default",
+			remoteAddr: "@",
+			headers:    map[string]string{HeaderXForwardedFor: "203.0.113.9"},
+			scheme:     "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{RemoteAddr: tt.remoteAddr, Headers: tt.headers}
+			r.ResolveClient(trusted)
+
+			var want netip.Addr
+			if tt.clientIP != "" {
+				want = netip.MustParseAddr(tt.clientIP)
+			}
+			if r.ClientIP != want {
+				t.Errorf("ClientIP = %v, want %v", r.ClientIP, want)
+			}
+			if r.Scheme != tt.scheme {
+				t.Errorf("Scheme = %q, want %q", r.Scheme, tt.scheme)
+			}
+			if r.Host != tt.host {
+				t.Errorf("Host = %q, want %q", r.Host, tt.host)
+			}
+		})
+	}
+}
+
+func TestResolveClientUnixTrusted(t *testing.T) {
+	r := &Request{
+		RemoteAddr: "@",
+		Headers:    map[string]string{HeaderXForwardedFor: "203.0.113.9"},
+	}
+	r.ResolveClient(func(addr netip.Addr) bool { return !addr.IsValid() })
+	if want := netip.MustParseAddr("203.0.113.9"); r.ClientIP != want {
+		t.Errorf("ClientIP = %v, want %v", r.ClientIP, want)
+	}
+}
+
+func TestParseNode(t *testing.T) {
+	tests := []struct {
+		node string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"192.0.2.1:80", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:80", "2001:db8::1"},
+		{"fe80::1%eth0", ""},
+		{"unknown", ""},
+		{"_obfuscated", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		var want netip.Addr
+		if tt.want != "" {
+			want = netip.MustParseAddr(tt.want)
+		}
+		if got := parseNode(tt.node); got != want {
+			t.Errorf("parseNode(%q) = %v, want %v", tt.node, got, want)
+		}
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	r := &Request{Scheme: "https", Host: "example.com"}
+	if got, want := r.AbsoluteURL("files/a"), "https://example.com/files/a"; got != want {
+		t.Errorf("AbsoluteURL = %q, want %q", got, want)
+	}
+}
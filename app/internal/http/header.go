@@ -0,0 +1,88 @@
+package http
+
+import (
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// Header holds response header fields. Keys are stored in canonical form
+// (e.g. "Set-Cookie") and a field may carry several values.
+type Header map[string][]string
+
+// Add appends a value to the named field
+func (h Header) Add(name, value string) {
+	key := textproto.CanonicalMIMEHeaderKey(name)
+	h[key] = append(h[key], value)
+}
+
+// Set replaces any existing values of the named field
+func (h Header) Set(name, value string) {
+	h[textproto.CanonicalMIMEHeaderKey(name)] = []string{value}
+}
+
+// Get returns the first value of the named field, or "" if there is none
+func (h Header) Get(name string) string {
+	values := h[textproto.CanonicalMIMEHeaderKey(name)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Values returns all values of the named field
+func (h Header) Values(name string) []string {
+	return h[textproto.CanonicalMIMEHeaderKey(name)]
+}
+
+// Del removes the named field
+func (h Header) Del(name string) {
+	delete(h, textproto.CanonicalMIMEHeaderKey(name))
+}
+
+// Suppress keeps the named field out of the response, including fields the
+// server would otherwise add automatically such as Date
+func (h Header) Suppress(name string) {
+	h[textproto.CanonicalMIMEHeaderKey(name)] = nil
+}
+
+// present reports whether the named field has been set or suppressed
+func (h Header) present(name string) bool {
+	_, exists := h[textproto.CanonicalMIMEHeaderKey(name)]
+	return exists
+}
+
+// Clone returns a deep copy of the header
+func (h Header) Clone() Header {
+	clone := make(Header, len(h))
+	for key, values := range h {
+		clone[key] = append([]string(nil), values...)
+	}
+	return clone
+}
+
+// headerValueReplacer strips line breaks so values cannot inject extra fields
+var headerValueReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// Write writes the header fields in wire format, sorted by name
+func (h Header) Write(w io.Writer) error {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		for _, value := range h[name] {
+			b.WriteString(name)
+			b.WriteString(": ")
+			b.WriteString(headerValueReplacer.Replace(value))
+			b.WriteString("\r\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -4,19 +4,75 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
-	"net"
+	"net/netip"
 	"strconv"
 	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/proxyproto"
 )
 
 // Request represents an HTTP request
 type Request struct {
-	Method  string
-	Path    string
-	Headers map[string]string
-	Body    []byte
+	Method   string
+	Path     string
+	RawQuery string
+	Headers  map[string]string
+	Body     []byte
+
+	// Protocol version from the request line, e.g. "HTTP/1.0"
+	Proto      string
+	ProtoMajor int
+	ProtoMinor int
+
+	// TLS describes the connection the request arrived on; nil for
+	// plaintext connections
+	TLS *tls.ConnectionState
+
+	// Proxy is the PROXY protocol header the connection started with, nil
+	// if it did not
+	Proxy *proxyproto.Header
+
+	// RemoteAddr is the address of the peer, "host:port", as reported by
+	// the connection. ClientIP, Scheme and Host describe the client as
+	// seen through trusted proxies, see ResolveClient.
+	RemoteAddr string
+	ClientIP   netip.Addr
+	Scheme     string
+	Host       string
+
+	// Lazily parsed parameters, see ParseForm
+	formParsed bool
+	formErr    error
+	query      Values
+	postForm   Values
+	form       Values
+
+	// Lazily parsed Cookie header, see Cookies
+	cookies []*Cookie
+
+	// Request-scoped context, see Context
+	ctx context.Context
+}
+
+// ProtoAtLeast reports whether the request's protocol version is at least major.minor
+func (r *Request) ProtoAtLeast(major, minor int) bool {
+	return r.ProtoMajor > major || r.ProtoMajor == major && r.ProtoMinor >= minor
+}
+
+// ProtocolError is a malformed request that should be answered with Status
+// before the connection is closed
+type ProtocolError struct {
+	Status Status
+	Reason string
+}
+
+// Error implements the error interface
+func (e *ProtocolError) Error() string {
+	return e.Reason
 }
 
 // AcceptsEncoding checks if the client accepts a specific encoding
@@ -57,52 +113,148 @@ func CompressGzip(data []byte) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// ParseRequest reads and parses an HTTP request from a connection
-func ParseRequest(conn net.Conn) (*Request, error) {
-	reader := bufio.NewReader(conn)
+// DefaultMaxBodySize is the largest request body ParseRequest accepts
+const DefaultMaxBodySize = 10 << 20
 
+// ParseRequest reads and parses an HTTP request from a connection's reader.
+// The same reader must be used for every request on a persistent connection.
+func ParseRequest(reader *bufio.Reader) (*Request, error) {
+	request, err := ParseRequestHead(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := request.ReadBody(reader, DefaultMaxBodySize); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// ParseRequestHead reads the request line and headers, leaving the body
+// unread so the caller can apply a different deadline to it
+func ParseRequestHead(reader *bufio.Reader) (*Request, error) {
 	// Parse the request line
-	method, path, err := parseRequestLine(reader)
+	method, target, proto, err := parseRequestLine(reader)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse headers
-	headers, err := parseHeaders(reader)
+	major, minor, err := parseVersion(proto)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse body based on Content-Length header
-	body, err := parseBody(reader, headers)
+	// Split the request target into path and query string
+	path, rawQuery, _ := strings.Cut(target, "?")
+
+	// Parse headers
+	headers, err := parseHeaders(reader)
 	if err != nil {
 		return nil, err
 	}
 
+	// HTTP/1.1 requires Host; HTTP/1.0 clients may omit it
+	if _, exists := headers[HeaderHost]; !exists && major == 1 && minor >= 1 {
+		return nil, &ProtocolError{Status: StatusBadRequest, Reason: "missing Host header"}
+	}
+
 	// Build and return the request struct
 	request := &Request{
-		Method:  method,
-		Path:    path,
-		Headers: headers,
-		Body:    body,
+		Method:     method,
+		Path:       path,
+		RawQuery:   rawQuery,
+		Headers:    headers,
+		Proto:      proto,
+		ProtoMajor: major,
+		ProtoMinor: minor,
 	}
 
 	return request, nil
 }
 
+// ReadBody reads the request body following the head. A Content-Length
+// that is not a plain number is refused with 400, and a body larger than
+// maxSize, or a urlencoded form larger than MaxFormBodySize, with 413
+// before anything is read.
+func (r *Request) ReadBody(reader *bufio.Reader, maxSize int64) error {
+	value, exists := r.Headers[HeaderContentLength]
+	if !exists {
+		r.Body = []byte{}
+		return nil
+	}
+
+	n, err := ParseContentLength(value)
+	if err != nil {
+		return &ProtocolError{Status: StatusBadRequest, Reason: err.Error()}
+	}
+	if r.hasFormBody() && n > MaxFormBodySize {
+		return &ProtocolError{Status: StatusContentTooLarge, Reason: fmt.Sprintf("form body of %d bytes is too large", n)}
+	}
+	if n > maxSize {
+		return &ProtocolError{Status: StatusContentTooLarge, Reason: fmt.Sprintf("body of %d bytes is too large", n)}
+	}
+
+	body, err := parseBody(reader, n)
+	if err != nil {
+		return err
+	}
+
+	r.Body = body
+	return nil
+}
+
+// ParseContentLength parses a Content-Length value, which must be plain
+// decimal digits
+func ParseContentLength(value string) (int64, error) {
+	if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid Content-Length %q", value)
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Content-Length %q", value)
+	}
+	return n, nil
+}
+
 // parseRequestLine parses the HTTP request line
-func parseRequestLine(reader *bufio.Reader) (method, path string, err error) {
+func parseRequestLine(reader *bufio.Reader) (method, target, proto string, err error) {
 	requestLine, err := reader.ReadString('\n')
 	if err != nil {
-		return "", "", fmt.Errorf("error reading request line: %w", err)
+		return "", "", "", fmt.Errorf("error reading request line: %w", err)
 	}
 
 	parts := strings.Split(strings.TrimSpace(requestLine), " ")
-	if len(parts) < 2 {
-		return "", "", fmt.Errorf("invalid request line: %s", requestLine)
+	if len(parts) != 3 {
+		return "", "", "", &ProtocolError{
+			Status: StatusBadRequest,
+			Reason: fmt.Sprintf("invalid request line: %q", strings.TrimSpace(requestLine)),
+		}
 	}
 
-	return parts[0], parts[1], nil
+	return parts[0], parts[1], parts[2], nil
+}
+
+// parseVersion parses an HTTP version such as "HTTP/1.1". Versions other
+// than 1.x are rejected with 505, since only HTTP/1 framing is understood.
+func parseVersion(proto string) (major, minor int, err error) {
+	version, found := strings.CutPrefix(proto, "HTTP/")
+	majorStr, minorStr, hasDot := strings.Cut(version, ".")
+	if !found || !hasDot || len(majorStr) != 1 || len(minorStr) != 1 {
+		return 0, 0, &ProtocolError{Status: StatusBadRequest, Reason: fmt.Sprintf("invalid HTTP version %q", proto)}
+	}
+
+	major, errMajor := strconv.Atoi(majorStr)
+	minor, errMinor := strconv.Atoi(minorStr)
+	if errMajor != nil || errMinor != nil {
+		return 0, 0, &ProtocolError{Status: StatusBadRequest, Reason: fmt.Sprintf("invalid HTTP version %q", proto)}
+	}
+
+	if major != 1 {
+		return 0, 0, &ProtocolError{Status: StatusHTTPVersionNotSupported, Reason: fmt.Sprintf("unsupported HTTP version %q", proto)}
+	}
+
+	return major, minor, nil
 }
 
 // parseHeaders reads and parses HTTP headers
@@ -125,6 +277,15 @@ func parseHeaders(reader *bufio.Reader) (map[string]string, error) {
 		if colonIndex > 0 {
 			name := strings.ToLower(strings.TrimSpace(headerLine[:colonIndex]))
 			value := strings.TrimSpace(headerLine[colonIndex+1:])
+
+			// Combine repeated fields; cookies use their own separator
+			if existing, ok := headers[name]; ok {
+				separator := ", "
+				if name == HeaderCookie {
+					separator = "; "
+				}
+				value = existing + separator + value
+			}
 			headers[name] = value
 		}
 	}
@@ -132,61 +293,11 @@ func parseHeaders(reader *bufio.Reader) (map[string]string, error) {
 	return headers, nil
 }
 
-// parseBody reads the request body based on Content-Length header
-func parseBody(reader *bufio.Reader, headers map[string]string) ([]byte, error) {
-	contentLengthStr, exists := headers[HeaderContentLength]
-	if !exists {
-		return []byte{}, nil
-	}
-
-	contentLength, err := strconv.Atoi(contentLengthStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid Content-Length: %w", err)
-	}
-
-	// Read the body only if Content-Length > 0
-	if contentLength > 0 {
-		body := make([]byte, contentLength)
-		_, err := io.ReadFull(reader, body)
-		if err != nil {
-			return nil, fmt.Errorf("error reading request body: %w", err)
-		}
-		return body, nil
-	}
-
-	return []byte{}, nil
-}
-
-// FormatResponse formats an HTTP response
-func FormatResponse(status, contentType string, body []byte) string {
-	if contentType != "" && body != nil {
-		return fmt.Sprintf(
-			"HTTP/1.1 %s\r\n"+
-				"Content-Type: %s\r\n"+
-				"Content-Length: %d\r\n\r\n",
-			status,
-			contentType,
-			len(body),
-		)
+// parseBody reads a request body of contentLength bytes
+func parseBody(reader *bufio.Reader, contentLength int64) ([]byte, error) {
+	body := make([]byte, contentLength)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
 	}
-
-	return fmt.Sprintf("HTTP/1.1 %s\r\n\r\n", status)
-}
-
-// FormatResponseWithEncoding formats an HTTP response with encoding
-func FormatResponseWithEncoding(status, contentType, encoding string, body []byte) string {
-	if contentType != "" && body != nil {
-		return fmt.Sprintf(
-			"HTTP/1.1 %s\r\n"+
-				"Content-Type: %s\r\n"+
-				"Content-Encoding: %s\r\n"+
-				"Content-Length: %d\r\n\r\n",
-			status,
-			contentType,
-			encoding,
-			len(body),
-		)
-	}
-
-	return fmt.Sprintf("HTTP/1.1 %s\r\n\r\n", status)
+	return body, nil
 }
@@ -0,0 +1,80 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength string // "" for no header
+		contentType   string
+		body          string
+		maxSize       int64
+		want          string
+		status        Status // 0 when the body is read
+	}{
+		{name: "no Content-Length", body: "ignored", maxSize: 10},
+		{name: "body", contentLength: "5", body: "hello, more", maxSize: 10, want: "hello"},
+		{name: "empty body", contentLength: "0", maxSize: 10},
+		{name: "leading zeros", contentLength: "005", body: "hello", maxSize: 10, want: "hello"},
+		{name: "at the limit", contentLength: "10", body: "0123456789", maxSize: 10, want: "0123456789"},
+		{name: "over the limit", contentLength: "11", body: "0123456789x", maxSize: 10, status: StatusContentTooLarge},
+		// Refused before anything is allocated
+		{name: "huge", contentLength: "1000000000000000000", maxSize: 10, status: StatusContentTooLarge},
+		{
+			name: "form over MaxFormBodySize", contentLength: "10485761", contentType: ContentTypeForm,
+			maxSize: 1 << 30, status: StatusContentTooLarge,
+		},
+		{name: "negative", contentLength: "-5", maxSize: 10, status: StatusBadRequest},
+		{name: "plus sign", contentLength: "+5", body: "hello", maxSize: 10, status: StatusBadRequest},
+		{name: "not a number", contentLength: "five", maxSize: 10, status: StatusBadRequest},
+		{name: "exponent", contentLength: "1e3", maxSize: 10, status: StatusBadRequest},
+		{name: "list", contentLength: "5, 5", body: "hello", maxSize: 10, status: StatusBadRequest},
+		{name: "overflow", contentLength: "99999999999999999999", maxSize: 10, status: StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Request{Method: POST, Headers: map[string]string{}}
+			if tt.contentLength != "" {
+				r.Headers[HeaderContentLength] = tt.contentLength
+			}
+			if tt.contentType != "" {
+				r.Headers[HeaderContentType] = tt.contentType
+			}
+
+			err := r.ReadBody(bufio.NewReader(strings.NewReader(tt.body)), tt.maxSize)
+			if tt.status != 0 {
+				var protocolErr *ProtocolError
+				if !errors.As(err, &protocolErr) || protocolErr.Status != tt.status {
+					t.Errorf("error = %v, want status %d", err, tt.status)
+				}
+				return
+			}
+			if err != nil || string(r.Body) != tt.want {
+				t.Errorf("ReadBody = %q, %v; want %q", r.Body, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBodyTruncated(t *testing.T) {
+	r := &Request{Method: POST, Headers: map[string]string{HeaderContentLength: "10"}}
+	err := r.ReadBody(bufio.NewReader(strings.NewReader("short")), 100)
+	var protocolErr *ProtocolError
+	if err == nil || errors.As(err, &protocolErr) {
+		t.Errorf("error = %v, want a read error", err)
+	}
+}
+
+func TestParseRequestBodyLimit(t *testing.T) {
+	request := "POST /files/x HTTP/1.1\r\nHost: a\r\nContent-Length: 1000000000000000000\r\n\r\n"
+	_, err := ParseRequest(bufio.NewReader(strings.NewReader(request)))
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) || protocolErr.Status != StatusContentTooLarge {
+		t.Errorf("error = %v, want 413", err)
+	}
+}
@@ -0,0 +1,448 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrAborted is returned by writes after the server has abandoned the
+// response, for example because the handler ran past its deadline
+var ErrAborted = errors.New("response aborted")
+
+// ResponseWriter writes a single response to a client connection.
+//
+// The Date, Server and Connection fields are added automatically when the
+// header is written. A handler overrides one by setting it in Header, or
+// suppresses it with Header().Suppress.
+//
+// A ResponseWriter may be aborted by the server while the handler is still
+// running, so its methods are safe for concurrent use.
+type ResponseWriter struct {
+	mu sync.Mutex
+
+	// writer carries HTTP/1 responses; stream carries responses for
+	// protocols with their own framing, such as HTTP/2, and is nil otherwise
+	writer *bufio.Writer
+	stream ResponseStream
+
+	// conn is the connection writer wraps, for SetWriteDeadline
+	conn io.Writer
+
+	request    *Request
+	header     Header
+	serverName string
+
+	status      Status
+	wroteHeader bool
+	chunked     bool
+	noBody      bool
+	closeAfter  bool
+	aborted     bool
+
+	// upgrader hands over the connection, see Upgrade and Hijack;
+	// upgraded or hijacked is set once it has
+	upgrader Upgrader
+	upgraded bool
+	hijacked bool
+
+	// streamErr is the error from sending the header over a stream
+	streamErr error
+}
+
+// NewResponseWriter creates a response writer for the given request.
+// serverName is the default Server token; empty means no Server field.
+// request is nil when answering a request that could not be parsed, in
+// which case the connection is closed after the response.
+func NewResponseWriter(w io.Writer, request *Request, serverName string) *ResponseWriter {
+	if request == nil {
+		request = &Request{Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1, Headers: map[string]string{HeaderConnection: "close"}}
+	}
+
+	return &ResponseWriter{
+		writer:     bufio.NewWriter(w),
+		conn:       w,
+		request:    request,
+		header:     make(Header),
+		serverName: serverName,
+		closeAfter: request.wantsClose(),
+	}
+}
+
+// ResponseStream sends a response over a protocol with its own framing,
+// such as an HTTP/2 stream. Its methods are called with the response
+// writer's lock held, so are never called concurrently.
+type ResponseStream interface {
+	// WriteHeader sends the status and header fields; endStream says
+	// there is no body to follow
+	WriteHeader(status Status, header Header, endStream bool) error
+
+	// Write sends body data
+	Write(p []byte) (int, error)
+
+	// Flush sends any buffered data to the client
+	Flush() error
+
+	// Close ends a response whose header has been sent
+	Close() error
+
+	// Reset abandons a response whose header has been sent
+	Reset() error
+}
+
+// NewStreamResponseWriter creates a response writer that sends the response
+// over stream instead of in HTTP/1 framing
+func NewStreamResponseWriter(stream ResponseStream, request *Request, serverName string) *ResponseWriter {
+	return &ResponseWriter{
+		stream:     stream,
+		request:    request,
+		header:     make(Header),
+		serverName: serverName,
+	}
+}
+
+// Header returns the header fields that will be sent with the response
+func (w *ResponseWriter) Header() Header {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.header
+}
+
+// WriteHeader sends the status line and header fields. Only the first call
+// has any effect. If Content-Length is not set the body is sent chunked, or
+// delimited by closing the connection for HTTP/1.0 clients.
+func (w *ResponseWriter) WriteHeader(status Status) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.writeHeader(status)
+}
+
+// writeHeader sends the header; the caller must hold w.mu
+func (w *ResponseWriter) writeHeader(status Status) {
+	if w.wroteHeader || w.aborted {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	w.noBody = !status.AllowsBody()
+
+	if w.stream != nil {
+		w.writeStreamHeader(status)
+		return
+	}
+
+	// A handler asking for the connection to close gets its way
+	if hasToken(w.header.Get(HeaderConnection), "close") {
+		w.closeAfter = true
+	}
+
+	// Frame the body so the connection can be reused
+	if !w.noBody && w.header.Get(HeaderContentLength) == "" {
+		if w.request.ProtoAtLeast(1, 1) {
+			w.header.Set(HeaderTransferEncoding, "chunked")
+			w.chunked = true
+		} else {
+			// HTTP/1.0 has no chunked encoding
+			w.header.Del(HeaderTransferEncoding)
+			w.closeAfter = true
+		}
+	}
+
+	w.addDefaultHeaders()
+
+	fmt.Fprintf(w.writer, "%s %s\r\n", w.proto(), status)
+	w.header.Write(w.writer)
+	w.writer.WriteString("\r\n")
+}
+
+// hopByHopHeaders describe an HTTP/1 connection and have no meaning on
+// protocols with their own framing
+var hopByHopHeaders = []string{
+	HeaderConnection,
+	HeaderTransferEncoding,
+	"keep-alive",
+	"proxy-connection",
+	HeaderUpgrade,
+}
+
+// writeStreamHeader sends the header over the stream; the caller must hold w.mu
+func (w *ResponseWriter) writeStreamHeader(status Status) {
+	for _, name := range hopByHopHeaders {
+		w.header.Del(name)
+	}
+	w.addDefaultHeaders()
+
+	if err := w.stream.WriteHeader(status, w.header, w.noBody); err != nil {
+		w.streamErr = err
+	}
+}
+
+// addDefaultHeaders fills in Date, Server and Connection unless the handler
+// has set or suppressed them
+func (w *ResponseWriter) addDefaultHeaders() {
+	if !w.header.present(HeaderDate) {
+		w.header.Set(HeaderDate, currentDate())
+	}
+	if !w.header.present(HeaderServer) && w.serverName != "" {
+		w.header.Set(HeaderServer, w.serverName)
+	}
+	if !w.header.present(HeaderConnection) && w.stream == nil {
+		// Each version has a different default, so only the exception is sent
+		if w.request.ProtoAtLeast(1, 1) && w.closeAfter {
+			w.header.Set(HeaderConnection, "close")
+		} else if !w.request.ProtoAtLeast(1, 1) && !w.closeAfter {
+			w.header.Set(HeaderConnection, "keep-alive")
+		}
+	}
+}
+
+// proto returns the version for the status line, which matches the
+// request's so HTTP/1.0 clients get an HTTP/1.0 response
+func (w *ResponseWriter) proto() string {
+	if w.request.ProtoAtLeast(1, 1) {
+		return "HTTP/1.1"
+	}
+	return "HTTP/1.0"
+}
+
+// Write writes body data, sending a 200 OK header first if needed
+func (w *ResponseWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted {
+		return 0, ErrAborted
+	}
+	if w.upgraded {
+		return 0, ErrUpgraded
+	}
+	if w.hijacked {
+		return 0, ErrHijacked
+	}
+	if !w.wroteHeader {
+		w.writeHeader(StatusOK)
+	}
+	if w.noBody || len(p) == 0 {
+		return len(p), nil
+	}
+
+	if w.stream != nil {
+		if w.streamErr != nil {
+			return 0, w.streamErr
+		}
+		return w.stream.Write(p)
+	}
+
+	if w.chunked {
+		fmt.Fprintf(w.writer, "%x\r\n", len(p))
+		n, err := w.writer.Write(p)
+		if err != nil {
+			return n, err
+		}
+		_, err = w.writer.WriteString("\r\n")
+		return n, err
+	}
+
+	return w.writer.Write(p)
+}
+
+// Flush sends any buffered data to the client
+func (w *ResponseWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted {
+		return ErrAborted
+	}
+	if w.upgraded {
+		return ErrUpgraded
+	}
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if !w.wroteHeader {
+		w.writeHeader(StatusOK)
+	}
+	if w.stream != nil {
+		if w.streamErr != nil {
+			return w.streamErr
+		}
+		return w.stream.Flush()
+	}
+	return w.writer.Flush()
+}
+
+// Finish completes the response, writing a header if the handler did not
+// and terminating a chunked body
+func (w *ResponseWriter) Finish() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted || w.upgraded || w.hijacked {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.header.Set(HeaderContentLength, "0")
+		w.writeHeader(StatusOK)
+	}
+
+	if w.stream != nil {
+		if w.streamErr != nil {
+			return w.streamErr
+		}
+		if w.noBody {
+			// The header already ended the stream
+			return nil
+		}
+		return w.stream.Close()
+	}
+
+	if w.chunked {
+		if _, err := w.writer.WriteString("0\r\n\r\n"); err != nil {
+			return fmt.Errorf("error writing final chunk: %w", err)
+		}
+	}
+
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("error flushing response: %w", err)
+	}
+
+	return nil
+}
+
+// Abort abandons the response on behalf of the server. If the header has
+// not been sent yet, an empty response with the given status is sent in its
+// place; otherwise the partial response is left as is. Either way the
+// connection must be closed, and further writes by the handler fail with
+// ErrAborted. On a stream only the stream is ended, or reset if the
+// header was already sent. A hijacked connection is left alone.
+func (w *ResponseWriter) Abort(status Status) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted || w.hijacked {
+		return nil
+	}
+	w.closeAfter = true
+
+	var err error
+	switch {
+	case !w.wroteHeader:
+		// Start from a fresh header, the handler may still hold the old one
+		w.header = Header{}
+		w.header.Set(HeaderContentLength, "0")
+		w.writeHeader(status)
+		if w.stream == nil {
+			err = w.writer.Flush()
+		} else if err = w.streamErr; err == nil && !w.noBody {
+			err = w.stream.Close()
+		}
+	case w.stream != nil:
+		err = w.stream.Reset()
+	}
+
+	w.aborted = true
+	return err
+}
+
+// SetWriteDeadline sets the time by which the rest of an HTTP/1 response
+// must be written, replacing the server's write timeout, for long-lived
+// responses that push it back as they go. Zero means no deadline. HTTP/2
+// and HTTP/3 streams apply the write timeout to each write instead, so it
+// has no effect on them.
+func (w *ResponseWriter) SetWriteDeadline(t time.Time) error {
+	conn, ok := w.conn.(interface{ SetWriteDeadline(time.Time) error })
+	if !ok {
+		return nil
+	}
+	return conn.SetWriteDeadline(t)
+}
+
+// Written reports whether the status line and header have been sent
+func (w *ResponseWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.wroteHeader
+}
+
+// Status returns the status sent with the header, or 0 if none has been sent
+func (w *ResponseWriter) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+// KeepAlive reports whether the connection may be reused for another request
+func (w *ResponseWriter) KeepAlive() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return !w.closeAfter
+}
+
+// wantsClose reports whether the request rules out reusing the connection.
+// HTTP/1.1 connections persist unless closed; HTTP/1.0 connections close
+// unless the client asks for keep-alive.
+func (r *Request) wantsClose() bool {
+	connection := r.Headers[HeaderConnection]
+	if r.ProtoAtLeast(1, 1) {
+		if hasToken(connection, "close") {
+			return true
+		}
+	} else if !hasToken(connection, "keep-alive") {
+		return true
+	}
+
+	// Bodies are only read by Content-Length, so anything else can't be framed
+	_, hasTransferEncoding := r.Headers[HeaderTransferEncoding]
+	return hasTransferEncoding
+}
+
+// IsUpgrade reports whether the request asks to switch the connection to
+// protocol, with the protocol in Upgrade and "upgrade" in Connection
+func (r *Request) IsUpgrade(protocol string) bool {
+	return r.ProtoAtLeast(1, 1) &&
+		hasToken(r.Headers[HeaderConnection], "upgrade") &&
+		hasToken(r.Headers[HeaderUpgrade], protocol)
+}
+
+// hasToken reports whether a comma-separated header value contains token,
+// ignoring case
+func hasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedDate holds the formatted Date value for the current second
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+var dateCache atomic.Pointer[cachedDate]
+
+// currentDate returns the current time formatted for the Date field,
+// reformatting at most once per second
+func currentDate() string {
+	now := time.Now()
+	if cached := dateCache.Load(); cached != nil && cached.unix == now.Unix() {
+		return cached.value
+	}
+
+	cached := &cachedDate{unix: now.Unix(), value: now.UTC().Format(TimeFormat)}
+	dateCache.Store(cached)
+	return cached.value
+}
@@ -0,0 +1,244 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Status is an HTTP response status code
+type Status int
+
+// HTTP Status Codes, from the IANA HTTP Status Code Registry
+const (
+	StatusContinue           Status = 100
+	StatusSwitchingProtocols Status = 101
+	StatusProcessing         Status = 102
+	StatusEarlyHints         Status = 103
+
+	StatusOK                   Status = 200
+	StatusCreated              Status = 201
+	StatusAccepted             Status = 202
+	StatusNonAuthoritativeInfo Status = 203
+	StatusNoContent            Status = 204
+	StatusResetContent         Status = 205
+	StatusPartialContent       Status = 206
+	StatusMultiStatus          Status = 207
+	StatusAlreadyReported      Status = 208
+	StatusIMUsed               Status = 226
+
+	StatusMultipleChoices   Status = 300
+	StatusMovedPermanently  Status = 301
+	StatusFound             Status = 302
+	StatusSeeOther          Status = 303
+	StatusNotModified       Status = 304
+	StatusUseProxy          Status = 305
+	StatusTemporaryRedirect Status = 307
+	StatusPermanentRedirect Status = 308
+
+	StatusBadRequest                  Status = 400
+	StatusUnauthorized                Status = 401
+	StatusPaymentRequired             Status = 402
+	StatusForbidden                   Status = 403
+	StatusNotFound                    Status = 404
+	StatusMethodNotAllowed            Status = 405
+	StatusNotAcceptable               Status = 406
+	StatusProxyAuthRequired           Status = 407
+	StatusRequestTimeout              Status = 408
+	StatusConflict                    Status = 409
+	StatusGone                        Status = 410
+	StatusLengthRequired              Status = 411
+	StatusPreconditionFailed          Status = 412
+	StatusContentTooLarge             Status = 413
+	StatusURITooLong                  Status = 414
+	StatusUnsupportedMediaType        Status = 415
+	StatusRangeNotSatisfiable         Status = 416
+	StatusExpectationFailed           Status = 417
+	StatusMisdirectedRequest          Status = 421
+	StatusUnprocessableContent        Status = 422
+	StatusLocked                      Status = 423
+	StatusFailedDependency            Status = 424
+	StatusTooEarly                    Status = 425
+	StatusUpgradeRequired             Status = 426
+	StatusPreconditionRequired        Status = 428
+	StatusTooManyRequests             Status = 429
+	StatusRequestHeaderFieldsTooLarge Status = 431
+	StatusUnavailableForLegalReasons  Status = 451
+
+	StatusInternalServerError           Status = 500
+	StatusNotImplemented                Status = 501
+	StatusBadGateway                    Status = 502
+	StatusServiceUnavailable            Status = 503
+	StatusGatewayTimeout                Status = 504
+	StatusHTTPVersionNotSupported       Status = 505
+	StatusVariantAlsoNegotiates         Status = 506
+	StatusInsufficientStorage           Status = 507
+	StatusLoopDetected                  Status = 508
+	StatusNotExtended                   Status = 510
+	StatusNetworkAuthenticationRequired Status = 511
+)
+
+// statusText holds the reason phrase for each registered status code
+var statusText = map[Status]string{
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+	StatusProcessing:         "Processing",
+	StatusEarlyHints:         "Early Hints",
+
+	StatusOK:                   "OK",
+	StatusCreated:              "Created",
+	StatusAccepted:             "Accepted",
+	StatusNonAuthoritativeInfo: "Non-Authoritative Information",
+	StatusNoContent:            "No Content",
+	StatusResetContent:         "Reset Content",
+	StatusPartialContent:       "Partial Content",
+	StatusMultiStatus:          "Multi-Status",
+	StatusAlreadyReported:      "Already Reported",
+	StatusIMUsed:               "IM Used",
+
+	StatusMultipleChoices:   "Multiple Choices",
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusUseProxy:          "Use Proxy",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBadRequest:                  "Bad Request",
+	StatusUnauthorized:                "Unauthorized",
+	StatusPaymentRequired:             "Payment Required",
+	StatusForbidden:                   "Forbidden",
+	StatusNotFound:                    "Not Found",
+	StatusMethodNotAllowed:            "Method Not Allowed",
+	StatusNotAcceptable:               "Not Acceptable",
+	StatusProxyAuthRequired:           "Proxy Authentication Required",
+	StatusRequestTimeout:              "Request Timeout",
+	StatusConflict:                    "Conflict",
+	StatusGone:                        "Gone",
+	StatusLengthRequired:              "Length Required",
+	StatusPreconditionFailed:          "Precondition Failed",
+	StatusContentTooLarge:             "Content Too Large",
+	StatusURITooLong:                  "URI Too Long",
+	StatusUnsupportedMediaType:        "Unsupported Media Type",
+	StatusRangeNotSatisfiable:         "Range Not Satisfiable",
+	StatusExpectationFailed:           "Expectation Failed",
+	StatusMisdirectedRequest:          "Misdirected Request",
+	StatusUnprocessableContent:        "Unprocessable Content",
+	StatusLocked:                      "Locked",
+	StatusFailedDependency:            "Failed Dependency",
+	StatusTooEarly:                    "Too Early",
+	StatusUpgradeRequired:             "Upgrade Required",
+	StatusPreconditionRequired:        "Precondition Required",
+	StatusTooManyRequests:             "Too Many Requests",
+	StatusRequestHeaderFieldsTooLarge: "Request Header Fields Too Large",
+	StatusUnavailableForLegalReasons:  "Unavailable For Legal Reasons",
+
+	StatusInternalServerError:           "Internal Server Error",
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusVariantAlsoNegotiates:         "Variant Also Negotiates",
+	StatusInsufficientStorage:           "Insufficient Storage",
+	StatusLoopDetected:                  "Loop Detected",
+	StatusNotExtended:                   "Not Extended",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
+}
+
+// customStatusText holds reason phrases registered at runtime
+var customStatusText sync.Map
+
+// RegisterStatus sets the reason phrase for a custom status code. Registered
+// codes in the IANA table cannot be overridden, and the phrase may only
+// hold the characters RFC 9110 allows in a status line.
+func RegisterStatus(code int, text string) error {
+	status := Status(code)
+	if !status.Valid() {
+		return fmt.Errorf("invalid status code %d", code)
+	}
+	if _, exists := statusText[status]; exists {
+		return fmt.Errorf("status code %d is already registered", code)
+	}
+	if !validReasonPhrase(text) {
+		return fmt.Errorf("invalid reason phrase %q for status code %d", text, code)
+	}
+
+	customStatusText.Store(status, text)
+	return nil
+}
+
+// validReasonPhrase reports whether text is a reason-phrase: HTAB, SP,
+// visible ASCII and obs-text (RFC 9110 Section 15.1)
+func validReasonPhrase(text string) bool {
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\t' && c != ' ' && (c < 0x21 || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// Text returns the reason phrase, or "" for an unknown code
+func (s Status) Text() string {
+	if text, exists := statusText[s]; exists {
+		return text
+	}
+	if text, exists := customStatusText.Load(s); exists {
+		return text.(string)
+	}
+	return ""
+}
+
+// String returns the code and reason phrase as used in a status line,
+// e.g. "404 Not Found". Unknown codes keep the space with an empty phrase.
+func (s Status) String() string {
+	return strconv.Itoa(int(s)) + " " + s.Text()
+}
+
+// Code returns the numeric status code
+func (s Status) Code() int {
+	return int(s)
+}
+
+// Valid reports whether the code is a three-digit status code
+func (s Status) Valid() bool {
+	return s >= 100 && s <= 999
+}
+
+// IsInformational reports whether the status is 1xx
+func (s Status) IsInformational() bool {
+	return s >= 100 && s < 200
+}
+
+// IsSuccess reports whether the status is 2xx
+func (s Status) IsSuccess() bool {
+	return s >= 200 && s < 300
+}
+
+// IsRedirect reports whether the status is 3xx
+func (s Status) IsRedirect() bool {
+	return s >= 300 && s < 400
+}
+
+// IsClientError reports whether the status is 4xx
+func (s Status) IsClientError() bool {
+	return s >= 400 && s < 500
+}
+
+// IsServerError reports whether the status is 5xx
+func (s Status) IsServerError() bool {
+	return s >= 500 && s < 600
+}
+
+// IsError reports whether the status is 4xx or 5xx
+func (s Status) IsError() bool {
+	return s >= 400 && s < 600
+}
+
+// AllowsBody reports whether a response with this status may include a body
+func (s Status) AllowsBody() bool {
+	return !s.IsInformational() && s != StatusNoContent && s != StatusNotModified
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrNotUpgradable is returned by Upgrade when the connection cannot
+// switch protocols: the response is sent over an HTTP/2 or HTTP/3 stream,
+// or its header has already been written
+var ErrNotUpgradable = errors.New("connection cannot be upgraded")
+
+// ErrUpgraded is returned by writes after the connection has switched to
+// another protocol
+var ErrUpgraded = errors.New("connection upgraded to another protocol")
+
+// ErrNotHijackable is returned by Hijack for responses sent over an
+// HTTP/2 or HTTP/3 stream, which share their connection
+var ErrNotHijackable = errors.New("connection cannot be hijacked")
+
+// ErrHijacked is returned by writes after the connection was hijacked
+var ErrHijacked = errors.New("connection hijacked")
+
+// Upgrader hands over the connection of an HTTP/1 response, with a reader
+// holding any bytes the client sent after the request. hijacked says the
+// server must stop managing the connection altogether.
+type Upgrader func(hijacked bool) (net.Conn, *bufio.Reader)
+
+// SetUpgrader lets handlers take over the response's connection with
+// Upgrade or Hijack. The server sets it on HTTP/1 connections.
+func (w *ResponseWriter) SetUpgrader(upgrader Upgrader) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.upgrader = upgrader
+}
+
+// Upgrade sends 101 Switching Protocols for protocol, along with any header
+// fields already set, and returns the connection to speak it on. Reads
+// through the returned ReadWriter see bytes the client sent after the
+// request. The handler owns the connection until it returns, when the
+// server closes it.
+func (w *ResponseWriter) Upgrade(protocol string) (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted {
+		return nil, nil, ErrAborted
+	}
+	if w.upgraded || w.hijacked || w.wroteHeader || w.upgrader == nil {
+		return nil, nil, ErrNotUpgradable
+	}
+
+	w.header.Set(HeaderConnection, "Upgrade")
+	w.header.Set(HeaderUpgrade, protocol)
+	w.writeHeader(StatusSwitchingProtocols)
+	w.closeAfter = true
+	w.upgraded = true
+	if err := w.writer.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("error writing upgrade response: %w", err)
+	}
+
+	conn, reader := w.upgrader(false)
+	return conn, bufio.NewReadWriter(reader, bufio.NewWriter(conn)), nil
+}
+
+// Hijack hands the connection to the handler, which from then on speaks
+// whatever it likes on it and must close it; the server neither writes a
+// response nor closes the connection, and Shutdown no longer waits for it.
+// Anything already written to the response is flushed first. Reads
+// through the returned ReadWriter see bytes the client sent after the
+// request.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.aborted {
+		return nil, nil, ErrAborted
+	}
+	if w.upgraded || w.hijacked || w.upgrader == nil {
+		return nil, nil, ErrNotHijackable
+	}
+
+	w.closeAfter = true
+	w.hijacked = true
+	if err := w.writer.Flush(); err != nil {
+		return nil, nil, fmt.Errorf("error flushing response: %w", err)
+	}
+
+	conn, reader := w.upgrader(true)
+	return conn, bufio.NewReadWriter(reader, bufio.NewWriter(conn)), nil
+}
+
+// Hijacked reports whether the handler has taken the connection with Hijack
+func (w *ResponseWriter) Hijacked() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.hijacked
+}
@@ -0,0 +1,344 @@
+package http2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// frameHeaderLen is the size of the header every frame starts with
+const frameHeaderLen = 9
+
+// FrameType identifies the kind of a frame
+type FrameType uint8
+
+// Frame types (RFC 9113 Section 6)
+const (
+	FrameData         FrameType = 0x0
+	FrameHeaders      FrameType = 0x1
+	FramePriority     FrameType = 0x2
+	FrameRSTStream    FrameType = 0x3
+	FrameSettings     FrameType = 0x4
+	FramePushPromise  FrameType = 0x5
+	FramePing         FrameType = 0x6
+	FrameGoAway       FrameType = 0x7
+	FrameWindowUpdate FrameType = 0x8
+	FrameContinuation FrameType = 0x9
+)
+
+var frameTypeNames = map[FrameType]string{
+	FrameData:         "DATA",
+	FrameHeaders:      "HEADERS",
+	FramePriority:     "PRIORITY",
+	FrameRSTStream:    "RST_STREAM",
+	FrameSettings:     "SETTINGS",
+	FramePushPromise:  "PUSH_PROMISE",
+	FramePing:         "PING",
+	FrameGoAway:       "GOAWAY",
+	FrameWindowUpdate: "WINDOW_UPDATE",
+	FrameContinuation: "CONTINUATION",
+}
+
+// String returns the type's name from the specification
+func (t FrameType) String() string {
+	if name, ok := frameTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_%d", uint8(t))
+}
+
+// Flags is the flags byte of a frame, whose meaning depends on the type
+type Flags uint8
+
+// Frame flags
+const (
+	FlagEndStream  Flags = 0x1
+	FlagAck        Flags = 0x1
+	FlagEndHeaders Flags = 0x4
+	FlagPadded     Flags = 0x8
+	FlagPriority   Flags = 0x20
+)
+
+// Has reports whether all of the given flags are set
+func (f Flags) Has(flag Flags) bool {
+	return f&flag == flag
+}
+
+// ErrCode is an error code carried by RST_STREAM and GOAWAY frames
+type ErrCode uint32
+
+// Error codes (RFC 9113 Section 7)
+const (
+	ErrCodeNo                 ErrCode = 0x0
+	ErrCodeProtocol           ErrCode = 0x1
+	ErrCodeInternal           ErrCode = 0x2
+	ErrCodeFlowControl        ErrCode = 0x3
+	ErrCodeSettingsTimeout    ErrCode = 0x4
+	ErrCodeStreamClosed       ErrCode = 0x5
+	ErrCodeFrameSize          ErrCode = 0x6
+	ErrCodeRefusedStream      ErrCode = 0x7
+	ErrCodeCancel             ErrCode = 0x8
+	ErrCodeCompression        ErrCode = 0x9
+	ErrCodeConnect            ErrCode = 0xa
+	ErrCodeEnhanceYourCalm    ErrCode = 0xb
+	ErrCodeInadequateSecurity ErrCode = 0xc
+	ErrCodeHTTP11Required     ErrCode = 0xd
+)
+
+var errCodeNames = map[ErrCode]string{
+	ErrCodeNo:                 "NO_ERROR",
+	ErrCodeProtocol:           "PROTOCOL_ERROR",
+	ErrCodeInternal:           "INTERNAL_ERROR",
+	ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	ErrCodeStreamClosed:       "STREAM_CLOSED",
+	ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	ErrCodeRefusedStream:      "REFUSED_STREAM",
+	ErrCodeCancel:             "CANCEL",
+	ErrCodeCompression:        "COMPRESSION_ERROR",
+	ErrCodeConnect:            "CONNECT_ERROR",
+	ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+// String returns the code's name from the specification
+func (c ErrCode) String() string {
+	if name, ok := errCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_ERROR_CODE_%d", uint32(c))
+}
+
+// ConnError is a connection error: the connection is ended with a GOAWAY
+// carrying Code
+type ConnError struct {
+	Code   ErrCode
+	Reason string
+}
+
+// Error implements the error interface
+func (e ConnError) Error() string {
+	return fmt.Sprintf("http2: connection error %s: %s", e.Code, e.Reason)
+}
+
+// StreamError is a stream error: only the stream is reset with Code
+type StreamError struct {
+	StreamID uint32
+	Code     ErrCode
+	Reason   string
+}
+
+// Error implements the error interface
+func (e StreamError) Error() string {
+	return fmt.Sprintf("http2: stream %d error %s: %s", e.StreamID, e.Code, e.Reason)
+}
+
+// SettingID identifies a setting in a SETTINGS frame
+type SettingID uint16
+
+// Settings (RFC 9113 Section 6.5.2)
+const (
+	SettingHeaderTableSize      SettingID = 0x1
+	SettingEnablePush           SettingID = 0x2
+	SettingMaxConcurrentStreams SettingID = 0x3
+	SettingInitialWindowSize    SettingID = 0x4
+	SettingMaxFrameSize         SettingID = 0x5
+	SettingMaxHeaderListSize    SettingID = 0x6
+)
+
+// Setting is a single setting and its value
+type Setting struct {
+	ID    SettingID
+	Value uint32
+}
+
+// Protocol limits
+const (
+	// defaultMaxFrameSize is the largest frame payload either side may
+	// send until told otherwise
+	defaultMaxFrameSize = 1 << 14
+
+	// maxAllowedFrameSize is the largest value of SETTINGS_MAX_FRAME_SIZE
+	maxAllowedFrameSize = 1<<24 - 1
+
+	// defaultWindowSize is the initial flow-control window
+	defaultWindowSize = 65535
+
+	// maxWindowSize is the largest flow-control window
+	maxWindowSize = 1<<31 - 1
+)
+
+// Frame is a frame as read from the connection. Payload is only valid
+// until the next frame is read.
+type Frame struct {
+	Type     FrameType
+	Flags    Flags
+	StreamID uint32
+	Payload  []byte
+}
+
+// framer reads and writes frames on a connection
+type framer struct {
+	r io.Reader
+	w io.Writer
+
+	// maxReadSize is the largest payload accepted, as advertised in our
+	// SETTINGS_MAX_FRAME_SIZE
+	maxReadSize uint32
+
+	header  [frameHeaderLen]byte
+	readBuf []byte
+	wbuf    []byte
+}
+
+// newFramer returns a framer reading from r and writing to w
+func newFramer(r io.Reader, w io.Writer) *framer {
+	return &framer{r: r, w: w, maxReadSize: defaultMaxFrameSize}
+}
+
+// ReadFrame reads the next frame. A frame larger than maxReadSize is a
+// connection error of type FRAME_SIZE_ERROR.
+func (fr *framer) ReadFrame() (*Frame, error) {
+	if _, err := io.ReadFull(fr.r, fr.header[:]); err != nil {
+		return nil, err
+	}
+
+	length := uint32(fr.header[0])<<16 | uint32(fr.header[1])<<8 | uint32(fr.header[2])
+	f := &Frame{
+		Type:     FrameType(fr.header[3]),
+		Flags:    Flags(fr.header[4]),
+		StreamID: binary.BigEndian.Uint32(fr.header[5:]) & (1<<31 - 1),
+	}
+
+	if length > fr.maxReadSize {
+		return nil, ConnError{Code: ErrCodeFrameSize, Reason: fmt.Sprintf("%s frame of %d bytes exceeds limit", f.Type, length)}
+	}
+
+	if uint32(cap(fr.readBuf)) < length {
+		fr.readBuf = make([]byte, length)
+	}
+	f.Payload = fr.readBuf[:length]
+	if _, err := io.ReadFull(fr.r, f.Payload); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// writeFrame writes a frame with the given payload
+func (fr *framer) writeFrame(t FrameType, flags Flags, streamID uint32, payload []byte) error {
+	fr.wbuf = append(fr.wbuf[:0],
+		byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)),
+		byte(t), byte(flags),
+		byte(streamID>>24), byte(streamID>>16), byte(streamID>>8), byte(streamID))
+	fr.wbuf = append(fr.wbuf, payload...)
+
+	_, err := fr.w.Write(fr.wbuf)
+	return err
+}
+
+// WriteSettings writes a SETTINGS frame
+func (fr *framer) WriteSettings(settings ...Setting) error {
+	payload := make([]byte, 0, 6*len(settings))
+	for _, s := range settings {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(s.ID))
+		payload = binary.BigEndian.AppendUint32(payload, s.Value)
+	}
+	return fr.writeFrame(FrameSettings, 0, 0, payload)
+}
+
+// WriteSettingsAck acknowledges the peer's SETTINGS
+func (fr *framer) WriteSettingsAck() error {
+	return fr.writeFrame(FrameSettings, FlagAck, 0, nil)
+}
+
+// WritePing writes a PING frame
+func (fr *framer) WritePing(ack bool, data [8]byte) error {
+	var flags Flags
+	if ack {
+		flags = FlagAck
+	}
+	return fr.writeFrame(FramePing, flags, 0, data[:])
+}
+
+// WriteGoAway writes a GOAWAY frame
+func (fr *framer) WriteGoAway(lastStreamID uint32, code ErrCode, debug []byte) error {
+	payload := make([]byte, 8, 8+len(debug))
+	binary.BigEndian.PutUint32(payload, lastStreamID&(1<<31-1))
+	binary.BigEndian.PutUint32(payload[4:], uint32(code))
+	payload = append(payload, debug...)
+	return fr.writeFrame(FrameGoAway, 0, 0, payload)
+}
+
+// WriteRSTStream writes a RST_STREAM frame
+func (fr *framer) WriteRSTStream(streamID uint32, code ErrCode) error {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], uint32(code))
+	return fr.writeFrame(FrameRSTStream, 0, streamID, payload[:])
+}
+
+// WriteWindowUpdate writes a WINDOW_UPDATE frame
+func (fr *framer) WriteWindowUpdate(streamID, increment uint32) error {
+	var payload [4]byte
+	binary.BigEndian.PutUint32(payload[:], increment&(1<<31-1))
+	return fr.writeFrame(FrameWindowUpdate, 0, streamID, payload[:])
+}
+
+// WriteData writes a DATA frame
+func (fr *framer) WriteData(streamID uint32, endStream bool, data []byte) error {
+	var flags Flags
+	if endStream {
+		flags = FlagEndStream
+	}
+	return fr.writeFrame(FrameData, flags, streamID, data)
+}
+
+// WriteHeaders writes a header block as a HEADERS frame followed by as
+// many CONTINUATION frames as needed to stay within maxFrameSize
+func (fr *framer) WriteHeaders(streamID uint32, endStream bool, block []byte, maxFrameSize uint32) error {
+	var flags Flags
+	if endStream {
+		flags = FlagEndStream
+	}
+
+	frameType := FrameHeaders
+	for {
+		chunk := block
+		if uint32(len(chunk)) > maxFrameSize {
+			chunk = chunk[:maxFrameSize]
+		}
+		block = block[len(chunk):]
+
+		if len(block) == 0 {
+			flags |= FlagEndHeaders
+		}
+		if err := fr.writeFrame(frameType, flags, streamID, chunk); err != nil {
+			return err
+		}
+		if len(block) == 0 {
+			return nil
+		}
+
+		frameType = FrameContinuation
+		flags = 0
+	}
+}
+
+// stripPadding strips the padding from a DATA or HEADERS payload
+func stripPadding(f *Frame) ([]byte, error) {
+	payload := f.Payload
+	if !f.Flags.Has(FlagPadded) {
+		return payload, nil
+	}
+
+	if len(payload) == 0 {
+		return nil, ConnError{Code: ErrCodeProtocol, Reason: fmt.Sprintf("padded %s frame without pad length", f.Type)}
+	}
+	padLength := int(payload[0])
+	payload = payload[1:]
+	if padLength > len(payload) {
+		return nil, ConnError{Code: ErrCodeProtocol, Reason: fmt.Sprintf("%s frame padding exceeds payload", f.Type)}
+	}
+	return payload[:len(payload)-padLength], nil
+}
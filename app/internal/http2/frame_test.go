@@ -0,0 +1,150 @@
+package http2
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	fr := newFramer(&buf, &buf)
+
+	if err := fr.WriteData(3, true, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.WriteWindowUpdate(5, 1<<31|100); err != nil {
+		t.Fatal(err)
+	}
+	if err := fr.WriteRSTStream(7, ErrCodeCancel); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameData || f.Flags != FlagEndStream || f.StreamID != 3 || string(f.Payload) != "hello" {
+		t.Errorf("DATA frame = %+v", f)
+	}
+
+	// The reserved bit is cleared when writing
+	f, err = fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameWindowUpdate || f.StreamID != 5 || !bytes.Equal(f.Payload, []byte{0, 0, 0, 100}) {
+		t.Errorf("WINDOW_UPDATE frame = %+v", f)
+	}
+
+	f, err = fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Type != FrameRSTStream || f.StreamID != 7 || !bytes.Equal(f.Payload, []byte{0, 0, 0, 8}) {
+		t.Errorf("RST_STREAM frame = %+v", f)
+	}
+}
+
+func TestReadFrameReservedBit(t *testing.T) {
+	fr := newFramer(bytes.NewReader([]byte{0, 0, 0, byte(FramePing), 0, 0x80, 0, 0, 1}), nil)
+	f, err := fr.ReadFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.StreamID != 1 {
+		t.Errorf("StreamID = %d, want the reserved bit ignored", f.StreamID)
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	header := []byte{0, 0x40, 1, byte(FrameData), 0, 0, 0, 0, 1}
+	fr := newFramer(bytes.NewReader(header), nil)
+
+	_, err := fr.ReadFrame()
+	var ce ConnError
+	if !errors.As(err, &ce) || ce.Code != ErrCodeFrameSize {
+		t.Errorf("ReadFrame error = %v, want FRAME_SIZE_ERROR", err)
+	}
+}
+
+func TestWriteHeadersContinuation(t *testing.T) {
+	var buf bytes.Buffer
+	fr := newFramer(&buf, &buf)
+
+	block := bytes.Repeat([]byte("x"), 25)
+	if err := fr.WriteHeaders(1, true, block, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		typ   FrameType
+		flags Flags
+		size  int
+	}{
+		{FrameHeaders, FlagEndStream, 10},
+		{FrameContinuation, 0, 10},
+		{FrameContinuation, FlagEndHeaders, 5},
+	}
+	for i, w := range want {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type != w.typ || f.Flags != w.flags || len(f.Payload) != w.size || f.StreamID != 1 {
+			t.Errorf("frame %d = %s flags %#x %d bytes, want %s flags %#x %d bytes",
+				i, f.Type, f.Flags, len(f.Payload), w.typ, w.flags, w.size)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("%d bytes left over", buf.Len())
+	}
+}
+
+func TestStripPadding(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   Flags
+		payload string
+		want    string
+		err     bool
+	}{
+		{"unpadded", 0, "data", "data", false},
+		{"padded", FlagPadded, "\x03data\x00\x00\x00", "data", false},
+		{"no padding", FlagPadded, "\x00data", "data", false},
+		{"all padding", FlagPadded, "\x02\x00\x00", "", false},
+		{"missing pad length", FlagPadded, "", "", true},
+		{"padding exceeds payload", FlagPadded, "\x05data", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Frame{Type: FrameData, Flags: tt.flags, Payload: []byte(tt.payload)}
+			got, err := stripPadding(f)
+			if tt.err {
+				var ce ConnError
+				if !errors.As(err, &ce) || ce.Code != ErrCodeProtocol {
+					t.Errorf("error = %v, want PROTOCOL_ERROR", err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Errorf("stripPadding = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	if got := FrameWindowUpdate.String(); got != "WINDOW_UPDATE" {
+		t.Errorf("FrameWindowUpdate = %q", got)
+	}
+	if got := FrameType(0x42).String(); got != "UNKNOWN_FRAME_TYPE_66" {
+		t.Errorf("unknown frame type = %q", got)
+	}
+	if got := ErrCodeFlowControl.String(); got != "FLOW_CONTROL_ERROR" {
+		t.Errorf("ErrCodeFlowControl = %q", got)
+	}
+	if got := ErrCode(0x42).String(); got != "UNKNOWN_ERROR_CODE_66" {
+		t.Errorf("unknown error code = %q", got)
+	}
+}
@@ -0,0 +1,400 @@
+// Package hpack implements HPACK, the header compression of HTTP/2
+// (RFC 7541).
+package hpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultTableSize is the dynamic table size both sides start with
+const DefaultTableSize = 4096
+
+// entryOverhead is added to every entry's size (RFC 7541 Section 4.1)
+const entryOverhead = 32
+
+// Errors returned while decoding a header block. Any of them is a
+// connection error of type COMPRESSION_ERROR.
+var (
+	ErrIntegerOverflow  = errors.New("hpack: integer overflow")
+	ErrTruncated        = errors.New("hpack: truncated header block")
+	ErrInvalidIndex     = errors.New("hpack: invalid table index")
+	ErrTableSizeUpdate  = errors.New("hpack: invalid dynamic table size update")
+	ErrHeaderListTooBig = errors.New("hpack: header list too large")
+)
+
+// HeaderField is a single name-value pair. Sensitive fields are never
+// added to a dynamic table, by this encoder or by intermediaries.
+type HeaderField struct {
+	Name      string
+	Value     string
+	Sensitive bool
+}
+
+// Size returns the size of the field as an entry in a dynamic table
+func (f HeaderField) Size() uint32 {
+	return uint32(len(f.Name) + len(f.Value) + entryOverhead)
+}
+
+// dynamicTable is the table of recently used fields. Entries are appended,
+// so the newest entry, index 62, is the last one.
+type dynamicTable struct {
+	entries []HeaderField
+	size    uint32
+	maxSize uint32
+}
+
+// add inserts a field, evicting the oldest entries to make room. A field
+// larger than the table empties it.
+func (t *dynamicTable) add(f HeaderField) {
+	t.entries = append(t.entries, f)
+	t.size += f.Size()
+	t.evict()
+}
+
+// setMaxSize changes the table size, evicting entries that no longer fit
+func (t *dynamicTable) setMaxSize(size uint32) {
+	t.maxSize = size
+	t.evict()
+}
+
+// evict drops the oldest entries until the table fits its size
+func (t *dynamicTable) evict() {
+	n := 0
+	for t.size > t.maxSize && n < len(t.entries) {
+		t.size -= t.entries[n].Size()
+		n++
+	}
+	if n > 0 {
+		t.entries = append(t.entries[:0], t.entries[n:]...)
+	}
+}
+
+// field returns the entry at an HPACK index, counting the static table first
+func (t *dynamicTable) field(index uint64) (HeaderField, bool) {
+	if index == 0 {
+		return HeaderField{}, false
+	}
+	if index <= uint64(len(staticTable)) {
+		return staticTable[index-1], true
+	}
+
+	offset := index - uint64(len(staticTable))
+	if offset > uint64(len(t.entries)) {
+		return HeaderField{}, false
+	}
+	return t.entries[uint64(len(t.entries))-offset], true
+}
+
+// search returns the index of an entry matching f exactly, or failing that
+// one with the same name, and whether the match was exact. Zero means no
+// entry has the name.
+func (t *dynamicTable) search(f HeaderField) (index uint64, exact bool) {
+	for i, entry := range staticTable {
+		if entry.Name != f.Name {
+			continue
+		}
+		if entry.Value == f.Value {
+			return uint64(i + 1), true
+		}
+		if index == 0 {
+			index = uint64(i + 1)
+		}
+	}
+
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		entry := t.entries[i]
+		if entry.Name != f.Name {
+			continue
+		}
+		dynIndex := uint64(len(staticTable) + len(t.entries) - i)
+		if entry.Value == f.Value {
+			return dynIndex, true
+		}
+		if index == 0 {
+			index = dynIndex
+		}
+	}
+
+	return index, false
+}
+
+// Decoder decodes header blocks from one peer. It keeps the peer's dynamic
+// table, so every block on a connection must go through the same Decoder
+// in order.
+type Decoder struct {
+	table dynamicTable
+
+	// maxTableSize is the limit advertised to the peer
+	maxTableSize uint32
+
+	// MaxHeaderListSize limits the decoded size of a header block, as
+	// counted by HeaderField.Size; zero means no limit
+	MaxHeaderListSize uint32
+}
+
+// NewDecoder returns a decoder whose peer may use a dynamic table of up to
+// maxTableSize bytes
+func NewDecoder(maxTableSize uint32) *Decoder {
+	return &Decoder{
+		table:        dynamicTable{maxSize: maxTableSize},
+		maxTableSize: maxTableSize,
+	}
+}
+
+// Decode decodes a complete header block
+func (d *Decoder) Decode(block []byte) ([]HeaderField, error) {
+	var fields []HeaderField
+	var listSize uint32
+
+	for len(block) > 0 {
+		b := block[0]
+
+		var field HeaderField
+		var err error
+		switch {
+		case b&0x80 != 0:
+			// Indexed field
+			var index uint64
+			index, block, err = readInt(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			var ok bool
+			if field, ok = d.table.field(index); !ok {
+				return nil, ErrInvalidIndex
+			}
+			field.Sensitive = false
+
+		case b&0xc0 == 0x40:
+			// Literal with incremental indexing
+			field, block, err = d.readLiteral(block, 6)
+			if err != nil {
+				return nil, err
+			}
+			d.table.add(field)
+
+		case b&0xe0 == 0x20:
+			// Dynamic table size update, only allowed before any field
+			if len(fields) > 0 {
+				return nil, ErrTableSizeUpdate
+			}
+			var size uint64
+			size, block, err = readInt(block, 5)
+			if err != nil {
+				return nil, err
+			}
+			if size > uint64(d.maxTableSize) {
+				return nil, ErrTableSizeUpdate
+			}
+			d.table.setMaxSize(uint32(size))
+			continue
+
+		default:
+			// Literal without indexing (0000) or never indexed (0001)
+			field, block, err = d.readLiteral(block, 4)
+			if err != nil {
+				return nil, err
+			}
+			field.Sensitive = b&0x10 != 0
+		}
+
+		listSize += field.Size()
+		if d.MaxHeaderListSize > 0 && listSize > d.MaxHeaderListSize {
+			return nil, ErrHeaderListTooBig
+		}
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// readLiteral reads a literal field whose name index has the given prefix
+func (d *Decoder) readLiteral(block []byte, prefix uint8) (HeaderField, []byte, error) {
+	nameIndex, block, err := readInt(block, prefix)
+	if err != nil {
+		return HeaderField{}, nil, err
+	}
+
+	var field HeaderField
+	if nameIndex > 0 {
+		indexed, ok := d.table.field(nameIndex)
+		if !ok {
+			return HeaderField{}, nil, ErrInvalidIndex
+		}
+		field.Name = indexed.Name
+	} else {
+		field.Name, block, err = readString(block)
+		if err != nil {
+			return HeaderField{}, nil, err
+		}
+	}
+
+	field.Value, block, err = readString(block)
+	if err != nil {
+		return HeaderField{}, nil, err
+	}
+
+	return field, block, nil
+}
+
+// readInt reads an integer with an N-bit prefix (RFC 7541 Section 5.1)
+func readInt(block []byte, prefix uint8) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, ErrTruncated
+	}
+
+	mask := uint64(1)<<prefix - 1
+	value := uint64(block[0]) & mask
+	block = block[1:]
+	if value < mask {
+		return value, block, nil
+	}
+
+	shift := uint(0)
+	for {
+		if len(block) == 0 {
+			return 0, nil, ErrTruncated
+		}
+		b := block[0]
+		block = block[1:]
+
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, block, nil
+		}
+
+		shift += 7
+		if shift > 56 {
+			return 0, nil, ErrIntegerOverflow
+		}
+	}
+}
+
+// readString reads a string literal, Huffman-coded or not
+func readString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, ErrTruncated
+	}
+	huffman := block[0]&0x80 != 0
+
+	length, block, err := readInt(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(block)) {
+		return "", nil, ErrTruncated
+	}
+
+	data := block[:length]
+	block = block[length:]
+
+	if !huffman {
+		return string(data), block, nil
+	}
+	s, err := HuffmanDecode(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return s, block, nil
+}
+
+// Encoder encodes header blocks for one peer, keeping the dynamic table
+// the peer's decoder mirrors
+type Encoder struct {
+	table dynamicTable
+
+	// pendingSize is a table size change to announce in the next block
+	pendingSize bool
+}
+
+// NewEncoder returns an encoder using a dynamic table of the default size
+func NewEncoder() *Encoder {
+	return &Encoder{table: dynamicTable{maxSize: DefaultTableSize}}
+}
+
+// SetMaxTableSize applies the table size the peer allows, capped at the
+// default so memory use stays bounded
+func (e *Encoder) SetMaxTableSize(size uint32) {
+	if size > DefaultTableSize {
+		size = DefaultTableSize
+	}
+	if size == e.table.maxSize {
+		return
+	}
+
+	e.table.setMaxSize(size)
+	e.pendingSize = true
+}
+
+// Encode appends a header block for fields to dst
+func (e *Encoder) Encode(dst []byte, fields []HeaderField) []byte {
+	if e.pendingSize {
+		dst = appendInt(dst, 0x20, 5, uint64(e.table.maxSize))
+		e.pendingSize = false
+	}
+
+	for _, f := range fields {
+		index, exact := e.table.search(f)
+		switch {
+		case exact && !f.Sensitive:
+			dst = appendInt(dst, 0x80, 7, index)
+
+		case f.Sensitive:
+			dst = e.appendLiteral(dst, 0x10, 4, index, f)
+
+		case f.Size() <= e.table.maxSize:
+			dst = e.appendLiteral(dst, 0x40, 6, index, f)
+			e.table.add(f)
+
+		default:
+			dst = e.appendLiteral(dst, 0x00, 4, index, f)
+		}
+	}
+
+	return dst
+}
+
+// appendLiteral appends a literal field with the given representation
+func (e *Encoder) appendLiteral(dst []byte, pattern byte, prefix uint8, nameIndex uint64, f HeaderField) []byte {
+	dst = appendInt(dst, pattern, prefix, nameIndex)
+	if nameIndex == 0 {
+		dst = appendString(dst, f.Name)
+	}
+	return appendString(dst, f.Value)
+}
+
+// appendInt appends an integer with an N-bit prefix after pattern
+func appendInt(dst []byte, pattern byte, prefix uint8, value uint64) []byte {
+	mask := uint64(1)<<prefix - 1
+	if value < mask {
+		return append(dst, pattern|byte(value))
+	}
+
+	dst = append(dst, pattern|byte(mask))
+	value -= mask
+	for value >= 0x80 {
+		dst = append(dst, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+	return append(dst, byte(value))
+}
+
+// appendString appends a string literal, Huffman-coded if that is shorter
+func appendString(dst []byte, s string) []byte {
+	if n := HuffmanEncodedLen(s); n < len(s) {
+		dst = appendInt(dst, 0x80, 7, uint64(n))
+		return AppendHuffman(dst, s)
+	}
+
+	dst = appendInt(dst, 0x00, 7, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// String describes a field for logs, hiding sensitive values
+func (f HeaderField) String() string {
+	if f.Sensitive {
+		return fmt.Sprintf("%s: <sensitive>", f.Name)
+	}
+	return fmt.Sprintf("%s: %s", f.Name, f.Value)
+}
@@ -0,0 +1,383 @@
+package hpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// block is one header block of an RFC 7541 Appendix C example, with the
+// dynamic table size expected after it
+type block struct {
+	hex       string
+	fields    []HeaderField
+	tableSize uint32
+}
+
+func fields(pairs ...string) []HeaderField {
+	var fs []HeaderField
+	for i := 0; i < len(pairs); i += 2 {
+		fs = append(fs, HeaderField{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return fs
+}
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// Requests of Appendix C.3 (plain) and C.4 (Huffman-coded)
+var (
+	requests = []block{
+		{
+			"8286 8441 0f77 7777 2e65 7861 6d70 6c65 2e63 6f6d",
+			fields(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com"),
+			57,
+		},
+		{
+			"8286 84be 5808 6e6f 2d63 6163 6865",
+			fields(":method", "GET", ":scheme", "http", ":path", "/", ":authority", "www.example.com",
+				"cache-control", "no-cache"),
+			110,
+		},
+		{
+			"8287 85bf 400a 6375 7374 6f6d 2d6b 6579 0c63 7573 746f 6d2d 7661 6c75 65",
+			fields(":method", "GET", ":scheme", "https", ":path", "/index.html", ":authority", "www.example.com",
+				"custom-key", "custom-value"),
+			164,
+		},
+	}
+
+	huffmanRequests = []block{
+		{"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff", requests[0].fields, 57},
+		{"8286 84be 5886 a8eb 1064 9cbf", requests[1].fields, 110},
+		{"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf", requests[2].fields, 164},
+	}
+)
+
+// Responses of Appendix C.5 (plain) and C.6 (Huffman-coded), with a
+// dynamic table of 256 bytes
+var (
+	responses = []block{
+		{
+			"4803 3330 3258 0770 7269 7661 7465 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 " +
+				"2032 303a 3133 3a32 3120 474d 546e 1768 7474 7073 3a2f 2f77 7777 2e65 7861 6d70 " +
+				"6c65 2e63 6f6d",
+			fields(":status", "302", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:21 GMT",
+				"location", "https://www.example.com"),
+			222,
+		},
+		{
+			"4803 3330 37c1 c0bf",
+			fields(":status", "307", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:21 GMT",
+				"location", "https://www.example.com"),
+			222,
+		},
+		{
+			"88c1 611d 4d6f 6e2c 2032 3120 4f63 7420 3230 3133 2032 303a 3133 3a32 3220 474d " +
+				"54c0 5a04 677a 6970 7738 666f 6f3d 4153 444a 4b48 514b 425a 584f 5157 454f 5049 " +
+				"5541 5851 5745 4f49 553b 206d 6178 2d61 6765 3d33 3630 303b 2076 6572 7369 6f6e " +
+				"3d31",
+			fields(":status", "200", "cache-control", "private", "date", "Mon, 21 Oct 2013 20:13:22 GMT",
+				"location", "https://www.example.com", "content-encoding", "gzip",
+				"set-cookie", "foo=ASDJKHQKBZXOQWEOPIUAXQWEOIU; max-age=3600; version=1"),
+			215,
+		},
+	}
+
+	huffmanResponses = []block{
+		{
+			"4882 6402 5885 aec3 771a 4b61 96d0 7abe 9410 54d4 44a8 2005 9504 0b81 66e0 82a6 " +
+				"2d1b ff6e 919d 29ad 1718 63c7 8f0b 97c8 e9ae 82ae 43d3",
+			responses[0].fields, 222,
+		},
+		{"4883 640e ffc1 c0bf", responses[1].fields, 222},
+		{
+			"88c1 6196 d07a be94 1054 d444 a820 0595 040b 8166 e084 a62d 1bff c05a 839b d9ab " +
+				"77ad 94e7 821d d7f2 e6c7 b335 dfdf cd5b 3960 d5af 2708 7f36 72c1 ab27 0fb5 291f " +
+				"9587 3160 65c0 03ed 4ee5 b106 3d50 07",
+			responses[2].fields, 215,
+		},
+	}
+)
+
+func TestDecodeExamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableSize uint32
+		blocks    []block
+	}{
+		{"C.3 requests", DefaultTableSize, requests},
+		{"C.4 requests with Huffman", DefaultTableSize, huffmanRequests},
+		{"C.5 responses", 256, responses},
+		{"C.6 responses with Huffman", 256, huffmanResponses},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(tt.tableSize)
+			for i, b := range tt.blocks {
+				got, err := d.Decode(unhex(t, b.hex))
+				if err != nil {
+					t.Fatalf("block %d: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, b.fields) {
+					t.Errorf("block %d = %v, want %v", i, got, b.fields)
+				}
+				if d.table.size != b.tableSize {
+					t.Errorf("block %d: table size %d, want %d", i, d.table.size, b.tableSize)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeExamples(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableSize uint32
+		blocks    []block
+	}{
+		{"C.4 requests with Huffman", DefaultTableSize, huffmanRequests},
+		{"C.6 responses with Huffman", 256, []block{
+			huffmanResponses[0],
+			// "307" is no shorter Huffman-coded, so it is sent as it is
+			{"4803 3330 37c1 c0bf", responses[1].fields, 222},
+			huffmanResponses[2],
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The examples assume both sides start with this table size,
+			// so no size update is announced
+			e := &Encoder{table: dynamicTable{maxSize: tt.tableSize}}
+			for i, b := range tt.blocks {
+				got := e.Encode(nil, b.fields)
+				if want := unhex(t, b.hex); !bytes.Equal(got, want) {
+					t.Errorf("block %d = %x, want %x", i, got, want)
+				}
+				if e.table.size != b.tableSize {
+					t.Errorf("block %d: table size %d, want %d", i, e.table.size, b.tableSize)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFieldRepresentations(t *testing.T) {
+	// Appendix C.2
+	tests := []struct {
+		name      string
+		hex       string
+		field     HeaderField
+		tableSize uint32
+	}{
+		{
+			"literal with indexing",
+			"400a 6375 7374 6f6d 2d6b 6579 0d63 7573 746f 6d2d 6865 6164 6572",
+			HeaderField{Name: "custom-key", Value: "custom-header"},
+			55,
+		},
+		{
+			"literal without indexing",
+			"040c 2f73 616d 706c 652f 7061 7468",
+			HeaderField{Name: ":path", Value: "/sample/path"},
+			0,
+		},
+		{
+			"literal never indexed",
+			"1008 7061 7373 776f 7264 0673 6563 7265 74",
+			HeaderField{Name: "password", Value: "secret", Sensitive: true},
+			0,
+		},
+		{
+			"indexed",
+			"82",
+			HeaderField{Name: ":method", Value: "GET"},
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDecoder(DefaultTableSize)
+			got, err := d.Decode(unhex(t, tt.hex))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 || got[0] != tt.field {
+				t.Errorf("Decode = %v, want %v", got, tt.field)
+			}
+			if d.table.size != tt.tableSize {
+				t.Errorf("table size %d, want %d", d.table.size, tt.tableSize)
+			}
+		})
+	}
+}
+
+func TestEncodeSensitive(t *testing.T) {
+	e := NewEncoder()
+	f := HeaderField{Name: "password", Value: "secret", Sensitive: true}
+	got := e.Encode(nil, []HeaderField{f, f})
+	if len(e.table.entries) != 0 {
+		t.Errorf("sensitive field added to the dynamic table")
+	}
+
+	d := NewDecoder(DefaultTableSize)
+	decoded, err := d.Decode(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[0] != f || decoded[1] != f {
+		t.Errorf("Decode = %v, want the field twice, never indexed", decoded)
+	}
+}
+
+func TestTableSizeUpdate(t *testing.T) {
+	e := NewEncoder()
+	d := NewDecoder(DefaultTableSize)
+
+	first := e.Encode(nil, fields("custom-key", "custom-value"))
+	if _, err := d.Decode(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shrinking the table is announced and evicts the entry on both sides
+	e.SetMaxTableSize(0)
+	second := e.Encode(nil, fields("custom-key", "custom-value"))
+	if second[0] != 0x20 {
+		t.Errorf("block starts with %#x, want a size update to 0", second[0])
+	}
+	got, err := d.Decode(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields("custom-key", "custom-value")) {
+		t.Errorf("Decode = %v", got)
+	}
+	if d.table.size != 0 || e.table.size != 0 {
+		t.Errorf("table sizes %d and %d, want 0", d.table.size, e.table.size)
+	}
+
+	// The encoder never uses more than the default, whatever is allowed
+	e.SetMaxTableSize(1 << 20)
+	if e.table.maxSize != DefaultTableSize {
+		t.Errorf("maxSize = %d, want %d", e.table.maxSize, DefaultTableSize)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	d := NewDecoder(100)
+	// Each entry is 32 + 10 + 11 = 53 bytes, so only one fits
+	for _, value := range []string{"value-00001", "value-00002"} {
+		block := append([]byte{0x40, 10}, "custom-key"...)
+		block = append(block, byte(len(value)))
+		block = append(block, value...)
+		if _, err := d.Decode(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(d.table.entries) != 1 || d.table.entries[0].Value != "value-00002" {
+		t.Errorf("entries = %v, want only the newest", d.table.entries)
+	}
+
+	got, err := d.Decode([]byte{0xbe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Value != "value-00002" {
+		t.Errorf("index 62 = %v", got[0])
+	}
+	if _, err := d.Decode([]byte{0xbf}); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("index 63 error = %v, want ErrInvalidIndex", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want error
+	}{
+		{"index zero", "80", ErrInvalidIndex},
+		{"index past the tables", "ff00", ErrInvalidIndex},
+		{"literal name index past the tables", "7f00 0161", ErrInvalidIndex},
+		{"truncated integer", "ff", ErrTruncated},
+		{"truncated string", "400a 6375 7374", ErrTruncated},
+		{"missing value", "4001 61", ErrTruncated},
+		{"integer overflow", "ff ffff ffff ffff ffff ffff 01", ErrIntegerOverflow},
+		{"size update after a field", "82 20", ErrTableSizeUpdate},
+		{"size update above the limit", "3fe2 1f", ErrTableSizeUpdate},
+		{"huffman padding not ones", "4081 0001 61", ErrInvalidHuffman},
+		{"huffman padding too long", "4082 ffff 0161", ErrInvalidHuffman},
+		{"huffman eos", "4084 ffff ffff 0161", ErrInvalidHuffman},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDecoder(DefaultTableSize).Decode(unhex(t, tt.hex))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxHeaderListSize(t *testing.T) {
+	d := NewDecoder(DefaultTableSize)
+	d.MaxHeaderListSize = 100
+	// :method GET and :scheme http are 42 and 43 bytes
+	if _, err := d.Decode([]byte{0x82, 0x86}); err != nil {
+		t.Errorf("85 bytes: %v", err)
+	}
+	if _, err := d.Decode([]byte{0x82, 0x86, 0x84}); !errors.Is(err, ErrHeaderListTooBig) {
+		t.Errorf("123 bytes: error = %v, want ErrHeaderListTooBig", err)
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	// Appendix C.1
+	tests := []struct {
+		value  uint64
+		prefix uint8
+		hex    string
+	}{
+		{10, 5, "0a"},
+		{1337, 5, "1f9a0a"},
+		{42, 8, "2a"},
+		{31, 5, "1f00"},
+		{127, 7, "7f00"},
+	}
+	for _, tt := range tests {
+		got := appendInt(nil, 0, tt.prefix, tt.value)
+		if want := unhex(t, tt.hex); !bytes.Equal(got, want) {
+			t.Errorf("appendInt(%d, %d) = %x, want %x", tt.value, tt.prefix, got, want)
+		}
+		value, rest, err := readInt(got, tt.prefix)
+		if err != nil || value != tt.value || len(rest) != 0 {
+			t.Errorf("readInt(%x, %d) = %d, %x, %v", got, tt.prefix, value, rest, err)
+		}
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	var all strings.Builder
+	for c := 0; c < 256; c++ {
+		all.WriteByte(byte(c))
+	}
+	for _, s := range []string{"", "a", "www.example.com", "no-cache", all.String()} {
+		encoded := AppendHuffman(nil, s)
+		if len(encoded) != HuffmanEncodedLen(s) {
+			t.Errorf("%q: encoded %d bytes, HuffmanEncodedLen %d", s, len(encoded), HuffmanEncodedLen(s))
+		}
+		decoded, err := HuffmanDecode(encoded)
+		if err != nil || decoded != s {
+			t.Errorf("%q: decoded %q, %v", s, decoded, err)
+		}
+	}
+}
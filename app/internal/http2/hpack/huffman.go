@@ -0,0 +1,125 @@
+package hpack
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrInvalidHuffman is returned for Huffman-coded strings that do not
+// decode, including ones with bad padding or an EOS symbol
+var ErrInvalidHuffman = errors.New("hpack: invalid Huffman-coded data")
+
+// eosSymbol is the end-of-string symbol, which never appears in a string
+const eosSymbol = 256
+
+// huffmanCode is the code for one symbol, in the low length bits of code
+type huffmanCode struct {
+	code   uint32
+	length uint8
+}
+
+// huffmanNode is a node of the decoding tree. Leaves have no children and
+// hold a symbol.
+type huffmanNode struct {
+	children [2]*huffmanNode
+	symbol   int
+}
+
+var (
+	huffmanRoot     *huffmanNode
+	huffmanRootOnce sync.Once
+)
+
+// huffmanTree returns the decoding tree, building it on first use
+func huffmanTree() *huffmanNode {
+	huffmanRootOnce.Do(func() {
+		huffmanRoot = &huffmanNode{}
+		for symbol, hc := range huffmanCodes {
+			node := huffmanRoot
+			for i := int(hc.length) - 1; i >= 0; i-- {
+				bit := (hc.code >> uint(i)) & 1
+				if node.children[bit] == nil {
+					node.children[bit] = &huffmanNode{}
+				}
+				node = node.children[bit]
+			}
+			node.symbol = symbol
+		}
+	})
+	return huffmanRoot
+}
+
+// HuffmanDecode decodes a Huffman-coded string
+func HuffmanDecode(data []byte) (string, error) {
+	root := huffmanTree()
+	out := make([]byte, 0, len(data)*8/5)
+
+	node := root
+	// Bits read since the last symbol, and whether they were all ones
+	pending := 0
+	allOnes := true
+
+	for _, b := range data {
+		for i := 7; i >= 0; i-- {
+			bit := (b >> uint(i)) & 1
+			node = node.children[bit]
+			if node == nil {
+				return "", ErrInvalidHuffman
+			}
+
+			pending++
+			allOnes = allOnes && bit == 1
+
+			if node.children[0] == nil && node.children[1] == nil {
+				if node.symbol == eosSymbol {
+					return "", ErrInvalidHuffman
+				}
+				out = append(out, byte(node.symbol))
+				node = root
+				pending = 0
+				allOnes = true
+			}
+		}
+	}
+
+	// Padding is the most significant bits of EOS: fewer than 8 ones
+	if pending > 7 || !allOnes {
+		return "", ErrInvalidHuffman
+	}
+
+	return string(out), nil
+}
+
+// HuffmanEncodedLen returns the length of s once Huffman-coded
+func HuffmanEncodedLen(s string) int {
+	bits := 0
+	for i := 0; i < len(s); i++ {
+		bits += int(huffmanCodes[s[i]].length)
+	}
+	return (bits + 7) / 8
+}
+
+// AppendHuffman appends the Huffman coding of s to dst
+func AppendHuffman(dst []byte, s string) []byte {
+	var acc uint64
+	bits := uint(0)
+
+	for i := 0; i < len(s); i++ {
+		hc := huffmanCodes[s[i]]
+		acc = acc<<hc.length | uint64(hc.code)
+		bits += uint(hc.length)
+
+		for bits >= 8 {
+			bits -= 8
+			dst = append(dst, byte(acc>>bits))
+		}
+	}
+
+	// Pad the last byte with the start of EOS, which is all ones
+	if bits > 0 {
+		acc = acc<<(8-bits) | (1<<(8-bits) - 1)
+		dst = append(dst, byte(acc))
+	}
+
+	return dst
+}
@@ -0,0 +1,1254 @@
+// Package http2 implements the server side of HTTP/2 (RFC 9113): framing,
+// HPACK header compression, stream multiplexing, flow control and settings.
+// Requests are handed to a handler as http.Request values with their
+// response sent through an http.ResponseStream, so handlers written for
+// HTTP/1 work unchanged.
+package http2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// NextProto is the ALPN protocol identifier for HTTP/2 over TLS
+const NextProto = "h2"
+
+// ClientPreface is the connection preface every HTTP/2 client sends first
+const ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// Limits on what a client may send
+const (
+	// DefaultMaxConcurrentStreams is advertised unless configured otherwise
+	DefaultMaxConcurrentStreams = 250
+
+	// maxHeaderListSize bounds a request's decoded header fields
+	maxHeaderListSize = 1 << 20
+
+	// writeBufferSize is the size of the connection's write buffer
+	writeBufferSize = 16 << 10
+
+	// DefaultMaxRequestBodySize is the largest request body buffered
+	// unless configured otherwise
+	DefaultMaxRequestBodySize = http.DefaultMaxBodySize
+)
+
+// errStreamClosed is returned by writes to a stream that was reset or
+// whose connection is gone
+var errStreamClosed = errors.New("http2: stream closed")
+
+// Handler serves a request arriving on a stream. It runs in its own
+// goroutine and sends the response through stream, which it must end with
+// Close or Reset before returning.
+type Handler func(stream http.ResponseStream, request *http.Request)
+
+// Server holds the settings for serving HTTP/2 connections
+type Server struct {
+	// Handler serves each request
+	Handler Handler
+
+	// MaxConcurrentStreams limits the streams a client may have open at
+	// once; zero uses DefaultMaxConcurrentStreams
+	MaxConcurrentStreams uint32
+
+	// IdleTimeout closes a connection with no open streams after this
+	// long; zero means no limit
+	IdleTimeout time.Duration
+
+	// WriteTimeout limits each write to the connection, and how long a
+	// stream waits for the client to open its flow-control window
+	WriteTimeout time.Duration
+
+	// MaxRequestBodySize limits the request body buffered for a stream;
+	// zero uses DefaultMaxRequestBodySize
+	MaxRequestBodySize int64
+}
+
+// ServeConnOpts are the per-connection options for ServeConn
+type ServeConnOpts struct {
+	// Context is the parent of every stream's context
+	Context context.Context
+
+	// Reader reads from the connection, with any bytes already buffered;
+	// nil reads from the connection directly
+	Reader io.Reader
+
+	// TLS is the connection's TLS state, set on every request
+	TLS *tls.ConnectionState
+
+	// Upgrade is the request of an h2c upgrade, served as stream 1, and
+	// UpgradeSettings the payload of its HTTP2-Settings field
+	Upgrade         *http.Request
+	UpgradeSettings []byte
+
+	// Shutdown is closed to ask the connection to finish its streams and
+	// close gracefully
+	Shutdown <-chan struct{}
+
+	// StateHook is called with true when the first stream opens and with
+	// false when the last one closes
+	StateHook func(active bool)
+}
+
+// serverConn is one HTTP/2 connection
+type serverConn struct {
+	srv  *Server
+	conn net.Conn
+	opts ServeConnOpts
+	ctx  context.Context
+
+	// The framer reads only from the serve loop; writes, the encoder and
+	// the write buffer are guarded by wmu
+	framer  *framer
+	decoder *hpack.Decoder
+
+	wmu      sync.Mutex
+	bw       *bufio.Writer
+	encoder  *hpack.Encoder
+	writeErr error
+
+	// mu guards the fields below; cond is signalled when flow-control
+	// windows grow or streams close
+	mu                sync.Mutex
+	cond              *sync.Cond
+	streams           map[uint32]*stream
+	sendWindow        int64
+	recvWindow        int64
+	peerInitialWindow int64
+	peerMaxFrameSize  uint32
+	lastStreamID      uint32
+	goingAway         bool
+	closed            bool
+
+	// Header blocks spanning CONTINUATION frames are collected here
+	continuing      uint32
+	continuingFlags Flags
+	headerBlock     []byte
+}
+
+// ServeConn serves HTTP/2 on a connection until the client goes away, it
+// is idle for too long or a connection error occurs. The client preface
+// must not have been consumed yet. The connection is closed on return.
+func (s *Server) ServeConn(conn net.Conn, opts ServeConnOpts) error {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	reader := opts.Reader
+	if reader == nil {
+		reader = conn
+	}
+
+	bw := bufio.NewWriterSize(conn, writeBufferSize)
+	sc := &serverConn{
+		srv:               s,
+		conn:              conn,
+		opts:              opts,
+		ctx:               opts.Context,
+		framer:            newFramer(reader, bw),
+		decoder:           hpack.NewDecoder(hpack.DefaultTableSize),
+		bw:                bw,
+		encoder:           hpack.NewEncoder(),
+		streams:           make(map[uint32]*stream),
+		sendWindow:        defaultWindowSize,
+		recvWindow:        defaultWindowSize,
+		peerInitialWindow: defaultWindowSize,
+		peerMaxFrameSize:  defaultMaxFrameSize,
+	}
+	sc.cond = sync.NewCond(&sc.mu)
+	sc.decoder.MaxHeaderListSize = maxHeaderListSize
+
+	// Closing also releases the streams if serve panics
+	defer sc.close()
+	err := sc.serve()
+
+	if err != nil && !isClosedError(err) {
+		return err
+	}
+	return nil
+}
+
+// maxConcurrentStreams returns the advertised stream limit
+func (s *Server) maxConcurrentStreams() uint32 {
+	if s.MaxConcurrentStreams > 0 {
+		return s.MaxConcurrentStreams
+	}
+	return DefaultMaxConcurrentStreams
+}
+
+// maxRequestBodySize returns the request body limit
+func (s *Server) maxRequestBodySize() int64 {
+	if s.MaxRequestBodySize > 0 {
+		return s.MaxRequestBodySize
+	}
+	return DefaultMaxRequestBodySize
+}
+
+// serve runs the connection's read loop
+func (sc *serverConn) serve() error {
+	// The server preface is a SETTINGS frame, sent before anything else
+	err := sc.write(true, func(fr *framer) error {
+		return fr.WriteSettings(
+			Setting{SettingMaxConcurrentStreams, sc.srv.maxConcurrentStreams()},
+			Setting{SettingMaxHeaderListSize, maxHeaderListSize},
+			Setting{SettingEnablePush, 0},
+		)
+	})
+	if err != nil {
+		return err
+	}
+
+	if sc.opts.Upgrade != nil {
+		if err := sc.applySettings(sc.opts.UpgradeSettings); err != nil {
+			return sc.connError(err)
+		}
+	}
+
+	if err := sc.readPreface(); err != nil {
+		return err
+	}
+
+	// The first frame from the client must be its SETTINGS
+	f, err := sc.framer.ReadFrame()
+	if err != nil {
+		return sc.connError(err)
+	}
+	if f.Type != FrameSettings || f.Flags.Has(FlagAck) {
+		return sc.connError(ConnError{Code: ErrCodeProtocol, Reason: "expected SETTINGS as first frame"})
+	}
+	if err := sc.processFrame(f); err != nil {
+		return sc.connError(err)
+	}
+
+	if sc.opts.Upgrade != nil {
+		sc.startUpgradeStream()
+	}
+
+	go sc.watchShutdown()
+
+	for {
+		sc.setIdleDeadline()
+
+		f, err := sc.framer.ReadFrame()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				sc.goAway(ErrCodeNo, "idle timeout")
+				return nil
+			}
+			return sc.connError(err)
+		}
+
+		if err := sc.processFrame(f); err != nil {
+			return sc.connError(err)
+		}
+	}
+}
+
+// readPreface reads and checks the client connection preface
+func (sc *serverConn) readPreface() error {
+	preface := make([]byte, len(ClientPreface))
+	if _, err := io.ReadFull(sc.framer.r, preface); err != nil {
+		return fmt.Errorf("http2: error reading client preface: %w", err)
+	}
+	if string(preface) != ClientPreface {
+		return errors.New("http2: invalid client preface")
+	}
+	return nil
+}
+
+// setIdleDeadline limits the next read to the idle timeout while no
+// stream is open
+func (sc *serverConn) setIdleDeadline() {
+	sc.mu.Lock()
+	idle := len(sc.streams) == 0
+	sc.mu.Unlock()
+
+	if idle && sc.srv.IdleTimeout > 0 {
+		sc.conn.SetReadDeadline(time.Now().Add(sc.srv.IdleTimeout))
+	} else {
+		sc.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// watchShutdown starts a graceful close when the server shuts down
+func (sc *serverConn) watchShutdown() {
+	if sc.opts.Shutdown == nil {
+		return
+	}
+
+	select {
+	case <-sc.opts.Shutdown:
+		sc.goAway(ErrCodeNo, "server shutting down")
+	case <-sc.ctx.Done():
+	}
+}
+
+// connError ends the connection after an error. Protocol errors are
+// reported to the client with a GOAWAY; I/O errors end it silently.
+func (sc *serverConn) connError(err error) error {
+	var ce ConnError
+	if errors.As(err, &ce) {
+		sc.goAway(ce.Code, ce.Reason)
+		return err
+	}
+
+	var se StreamError
+	if errors.As(err, &se) {
+		// Stream errors that escape processing are handled by resetting
+		sc.resetStream(se.StreamID, se.Code)
+		return nil
+	}
+
+	if errors.Is(err, hpack.ErrHeaderListTooBig) {
+		sc.goAway(ErrCodeEnhanceYourCalm, err.Error())
+		return err
+	}
+
+	return err
+}
+
+// goAway tells the client no new streams will be accepted. Streams already
+// open are finished, after which the connection is closed. A code other
+// than NO_ERROR closes the connection straight away.
+func (sc *serverConn) goAway(code ErrCode, reason string) {
+	sc.mu.Lock()
+	alreadyGoingAway := sc.goingAway
+	sc.goingAway = true
+	lastStreamID := sc.lastStreamID
+	idle := len(sc.streams) == 0
+	// The last stream to end closes the connection once it is going away,
+	// so take the write side before it can, to send the GOAWAY first
+	sc.wmu.Lock()
+	sc.mu.Unlock()
+
+	if !alreadyGoingAway || code != ErrCodeNo {
+		var debug []byte
+		if code != ErrCodeNo {
+			debug = []byte(reason)
+		}
+		sc.writeLocked(true, func(fr *framer) error {
+			return fr.WriteGoAway(lastStreamID, code, debug)
+		})
+	}
+	sc.wmu.Unlock()
+
+	if code != ErrCodeNo || idle {
+		sc.conn.Close()
+	}
+}
+
+// close releases the connection's streams after the read loop ends
+func (sc *serverConn) close() {
+	sc.mu.Lock()
+	sc.closed = true
+	for _, st := range sc.streams {
+		st.cancel()
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	sc.wmu.Lock()
+	sc.bw.Flush()
+	sc.wmu.Unlock()
+
+	sc.conn.Close()
+}
+
+// write runs fn with the write side of the connection, flushing afterwards
+// if asked. After a write error the connection is unusable and every
+// later write fails.
+func (sc *serverConn) write(flush bool, fn func(fr *framer) error) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+
+	return sc.writeLocked(flush, fn)
+}
+
+// writeLocked is write for a caller holding wmu
+func (sc *serverConn) writeLocked(flush bool, fn func(fr *framer) error) error {
+	if sc.writeErr != nil {
+		return sc.writeErr
+	}
+
+	if sc.srv.WriteTimeout > 0 {
+		sc.conn.SetWriteDeadline(time.Now().Add(sc.srv.WriteTimeout))
+	}
+
+	err := fn(sc.framer)
+	if err == nil && flush {
+		err = sc.bw.Flush()
+	}
+	if err != nil {
+		sc.writeErr = err
+		sc.conn.Close()
+	}
+	return err
+}
+
+// processFrame handles a frame read from the client
+func (sc *serverConn) processFrame(f *Frame) error {
+	// A header block must be continued before anything else is sent
+	if sc.continuing != 0 && (f.Type != FrameContinuation || f.StreamID != sc.continuing) {
+		return ConnError{Code: ErrCodeProtocol, Reason: fmt.Sprintf("expected CONTINUATION for stream %d, got %s", sc.continuing, f.Type)}
+	}
+
+	switch f.Type {
+	case FrameData:
+		return sc.processData(f)
+	case FrameHeaders:
+		return sc.processHeaders(f)
+	case FrameContinuation:
+		return sc.processContinuation(f)
+	case FramePriority:
+		if f.StreamID == 0 || len(f.Payload) != 5 {
+			return ConnError{Code: ErrCodeProtocol, Reason: "invalid PRIORITY frame"}
+		}
+		// Prioritization is advisory and not implemented
+		return nil
+	case FrameRSTStream:
+		return sc.processRSTStream(f)
+	case FrameSettings:
+		return sc.processSettings(f)
+	case FramePushPromise:
+		return ConnError{Code: ErrCodeProtocol, Reason: "clients cannot push"}
+	case FramePing:
+		return sc.processPing(f)
+	case FrameGoAway:
+		return sc.processGoAway(f)
+	case FrameWindowUpdate:
+		return sc.processWindowUpdate(f)
+	}
+
+	// Unknown frame types are ignored
+	return nil
+}
+
+// processSettings applies the client's settings and acknowledges them
+func (sc *serverConn) processSettings(f *Frame) error {
+	if f.StreamID != 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "SETTINGS on a stream"}
+	}
+	if f.Flags.Has(FlagAck) {
+		if len(f.Payload) != 0 {
+			return ConnError{Code: ErrCodeFrameSize, Reason: "SETTINGS ack with payload"}
+		}
+		return nil
+	}
+
+	if err := sc.applySettings(f.Payload); err != nil {
+		return err
+	}
+
+	return sc.write(true, func(fr *framer) error {
+		return fr.WriteSettingsAck()
+	})
+}
+
+// applySettings applies a SETTINGS payload
+func (sc *serverConn) applySettings(payload []byte) error {
+	if len(payload)%6 != 0 {
+		return ConnError{Code: ErrCodeFrameSize, Reason: "SETTINGS payload not a multiple of 6"}
+	}
+
+	for ; len(payload) > 0; payload = payload[6:] {
+		id := SettingID(binary.BigEndian.Uint16(payload))
+		value := binary.BigEndian.Uint32(payload[2:])
+
+		switch id {
+		case SettingHeaderTableSize:
+			sc.wmu.Lock()
+			sc.encoder.SetMaxTableSize(value)
+			sc.wmu.Unlock()
+
+		case SettingEnablePush:
+			if value > 1 {
+				return ConnError{Code: ErrCodeProtocol, Reason: "invalid SETTINGS_ENABLE_PUSH"}
+			}
+
+		case SettingInitialWindowSize:
+			if value > maxWindowSize {
+				return ConnError{Code: ErrCodeFlowControl, Reason: "SETTINGS_INITIAL_WINDOW_SIZE too large"}
+			}
+			if err := sc.setInitialWindow(int64(value)); err != nil {
+				return err
+			}
+
+		case SettingMaxFrameSize:
+			if value < defaultMaxFrameSize || value > maxAllowedFrameSize {
+				return ConnError{Code: ErrCodeProtocol, Reason: "invalid SETTINGS_MAX_FRAME_SIZE"}
+			}
+			sc.mu.Lock()
+			sc.peerMaxFrameSize = value
+			sc.mu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// setInitialWindow changes the send window of every stream by the
+// difference between the old and new initial window sizes
+func (sc *serverConn) setInitialWindow(size int64) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	delta := size - sc.peerInitialWindow
+	sc.peerInitialWindow = size
+	for _, st := range sc.streams {
+		st.sendWindow += delta
+		if st.sendWindow > maxWindowSize {
+			return ConnError{Code: ErrCodeFlowControl, Reason: "stream window overflow"}
+		}
+	}
+	sc.cond.Broadcast()
+	return nil
+}
+
+// processPing answers a PING
+func (sc *serverConn) processPing(f *Frame) error {
+	if f.StreamID != 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "PING on a stream"}
+	}
+	if len(f.Payload) != 8 {
+		return ConnError{Code: ErrCodeFrameSize, Reason: "PING payload must be 8 bytes"}
+	}
+	if f.Flags.Has(FlagAck) {
+		return nil
+	}
+
+	var data [8]byte
+	copy(data[:], f.Payload)
+	return sc.write(true, func(fr *framer) error {
+		return fr.WritePing(true, data)
+	})
+}
+
+// processGoAway stops accepting streams after the client says it is leaving
+func (sc *serverConn) processGoAway(f *Frame) error {
+	if f.StreamID != 0 || len(f.Payload) < 8 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "invalid GOAWAY frame"}
+	}
+
+	code := ErrCode(binary.BigEndian.Uint32(f.Payload[4:]))
+	if code != ErrCodeNo {
+		log.Printf("HTTP/2 client sent GOAWAY %s: %s", code, f.Payload[8:])
+	}
+
+	sc.goAway(ErrCodeNo, "")
+	return nil
+}
+
+// processWindowUpdate grows a send window
+func (sc *serverConn) processWindowUpdate(f *Frame) error {
+	if len(f.Payload) != 4 {
+		return ConnError{Code: ErrCodeFrameSize, Reason: "WINDOW_UPDATE payload must be 4 bytes"}
+	}
+	increment := int64(binary.BigEndian.Uint32(f.Payload) & (1<<31 - 1))
+
+	sc.mu.Lock()
+	if f.StreamID == 0 {
+		defer sc.mu.Unlock()
+
+		if increment == 0 {
+			return ConnError{Code: ErrCodeProtocol, Reason: "WINDOW_UPDATE with zero increment"}
+		}
+		sc.sendWindow += increment
+		if sc.sendWindow > maxWindowSize {
+			return ConnError{Code: ErrCodeFlowControl, Reason: "connection window overflow"}
+		}
+		sc.cond.Broadcast()
+		return nil
+	}
+
+	st, ok := sc.streams[f.StreamID]
+	if !ok {
+		if f.StreamID > sc.lastStreamID {
+			sc.mu.Unlock()
+			return ConnError{Code: ErrCodeProtocol, Reason: "WINDOW_UPDATE on idle stream"}
+		}
+		// Updates may race with the stream closing
+		sc.mu.Unlock()
+		return nil
+	}
+
+	code := ErrCodeNo
+	switch {
+	case increment == 0:
+		code = ErrCodeProtocol
+	case st.sendWindow+increment > maxWindowSize:
+		code = ErrCodeFlowControl
+	default:
+		st.sendWindow += increment
+		sc.cond.Broadcast()
+	}
+	sc.mu.Unlock()
+
+	if code != ErrCodeNo {
+		sc.resetStream(f.StreamID, code)
+	}
+	return nil
+}
+
+// processRSTStream abandons a stream the client reset
+func (sc *serverConn) processRSTStream(f *Frame) error {
+	if f.StreamID == 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "RST_STREAM on stream 0"}
+	}
+	if len(f.Payload) != 4 {
+		return ConnError{Code: ErrCodeFrameSize, Reason: "RST_STREAM payload must be 4 bytes"}
+	}
+
+	sc.mu.Lock()
+	if f.StreamID > sc.lastStreamID {
+		sc.mu.Unlock()
+		return ConnError{Code: ErrCodeProtocol, Reason: "RST_STREAM on idle stream"}
+	}
+	st, ok := sc.streams[f.StreamID]
+	if ok {
+		st.resetLocked()
+	}
+	sc.mu.Unlock()
+
+	if ok && !st.dispatched {
+		sc.streamDone(st)
+	}
+	return nil
+}
+
+// processHeaders starts a header block
+func (sc *serverConn) processHeaders(f *Frame) error {
+	if f.StreamID == 0 || f.StreamID%2 == 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: fmt.Sprintf("HEADERS on invalid stream %d", f.StreamID)}
+	}
+
+	payload, err := stripPadding(f)
+	if err != nil {
+		return err
+	}
+	if f.Flags.Has(FlagPriority) {
+		if len(payload) < 5 {
+			return ConnError{Code: ErrCodeFrameSize, Reason: "HEADERS priority truncated"}
+		}
+		payload = payload[5:]
+	}
+
+	sc.headerBlock = append(sc.headerBlock[:0], payload...)
+	sc.continuingFlags = f.Flags
+	if !f.Flags.Has(FlagEndHeaders) {
+		sc.continuing = f.StreamID
+		return nil
+	}
+	return sc.processHeaderBlock(f.StreamID)
+}
+
+// processContinuation adds to a header block
+func (sc *serverConn) processContinuation(f *Frame) error {
+	if sc.continuing == 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "unexpected CONTINUATION"}
+	}
+	if len(sc.headerBlock)+len(f.Payload) > maxHeaderListSize {
+		return ConnError{Code: ErrCodeEnhanceYourCalm, Reason: "header block too large"}
+	}
+
+	sc.headerBlock = append(sc.headerBlock, f.Payload...)
+	if !f.Flags.Has(FlagEndHeaders) {
+		return nil
+	}
+
+	sc.continuing = 0
+	return sc.processHeaderBlock(f.StreamID)
+}
+
+// processHeaderBlock decodes a complete header block, which either opens a
+// stream or carries its trailers
+func (sc *serverConn) processHeaderBlock(streamID uint32) error {
+	// The block is decoded even if the stream is refused, to keep the
+	// decoder's table in step with the client's
+	fields, err := sc.decoder.Decode(sc.headerBlock)
+	if err != nil {
+		if errors.Is(err, hpack.ErrHeaderListTooBig) {
+			return err
+		}
+		return ConnError{Code: ErrCodeCompression, Reason: err.Error()}
+	}
+	endStream := sc.continuingFlags.Has(FlagEndStream)
+
+	sc.mu.Lock()
+	if st, ok := sc.streams[streamID]; ok {
+		sc.mu.Unlock()
+		return sc.processTrailers(st, endStream)
+	}
+	if streamID <= sc.lastStreamID {
+		sc.mu.Unlock()
+		return ConnError{Code: ErrCodeStreamClosed, Reason: fmt.Sprintf("HEADERS on closed stream %d", streamID)}
+	}
+	sc.lastStreamID = streamID
+
+	if sc.goingAway {
+		sc.mu.Unlock()
+		return nil
+	}
+	if uint32(len(sc.streams)) >= sc.srv.maxConcurrentStreams() {
+		sc.mu.Unlock()
+		sc.resetStream(streamID, ErrCodeRefusedStream)
+		return nil
+	}
+	sc.mu.Unlock()
+
+	request, err := NewRequest(fields, sc.opts.TLS)
+	if err != nil {
+		log.Printf("HTTP/2 malformed request on stream %d: %v", streamID, err)
+		sc.resetStream(streamID, ErrCodeProtocol)
+		return nil
+	}
+
+	st := sc.openStream(streamID, request)
+	if endStream {
+		sc.dispatch(st)
+	}
+	return nil
+}
+
+// processTrailers handles a second header block on an open stream. The
+// fields are dropped, since requests have no place for them.
+func (sc *serverConn) processTrailers(st *stream, endStream bool) error {
+	sc.mu.Lock()
+	receiving := st.receiving
+	sc.mu.Unlock()
+
+	if !receiving {
+		sc.resetStream(st.id, ErrCodeStreamClosed)
+		return nil
+	}
+	if !endStream {
+		sc.resetStream(st.id, ErrCodeProtocol)
+		return nil
+	}
+
+	sc.dispatch(st)
+	return nil
+}
+
+// processData adds request body data to a stream. The client may only
+// send as much as the receive windows allow. The connection window is
+// handed back at once, since every stream's buffered body is capped; a
+// stream's window is handed back as its data joins the body, until the
+// body grows past the cap and the request is refused with 413.
+func (sc *serverConn) processData(f *Frame) error {
+	if f.StreamID == 0 {
+		return ConnError{Code: ErrCodeProtocol, Reason: "DATA on stream 0"}
+	}
+
+	data, err := stripPadding(f)
+	if err != nil {
+		return err
+	}
+
+	// The whole frame, padding included, counts against flow control
+	n := int64(len(f.Payload))
+
+	sc.mu.Lock()
+	if n > sc.recvWindow {
+		sc.mu.Unlock()
+		return ConnError{Code: ErrCodeFlowControl, Reason: "connection receive window exceeded"}
+	}
+	sc.recvWindow -= n
+
+	st, ok := sc.streams[f.StreamID]
+	var code ErrCode
+	tooLarge := false
+	switch {
+	case !ok || !st.receiving:
+		if f.StreamID > sc.lastStreamID {
+			sc.mu.Unlock()
+			return ConnError{Code: ErrCodeProtocol, Reason: "DATA on idle stream"}
+		}
+		code = ErrCodeStreamClosed
+	case n > st.recvWindow:
+		code = ErrCodeFlowControl
+	default:
+		st.recvWindow -= n
+		st.body.Write(data)
+		tooLarge = int64(st.body.Len()) > sc.srv.maxRequestBodySize()
+	}
+	sc.mu.Unlock()
+
+	if n > 0 {
+		if err := sc.replenish(0, n); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case code != ErrCodeNo:
+		sc.resetStream(f.StreamID, code)
+		return nil
+	case tooLarge:
+		sc.refuseBody(st)
+		return nil
+	case f.Flags.Has(FlagEndStream):
+		sc.dispatch(st)
+		return sc.flush()
+	case n > 0:
+		return sc.replenish(st.id, n)
+	}
+	return sc.flush()
+}
+
+// replenish hands n bytes back to the client's send window for a stream,
+// or for the connection if streamID is 0
+func (sc *serverConn) replenish(streamID uint32, n int64) error {
+	sc.mu.Lock()
+	if streamID == 0 {
+		sc.recvWindow += n
+	} else if st, ok := sc.streams[streamID]; ok {
+		st.recvWindow += n
+	}
+	sc.mu.Unlock()
+
+	return sc.write(streamID != 0, func(fr *framer) error {
+		return fr.WriteWindowUpdate(streamID, uint32(n))
+	})
+}
+
+// refuseBody answers a request whose body is too large with 413 and
+// resets the stream so the client stops sending the rest
+func (sc *serverConn) refuseBody(st *stream) {
+	header := http.Header{}
+	header.Set(http.HeaderContentLength, "0")
+	if err := st.WriteHeader(http.StatusContentTooLarge, header, true); err != nil {
+		return
+	}
+	sc.resetStream(st.id, ErrCodeNo)
+}
+
+// flush sends buffered frames
+func (sc *serverConn) flush() error {
+	return sc.write(true, func(*framer) error { return nil })
+}
+
+// resetStream sends RST_STREAM and abandons the stream
+func (sc *serverConn) resetStream(streamID uint32, code ErrCode) {
+	sc.mu.Lock()
+	st, ok := sc.streams[streamID]
+	if ok {
+		st.resetLocked()
+	}
+	sc.mu.Unlock()
+
+	sc.write(true, func(fr *framer) error {
+		return fr.WriteRSTStream(streamID, code)
+	})
+
+	// A stream whose handler never started is forgotten here
+	if ok && !st.dispatched {
+		sc.streamDone(st)
+	}
+}
+
+// NewRequest builds a request from a decoded header block. HTTP/3 sends
+// the same fields, so it builds its requests here too.
+func NewRequest(fields []hpack.HeaderField, tlsState *tls.ConnectionState) (*http.Request, error) {
+	request := &http.Request{
+		Headers:    make(map[string]string),
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		TLS:        tlsState,
+	}
+
+	var path, scheme, authority string
+	regular := false
+	for _, field := range fields {
+		if strings.HasPrefix(field.Name, ":") {
+			if regular {
+				return nil, fmt.Errorf("pseudo-header %s after regular fields", field.Name)
+			}
+
+			var target *string
+			switch field.Name {
+			case ":method":
+				target = &request.Method
+			case ":path":
+				target = &path
+			case ":scheme":
+				target = &scheme
+			case ":authority":
+				target = &authority
+			default:
+				return nil, fmt.Errorf("unknown pseudo-header %s", field.Name)
+			}
+			if *target != "" {
+				return nil, fmt.Errorf("duplicate pseudo-header %s", field.Name)
+			}
+			*target = field.Value
+			continue
+		}
+
+		regular = true
+		if field.Name != strings.ToLower(field.Name) {
+			return nil, fmt.Errorf("uppercase field name %q", field.Name)
+		}
+		switch field.Name {
+		case http.HeaderConnection, "keep-alive", "proxy-connection", http.HeaderTransferEncoding, http.HeaderUpgrade:
+			return nil, fmt.Errorf("connection-specific field %s", field.Name)
+		case "te":
+			if field.Value != "trailers" {
+				return nil, errors.New("te other than trailers")
+			}
+		}
+
+		// Combine repeated fields as the HTTP/1 parser does
+		value := field.Value
+		if existing, ok := request.Headers[field.Name]; ok {
+			separator := ", "
+			if field.Name == http.HeaderCookie {
+				separator = "; "
+			}
+			value = existing + separator + value
+		}
+		request.Headers[field.Name] = value
+	}
+
+	if request.Method == "" || path == "" || scheme == "" {
+		return nil, errors.New("missing :method, :path or :scheme")
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("unsupported :path %q", path)
+	}
+	request.Path, request.RawQuery, _ = strings.Cut(path, "?")
+
+	// :authority stands in for Host
+	if authority != "" {
+		request.Headers[http.HeaderHost] = authority
+	}
+
+	return request, nil
+}
+
+// openStream registers a new stream receiving its request
+func (sc *serverConn) openStream(id uint32, request *http.Request) *stream {
+	ctx, cancel := context.WithCancel(sc.ctx)
+
+	// The client starts from the default receive window, which the
+	// server's SETTINGS leave unchanged
+	st := &stream{
+		id:         id,
+		sc:         sc,
+		request:    request.WithContext(ctx),
+		cancel:     cancel,
+		receiving:  true,
+		recvWindow: defaultWindowSize,
+	}
+
+	sc.mu.Lock()
+	st.sendWindow = sc.peerInitialWindow
+	sc.streams[id] = st
+	first := len(sc.streams) == 1
+	sc.mu.Unlock()
+
+	if first && sc.opts.StateHook != nil {
+		sc.opts.StateHook(true)
+	}
+	return st
+}
+
+// startUpgradeStream serves the request that upgraded the connection as
+// stream 1, whose request side is already complete
+func (sc *serverConn) startUpgradeStream() {
+	sc.mu.Lock()
+	sc.lastStreamID = 1
+	sc.mu.Unlock()
+
+	request := *sc.opts.Upgrade
+	request.Proto, request.ProtoMajor, request.ProtoMinor = "HTTP/2.0", 2, 0
+	for _, name := range []string{http.HeaderConnection, http.HeaderUpgrade, http.HeaderHTTP2Settings} {
+		delete(request.Headers, name)
+	}
+
+	st := sc.openStream(1, &request)
+	st.body.Write(request.Body)
+	sc.dispatch(st)
+}
+
+// dispatch runs the handler for a stream whose request is complete
+func (sc *serverConn) dispatch(st *stream) {
+	sc.mu.Lock()
+	if !st.receiving {
+		sc.mu.Unlock()
+		return
+	}
+	st.receiving = false
+	st.dispatched = true
+	st.request.Body = st.body.Bytes()
+	sc.mu.Unlock()
+
+	if cl, ok := st.request.Headers[http.HeaderContentLength]; ok {
+		if n, err := http.ParseContentLength(cl); err != nil || n != int64(len(st.request.Body)) {
+			sc.resetStream(st.id, ErrCodeProtocol)
+			sc.streamDone(st)
+			return
+		}
+	}
+
+	go func() {
+		defer sc.streamDone(st)
+		defer func() {
+			if v := recover(); v != nil {
+				panics.Report(panics.Stream, v, "HTTP/2 stream %d from %s", st.id, sc.conn.RemoteAddr())
+				sc.resetStream(st.id, ErrCodeInternal)
+			}
+		}()
+		sc.srv.Handler(st, st.request)
+	}()
+}
+
+// streamDone forgets a stream once its handler has returned
+func (sc *serverConn) streamDone(st *stream) {
+	st.cancel()
+
+	sc.mu.Lock()
+	delete(sc.streams, st.id)
+	idle := len(sc.streams) == 0
+	finished := idle && sc.goingAway
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	if idle {
+		if sc.opts.StateHook != nil {
+			sc.opts.StateHook(false)
+		}
+		// Restart the idle timer the read loop set aside
+		if sc.srv.IdleTimeout > 0 {
+			sc.conn.SetReadDeadline(time.Now().Add(sc.srv.IdleTimeout))
+		}
+	}
+
+	if finished {
+		sc.flush()
+		sc.conn.Close()
+	}
+}
+
+// isClosedError reports whether err only says the connection is gone
+func isClosedError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// stream is one request-response exchange on a connection. Its fields are
+// guarded by the connection's mu.
+type stream struct {
+	id      uint32
+	sc      *serverConn
+	request *http.Request
+	cancel  context.CancelFunc
+
+	// receiving is true until the request is complete, and dispatched
+	// once its handler has started
+	receiving  bool
+	dispatched bool
+	body       bytes.Buffer
+
+	sendWindow int64
+	recvWindow int64
+	ended      bool
+	reset      bool
+}
+
+// resetLocked marks the stream abandoned; the caller holds sc.mu
+func (st *stream) resetLocked() {
+	st.reset = true
+	st.receiving = false
+	st.cancel()
+	st.sc.cond.Broadcast()
+}
+
+// WriteHeader sends the response header block
+func (st *stream) WriteHeader(status http.Status, header http.Header, endStream bool) error {
+	sc := st.sc
+
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status.Code())}}
+	for _, name := range sortedNames(header) {
+		lower := strings.ToLower(name)
+		for _, value := range header[name] {
+			fields = append(fields, hpack.HeaderField{
+				Name:      lower,
+				Value:     strings.NewReplacer("\r", "", "\n", "").Replace(value),
+				Sensitive: lower == http.HeaderSetCookie || lower == http.HeaderAuthorization,
+			})
+		}
+	}
+
+	sc.mu.Lock()
+	if st.reset || sc.closed {
+		sc.mu.Unlock()
+		return errStreamClosed
+	}
+	maxFrameSize := sc.peerMaxFrameSize
+	st.ended = endStream
+	sc.mu.Unlock()
+
+	return sc.write(endStream, func(fr *framer) error {
+		block := sc.encoder.Encode(nil, fields)
+		return fr.WriteHeaders(st.id, endStream, block, maxFrameSize)
+	})
+}
+
+// Write sends body data in DATA frames, waiting for the client to open
+// the flow-control windows as needed
+func (st *stream) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n, err := st.reserve(len(p))
+		if err != nil {
+			return written, err
+		}
+
+		chunk := p[:n]
+		err = st.sc.write(false, func(fr *framer) error {
+			return fr.WriteData(st.id, false, chunk)
+		})
+		if err != nil {
+			return written, err
+		}
+
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// reserve waits until at least one byte may be sent and takes up to want
+// bytes from the stream and connection windows. Buffered frames are sent
+// before waiting, since the client may need to see them before it opens
+// the windows.
+func (st *stream) reserve(want int) (int, error) {
+	sc := st.sc
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var timedOut bool
+	if sc.srv.WriteTimeout > 0 {
+		timer := time.AfterFunc(sc.srv.WriteTimeout, func() {
+			sc.mu.Lock()
+			timedOut = true
+			sc.cond.Broadcast()
+			sc.mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	flushed := false
+	for {
+		if st.reset || sc.closed {
+			return 0, errStreamClosed
+		}
+		if st.sendWindow > 0 && sc.sendWindow > 0 {
+			break
+		}
+		if timedOut {
+			return 0, os.ErrDeadlineExceeded
+		}
+		if !flushed {
+			// The windows may change while unlocked, so check again
+			sc.mu.Unlock()
+			err := sc.flush()
+			sc.mu.Lock()
+			if err != nil {
+				return 0, err
+			}
+			flushed = true
+			continue
+		}
+		sc.cond.Wait()
+	}
+
+	n := int64(want)
+	n = min(n, st.sendWindow, sc.sendWindow, int64(sc.peerMaxFrameSize))
+	st.sendWindow -= n
+	sc.sendWindow -= n
+	return int(n), nil
+}
+
+// Flush sends any buffered frames
+func (st *stream) Flush() error {
+	if st.isReset() {
+		return errStreamClosed
+	}
+	return st.sc.flush()
+}
+
+// Close ends the response with an empty DATA frame
+func (st *stream) Close() error {
+	sc := st.sc
+
+	sc.mu.Lock()
+	if st.ended {
+		sc.mu.Unlock()
+		return nil
+	}
+	if st.reset || sc.closed {
+		sc.mu.Unlock()
+		return errStreamClosed
+	}
+	st.ended = true
+	sc.mu.Unlock()
+
+	return sc.write(true, func(fr *framer) error {
+		return fr.WriteData(st.id, true, nil)
+	})
+}
+
+// Reset abandons the response with RST_STREAM
+func (st *stream) Reset() error {
+	sc := st.sc
+
+	sc.mu.Lock()
+	if st.ended || st.reset {
+		sc.mu.Unlock()
+		return nil
+	}
+	st.resetLocked()
+	sc.mu.Unlock()
+
+	return sc.write(true, func(fr *framer) error {
+		return fr.WriteRSTStream(st.id, ErrCodeInternal)
+	})
+}
+
+// isReset reports whether the stream has been reset
+func (st *stream) isReset() bool {
+	st.sc.mu.Lock()
+	defer st.sc.mu.Unlock()
+
+	return st.reset || st.sc.closed
+}
+
+// sortedNames returns the names of the fields to send, in order, skipping
+// suppressed ones
+func sortedNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name, values := range header {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,586 @@
+package http2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+)
+
+// echo answers with the method, path and body of the request
+func echo(stream http.ResponseStream, request *http.Request) {
+	body := request.Method + " " + request.Path + " " + string(request.Body)
+	stream.WriteHeader(http.StatusOK, http.Header{}, false)
+	stream.Write([]byte(body))
+	stream.Close()
+}
+
+// testConn is the client side of a connection to a server under test
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	fr     *framer
+	enc    *hpack.Encoder
+	dec    *hpack.Decoder
+	frames chan *Frame
+}
+
+// newTestConn connects to srv and exchanges SETTINGS with it
+func newTestConn(t *testing.T, srv *Server, settings ...Setting) *testConn {
+	if srv.Handler == nil {
+		srv.Handler = echo
+	}
+	client, server := net.Pipe()
+	tc := &testConn{
+		t:      t,
+		conn:   client,
+		fr:     newFramer(nil, client),
+		enc:    hpack.NewEncoder(),
+		dec:    hpack.NewDecoder(hpack.DefaultTableSize),
+		frames: make(chan *Frame, 100),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.ServeConn(server, ServeConnOpts{})
+	}()
+	go tc.readFrames()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+
+	if _, err := io.WriteString(client, ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.fr.WriteSettings(settings...); err != nil {
+		t.Fatal(err)
+	}
+	if f := tc.next(); f.Type != FrameSettings || f.Flags.Has(FlagAck) {
+		t.Fatalf("first frame %s flags %#x, want SETTINGS", f.Type, f.Flags)
+	}
+	if f := tc.next(); f.Type != FrameSettings || !f.Flags.Has(FlagAck) {
+		t.Fatalf("second frame %s flags %#x, want SETTINGS ack", f.Type, f.Flags)
+	}
+	return tc
+}
+
+// readFrames passes the server's frames to the test until the connection
+// closes
+func (tc *testConn) readFrames() {
+	defer close(tc.frames)
+	fr := newFramer(tc.conn, nil)
+	fr.maxReadSize = maxAllowedFrameSize
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		f.Payload = bytes.Clone(f.Payload)
+		tc.frames <- f
+	}
+}
+
+// next returns the next frame from the server
+func (tc *testConn) next() *Frame {
+	tc.t.Helper()
+	select {
+	case f, ok := <-tc.frames:
+		if !ok {
+			tc.t.Fatal("connection closed")
+		}
+		return f
+	case <-time.After(5 * time.Second):
+		tc.t.Fatal("timed out waiting for a frame")
+	}
+	return nil
+}
+
+// waitFor skips frames until one of the given type on the given stream
+func (tc *testConn) waitFor(typ FrameType, streamID uint32) *Frame {
+	tc.t.Helper()
+	for {
+		if f := tc.next(); f.Type == typ && f.StreamID == streamID {
+			return f
+		}
+	}
+}
+
+// write sends a frame
+func (tc *testConn) write(typ FrameType, flags Flags, streamID uint32, payload []byte) {
+	tc.t.Helper()
+	if err := tc.fr.writeFrame(typ, flags, streamID, payload); err != nil {
+		tc.t.Fatalf("writing %s: %v", typ, err)
+	}
+}
+
+// headerBlock encodes a request for path
+func (tc *testConn) headerBlock(method, path string) []byte {
+	return tc.enc.Encode(nil, []hpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: path},
+	})
+}
+
+// request opens a stream with a request for path
+func (tc *testConn) request(streamID uint32, method, path string, endStream bool) {
+	tc.t.Helper()
+	flags := FlagEndHeaders
+	if endStream {
+		flags |= FlagEndStream
+	}
+	tc.write(FrameHeaders, flags, streamID, tc.headerBlock(method, path))
+}
+
+// response reads the response on a stream, skipping other frames
+func (tc *testConn) response(streamID uint32) (status string, body string) {
+	tc.t.Helper()
+	var block []byte
+	for {
+		f := tc.next()
+		if f.StreamID != streamID {
+			continue
+		}
+		switch f.Type {
+		case FrameHeaders, FrameContinuation:
+			block = append(block, f.Payload...)
+			if f.Flags.Has(FlagEndHeaders) {
+				fields, err := tc.dec.Decode(block)
+				if err != nil {
+					tc.t.Fatal(err)
+				}
+				status = fields[0].Value
+			}
+		case FrameData:
+			body += string(f.Payload)
+		case FrameRSTStream:
+			tc.t.Fatalf("stream %d reset with %s", streamID, ErrCode(binary.BigEndian.Uint32(f.Payload)))
+		}
+		if f.Flags.Has(FlagEndStream) {
+			return status, body
+		}
+	}
+}
+
+// wantGoAway reads until a GOAWAY and checks its code
+func (tc *testConn) wantGoAway(code ErrCode) {
+	tc.t.Helper()
+	f := tc.waitFor(FrameGoAway, 0)
+	if got := ErrCode(binary.BigEndian.Uint32(f.Payload[4:])); got != code {
+		tc.t.Errorf("GOAWAY %s (%s), want %s", got, f.Payload[8:], code)
+	}
+}
+
+// wantRSTStream reads until a RST_STREAM on a stream and checks its code
+func (tc *testConn) wantRSTStream(streamID uint32, code ErrCode) {
+	tc.t.Helper()
+	f := tc.waitFor(FrameRSTStream, streamID)
+	if got := ErrCode(binary.BigEndian.Uint32(f.Payload)); got != code {
+		tc.t.Errorf("RST_STREAM %s, want %s", got, code)
+	}
+}
+
+func setting(id SettingID, value uint32) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(id))
+	return binary.BigEndian.AppendUint32(b, value)
+}
+
+func uint32Payload(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func TestRequest(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	tc.request(1, "GET", "/hello", true)
+	if status, body := tc.response(1); status != "200" || body != "GET /hello " {
+		t.Errorf("response %s %q", status, body)
+	}
+
+	tc.request(3, "POST", "/echo", false)
+	tc.write(FrameData, 0, 3, []byte("abc"))
+	tc.write(FrameData, FlagEndStream, 3, []byte("def"))
+	if status, body := tc.response(3); status != "200" || body != "POST /echo abcdef" {
+		t.Errorf("response %s %q", status, body)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+
+	// HEADERS with padding and priority
+	payload := []byte{4}
+	payload = append(payload, 0, 0, 0, 0, 16)
+	payload = append(payload, tc.headerBlock("POST", "/padded")...)
+	payload = append(payload, 0, 0, 0, 0)
+	tc.write(FrameHeaders, FlagEndHeaders|FlagPadded|FlagPriority, 1, payload)
+
+	// The padding of DATA counts against flow control and is handed back
+	data := append([]byte{10}, "body"...)
+	data = append(data, make([]byte, 10)...)
+	tc.write(FrameData, FlagPadded, 1, data)
+	f := tc.waitFor(FrameWindowUpdate, 0)
+	if got := binary.BigEndian.Uint32(f.Payload); got != uint32(len(data)) {
+		t.Errorf("connection WINDOW_UPDATE of %d, want %d", got, len(data))
+	}
+
+	tc.write(FrameData, FlagEndStream, 1, nil)
+	if status, body := tc.response(1); status != "200" || body != "POST /padded body" {
+		t.Errorf("response %s %q", status, body)
+	}
+}
+
+func TestPaddingErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     FrameType
+		flags   Flags
+		payload []byte
+	}{
+		{"DATA without pad length", FrameData, FlagPadded, nil},
+		{"DATA padding exceeds payload", FrameData, FlagPadded, []byte{5, 'a'}},
+		{"HEADERS padding exceeds payload", FrameHeaders, FlagPadded | FlagEndHeaders, []byte{5, 0x82}},
+		{"HEADERS priority truncated", FrameHeaders, FlagPriority | FlagEndHeaders, []byte{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			if tt.typ == FrameData {
+				tc.request(1, "POST", "/", false)
+			}
+			tc.write(tt.typ, tt.flags, 1, tt.payload)
+			code := ErrCodeProtocol
+			if tt.flags.Has(FlagPriority) {
+				code = ErrCodeFrameSize
+			}
+			tc.wantGoAway(code)
+		})
+	}
+}
+
+func TestContinuation(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	block := tc.headerBlock("GET", "/continued")
+	tc.write(FrameHeaders, FlagEndStream, 1, block[:3])
+	tc.write(FrameContinuation, 0, 1, block[3:5])
+	tc.write(FrameContinuation, FlagEndHeaders, 1, block[5:])
+	if status, body := tc.response(1); status != "200" || body != "GET /continued " {
+		t.Errorf("response %s %q", status, body)
+	}
+}
+
+func TestContinuationErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame func(tc *testConn)
+	}{
+		{"interleaved PING", func(tc *testConn) {
+			tc.write(FramePing, 0, 0, make([]byte, 8))
+		}},
+		{"interleaved DATA", func(tc *testConn) {
+			tc.write(FrameData, 0, 1, []byte("x"))
+		}},
+		{"interleaved HEADERS", func(tc *testConn) {
+			tc.write(FrameHeaders, FlagEndHeaders, 3, []byte{0x82})
+		}},
+		{"CONTINUATION on another stream", func(tc *testConn) {
+			tc.write(FrameContinuation, FlagEndHeaders, 3, []byte{0x82})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			block := tc.headerBlock("GET", "/")
+			tc.write(FrameHeaders, FlagEndStream, 1, block[:3])
+			tt.frame(tc)
+			tc.wantGoAway(ErrCodeProtocol)
+		})
+	}
+
+	t.Run("CONTINUATION without HEADERS", func(t *testing.T) {
+		tc := newTestConn(t, &Server{})
+		tc.write(FrameContinuation, FlagEndHeaders, 1, []byte{0x82})
+		tc.wantGoAway(ErrCodeProtocol)
+	})
+}
+
+func TestSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    Flags
+		streamID uint32
+		payload  []byte
+		code     ErrCode
+	}{
+		{"on a stream", 0, 1, nil, ErrCodeProtocol},
+		{"ack with payload", FlagAck, 0, setting(SettingEnablePush, 0), ErrCodeFrameSize},
+		{"partial setting", 0, 0, []byte{0, 1, 0, 0, 0}, ErrCodeFrameSize},
+		{"invalid enable push", 0, 0, setting(SettingEnablePush, 2), ErrCodeProtocol},
+		{"initial window too large", 0, 0, setting(SettingInitialWindowSize, 1<<31), ErrCodeFlowControl},
+		{"max frame size too small", 0, 0, setting(SettingMaxFrameSize, 1<<14-1), ErrCodeProtocol},
+		{"max frame size too large", 0, 0, setting(SettingMaxFrameSize, 1<<24), ErrCodeProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			tc.write(FrameSettings, tt.flags, tt.streamID, tt.payload)
+			tc.wantGoAway(tt.code)
+		})
+	}
+}
+
+func TestSettingsAccepted(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	payload := setting(0x99, 7) // unknown settings are ignored
+	payload = append(payload, setting(SettingMaxFrameSize, maxAllowedFrameSize)...)
+	payload = append(payload, setting(SettingHeaderTableSize, 0)...)
+	tc.write(FrameSettings, 0, 0, payload)
+	if f := tc.waitFor(FrameSettings, 0); !f.Flags.Has(FlagAck) {
+		t.Errorf("SETTINGS not acknowledged")
+	}
+
+	// With a zero table size the response starts with a size update
+	tc.request(1, "GET", "/", true)
+	f := tc.waitFor(FrameHeaders, 1)
+	if f.Payload[0] != 0x20 {
+		t.Errorf("header block starts with %#x, want a table size update", f.Payload[0])
+	}
+}
+
+func TestFirstFrameMustBeSettings(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go (&Server{Handler: echo}).ServeConn(server, ServeConnOpts{})
+
+	tc := &testConn{t: t, conn: client, fr: newFramer(nil, client), frames: make(chan *Frame, 100)}
+	go tc.readFrames()
+	io.WriteString(client, ClientPreface)
+	tc.write(FramePing, 0, 0, make([]byte, 8))
+	tc.wantGoAway(ErrCodeProtocol)
+}
+
+func TestInitialWindowSize(t *testing.T) {
+	// The client only accepts 10 bytes per stream to begin with
+	tc := newTestConn(t, &Server{}, Setting{SettingInitialWindowSize, 10})
+	tc.request(1, "GET", "/twenty-bytes", true)
+
+	f := tc.waitFor(FrameData, 1)
+	if string(f.Payload) != "GET /twent" {
+		t.Fatalf("first DATA %q, want 10 bytes", f.Payload)
+	}
+
+	// Growing the initial window applies to open streams
+	tc.write(FrameSettings, 0, 0, setting(SettingInitialWindowSize, 15))
+	f = tc.waitFor(FrameData, 1)
+	if string(f.Payload) != "y-byt" {
+		t.Fatalf("second DATA %q, want 5 bytes", f.Payload)
+	}
+
+	tc.write(FrameWindowUpdate, 0, 1, uint32Payload(100))
+	f = tc.waitFor(FrameData, 1)
+	if string(f.Payload) != "es " {
+		t.Errorf("third DATA %q", f.Payload)
+	}
+}
+
+func TestConnectionSendWindow(t *testing.T) {
+	tc := newTestConn(t, &Server{Handler: func(stream http.ResponseStream, request *http.Request) {
+		stream.WriteHeader(http.StatusOK, http.Header{}, false)
+		stream.Write(make([]byte, defaultWindowSize+10))
+		stream.Close()
+	}}, Setting{SettingInitialWindowSize, maxWindowSize})
+
+	tc.request(1, "GET", "/", true)
+	received := 0
+	for received < defaultWindowSize {
+		received += len(tc.waitFor(FrameData, 1).Payload)
+	}
+	if received != defaultWindowSize {
+		t.Fatalf("received %d bytes, want the connection window of %d", received, defaultWindowSize)
+	}
+
+	tc.write(FrameWindowUpdate, 0, 0, uint32Payload(10))
+	if f := tc.waitFor(FrameData, 1); len(f.Payload) != 10 {
+		t.Errorf("DATA of %d bytes after WINDOW_UPDATE, want 10", len(f.Payload))
+	}
+}
+
+func TestWindowUpdateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		streamID uint32
+		payload  []byte
+		code     ErrCode
+	}{
+		{"short payload", 0, []byte{0, 0, 1}, ErrCodeFrameSize},
+		{"zero increment", 0, uint32Payload(0), ErrCodeProtocol},
+		{"connection window overflow", 0, uint32Payload(maxWindowSize), ErrCodeFlowControl},
+		{"idle stream", 5, uint32Payload(1), ErrCodeProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			tc.write(FrameWindowUpdate, 0, tt.streamID, tt.payload)
+			tc.wantGoAway(tt.code)
+		})
+	}
+}
+
+func TestWindowUpdateStreamErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		increment uint32
+		code      ErrCode
+	}{
+		{"zero increment", 0, ErrCodeProtocol},
+		{"stream window overflow", maxWindowSize, ErrCodeFlowControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			tc.request(1, "POST", "/", false)
+			tc.write(FrameWindowUpdate, 0, 1, uint32Payload(tt.increment))
+			tc.wantRSTStream(1, tt.code)
+
+			// The connection carries on
+			tc.request(3, "GET", "/", true)
+			if status, _ := tc.response(3); status != "200" {
+				t.Errorf("status %s after stream error", status)
+			}
+		})
+	}
+}
+
+func TestRSTStreamErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		streamID uint32
+		payload  []byte
+		code     ErrCode
+	}{
+		{"stream 0", 0, uint32Payload(uint32(ErrCodeCancel)), ErrCodeProtocol},
+		{"short payload", 1, []byte{0, 0, 8}, ErrCodeFrameSize},
+		{"idle stream", 1, uint32Payload(uint32(ErrCodeCancel)), ErrCodeProtocol},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			tc.write(FrameRSTStream, 0, tt.streamID, tt.payload)
+			tc.wantGoAway(tt.code)
+		})
+	}
+}
+
+func TestRSTStreamClosesStream(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	tc.request(1, "POST", "/", false)
+	tc.write(FrameRSTStream, 0, 1, uint32Payload(uint32(ErrCodeCancel)))
+
+	// Data after the reset is a stream error, not a connection error
+	tc.write(FrameData, FlagEndStream, 1, []byte("late"))
+	tc.wantRSTStream(1, ErrCodeStreamClosed)
+
+	tc.request(3, "GET", "/", true)
+	if status, _ := tc.response(3); status != "200" {
+		t.Errorf("status %s after reset", status)
+	}
+}
+
+func TestDataErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		streamID uint32
+	}{
+		{"stream 0", 0},
+		{"idle stream", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestConn(t, &Server{})
+			tc.write(FrameData, 0, tt.streamID, []byte("x"))
+			tc.wantGoAway(ErrCodeProtocol)
+		})
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	tc.request(1, "POST", "/", false)
+	// The server gives up after the frame header, so the payload may not
+	// be read
+	tc.fr.writeFrame(FrameData, 0, 1, make([]byte, defaultMaxFrameSize+1))
+	tc.wantGoAway(ErrCodeFrameSize)
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	tc := newTestConn(t, &Server{MaxRequestBodySize: 10})
+	tc.request(1, "POST", "/", false)
+	tc.write(FrameData, 0, 1, []byte("0123456789"))
+	tc.write(FrameData, 0, 1, []byte("x"))
+
+	f := tc.waitFor(FrameHeaders, 1)
+	fields, err := tc.dec.Decode(f.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := fields[0].Value; status != strconv.Itoa(http.StatusContentTooLarge.Code()) {
+		t.Errorf("status %s, want 413", status)
+	}
+	tc.wantRSTStream(1, ErrCodeNo)
+}
+
+func TestContentLengthMismatch(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	block := tc.enc.Encode(nil, []hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":path", Value: "/"},
+		{Name: "content-length", Value: "5"},
+	})
+	tc.write(FrameHeaders, FlagEndHeaders, 1, block)
+	tc.write(FrameData, FlagEndStream, 1, []byte("abc"))
+	tc.wantRSTStream(1, ErrCodeProtocol)
+}
+
+func TestPing(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	tc.write(FramePing, 0, 0, []byte("12345678"))
+	f := tc.waitFor(FramePing, 0)
+	if !f.Flags.Has(FlagAck) || string(f.Payload) != "12345678" {
+		t.Errorf("PING reply flags %#x payload %q", f.Flags, f.Payload)
+	}
+
+	tc.write(FramePing, 0, 0, []byte("1234"))
+	tc.wantGoAway(ErrCodeFrameSize)
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	release := make(chan struct{})
+	tc := newTestConn(t, &Server{MaxConcurrentStreams: 1, Handler: func(stream http.ResponseStream, request *http.Request) {
+		<-release
+		echo(stream, request)
+	}})
+	defer close(release)
+
+	tc.request(1, "GET", "/", true)
+	tc.request(3, "GET", "/", true)
+	tc.wantRSTStream(3, ErrCodeRefusedStream)
+}
+
+func TestClosedStreamHeaders(t *testing.T) {
+	tc := newTestConn(t, &Server{})
+	tc.request(3, "GET", "/", true)
+	tc.response(3)
+
+	// Stream IDs must increase
+	tc.request(1, "GET", "/", true)
+	tc.wantGoAway(ErrCodeStreamClosed)
+}
@@ -0,0 +1,705 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// testClient is a minimal QUIC client, written from RFC 9000 and RFC 9001
+// rather than reusing package quic so that it checks the server
+// independently. It is enough for a handshake and stream exchange over
+// loopback: everything is sent once, every packet is acknowledged at once
+// and flow-control limits are set too high to be reached.
+type testClient struct {
+	t    *testing.T
+	conn *net.UDPConn
+	tls  *tls.QUICConn
+
+	dcid, scid []byte
+	levels     [3]clientLevel
+	confirmed  bool
+
+	nextBidi, nextUni uint64
+	streams           map[uint64]*clientStream
+	sendOffsets       map[uint64]uint64
+	pending           [][]byte
+
+	// closeErr is set once the server closes the connection
+	closeErr *closeError
+}
+
+// clientLevel is the state of one encryption level: Initial, Handshake or
+// 1-RTT
+type clientLevel struct {
+	seal, open *packetKeys
+	nextPN     uint64
+	largest    int64
+	received   []uint64
+	ackPending bool
+
+	cryptoOut    []byte
+	cryptoOffset uint64
+	cryptoIn     map[uint64][]byte
+	cryptoNext   uint64
+}
+
+// clientStream is the data received on a stream
+type clientStream struct {
+	data      []byte
+	have      []bool
+	fin       bool
+	finalSize uint64
+	reset     bool
+	resetCode uint64
+
+	// stopSending is set when the server asks for no more data
+	stopSending bool
+	stopCode    uint64
+}
+
+// closeError is a CONNECTION_CLOSE received from the server
+type closeError struct {
+	app    bool
+	code   uint64
+	reason string
+}
+
+func (e *closeError) Error() string {
+	return fmt.Sprintf("connection closed with %#x (app %v): %s", e.code, e.app, e.reason)
+}
+
+// complete reports whether the whole stream up to its fin was received
+func (s *clientStream) complete() bool {
+	if !s.fin {
+		return false
+	}
+	for _, ok := range s.have[:s.finalSize] {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// prefix returns the data received without a gap from the start
+func (s *clientStream) prefix() []byte {
+	n := 0
+	for n < len(s.have) && s.have[n] {
+		n++
+	}
+	return s.data[:n]
+}
+
+// initialSalt is the QUIC version 1 salt (RFC 9001 Section 5.2)
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// packetKeys protect packets at one level in one direction
+type packetKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len("tls13 "+label)))
+	info = append(info, "tls13 "+label...)
+	info = append(info, 0)
+	out, err := hkdf.Expand(h, secret, string(info), length)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func newPacketKeys(suite uint16, secret []byte) (*packetKeys, error) {
+	h, keyLen := sha256.New, 16
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+	case tls.TLS_AES_256_GCM_SHA384:
+		h, keyLen = sha512.New384, 32
+	default:
+		return nil, fmt.Errorf("unsupported suite %s", tls.CipherSuiteName(suite))
+	}
+
+	block, err := aes.NewCipher(hkdfExpandLabel(h, secret, "quic key", keyLen))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(hkdfExpandLabel(h, secret, "quic hp", keyLen))
+	if err != nil {
+		return nil, err
+	}
+	return &packetKeys{aead: aead, iv: hkdfExpandLabel(h, secret, "quic iv", 12), hp: hp}, nil
+}
+
+func (k *packetKeys) nonce(pn uint64) []byte {
+	nonce := bytes.Clone(k.iv)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return nonce
+}
+
+// mask returns the header protection mask for the packet number at
+// pnOffset
+func (k *packetKeys) mask(pkt []byte, pnOffset int) []byte {
+	mask := make([]byte, 16)
+	k.hp.Encrypt(mask, pkt[pnOffset+4:pnOffset+20])
+	return mask
+}
+
+// dialTestClient completes a handshake with the server at addr
+func dialTestClient(t *testing.T, addr net.Addr, config *tls.Config) *testClient {
+	t.Helper()
+	conn, err := net.DialUDP("udp", nil, addr.(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &testClient{
+		t:           t,
+		conn:        conn,
+		dcid:        make([]byte, 8),
+		scid:        make([]byte, 8),
+		nextUni:     2,
+		streams:     make(map[uint64]*clientStream),
+		sendOffsets: make(map[uint64]uint64),
+	}
+	t.Cleanup(c.close)
+	rand.Read(c.dcid)
+	rand.Read(c.scid)
+	for i := range c.levels {
+		c.levels[i].largest = -1
+		c.levels[i].cryptoIn = make(map[uint64][]byte)
+	}
+
+	initial, err := hkdf.Extract(sha256.New, c.dcid, initialSalt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := uint16(tls.TLS_AES_128_GCM_SHA256)
+	c.levels[0].seal, _ = newPacketKeys(suite, hkdfExpandLabel(sha256.New, initial, "client in", 32))
+	c.levels[0].open, _ = newPacketKeys(suite, hkdfExpandLabel(sha256.New, initial, "server in", 32))
+
+	var params []byte
+	appendParam := func(id, v uint64) {
+		params = quic.AppendVarint(params, id)
+		params = quic.AppendVarint(params, uint64(quic.VarintLen(v)))
+		params = quic.AppendVarint(params, v)
+	}
+	params = quic.AppendVarint(params, 0x0f)
+	params = quic.AppendVarint(params, uint64(len(c.scid)))
+	params = append(params, c.scid...)
+	appendParam(0x01, 30000) // max_idle_timeout
+	appendParam(0x04, 1<<24) // initial_max_data
+	appendParam(0x05, 1<<24) // initial_max_stream_data_bidi_local
+	appendParam(0x07, 1<<24) // initial_max_stream_data_uni
+	appendParam(0x09, 3)     // initial_max_streams_uni
+
+	c.tls = tls.QUICClient(&tls.QUICConfig{TLSConfig: config})
+	c.tls.SetTransportParameters(params)
+	if err := c.tls.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c.processTLSEvents()
+	c.flush()
+
+	c.waitFor("the handshake", func() bool { return c.confirmed })
+	return c
+}
+
+// close sends CONNECTION_CLOSE with H3_NO_ERROR and closes the socket
+func (c *testClient) close() {
+	if c.closeErr == nil && c.levels[2].seal != nil {
+		frame := []byte{0x1d}
+		frame = quic.AppendVarint(frame, uint64(ErrCodeNo))
+		frame = quic.AppendVarint(frame, 0)
+		c.sendPacket(2, frame)
+	}
+	c.tls.Close()
+	c.conn.Close()
+}
+
+// processTLSEvents installs keys and queues handshake data from TLS
+func (c *testClient) processTLSEvents() {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			k, err := newPacketKeys(e.Suite, bytes.Clone(e.Data))
+			if err != nil {
+				c.t.Fatal(err)
+			}
+			level := clientLevelIndex(e.Level)
+			if e.Kind == tls.QUICSetReadSecret {
+				c.levels[level].open = k
+			} else {
+				c.levels[level].seal = k
+			}
+		case tls.QUICWriteData:
+			level := &c.levels[clientLevelIndex(e.Level)]
+			level.cryptoOut = append(level.cryptoOut, e.Data...)
+		}
+	}
+}
+
+func clientLevelIndex(level tls.QUICEncryptionLevel) int {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return 0
+	case tls.QUICEncryptionLevelHandshake:
+		return 1
+	}
+	return 2
+}
+
+// openStream returns the ID of the next bidirectional stream
+func (c *testClient) openStream() uint64 {
+	id := c.nextBidi
+	c.nextBidi += 4
+	return id
+}
+
+// openUniStream returns the ID of the next unidirectional stream
+func (c *testClient) openUniStream() uint64 {
+	id := c.nextUni
+	c.nextUni += 4
+	return id
+}
+
+// write sends data on a stream, ending it if fin is set
+func (c *testClient) write(id uint64, data []byte, fin bool) {
+	for {
+		n := min(len(data), 1000)
+		frame := []byte{0x08 | 0x04 | 0x02}
+		if fin && n == len(data) {
+			frame[0] |= 0x01
+		}
+		frame = quic.AppendVarint(frame, id)
+		frame = quic.AppendVarint(frame, c.sendOffsets[id])
+		frame = quic.AppendVarint(frame, uint64(n))
+		frame = append(frame, data[:n]...)
+		c.pending = append(c.pending, frame)
+		c.sendOffsets[id] += uint64(n)
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+	}
+	c.flush()
+}
+
+// stream returns what was received on a stream so far
+func (c *testClient) stream(id uint64) *clientStream {
+	st, ok := c.streams[id]
+	if !ok {
+		st = &clientStream{}
+		c.streams[id] = st
+	}
+	return st
+}
+
+// readStream waits for a stream to end and returns its data
+func (c *testClient) readStream(id uint64) []byte {
+	c.t.Helper()
+	st := c.stream(id)
+	c.waitFor(fmt.Sprintf("stream %d to end", id), func() bool { return st.complete() || st.reset })
+	if st.reset {
+		c.t.Fatalf("stream %d reset with %s", id, ErrCode(st.resetCode))
+	}
+	return st.data[:st.finalSize]
+}
+
+// waitFor reads packets until done returns true, failing the test after
+// five seconds or if the connection is closed
+func (c *testClient) waitFor(what string, done func() bool) {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if c.closeErr != nil {
+			c.t.Fatalf("waiting for %s: %v", what, c.closeErr)
+		}
+		c.receive(what, deadline)
+	}
+}
+
+// waitForClose reads packets until the server closes the connection
+func (c *testClient) waitForClose() *closeError {
+	c.t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.closeErr == nil {
+		c.receive("CONNECTION_CLOSE", deadline)
+	}
+	return c.closeErr
+}
+
+// receive processes one datagram and sends what it calls for
+func (c *testClient) receive(what string, deadline time.Time) {
+	c.t.Helper()
+	buf := make([]byte, 2048)
+	c.conn.SetReadDeadline(deadline)
+	n, err := c.conn.Read(buf)
+	if err != nil {
+		c.t.Fatalf("waiting for %s: %v", what, err)
+	}
+	c.handleDatagram(buf[:n])
+	c.flush()
+}
+
+// handleDatagram processes the packets coalesced in a datagram
+func (c *testClient) handleDatagram(d []byte) {
+	for len(d) > 0 {
+		var level, pnOffset, end int
+		if d[0]&0x80 != 0 {
+			r := bytes.NewReader(d[5:])
+			dcid := make([]byte, readByte(r))
+			io.ReadFull(r, dcid)
+			scid := make([]byte, readByte(r))
+			io.ReadFull(r, scid)
+			switch d[0] >> 4 & 0x3 {
+			case 0x0:
+				level = 0
+				token, _ := quic.ReadVarint(r)
+				r.Seek(int64(token), io.SeekCurrent)
+			case 0x2:
+				level = 1
+			default:
+				c.t.Fatalf("unexpected long header packet %#x", d[0])
+			}
+			length, _ := quic.ReadVarint(r)
+			pnOffset = len(d) - r.Len()
+			end = pnOffset + int(length)
+			if level == 0 && c.levels[0].largest < 0 {
+				// The server's first Initial chooses its connection ID
+				c.dcid = scid
+			}
+		} else {
+			level = 2
+			pnOffset = 1 + len(c.scid)
+			end = len(d)
+		}
+
+		if end > len(d) {
+			c.t.Fatalf("packet of %d bytes in a datagram of %d", end, len(d))
+		}
+		c.handlePacket(level, d[:end], pnOffset)
+		d = d[end:]
+	}
+}
+
+// handlePacket removes the protection of a packet and processes its frames
+func (c *testClient) handlePacket(level int, pkt []byte, pnOffset int) {
+	l := &c.levels[level]
+	if l.open == nil {
+		return
+	}
+
+	mask := l.open.mask(pkt, pnOffset)
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	pnLen := int(pkt[0]&0x3) + 1
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(pkt[pnOffset+i])
+	}
+
+	// RFC 9000 Appendix A.3
+	expected := uint64(l.largest + 1)
+	win := uint64(1) << (8 * pnLen)
+	pn := expected&^(win-1) | truncated
+	switch {
+	case pn+win/2 <= expected:
+		pn += win
+	case pn > expected+win/2 && pn >= win:
+		pn -= win
+	}
+
+	hdrLen := pnOffset + pnLen
+	payload, err := l.open.aead.Open(nil, l.open.nonce(pn), pkt[hdrLen:], pkt[:hdrLen])
+	if err != nil {
+		c.t.Fatalf("level %d packet %d: %v", level, pn, err)
+	}
+
+	if i, found := slices.BinarySearch(l.received, pn); !found {
+		l.received = slices.Insert(l.received, i, pn)
+	}
+	l.largest = max(l.largest, int64(pn))
+	c.handleFrames(level, payload)
+}
+
+// handleFrames processes the frames in a packet payload
+func (c *testClient) handleFrames(level int, payload []byte) {
+	r := bytes.NewReader(payload)
+	varint := func() uint64 {
+		v, err := quic.ReadVarint(r)
+		if err != nil {
+			c.t.Fatalf("truncated frame: %v", err)
+		}
+		return v
+	}
+	read := func(n uint64) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			c.t.Fatalf("truncated frame: %v", err)
+		}
+		return b
+	}
+
+	for r.Len() > 0 {
+		typ := varint()
+		if typ != 0x00 && typ != 0x02 && typ != 0x03 && typ != 0x1c && typ != 0x1d {
+			c.levels[level].ackPending = true
+		}
+
+		switch {
+		case typ == 0x00, typ == 0x01: // PADDING, PING
+		case typ == 0x02, typ == 0x03: // ACK
+			varint()
+			varint()
+			ranges := varint()
+			varint()
+			for i := uint64(0); i < 2*ranges; i++ {
+				varint()
+			}
+			if typ == 0x03 {
+				varint()
+				varint()
+				varint()
+			}
+		case typ == 0x04: // RESET_STREAM
+			st := c.stream(varint())
+			st.reset, st.resetCode = true, varint()
+			varint()
+		case typ == 0x05: // STOP_SENDING
+			st := c.stream(varint())
+			st.stopSending, st.stopCode = true, varint()
+		case typ == 0x06: // CRYPTO
+			offset := varint()
+			c.handleCrypto(level, offset, read(varint()))
+		case typ >= 0x08 && typ <= 0x0f: // STREAM
+			id := varint()
+			var offset uint64
+			if typ&0x04 != 0 {
+				offset = varint()
+			}
+			var data []byte
+			if typ&0x02 != 0 {
+				data = read(varint())
+			} else {
+				data = read(uint64(r.Len()))
+			}
+			c.handleStream(id, offset, data, typ&0x01 != 0)
+		case typ == 0x10, typ == 0x12, typ == 0x13, typ == 0x14, typ == 0x16, typ == 0x17, typ == 0x19:
+			varint()
+		case typ == 0x11, typ == 0x15:
+			varint()
+			varint()
+		case typ == 0x18: // NEW_CONNECTION_ID
+			varint()
+			varint()
+			read(uint64(readByte(r)) + 16)
+		case typ == 0x1c, typ == 0x1d: // CONNECTION_CLOSE
+			code := varint()
+			if typ == 0x1c {
+				varint()
+			}
+			c.closeErr = &closeError{app: typ == 0x1d, code: code, reason: string(read(varint()))}
+		case typ == 0x1e: // HANDSHAKE_DONE
+			c.confirmed = true
+		default:
+			c.t.Fatalf("unexpected frame type %#x", typ)
+		}
+	}
+}
+
+// handleCrypto passes CRYPTO data to TLS in order
+func (c *testClient) handleCrypto(level int, offset uint64, data []byte) {
+	l := &c.levels[level]
+	l.cryptoIn[offset] = data
+	for {
+		progress := false
+		for off, chunk := range l.cryptoIn {
+			if off > l.cryptoNext {
+				continue
+			}
+			delete(l.cryptoIn, off)
+			if off+uint64(len(chunk)) <= l.cryptoNext {
+				continue
+			}
+			chunk = chunk[l.cryptoNext-off:]
+			tlsLevel := []tls.QUICEncryptionLevel{tls.QUICEncryptionLevelInitial, tls.QUICEncryptionLevelHandshake, tls.QUICEncryptionLevelApplication}[level]
+			if err := c.tls.HandleData(tlsLevel, chunk); err != nil {
+				c.t.Fatalf("TLS: %v", err)
+			}
+			l.cryptoNext += uint64(len(chunk))
+			c.processTLSEvents()
+			progress = true
+		}
+		if !progress {
+			return
+		}
+	}
+}
+
+// handleStream stores STREAM data
+func (c *testClient) handleStream(id, offset uint64, data []byte, fin bool) {
+	st := c.stream(id)
+	end := offset + uint64(len(data))
+	if uint64(len(st.data)) < end {
+		st.data = append(st.data, make([]byte, end-uint64(len(st.data)))...)
+		st.have = append(st.have, make([]bool, end-uint64(len(st.have)))...)
+	}
+	copy(st.data[offset:], data)
+	for i := offset; i < end; i++ {
+		st.have[i] = true
+	}
+	if fin {
+		st.fin, st.finalSize = true, end
+	}
+}
+
+// flush sends ACKs and pending data at every level that has keys
+func (c *testClient) flush() {
+	for level := range c.levels {
+		l := &c.levels[level]
+		if l.seal == nil || level == 1 && c.confirmed {
+			continue
+		}
+
+		var payload []byte
+		if l.ackPending {
+			payload = appendTestAck(payload, l.received)
+			l.ackPending = false
+		}
+		if len(l.cryptoOut) > 0 {
+			payload = append(payload, 0x06)
+			payload = quic.AppendVarint(payload, l.cryptoOffset)
+			payload = quic.AppendVarint(payload, uint64(len(l.cryptoOut)))
+			payload = append(payload, l.cryptoOut...)
+			l.cryptoOffset += uint64(len(l.cryptoOut))
+			l.cryptoOut = nil
+		}
+		if len(payload) > 0 {
+			c.sendPacket(level, payload)
+		}
+	}
+
+	if c.levels[2].seal != nil {
+		for _, frame := range c.pending {
+			c.sendPacket(2, frame)
+		}
+		c.pending = nil
+	}
+}
+
+// appendTestAck appends an ACK frame for the sorted packet numbers
+func appendTestAck(b []byte, pns []uint64) []byte {
+	type span struct{ lo, hi uint64 }
+	var spans []span
+	for i := len(pns) - 1; i >= 0; {
+		j := i
+		for j > 0 && pns[j-1] == pns[j]-1 {
+			j--
+		}
+		spans = append(spans, span{pns[j], pns[i]})
+		i = j - 1
+	}
+
+	b = append(b, 0x02)
+	b = quic.AppendVarint(b, spans[0].hi)
+	b = quic.AppendVarint(b, 0)
+	b = quic.AppendVarint(b, uint64(len(spans)-1))
+	b = quic.AppendVarint(b, spans[0].hi-spans[0].lo)
+	for i := 1; i < len(spans); i++ {
+		b = quic.AppendVarint(b, spans[i-1].lo-spans[i].hi-2)
+		b = quic.AppendVarint(b, spans[i].hi-spans[i].lo)
+	}
+	return b
+}
+
+// sendPacket sends a packet at a level in its own datagram, padding
+// Initial packets to 1200 bytes
+func (c *testClient) sendPacket(level int, payload []byte) {
+	l := &c.levels[level]
+	pn := l.nextPN
+	l.nextPN++
+
+	var pkt []byte
+	if level == 2 {
+		pkt = append(pkt, 0x40|0x03)
+		pkt = append(pkt, c.dcid...)
+	} else {
+		typ := byte(0x0)
+		if level == 1 {
+			typ = 0x2
+		}
+		pkt = append(pkt, 0xc0|typ<<4|0x03)
+		pkt = binary.BigEndian.AppendUint32(pkt, quic.Version1)
+		pkt = append(pkt, byte(len(c.dcid)))
+		pkt = append(pkt, c.dcid...)
+		pkt = append(pkt, byte(len(c.scid)))
+		pkt = append(pkt, c.scid...)
+		if level == 0 {
+			pkt = append(pkt, 0)
+			if n := 1200 - (len(pkt) + 2 + 4 + len(payload) + 16); n > 0 {
+				payload = append(payload, make([]byte, n)...)
+			}
+		}
+		pkt = binary.BigEndian.AppendUint16(pkt, 0x4000|uint16(4+len(payload)+16))
+	}
+
+	pnOffset := len(pkt)
+	pkt = binary.BigEndian.AppendUint32(pkt, uint32(pn))
+	pkt = l.seal.aead.Seal(pkt, l.seal.nonce(pn), payload, bytes.Clone(pkt))
+
+	mask := l.seal.mask(pkt, pnOffset)
+	if level == 2 {
+		pkt[0] ^= mask[0] & 0x1f
+	} else {
+		pkt[0] ^= mask[0] & 0x0f
+	}
+	for i := 0; i < 4; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+	}
+
+	if _, err := c.conn.Write(pkt); err != nil && !errors.Is(err, net.ErrClosed) {
+		c.t.Fatal(err)
+	}
+}
+
+func readByte(r *bytes.Reader) byte {
+	b, _ := r.ReadByte()
+	return b
+}
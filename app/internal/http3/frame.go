@@ -0,0 +1,250 @@
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// FrameType identifies the kind of a frame
+type FrameType uint64
+
+// Frame types (RFC 9114 Section 7.2)
+const (
+	FrameData        FrameType = 0x0
+	FrameHeaders     FrameType = 0x1
+	FrameCancelPush  FrameType = 0x3
+	FrameSettings    FrameType = 0x4
+	FramePushPromise FrameType = 0x5
+	FrameGoAway      FrameType = 0x7
+	FrameMaxPushID   FrameType = 0xd
+)
+
+var frameTypeNames = map[FrameType]string{
+	FrameData:        "DATA",
+	FrameHeaders:     "HEADERS",
+	FrameCancelPush:  "CANCEL_PUSH",
+	FrameSettings:    "SETTINGS",
+	FramePushPromise: "PUSH_PROMISE",
+	FrameGoAway:      "GOAWAY",
+	FrameMaxPushID:   "MAX_PUSH_ID",
+}
+
+// String returns the type's name from the specification
+func (t FrameType) String() string {
+	if name, ok := frameTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_0x%x", uint64(t))
+}
+
+// reservedHTTP2Frame reports whether a frame type only exists in HTTP/2,
+// which is an error to receive (RFC 9114 Section 7.2.8)
+func reservedHTTP2Frame(t FrameType) bool {
+	switch t {
+	case 0x2, 0x6, 0x8, 0x9:
+		return true
+	}
+	return false
+}
+
+// Unidirectional stream types (RFC 9114 Section 6.2, RFC 9204 Section 4.2)
+const (
+	streamControl      = 0x00
+	streamPush         = 0x01
+	streamQPACKEncoder = 0x02
+	streamQPACKDecoder = 0x03
+)
+
+// SettingID identifies a setting in a SETTINGS frame
+type SettingID uint64
+
+// Settings (RFC 9114 Section 7.2.4.1, RFC 9204 Section 5)
+const (
+	SettingQPACKMaxTableCapacity SettingID = 0x1
+	SettingMaxFieldSectionSize   SettingID = 0x6
+	SettingQPACKBlockedStreams   SettingID = 0x7
+)
+
+// reservedHTTP2Setting reports whether a setting only exists in HTTP/2
+func reservedHTTP2Setting(id SettingID) bool {
+	return id >= 0x2 && id <= 0x5
+}
+
+// ErrCode is an application error code carried by QUIC CONNECTION_CLOSE,
+// RESET_STREAM and STOP_SENDING frames
+type ErrCode uint64
+
+// Error codes (RFC 9114 Section 8.1, RFC 9204 Section 6)
+const (
+	ErrCodeNo                   ErrCode = 0x100
+	ErrCodeGeneralProtocol      ErrCode = 0x101
+	ErrCodeInternal             ErrCode = 0x102
+	ErrCodeStreamCreation       ErrCode = 0x103
+	ErrCodeClosedCriticalStream ErrCode = 0x104
+	ErrCodeFrameUnexpected      ErrCode = 0x105
+	ErrCodeFrame                ErrCode = 0x106
+	ErrCodeExcessiveLoad        ErrCode = 0x107
+	ErrCodeID                   ErrCode = 0x108
+	ErrCodeSettings             ErrCode = 0x109
+	ErrCodeMissingSettings      ErrCode = 0x10a
+	ErrCodeRequestRejected      ErrCode = 0x10b
+	ErrCodeRequestCancelled     ErrCode = 0x10c
+	ErrCodeRequestIncomplete    ErrCode = 0x10d
+	ErrCodeMessage              ErrCode = 0x10e
+	ErrCodeConnect              ErrCode = 0x10f
+	ErrCodeVersionFallback      ErrCode = 0x110
+	ErrCodeQPACKDecompression   ErrCode = 0x200
+)
+
+var errCodeNames = map[ErrCode]string{
+	ErrCodeNo:                   "H3_NO_ERROR",
+	ErrCodeGeneralProtocol:      "H3_GENERAL_PROTOCOL_ERROR",
+	ErrCodeInternal:             "H3_INTERNAL_ERROR",
+	ErrCodeStreamCreation:       "H3_STREAM_CREATION_ERROR",
+	ErrCodeClosedCriticalStream: "H3_CLOSED_CRITICAL_STREAM",
+	ErrCodeFrameUnexpected:      "H3_FRAME_UNEXPECTED",
+	ErrCodeFrame:                "H3_FRAME_ERROR",
+	ErrCodeExcessiveLoad:        "H3_EXCESSIVE_LOAD",
+	ErrCodeID:                   "H3_ID_ERROR",
+	ErrCodeSettings:             "H3_SETTINGS_ERROR",
+	ErrCodeMissingSettings:      "H3_MISSING_SETTINGS",
+	ErrCodeRequestRejected:      "H3_REQUEST_REJECTED",
+	ErrCodeRequestCancelled:     "H3_REQUEST_CANCELLED",
+	ErrCodeRequestIncomplete:    "H3_REQUEST_INCOMPLETE",
+	ErrCodeMessage:              "H3_MESSAGE_ERROR",
+	ErrCodeConnect:              "H3_CONNECT_ERROR",
+	ErrCodeVersionFallback:      "H3_VERSION_FALLBACK",
+	ErrCodeQPACKDecompression:   "QPACK_DECOMPRESSION_FAILED",
+}
+
+// String returns the code's name from the specification
+func (c ErrCode) String() string {
+	if name, ok := errCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_ERROR_CODE_0x%x", uint64(c))
+}
+
+// ConnError is a connection error: the QUIC connection is closed with
+// Code
+type ConnError struct {
+	Code   ErrCode
+	Reason string
+}
+
+// Error implements the error interface
+func (e ConnError) Error() string {
+	return fmt.Sprintf("http3: connection error %s: %s", e.Code, e.Reason)
+}
+
+// StreamError is a stream error: only the stream is reset with Code
+type StreamError struct {
+	StreamID uint64
+	Code     ErrCode
+	Reason   string
+}
+
+// Error implements the error interface
+func (e StreamError) Error() string {
+	return fmt.Sprintf("http3: stream %d error %s: %s", e.StreamID, e.Code, e.Reason)
+}
+
+// readFrameHeader reads the type and length of the next frame, skipping
+// frames of unknown types, which must be ignored. It returns io.EOF only
+// if the stream ends between frames.
+func readFrameHeader(r *bufio.Reader) (FrameType, uint64, error) {
+	for {
+		t, err := quic.ReadVarint(r)
+		if err != nil {
+			return 0, 0, err
+		}
+		length, err := quic.ReadVarint(r)
+		if err != nil {
+			return 0, 0, truncated(err)
+		}
+
+		typ := FrameType(t)
+		if _, known := frameTypeNames[typ]; known {
+			return typ, length, nil
+		}
+		if reservedHTTP2Frame(typ) {
+			return 0, 0, ConnError{Code: ErrCodeFrameUnexpected, Reason: fmt.Sprintf("HTTP/2 frame type 0x%x", t)}
+		}
+		if length > math.MaxInt32 {
+			return 0, 0, ConnError{Code: ErrCodeExcessiveLoad, Reason: "frame too large"}
+		}
+		if _, err := r.Discard(int(length)); err != nil {
+			return 0, 0, truncated(err)
+		}
+	}
+}
+
+// readPayload reads a frame payload of length bytes, refusing more than
+// max
+func readPayload(r io.Reader, length, max uint64) ([]byte, error) {
+	if length > max {
+		return nil, ConnError{Code: ErrCodeExcessiveLoad, Reason: fmt.Sprintf("frame of %d bytes", length)}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, truncated(err)
+	}
+	return payload, nil
+}
+
+// truncated turns the end of a stream inside a frame into a FRAME_ERROR
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ConnError{Code: ErrCodeFrame, Reason: "stream ended inside a frame"}
+	}
+	return err
+}
+
+// appendFrameHeader appends the type and length that start a frame
+func appendFrameHeader(b []byte, typ FrameType, length int) []byte {
+	b = quic.AppendVarint(b, uint64(typ))
+	return quic.AppendVarint(b, uint64(length))
+}
+
+// appendSettings appends a SETTINGS frame
+func appendSettings(b []byte, settings map[SettingID]uint64) []byte {
+	var payload []byte
+	for id, value := range settings {
+		payload = quic.AppendVarint(payload, uint64(id))
+		payload = quic.AppendVarint(payload, value)
+	}
+	b = appendFrameHeader(b, FrameSettings, len(payload))
+	return append(b, payload...)
+}
+
+// parseSettings checks the payload of the client's SETTINGS frame. None
+// of its values matter to this server: no dynamic table is used and
+// response field sections are small.
+func parseSettings(payload []byte) error {
+	seen := make(map[SettingID]bool)
+	r := bytes.NewReader(payload)
+	for {
+		id, err := quic.ReadVarint(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err == nil {
+			_, err = quic.ReadVarint(r)
+		}
+		if err != nil {
+			return ConnError{Code: ErrCodeFrame, Reason: "malformed SETTINGS"}
+		}
+
+		setting := SettingID(id)
+		if reservedHTTP2Setting(setting) || seen[setting] {
+			return ConnError{Code: ErrCodeSettings, Reason: fmt.Sprintf("invalid setting 0x%x", id)}
+		}
+		seen[setting] = true
+	}
+}
@@ -0,0 +1,146 @@
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// connErrCode returns the code of a ConnError, or 0 for other errors
+func connErrCode(err error) ErrCode {
+	var ce ConnError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return 0
+}
+
+func TestReadFrameHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		hex    string
+		typ    FrameType
+		length uint64
+		code   ErrCode
+	}{
+		{"data", "0005", FrameData, 5, 0},
+		{"headers with a two-byte length", "014100", FrameHeaders, 256, 0},
+		{"settings", "0400", FrameSettings, 0, 0},
+		// Unknown and reserved types (0x1f * N + 0x21) are skipped
+		{"unknown frame skipped", "2103616263" + "0102", FrameHeaders, 2, 0},
+		{"several unknown frames skipped", "2100" + "4040016a" + "0701", FrameGoAway, 1, 0},
+		{"HTTP/2 PRIORITY", "0200", 0, 0, ErrCodeFrameUnexpected},
+		{"HTTP/2 PING", "0608" + "0000000000000000", 0, 0, ErrCodeFrameUnexpected},
+		{"HTTP/2 WINDOW_UPDATE", "0804" + "00000001", 0, 0, ErrCodeFrameUnexpected},
+		{"HTTP/2 CONTINUATION", "0900", 0, 0, ErrCodeFrameUnexpected},
+		{"missing length", "01", 0, 0, ErrCodeFrame},
+		{"truncated length", "0140", 0, 0, ErrCodeFrame},
+		{"truncated unknown frame", "210561", 0, 0, ErrCodeFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			typ, length, err := readFrameHeader(bufio.NewReader(bytes.NewReader(unhex(t, tt.hex))))
+			if tt.code != 0 {
+				if got := connErrCode(err); got != tt.code {
+					t.Errorf("error = %v, want %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil || typ != tt.typ || length != tt.length {
+				t.Errorf("readFrameHeader = %s, %d, %v; want %s, %d", typ, length, err, tt.typ, tt.length)
+			}
+		})
+	}
+}
+
+func TestReadFrameHeaderEOF(t *testing.T) {
+	// The end of the stream between frames is not an error in itself
+	r := bufio.NewReader(bytes.NewReader(unhex(t, "2100")))
+	if _, _, err := readFrameHeader(r); err != io.EOF {
+		t.Errorf("error = %v, want EOF", err)
+	}
+}
+
+func TestReadPayload(t *testing.T) {
+	p, err := readPayload(bytes.NewReader([]byte("hello")), 5, 5)
+	if err != nil || string(p) != "hello" {
+		t.Errorf("readPayload = %q, %v", p, err)
+	}
+	if _, err := readPayload(bytes.NewReader([]byte("hello")), 5, 4); connErrCode(err) != ErrCodeExcessiveLoad {
+		t.Errorf("over max: error = %v, want H3_EXCESSIVE_LOAD", err)
+	}
+	if _, err := readPayload(bytes.NewReader([]byte("hel")), 5, 5); connErrCode(err) != ErrCodeFrame {
+		t.Errorf("truncated: error = %v, want H3_FRAME_ERROR", err)
+	}
+}
+
+func TestParseSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		code ErrCode
+	}{
+		{"empty", "", 0},
+		{"known settings", "0100" + "064400" + "0710", 0},
+		{"unknown setting", "4a0a05", 0},
+		{"duplicate", "0601" + "0602", ErrCodeSettings},
+		{"HTTP/2 ENABLE_PUSH", "0200", ErrCodeSettings},
+		{"HTTP/2 MAX_FRAME_SIZE", "0540ff", ErrCodeSettings},
+		{"missing value", "06", ErrCodeFrame},
+		{"truncated value", "0640", ErrCodeFrame},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := connErrCode(parseSettings(unhex(t, tt.hex))); got != tt.code {
+				t.Errorf("error code = %s, want %s", got, tt.code)
+			}
+		})
+	}
+}
+
+func TestAppendSettings(t *testing.T) {
+	b := appendSettings(nil, map[SettingID]uint64{
+		SettingQPACKMaxTableCapacity: 0,
+		SettingMaxFieldSectionSize:   1 << 16,
+	})
+	r := bufio.NewReader(bytes.NewReader(b))
+	typ, length, err := readFrameHeader(r)
+	if err != nil || typ != FrameSettings {
+		t.Fatalf("readFrameHeader = %s, %v", typ, err)
+	}
+	payload, err := readPayload(r, length, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0x01 0x00, and 0x06 with a four-byte varint
+	if len(payload) != 7 {
+		t.Errorf("payload %x, want 7 bytes", payload)
+	}
+	if err := parseSettings(payload); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrCodeString(t *testing.T) {
+	if got := ErrCodeExcessiveLoad.String(); got != "H3_EXCESSIVE_LOAD" {
+		t.Errorf("String = %q", got)
+	}
+	if got := ErrCode(0x1f).String(); got != "UNKNOWN_ERROR_CODE_0x1f" {
+		t.Errorf("String = %q", got)
+	}
+	if got := FrameType(0x21).String(); got != "UNKNOWN_FRAME_TYPE_0x21" {
+		t.Errorf("String = %q", got)
+	}
+}
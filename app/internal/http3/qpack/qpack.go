@@ -0,0 +1,247 @@
+// Package qpack implements QPACK, the header compression of HTTP/3
+// (RFC 9204), using only the static table. This side advertises a
+// dynamic table capacity of zero, so peers never reference one, and
+// encodes without one, so no encoder or decoder streams are needed.
+package qpack
+
+import (
+	"errors"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+)
+
+// Errors returned while decoding a field section. Any of them is a
+// connection error of type QPACK_DECOMPRESSION_FAILED.
+var (
+	ErrIntegerOverflow  = errors.New("qpack: integer overflow")
+	ErrTruncated        = errors.New("qpack: truncated field section")
+	ErrInvalidIndex     = errors.New("qpack: invalid static table index")
+	ErrDynamicReference = errors.New("qpack: reference to the dynamic table")
+	ErrHeaderListTooBig = errors.New("qpack: header list too large")
+)
+
+// Decode decodes a complete field section. maxListSize bounds the fields'
+// total size as counted for SETTINGS_MAX_FIELD_SECTION_SIZE.
+func Decode(block []byte, maxListSize uint32) ([]hpack.HeaderField, error) {
+	// The prefix holds the Required Insert Count, which must be zero
+	// without a dynamic table, and a base that is then meaningless
+	insertCount, block, err := readInt(block, 8)
+	if err != nil {
+		return nil, err
+	}
+	if insertCount != 0 {
+		return nil, ErrDynamicReference
+	}
+	if _, block, err = readInt(block, 7); err != nil {
+		return nil, err
+	}
+
+	var fields []hpack.HeaderField
+	var listSize uint32
+	for len(block) > 0 {
+		var f hpack.HeaderField
+		b := block[0]
+		switch {
+		case b&0x80 != 0:
+			// Indexed field line
+			if b&0x40 == 0 {
+				return nil, ErrDynamicReference
+			}
+			var index uint64
+			if index, block, err = readInt(block, 6); err != nil {
+				return nil, err
+			}
+			if f, err = staticField(index); err != nil {
+				return nil, err
+			}
+
+		case b&0x40 != 0:
+			// Literal field line with name reference
+			if b&0x10 == 0 {
+				return nil, ErrDynamicReference
+			}
+			var index uint64
+			if index, block, err = readInt(block, 4); err != nil {
+				return nil, err
+			}
+			name, err := staticField(index)
+			if err != nil {
+				return nil, err
+			}
+			f.Name = name.Name
+			if f.Value, block, err = readString(block, 7); err != nil {
+				return nil, err
+			}
+			f.Sensitive = b&0x20 != 0
+
+		case b&0x20 != 0:
+			// Literal field line with literal name
+			if f.Name, block, err = readString(block, 3); err != nil {
+				return nil, err
+			}
+			if f.Value, block, err = readString(block, 7); err != nil {
+				return nil, err
+			}
+			f.Sensitive = b&0x10 != 0
+
+		default:
+			// Post-base references only exist with a dynamic table
+			return nil, ErrDynamicReference
+		}
+
+		listSize += f.Size()
+		if listSize > maxListSize {
+			return nil, ErrHeaderListTooBig
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// staticField returns a static table entry
+func staticField(index uint64) (hpack.HeaderField, error) {
+	if index >= uint64(len(staticTable)) {
+		return hpack.HeaderField{}, ErrInvalidIndex
+	}
+	return staticTable[index], nil
+}
+
+// Encode appends a field section for fields to dst
+func Encode(dst []byte, fields []hpack.HeaderField) []byte {
+	// Required Insert Count and Delta Base are both zero
+	dst = append(dst, 0x00, 0x00)
+
+	for _, f := range fields {
+		index, exact := search(f)
+		switch {
+		case exact && !f.Sensitive:
+			dst = appendInt(dst, 0xc0, 6, uint64(index))
+
+		case index >= 0:
+			pattern := byte(0x50)
+			if f.Sensitive {
+				pattern |= 0x20
+			}
+			dst = appendInt(dst, pattern, 4, uint64(index))
+			dst = appendString(dst, 0x00, 7, f.Value)
+
+		default:
+			pattern := byte(0x20)
+			if f.Sensitive {
+				pattern |= 0x10
+			}
+			dst = appendString(dst, pattern, 3, f.Name)
+			dst = appendString(dst, 0x00, 7, f.Value)
+		}
+	}
+	return dst
+}
+
+// search returns the index of a static entry matching f exactly, or
+// failing that one with the same name, and whether the match was exact.
+// It returns -1 if no entry has the name.
+func search(f hpack.HeaderField) (index int, exact bool) {
+	index = -1
+	for i, entry := range staticTable {
+		if entry.Name != f.Name {
+			continue
+		}
+		if entry.Value == f.Value {
+			return i, true
+		}
+		if index < 0 {
+			index = i
+		}
+	}
+	return index, false
+}
+
+// readInt reads an integer with an N-bit prefix (RFC 7541 Section 5.1)
+func readInt(block []byte, prefix uint8) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, ErrTruncated
+	}
+
+	mask := uint64(1)<<prefix - 1
+	value := uint64(block[0]) & mask
+	block = block[1:]
+	if value < mask {
+		return value, block, nil
+	}
+
+	shift := uint(0)
+	for {
+		if len(block) == 0 {
+			return 0, nil, ErrTruncated
+		}
+		b := block[0]
+		block = block[1:]
+
+		value += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, block, nil
+		}
+
+		shift += 7
+		if shift > 56 {
+			return 0, nil, ErrIntegerOverflow
+		}
+	}
+}
+
+// readString reads a string literal whose length has an N-bit prefix,
+// preceded by the bit marking Huffman coding
+func readString(block []byte, prefix uint8) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, ErrTruncated
+	}
+	huffman := block[0]&(1<<prefix) != 0
+
+	length, block, err := readInt(block, prefix)
+	if err != nil {
+		return "", nil, err
+	}
+	if length > uint64(len(block)) {
+		return "", nil, ErrTruncated
+	}
+
+	data := block[:length]
+	block = block[length:]
+
+	if !huffman {
+		return string(data), block, nil
+	}
+	s, err := hpack.HuffmanDecode(data)
+	if err != nil {
+		return "", nil, err
+	}
+	return s, block, nil
+}
+
+// appendInt appends an integer with an N-bit prefix after pattern
+func appendInt(dst []byte, pattern byte, prefix uint8, value uint64) []byte {
+	mask := uint64(1)<<prefix - 1
+	if value < mask {
+		return append(dst, pattern|byte(value))
+	}
+
+	dst = append(dst, pattern|byte(mask))
+	value -= mask
+	for value >= 0x80 {
+		dst = append(dst, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+	return append(dst, byte(value))
+}
+
+// appendString appends a string literal whose length has an N-bit prefix
+// after pattern, Huffman-coded if that is shorter
+func appendString(dst []byte, pattern byte, prefix uint8, s string) []byte {
+	if n := hpack.HuffmanEncodedLen(s); n < len(s) {
+		dst = appendInt(dst, pattern|1<<prefix, prefix, uint64(n))
+		return hpack.AppendHuffman(dst, s)
+	}
+
+	dst = appendInt(dst, pattern, prefix, uint64(len(s)))
+	return append(dst, s...)
+}
@@ -0,0 +1,160 @@
+package qpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		hex    string
+		fields []hpack.HeaderField
+	}{
+		{
+			// RFC 9204 Appendix B.1
+			"literal with name reference",
+			"0000 510b 2f69 6e64 6578 2e68 746d 6c",
+			[]hpack.HeaderField{{Name: ":path", Value: "/index.html"}},
+		},
+		{
+			"indexed static",
+			"0000 d1 d7 c1",
+			[]hpack.HeaderField{
+				{Name: ":method", Value: "GET"},
+				{Name: ":scheme", Value: "https"},
+				{Name: ":path", Value: "/"},
+			},
+		},
+		{
+			"literal name",
+			"0000 25 782d 666f 6f 03 626172",
+			[]hpack.HeaderField{{Name: "x-foo", Value: "bar"}},
+		},
+		{
+			"huffman value",
+			"0000 50 8c f1e3 c2e5 f23a 6ba0 ab90 f4ff",
+			[]hpack.HeaderField{{Name: ":authority", Value: "www.example.com"}},
+		},
+		{
+			"never indexed",
+			"0000 7f45 06 736563726574",
+			[]hpack.HeaderField{{Name: "authorization", Value: "secret", Sensitive: true}},
+		},
+		{
+			"empty section",
+			"0000",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(unhex(t, tt.hex), 1<<16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("Decode = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		want error
+	}{
+		{"required insert count", "0100 d1", ErrDynamicReference},
+		{"indexed dynamic", "0000 81", ErrDynamicReference},
+		{"name reference to dynamic", "0000 41 0161", ErrDynamicReference},
+		{"post-base indexed", "0000 10", ErrDynamicReference},
+		{"post-base name reference", "0000 00 0161", ErrDynamicReference},
+		{"static index out of range", "0000 ff24", ErrInvalidIndex},
+		{"name reference out of range", "0000 5f54 0161", ErrInvalidIndex},
+		{"empty", "", ErrTruncated},
+		{"missing base", "00", ErrTruncated},
+		{"truncated value", "0000 51 05 2f", ErrTruncated},
+		{"truncated name", "0000 25 782d", ErrTruncated},
+		{"truncated integer", "0000 ff", ErrTruncated},
+		{"integer overflow", "0000 ff ffff ffff ffff ffff ff01", ErrIntegerOverflow},
+		{"invalid huffman", "0000 51 81 00", hpack.ErrInvalidHuffman},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(unhex(t, tt.hex), 1<<16); !errors.Is(err, tt.want) {
+				t.Errorf("Decode error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeListSize(t *testing.T) {
+	// :method GET and :path / are 42 and 38 bytes
+	block := unhex(t, "0000 d1 c1")
+	if _, err := Decode(block, 80); err != nil {
+		t.Errorf("80 bytes: %v", err)
+	}
+	if _, err := Decode(block, 79); !errors.Is(err, ErrHeaderListTooBig) {
+		t.Errorf("79 bytes: error = %v, want ErrHeaderListTooBig", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		field hpack.HeaderField
+		hex   string
+	}{
+		{"exact static match", hpack.HeaderField{Name: ":status", Value: "200"}, "d9"},
+		{"name reference", hpack.HeaderField{Name: ":status", Value: "201"}, "5f09 82 1003"},
+		{"huffman value", hpack.HeaderField{Name: ":path", Value: "/index.html"}, "51 88 60d5 485f 2bce 9a68"},
+		{"literal name", hpack.HeaderField{Name: "x-a", Value: "b"}, "23 782d61 01 62"},
+		{"sensitive name reference", hpack.HeaderField{Name: "authorization", Value: "x", Sensitive: true}, "7f45 01 78"},
+		{"sensitive literal name", hpack.HeaderField{Name: "x-a", Value: "b", Sensitive: true}, "33 782d61 01 62"},
+		// A sensitive field is never sent as an index, even if it matches
+		{"sensitive exact match", hpack.HeaderField{Name: ":method", Value: "GET", Sensitive: true}, "7f02 03 474554"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Encode(nil, []hpack.HeaderField{tt.field})
+			if want := append([]byte{0, 0}, unhex(t, tt.hex)...); !bytes.Equal(got, want) {
+				t.Errorf("Encode = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	fields := []hpack.HeaderField{
+		{Name: ":status", Value: "404"},
+		{Name: "content-type", Value: "text/plain; charset=utf-8"},
+		{Name: "content-length", Value: "1234"},
+		{Name: "set-cookie", Value: "id=1; HttpOnly", Sensitive: true},
+		{Name: "x-custom", Value: strings.Repeat("v", 300)},
+		{Name: "x-empty", Value: ""},
+	}
+	got, err := Decode(Encode(nil, fields), 1<<16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, fields) {
+		t.Errorf("round trip = %v, want %v", got, fields)
+	}
+}
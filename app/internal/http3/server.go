@@ -0,0 +1,614 @@
+// Package http3 implements the server side of HTTP/3 (RFC 9114) over the
+// QUIC transport in package quic. As with package http2, requests are
+// handed to a handler as http.Request values with their response sent
+// through an http.ResponseStream. Server push is not supported.
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http3/qpack"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// NextProto is the ALPN protocol identifier for HTTP/3
+const NextProto = "h3"
+
+// Limits on what a client may send
+const (
+	// maxFieldSectionSize bounds a request's decoded header fields
+	maxFieldSectionSize = 1 << 20
+
+	// maxControlFrameSize bounds frames on the client's control stream
+	maxControlFrameSize = 16 << 10
+)
+
+// errStreamClosed is returned by writes to a stream that was reset
+var errStreamClosed = errors.New("http3: stream closed")
+
+// errBodyTooLarge is returned by readRequest for a request body over the
+// server's limit
+var errBodyTooLarge = errors.New("http3: request body too large")
+
+// Handler serves a request arriving on a stream. It runs in its own
+// goroutine and sends the response through stream, which it must end with
+// Close or Reset before returning.
+type Handler func(stream http.ResponseStream, request *http.Request)
+
+// Server holds the settings for serving HTTP/3 connections. Idle timeouts
+// and stream limits belong to the QUIC listener.
+type Server struct {
+	// Handler serves each request
+	Handler Handler
+
+	// WriteTimeout limits each write of a response, including waiting
+	// for the client to acknowledge earlier data
+	WriteTimeout time.Duration
+
+	// MaxRequestBodySize limits the request body buffered for a stream;
+	// zero uses http.DefaultMaxBodySize
+	MaxRequestBodySize int64
+}
+
+// maxRequestBodySize returns the request body limit
+func (s *Server) maxRequestBodySize() int64 {
+	if s.MaxRequestBodySize > 0 {
+		return s.MaxRequestBodySize
+	}
+	return http.DefaultMaxBodySize
+}
+
+// ServeConnOpts are the per-connection options for ServeConn
+type ServeConnOpts struct {
+	// Context is the parent of every stream's context
+	Context context.Context
+
+	// TLS is the connection's TLS state, set on every request
+	TLS *tls.ConnectionState
+
+	// Shutdown is closed to ask the connection to finish its streams and
+	// close gracefully
+	Shutdown <-chan struct{}
+
+	// StateHook is called with true when the first stream opens and with
+	// false when the last one closes
+	StateHook func(active bool)
+}
+
+// serverConn is one HTTP/3 connection
+type serverConn struct {
+	srv     *Server
+	conn    *quic.Conn
+	opts    ServeConnOpts
+	ctx     context.Context
+	control *quic.Stream
+
+	// mu guards the fields below. nextStreamID is the ID after the last
+	// request stream accepted, sent in GOAWAY.
+	mu           sync.Mutex
+	active       int
+	nextStreamID uint64
+	goingAway    bool
+	peerControl  bool
+}
+
+// ServeConn serves HTTP/3 on a QUIC connection whose handshake is done,
+// until the client goes away, the connection is idle for too long or a
+// connection error occurs. The connection is closed on return.
+func (s *Server) ServeConn(conn *quic.Conn, opts ServeConnOpts) error {
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	ctx, cancel := context.WithCancel(opts.Context)
+	defer cancel()
+	stop := context.AfterFunc(conn.Context(), cancel)
+	defer stop()
+
+	sc := &serverConn{
+		srv:  s,
+		conn: conn,
+		opts: opts,
+		ctx:  ctx,
+	}
+
+	err := sc.serve()
+	if err != nil {
+		sc.connError(err)
+	}
+	conn.CloseWithError(uint64(ErrCodeNo), "")
+
+	if err != nil && !isClosedError(err) {
+		return err
+	}
+	return nil
+}
+
+// serve opens the control stream and accepts streams until the
+// connection ends
+func (sc *serverConn) serve() error {
+	control, err := sc.conn.OpenUniStream()
+	if err != nil {
+		return ConnError{Code: ErrCodeStreamCreation, Reason: "client allows no unidirectional streams"}
+	}
+	sc.control = control
+
+	preface := quic.AppendVarint(nil, streamControl)
+	preface = appendSettings(preface, map[SettingID]uint64{
+		SettingMaxFieldSectionSize: maxFieldSectionSize,
+	})
+	if _, err := control.Write(preface); err != nil {
+		return err
+	}
+
+	go sc.acceptUniStreams()
+	go sc.watchShutdown()
+
+	for {
+		st, err := sc.conn.AcceptStream(sc.ctx)
+		if err != nil {
+			return err
+		}
+
+		sc.mu.Lock()
+		if sc.goingAway {
+			sc.mu.Unlock()
+			st.CancelRead(uint64(ErrCodeRequestRejected))
+			st.CancelWrite(uint64(ErrCodeRequestRejected))
+			continue
+		}
+		sc.nextStreamID = st.ID() + 4
+		sc.active++
+		first := sc.active == 1
+		sc.mu.Unlock()
+
+		if first && sc.opts.StateHook != nil {
+			sc.opts.StateHook(true)
+		}
+		go sc.serveStream(st)
+	}
+}
+
+// connError closes the connection after an error. Protocol errors are
+// reported to the client with their code; others end it without one.
+func (sc *serverConn) connError(err error) {
+	var ce ConnError
+	if errors.As(err, &ce) {
+		sc.conn.CloseWithError(uint64(ce.Code), ce.Reason)
+		return
+	}
+	if errors.Is(err, qpack.ErrHeaderListTooBig) {
+		sc.conn.CloseWithError(uint64(ErrCodeExcessiveLoad), err.Error())
+		return
+	}
+	sc.conn.CloseWithError(uint64(ErrCodeInternal), "")
+}
+
+// isClosedError reports whether err only says the connection is gone.
+// Some clients close with code 0 rather than H3_NO_ERROR when done.
+func isClosedError(err error) bool {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) {
+		return appErr.Code == uint64(ErrCodeNo) || appErr.Remote && appErr.Code == 0
+	}
+	return errors.Is(err, quic.ErrIdleTimeout) || errors.Is(err, context.Canceled)
+}
+
+// watchShutdown starts a graceful close when the server shuts down
+func (sc *serverConn) watchShutdown() {
+	if sc.opts.Shutdown == nil {
+		return
+	}
+
+	select {
+	case <-sc.opts.Shutdown:
+		sc.goAway()
+	case <-sc.ctx.Done():
+	}
+}
+
+// goAway tells the client no new requests will be processed. Requests
+// already accepted are finished, after which the connection is closed.
+func (sc *serverConn) goAway() {
+	sc.mu.Lock()
+	if sc.goingAway {
+		sc.mu.Unlock()
+		return
+	}
+	sc.goingAway = true
+	id := sc.nextStreamID
+	idle := sc.active == 0
+	sc.mu.Unlock()
+
+	payload := quic.AppendVarint(nil, id)
+	frame := appendFrameHeader(nil, FrameGoAway, len(payload))
+	sc.control.Write(append(frame, payload...))
+
+	if idle {
+		sc.conn.CloseWithError(uint64(ErrCodeNo), "")
+	}
+}
+
+// acceptUniStreams handles the unidirectional streams the client opens
+func (sc *serverConn) acceptUniStreams() {
+	for {
+		st, err := sc.conn.AcceptUniStream(sc.ctx)
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() {
+				if v := recover(); v != nil {
+					panics.Report(panics.Stream, v, "HTTP/3 stream %d from %s", st.ID(), sc.conn.RemoteAddr())
+					sc.connError(ConnError{Code: ErrCodeInternal})
+				}
+			}()
+			if err := sc.serveUniStream(st); err != nil {
+				sc.connError(err)
+			}
+		}()
+	}
+}
+
+// serveUniStream reads a unidirectional stream according to its type
+func (sc *serverConn) serveUniStream(st *quic.Stream) error {
+	r := bufio.NewReader(st)
+	typ, err := quic.ReadVarint(r)
+	if err != nil {
+		return nil
+	}
+
+	switch typ {
+	case streamControl:
+		sc.mu.Lock()
+		duplicate := sc.peerControl
+		sc.peerControl = true
+		sc.mu.Unlock()
+		if duplicate {
+			return ConnError{Code: ErrCodeStreamCreation, Reason: "second control stream"}
+		}
+		return sc.readControl(r)
+
+	case streamQPACKEncoder, streamQPACKDecoder:
+		// With no dynamic table there is nothing to act on, but the
+		// streams must stay open
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil
+		}
+		return ConnError{Code: ErrCodeClosedCriticalStream, Reason: "QPACK stream closed"}
+
+	case streamPush:
+		return ConnError{Code: ErrCodeStreamCreation, Reason: "push stream from a client"}
+	}
+
+	// Streams of unknown types are refused
+	st.CancelRead(uint64(ErrCodeStreamCreation))
+	return nil
+}
+
+// readControl reads the client's control stream, which starts with
+// SETTINGS and must stay open
+func (sc *serverConn) readControl(r *bufio.Reader) error {
+	first := true
+	for {
+		typ, length, err := readFrameHeader(r)
+		if errors.Is(err, io.EOF) {
+			return ConnError{Code: ErrCodeClosedCriticalStream, Reason: "control stream closed"}
+		}
+		if err != nil {
+			var ce ConnError
+			if errors.As(err, &ce) {
+				return err
+			}
+			return nil
+		}
+
+		payload, err := readPayload(r, length, maxControlFrameSize)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case first && typ != FrameSettings:
+			return ConnError{Code: ErrCodeMissingSettings, Reason: fmt.Sprintf("control stream starts with %s", typ)}
+		case typ == FrameSettings && first:
+			if err := parseSettings(payload); err != nil {
+				return err
+			}
+		case typ == FrameGoAway, typ == FrameMaxPushID, typ == FrameCancelPush:
+			// The client going away needs no action here: it opens no
+			// more streams and closes the connection when done. Push is
+			// never used.
+		default:
+			return ConnError{Code: ErrCodeFrameUnexpected, Reason: fmt.Sprintf("%s on the control stream", typ)}
+		}
+		first = false
+	}
+}
+
+// serveStream reads a request from a stream and runs the handler
+func (sc *serverConn) serveStream(st *quic.Stream) {
+	defer sc.streamDone()
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.Stream, v, "HTTP/3 stream %d from %s", st.ID(), sc.conn.RemoteAddr())
+			st.CancelRead(uint64(ErrCodeInternal))
+			st.CancelWrite(uint64(ErrCodeInternal))
+		}
+	}()
+
+	request, err := sc.readRequest(st)
+	if err != nil {
+		var ce ConnError
+		var se StreamError
+		switch {
+		case errors.As(err, &ce):
+			sc.connError(err)
+		case errors.Is(err, errBodyTooLarge):
+			sc.refuseBody(st)
+		case errors.As(err, &se):
+			st.CancelRead(uint64(se.Code))
+			st.CancelWrite(uint64(se.Code))
+		default:
+			// The client reset the stream or the connection is gone
+			st.CancelRead(uint64(ErrCodeRequestCancelled))
+			st.CancelWrite(uint64(ErrCodeRequestCancelled))
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(sc.ctx)
+	defer cancel()
+	sc.srv.Handler(&stream{sc: sc, st: st}, request.WithContext(ctx))
+}
+
+// refuseBody answers a request whose body is too large with 413 and asks
+// the client to stop sending the rest
+func (sc *serverConn) refuseBody(st *quic.Stream) {
+	st.CancelRead(uint64(ErrCodeExcessiveLoad))
+	header := http.Header{}
+	header.Set(http.HeaderContentLength, "0")
+	(&stream{sc: sc, st: st}).WriteHeader(http.StatusContentTooLarge, header, true)
+}
+
+// readRequest reads the request header, body and any trailers. Trailers
+// are dropped, since requests have no place for them. A body over the
+// limit, by its content-length or as it arrives, gives errBodyTooLarge.
+func (sc *serverConn) readRequest(st *quic.Stream) (*http.Request, error) {
+	r := bufio.NewReader(st)
+
+	typ, length, err := readFrameHeader(r)
+	if errors.Is(err, io.EOF) {
+		return nil, StreamError{StreamID: st.ID(), Code: ErrCodeRequestIncomplete, Reason: "no request"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if typ != FrameHeaders {
+		return nil, ConnError{Code: ErrCodeFrameUnexpected, Reason: fmt.Sprintf("request starts with %s", typ)}
+	}
+	fields, err := sc.readFieldSection(st, r, length)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http2.NewRequest(fields, sc.opts.TLS)
+	if err != nil {
+		log.Printf("HTTP/3 malformed request on stream %d: %v", st.ID(), err)
+		return nil, StreamError{StreamID: st.ID(), Code: ErrCodeMessage, Reason: err.Error()}
+	}
+	request.Proto, request.ProtoMajor, request.ProtoMinor = "HTTP/3.0", 3, 0
+
+	maxSize := sc.srv.maxRequestBodySize()
+	contentLength := int64(-1)
+	if cl, ok := request.Headers[http.HeaderContentLength]; ok {
+		if contentLength, err = http.ParseContentLength(cl); err != nil {
+			return nil, StreamError{StreamID: st.ID(), Code: ErrCodeMessage, Reason: err.Error()}
+		}
+		if contentLength > maxSize {
+			return nil, errBodyTooLarge
+		}
+	}
+
+	var body bytes.Buffer
+	trailers := false
+	for {
+		typ, length, err := readFrameHeader(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case typ == FrameData && !trailers:
+			if length > uint64(maxSize-int64(body.Len())) {
+				return nil, errBodyTooLarge
+			}
+			if _, err := io.CopyN(&body, r, int64(length)); err != nil {
+				return nil, truncated(err)
+			}
+		case typ == FrameHeaders && !trailers:
+			if _, err := sc.readFieldSection(st, r, length); err != nil {
+				return nil, err
+			}
+			trailers = true
+		default:
+			return nil, ConnError{Code: ErrCodeFrameUnexpected, Reason: fmt.Sprintf("%s on a request stream", typ)}
+		}
+	}
+	request.Body = body.Bytes()
+
+	if contentLength >= 0 && contentLength != int64(len(request.Body)) {
+		return nil, StreamError{StreamID: st.ID(), Code: ErrCodeMessage, Reason: "body does not match content-length"}
+	}
+	return request, nil
+}
+
+// readFieldSection reads and decodes the payload of a HEADERS frame
+func (sc *serverConn) readFieldSection(st *quic.Stream, r io.Reader, length uint64) ([]hpack.HeaderField, error) {
+	if length > maxFieldSectionSize {
+		return nil, StreamError{StreamID: st.ID(), Code: ErrCodeExcessiveLoad, Reason: "field section too large"}
+	}
+	block, err := readPayload(r, length, maxFieldSectionSize)
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := qpack.Decode(block, maxFieldSectionSize)
+	if errors.Is(err, qpack.ErrHeaderListTooBig) {
+		return nil, StreamError{StreamID: st.ID(), Code: ErrCodeExcessiveLoad, Reason: err.Error()}
+	}
+	if err != nil {
+		return nil, ConnError{Code: ErrCodeQPACKDecompression, Reason: err.Error()}
+	}
+	return fields, nil
+}
+
+// streamDone records that a request stream's handler has returned
+func (sc *serverConn) streamDone() {
+	sc.mu.Lock()
+	sc.active--
+	idle := sc.active == 0
+	finished := idle && sc.goingAway
+	sc.mu.Unlock()
+
+	if idle && sc.opts.StateHook != nil {
+		sc.opts.StateHook(false)
+	}
+	if finished {
+		sc.conn.CloseWithError(uint64(ErrCodeNo), "")
+	}
+}
+
+// stream sends a response on a request stream
+type stream struct {
+	sc *serverConn
+	st *quic.Stream
+
+	mu    sync.Mutex
+	ended bool
+	reset bool
+}
+
+// WriteHeader sends the response header in a HEADERS frame
+func (s *stream) WriteHeader(status http.Status, header http.Header, endStream bool) error {
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(status.Code())}}
+	for _, name := range sortedNames(header) {
+		lower := strings.ToLower(name)
+		for _, value := range header[name] {
+			fields = append(fields, hpack.HeaderField{
+				Name:      lower,
+				Value:     strings.NewReplacer("\r", "", "\n", "").Replace(value),
+				Sensitive: lower == http.HeaderSetCookie || lower == http.HeaderAuthorization,
+			})
+		}
+	}
+
+	block := qpack.Encode(nil, fields)
+	frame := appendFrameHeader(nil, FrameHeaders, len(block))
+	if err := s.write(append(frame, block...)); err != nil {
+		return err
+	}
+	if endStream {
+		return s.Close()
+	}
+	return nil
+}
+
+// Write sends body data in a DATA frame
+func (s *stream) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := s.write(appendFrameHeader(nil, FrameData, len(p))); err != nil {
+		return 0, err
+	}
+	if err := s.write(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// write writes to the QUIC stream within the write timeout
+func (s *stream) write(p []byte) error {
+	s.mu.Lock()
+	ended := s.ended || s.reset
+	s.mu.Unlock()
+	if ended {
+		return errStreamClosed
+	}
+
+	if timeout := s.sc.srv.WriteTimeout; timeout > 0 {
+		s.st.SetWriteDeadline(time.Now().Add(timeout))
+	}
+	_, err := s.st.Write(p)
+	return err
+}
+
+// Flush does nothing: QUIC sends stream data as soon as it can
+func (s *stream) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reset {
+		return errStreamClosed
+	}
+	return nil
+}
+
+// Close ends the response by closing the sending side of the stream
+func (s *stream) Close() error {
+	s.mu.Lock()
+	if s.ended || s.reset {
+		s.mu.Unlock()
+		return nil
+	}
+	s.ended = true
+	s.mu.Unlock()
+
+	return s.st.Close()
+}
+
+// Reset abandons the response with RESET_STREAM
+func (s *stream) Reset() error {
+	s.mu.Lock()
+	if s.ended || s.reset {
+		s.mu.Unlock()
+		return nil
+	}
+	s.reset = true
+	s.mu.Unlock()
+
+	s.st.CancelWrite(uint64(ErrCodeInternal))
+	return nil
+}
+
+// sortedNames returns the names of the fields to send, in order, skipping
+// suppressed ones
+func sortedNames(header http.Header) []string {
+	names := make([]string, 0, len(header))
+	for name, values := range header {
+		if len(values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,340 @@
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2/hpack"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http3/qpack"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// startServer serves HTTP/3 with srv on a loopback UDP port and returns a
+// client connected to it
+func startServer(t *testing.T, srv *Server) *testClient {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := quic.Listen(udp, &quic.Config{TLSConfig: &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{NextProto},
+	}})
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			state := conn.ConnectionState()
+			go srv.ServeConn(conn, ServeConnOpts{TLS: &state})
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return dialTestClient(t, l.Addr(), &tls.Config{
+		ServerName: "localhost",
+		RootCAs:    roots,
+		NextProtos: []string{NextProto},
+	})
+}
+
+// openControl opens the client's control stream with an empty SETTINGS
+func openControl(c *testClient) {
+	c.write(c.openUniStream(), appendSettings([]byte{streamControl}, nil), false)
+}
+
+// appendHeaders appends a HEADERS frame
+func appendHeaders(b []byte, fields ...string) []byte {
+	var hf []hpack.HeaderField
+	for i := 0; i < len(fields); i += 2 {
+		hf = append(hf, hpack.HeaderField{Name: fields[i], Value: fields[i+1]})
+	}
+	block := qpack.Encode(nil, hf)
+	return append(appendFrameHeader(b, FrameHeaders, len(block)), block...)
+}
+
+// appendData appends a DATA frame
+func appendData(b, data []byte) []byte {
+	return append(appendFrameHeader(b, FrameData, len(data)), data...)
+}
+
+// response is a response read from a request stream
+type response struct {
+	fields []hpack.HeaderField
+	body   []byte
+}
+
+// header returns the value of a response field
+func (r *response) header(name string) string {
+	for _, f := range r.fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// roundTrip sends a request on a new stream and reads the response
+func roundTrip(t *testing.T, c *testClient, request []byte) *response {
+	t.Helper()
+	id := c.openStream()
+	c.write(id, request, true)
+	return readResponse(t, c, id)
+}
+
+// readResponse reads the response on a request stream
+func readResponse(t *testing.T, c *testClient, id uint64) *response {
+	t.Helper()
+	resp := &response{}
+	r := bufio.NewReader(bytes.NewReader(c.readStream(id)))
+	for {
+		typ, length, err := readFrameHeader(r)
+		if err != nil {
+			break
+		}
+		payload, err := readPayload(r, length, 1<<24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch typ {
+		case FrameHeaders:
+			if resp.fields, err = qpack.Decode(payload, 1<<16); err != nil {
+				t.Fatal(err)
+			}
+		case FrameData:
+			resp.body = append(resp.body, payload...)
+		default:
+			t.Fatalf("unexpected %s frame in the response", typ)
+		}
+	}
+	return resp
+}
+
+// echo responds with the request line and body
+func echo(stream http.ResponseStream, request *http.Request) {
+	body := request.Method + " " + request.Path + "?" + request.RawQuery + " " + request.Proto + " " + string(request.Body)
+	stream.WriteHeader(http.StatusOK, http.Header{"Content-Type": {"text/plain"}}, false)
+	stream.Write([]byte(body))
+	stream.Close()
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := startServer(t, &Server{Handler: echo})
+	openControl(c)
+
+	resp := roundTrip(t, c, appendHeaders(nil,
+		":method", "GET", ":scheme", "https", ":authority", "localhost", ":path", "/hello?x=1"))
+	if got := resp.header(":status"); got != "200" {
+		t.Errorf(":status = %q", got)
+	}
+	if got := resp.header("content-type"); got != "text/plain" {
+		t.Errorf("content-type = %q", got)
+	}
+	if got := string(resp.body); got != "GET /hello?x=1 HTTP/3.0 " {
+		t.Errorf("body = %q", got)
+	}
+
+	// A body in several DATA frames on the same connection
+	request := appendHeaders(nil,
+		":method", "POST", ":scheme", "https", ":authority", "localhost", ":path", "/post",
+		"content-length", "11")
+	request = appendData(request, []byte("hello"))
+	request = appendData(request, []byte(" world"))
+	resp = roundTrip(t, c, request)
+	if got := string(resp.body); got != "POST /post? HTTP/3.0 hello world" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestServerControlStream(t *testing.T) {
+	c := startServer(t, &Server{Handler: echo})
+
+	// The server opens its control stream, the first unidirectional one,
+	// and starts it with SETTINGS
+	st := c.stream(3)
+	c.waitFor("the server's SETTINGS", func() bool { return len(st.prefix()) > 2 })
+	r := bufio.NewReader(bytes.NewReader(st.prefix()))
+	if typ, _ := quic.ReadVarint(r); typ != streamControl {
+		t.Fatalf("stream type %#x", typ)
+	}
+	if typ, _, err := readFrameHeader(r); err != nil || typ != FrameSettings {
+		t.Errorf("first frame %s, %v", typ, err)
+	}
+}
+
+func TestLargeResponse(t *testing.T) {
+	// Much more than fits in the congestion window at first, so the
+	// transport has to wait for acknowledgements
+	body := bytes.Repeat([]byte("0123456789abcdef"), 32<<10)
+	c := startServer(t, &Server{Handler: func(stream http.ResponseStream, request *http.Request) {
+		stream.WriteHeader(http.StatusOK, nil, false)
+		for p := body; len(p) > 0; p = p[min(len(p), 10000):] {
+			stream.Write(p[:min(len(p), 10000)])
+		}
+		stream.Close()
+	}})
+	openControl(c)
+
+	resp := roundTrip(t, c, appendHeaders(nil,
+		":method", "GET", ":scheme", "https", ":authority", "localhost", ":path", "/large"))
+	if !bytes.Equal(resp.body, body) {
+		t.Errorf("body of %d bytes, want %d", len(resp.body), len(body))
+	}
+}
+
+func TestLargeRequest(t *testing.T) {
+	post := func(fields ...string) []byte {
+		return appendHeaders(nil, append([]string{
+			":method", "POST", ":scheme", "https", ":authority", "localhost", ":path", "/post",
+		}, fields...)...)
+	}
+	tests := []struct {
+		name    string
+		request []byte
+		status  string
+	}{
+		{"at the limit", appendData(appendData(post(), make([]byte, 600)), make([]byte, 400)), "200"},
+		{"content-length over the limit", post("content-length", "1001"), "413"},
+		{"huge content-length", post("content-length", "1000000000000000000"), "413"},
+		// Without a content-length the body is refused as it arrives
+		{"body over the limit", appendData(appendData(post(), make([]byte, 600)), make([]byte, 401)), "413"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startServer(t, &Server{Handler: echo, MaxRequestBodySize: 1000})
+			openControl(c)
+
+			// Refused requests are left open, as if more were coming
+			id := c.openStream()
+			c.write(id, tt.request, tt.status != "413")
+			resp := readResponse(t, c, id)
+			if got := resp.header(":status"); got != tt.status {
+				t.Errorf(":status = %q, want %s", got, tt.status)
+			}
+			if tt.status != "413" {
+				return
+			}
+
+			// The rest of the body is not wanted
+			st := c.stream(id)
+			c.waitFor("STOP_SENDING", func() bool { return st.stopSending })
+			if ErrCode(st.stopCode) != ErrCodeExcessiveLoad {
+				t.Errorf("STOP_SENDING with %s, want H3_EXCESSIVE_LOAD", ErrCode(st.stopCode))
+			}
+		})
+	}
+}
+
+func TestMalformedRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		code    ErrCode
+	}{
+		{"missing :path", appendHeaders(nil, ":method", "GET", ":scheme", "https", ":authority", "localhost"), ErrCodeMessage},
+		{"uppercase field name", appendHeaders(nil, ":method", "GET", ":scheme", "https", ":authority", "localhost", ":path", "/", "X-Upper", "1"), ErrCodeMessage},
+		{
+			"content-length mismatch",
+			appendData(appendHeaders(nil, ":method", "POST", ":scheme", "https", ":authority", "localhost", ":path", "/", "content-length", "5"), []byte("abc")),
+			ErrCodeMessage,
+		},
+		{"no request", nil, ErrCodeRequestIncomplete},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startServer(t, &Server{Handler: echo})
+			openControl(c)
+			id := c.openStream()
+			c.write(id, tt.request, true)
+
+			// Only the stream is reset
+			st := c.stream(id)
+			c.waitFor("RESET_STREAM", func() bool { return st.reset })
+			if ErrCode(st.resetCode) != tt.code {
+				t.Errorf("stream reset with %s, want %s", ErrCode(st.resetCode), tt.code)
+			}
+		})
+	}
+}
+
+func TestConnectionErrors(t *testing.T) {
+	get := appendHeaders(nil, ":method", "GET", ":scheme", "https", ":authority", "localhost", ":path", "/")
+	tests := []struct {
+		name    string
+		control []byte // nil for no control stream
+		request []byte
+		code    ErrCode
+	}{
+		{"request starts with DATA", nil, appendData(nil, []byte("x")), ErrCodeFrameUnexpected},
+		{"HTTP/2 frame on a request stream", nil, append(appendFrameHeader(nil, 0x2, 0), get...), ErrCodeFrameUnexpected},
+		{"invalid QPACK", nil, append(appendFrameHeader(nil, FrameHeaders, 3), 0x00, 0x00, 0x81), ErrCodeQPACKDecompression},
+		{"control stream without SETTINGS", append(appendFrameHeader([]byte{streamControl}, FrameGoAway, 1), 0x00), get, ErrCodeMissingSettings},
+		{"second SETTINGS", appendSettings(appendSettings([]byte{streamControl}, nil), nil), get, ErrCodeFrameUnexpected},
+		{"HTTP/2 setting", append(appendFrameHeader([]byte{streamControl}, FrameSettings, 2), 0x02, 0x00), get, ErrCodeSettings},
+		{"DATA on the control stream", appendData(appendSettings([]byte{streamControl}, nil), nil), get, ErrCodeFrameUnexpected},
+		{"push stream from a client", []byte{streamPush}, get, ErrCodeStreamCreation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := startServer(t, &Server{Handler: echo})
+			if tt.control != nil {
+				c.write(c.openUniStream(), tt.control, false)
+			}
+			c.write(c.openStream(), tt.request, true)
+
+			err := c.waitForClose()
+			if !err.app || ErrCode(err.code) != tt.code {
+				t.Errorf("connection closed with %v, want %s", err, tt.code)
+			}
+		})
+	}
+}
+
+func TestControlStreamClosed(t *testing.T) {
+	c := startServer(t, &Server{Handler: echo})
+	c.write(c.openUniStream(), appendSettings([]byte{streamControl}, nil), true)
+
+	err := c.waitForClose()
+	if !err.app || ErrCode(err.code) != ErrCodeClosedCriticalStream {
+		t.Errorf("connection closed with %v, want H3_CLOSED_CRITICAL_STREAM", err)
+	}
+	if !strings.Contains(err.reason, "control stream") {
+		t.Errorf("reason %q", err.reason)
+	}
+}
@@ -0,0 +1,32 @@
+// Package panics keeps a panic while serving one request, stream or
+// connection from taking down the whole server. The goroutines serving
+// clients recover, report the panic here and give up only on what they
+// were serving.
+package panics
+
+import (
+	"expvar"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Kinds of goroutine a panic is counted under
+const (
+	Handler    = "handler"
+	Connection = "connection"
+	Stream     = "stream"
+	QUIC       = "quic"
+)
+
+// counts holds the recovered panics by kind, published through expvar
+// and served by GET /admin/metrics
+var counts = expvar.NewMap("panics")
+
+// Report logs a panic recovered while serving what format describes,
+// with the stack of the goroutine that panicked, and counts it under
+// kind. It must be called from the deferred function that recovered.
+func Report(kind string, v any, format string, args ...any) {
+	counts.Add(kind, 1)
+	log.Printf("Panic serving %s: %v\n%s", fmt.Sprintf(format, args...), v, debug.Stack())
+}
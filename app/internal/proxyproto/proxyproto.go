@@ -0,0 +1,74 @@
+// Package proxyproto decodes the PROXY protocol header, versions 1 and 2,
+// that load balancers send at the start of a connection to pass on the
+// address of the client they accepted it from.
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Errors returned by Read
+var (
+	// ErrNoHeader is returned when the connection does not start with a
+	// PROXY header
+	ErrNoHeader = errors.New("proxyproto: no PROXY header")
+
+	// ErrInvalidHeader is returned for a malformed header
+	ErrInvalidHeader = errors.New("proxyproto: invalid PROXY header")
+)
+
+// Command says whether a connection carries a proxied client
+type Command byte
+
+const (
+	// CommandLocal is a connection the proxy made on its own behalf,
+	// such as a health check; it has no client address
+	CommandLocal Command = 0x0
+
+	// CommandProxy is a connection relayed for a client
+	CommandProxy Command = 0x1
+)
+
+// Header is a decoded PROXY header
+type Header struct {
+	// Version is 1 for the text format and 2 for the binary one
+	Version int
+
+	Command Command
+
+	// Source is the client's address and Destination the address it
+	// connected to. Both are nil for local connections and when the
+	// proxy did not know the protocol.
+	Source      net.Addr
+	Destination net.Addr
+
+	// TLVs are the extensions of a version 2 header, in order
+	TLVs []TLV
+}
+
+// Read reads a header from the start of r. It reads exactly the header's
+// bytes, so the rest of the connection can be read from r afterwards.
+func Read(r io.Reader) (*Header, error) {
+	// The version 2 signature is 12 bytes, and no version 1 header is shorter
+	var start [12]byte
+	if _, err := io.ReadFull(r, start[:]); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(start[:], signatureV2):
+		return readV2(r)
+	case bytes.HasPrefix(start[:], []byte(prefixV1)):
+		return readV1(r, start[:])
+	}
+	return nil, ErrNoHeader
+}
+
+// invalid reports a malformed header
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidHeader, fmt.Sprintf(format, args...))
+}
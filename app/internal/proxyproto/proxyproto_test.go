@@ -0,0 +1,298 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestReadV1(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		src   string
+		dst   string
+	}{
+		{"tcp4", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324", "192.168.0.11:443"},
+		{"tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 65535 80\r\n", "[2001:db8::1]:65535", "[2001:db8::2]:80"},
+		{"port zero", "PROXY TCP4 192.0.2.1 192.0.2.2 0 80\r\n", "192.0.2.1:0", "192.0.2.2:80"},
+		{"unknown", "PROXY UNKNOWN\r\n", "", ""},
+		{"unknown with addresses", "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n", "", ""},
+		{
+			"longest unknown",
+			"PROXY UNKNOWN ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff " +
+				"ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff 65535 65535\r\n",
+			"", "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.input + "GET / HTTP/1.1\r\n")
+			h, err := Read(r)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if h.Version != 1 || h.Command != CommandProxy {
+				t.Errorf("Version %d Command %d, want 1 and proxy", h.Version, h.Command)
+			}
+			checkAddr(t, "Source", h.Source, tt.src)
+			checkAddr(t, "Destination", h.Destination, tt.dst)
+			if rest, _ := io.ReadAll(r); string(rest) != "GET / HTTP/1.1\r\n" {
+				t.Errorf("data after header = %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadV1Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown protocol", "PROXY UDP4 192.0.2.1 192.0.2.2 1 2\r\n"},
+		{"too few fields", "PROXY TCP4 192.0.2.1 192.0.2.2 1\r\n"},
+		{"too many fields", "PROXY TCP4 192.0.2.1 192.0.2.2 1 2 3\r\n"},
+		{"ipv6 address for tcp4", "PROXY TCP4 2001:db8::1 192.0.2.2 1 2\r\n"},
+		{"ipv4 address for tcp6", "PROXY TCP6 192.0.2.1 2001:db8::2 1 2\r\n"},
+		{"zone", "PROXY TCP6 fe80::1%eth0 2001:db8::2 1 2\r\n"},
+		{"leading zero in port", "PROXY TCP4 192.0.2.1 192.0.2.2 01 2\r\n"},
+		{"port out of range", "PROXY TCP4 192.0.2.1 192.0.2.2 65536 2\r\n"},
+		{"double space", "PROXY TCP4  192.0.2.1 192.0.2.2 1 2\r\n"},
+		{"oversized", "PROXY UNKNOWN " + strings.Repeat("x", 100) + "\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(strings.NewReader(tt.input)); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("Read error = %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestReadNoHeader(t *testing.T) {
+	for _, input := range []string{
+		"GET / HTTP/1.1\r\nHost: x\r\n\r\n",
+		"\r\n\r\n\x00\r\nQUIT!",
+	} {
+		if _, err := Read(strings.NewReader(input)); !errors.Is(err, ErrNoHeader) {
+			t.Errorf("Read(%q) error = %v, want ErrNoHeader", input, err)
+		}
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	full := v2Header(0x21, 0x11, inetBlock(), nil)
+	inputs := []string{
+		"PROXY TCP4 192.0.2.1",
+		"PROXY",
+		string(full[:14]),
+		string(full[:len(full)-1]),
+	}
+	for _, input := range inputs {
+		_, err := Read(strings.NewReader(input))
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Read(%q) error = %v, want EOF", input, err)
+		}
+	}
+}
+
+func TestReadV2(t *testing.T) {
+	unix := make([]byte, addrLengthUnix)
+	copy(unix, "/run/src.sock")
+	copy(unix[108:], "/run/dst.sock")
+
+	inet6 := make([]byte, addrLengthInet6)
+	inet6[0], inet6[1], inet6[15] = 0x20, 0x01, 1
+	inet6[16], inet6[17], inet6[31] = 0x20, 0x01, 2
+	binary.BigEndian.PutUint16(inet6[32:], 1234)
+	binary.BigEndian.PutUint16(inet6[34:], 443)
+
+	tests := []struct {
+		name    string
+		command byte
+		family  byte
+		block   []byte
+		src     string
+		dst     string
+		network string
+	}{
+		{"tcp4", 0x21, 0x11, inetBlock(), "192.0.2.1:56324", "198.51.100.1:443", "tcp"},
+		{"udp4", 0x21, 0x12, inetBlock(), "192.0.2.1:56324", "198.51.100.1:443", "udp"},
+		{"tcp6", 0x21, 0x21, inet6, "[2001::1]:1234", "[2001::2]:443", "tcp"},
+		{"unix stream", 0x21, 0x31, unix, "/run/src.sock", "/run/dst.sock", "unix"},
+		{"unix dgram", 0x21, 0x32, unix, "/run/src.sock", "/run/dst.sock", "unixgram"},
+		{"unspec", 0x21, 0x00, nil, "", "", ""},
+		{"local drops addresses", 0x20, 0x11, inetBlock(), "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(append(v2Header(tt.command, tt.family, tt.block, nil), "rest"...))
+			h, err := Read(r)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if h.Version != 2 || h.Command != Command(tt.command&0x0f) {
+				t.Errorf("Version %d Command %d", h.Version, h.Command)
+			}
+			checkAddr(t, "Source", h.Source, tt.src)
+			checkAddr(t, "Destination", h.Destination, tt.dst)
+			if tt.network != "" && h.Source.Network() != tt.network {
+				t.Errorf("network = %q, want %q", h.Source.Network(), tt.network)
+			}
+			if rest, _ := io.ReadAll(r); string(rest) != "rest" {
+				t.Errorf("data after header = %q", rest)
+			}
+		})
+	}
+}
+
+func TestReadV2Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+	}{
+		{"version 1 in binary", v2Header(0x11, 0x11, inetBlock(), nil)},
+		{"unknown command", v2Header(0x22, 0x11, inetBlock(), nil)},
+		{"unknown family", v2Header(0x21, 0x41, inetBlock(), nil)},
+		{"unknown transport", v2Header(0x21, 0x13, inetBlock(), nil)},
+		{"short address block", v2Header(0x21, 0x21, inetBlock(), nil)},
+		{"truncated extension", v2Header(0x21, 0x11, inetBlock(), []byte{TypeNoop, 0})},
+		{"overrunning extension", v2Header(0x21, 0x11, inetBlock(), []byte{TypeNoop, 0, 5, 1})},
+		{"short checksum", v2Header(0x21, 0x11, inetBlock(), []byte{TypeCRC32C, 0, 2, 0, 0})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.header)); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("Read error = %v, want ErrInvalidHeader", err)
+			}
+		})
+	}
+}
+
+func TestReadV2Checksum(t *testing.T) {
+	header := v2Header(0x21, 0x11, inetBlock(), []byte{TypeCRC32C, 0, 4, 0, 0, 0, 0})
+	sum := crc32.Checksum(header, crc32.MakeTable(crc32.Castagnoli))
+	binary.BigEndian.PutUint32(header[len(header)-4:], sum)
+
+	h, err := Read(bytes.NewReader(header))
+	if err != nil {
+		t.Fatalf("Read with valid checksum: %v", err)
+	}
+	// The checksum must be left in place after verification
+	if value, _ := h.TLV(TypeCRC32C); binary.BigEndian.Uint32(value) != sum {
+		t.Errorf("CRC32C value = %x, want %x", value, sum)
+	}
+
+	header[len(header)-1] ^= 0xff
+	if _, err := Read(bytes.NewReader(header)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Read with bad checksum error = %v, want ErrInvalidHeader", err)
+	}
+}
+
+func TestTLVs(t *testing.T) {
+	var ssl []byte
+	ssl = append(ssl, ClientSSL|ClientCertConn, 0, 0, 0, 0)
+	ssl = appendTLV(ssl, subtypeSSLVersion, "TLSv1.3")
+	ssl = appendTLV(ssl, subtypeSSLCN, "client.example")
+	ssl = appendTLV(ssl, subtypeSSLCipher, "TLS_AES_128_GCM_SHA256")
+	ssl = appendTLV(ssl, subtypeSSLSigAlg, "SHA256")
+	ssl = appendTLV(ssl, subtypeSSLKeyAlg, "RSA2048")
+
+	var tlvs []byte
+	tlvs = appendTLV(tlvs, TypeALPN, "h2")
+	tlvs = appendTLV(tlvs, TypeAuthority, "example.com")
+	tlvs = appendTLV(tlvs, TypeUniqueID, "id-1")
+	tlvs = appendTLV(tlvs, TypeNoop, "")
+	tlvs = appendTLV(tlvs, TypeSSL, string(ssl))
+
+	h, err := Read(bytes.NewReader(v2Header(0x21, 0x11, inetBlock(), tlvs)))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(h.TLVs) != 5 {
+		t.Errorf("got %d TLVs, want 5", len(h.TLVs))
+	}
+	if h.ALPN() != "h2" || h.Authority() != "example.com" || string(h.UniqueID()) != "id-1" {
+		t.Errorf("ALPN %q Authority %q UniqueID %q", h.ALPN(), h.Authority(), h.UniqueID())
+	}
+
+	info, ok := h.TLS()
+	if !ok {
+		t.Fatal("TLS reported no SSL extension")
+	}
+	want := TLSInfo{
+		Client:             ClientSSL | ClientCertConn,
+		Verified:           true,
+		Version:            "TLSv1.3",
+		CommonName:         "client.example",
+		Cipher:             "TLS_AES_128_GCM_SHA256",
+		SignatureAlgorithm: "SHA256",
+		KeyAlgorithm:       "RSA2048",
+	}
+	if *info != want {
+		t.Errorf("TLS = %+v, want %+v", *info, want)
+	}
+}
+
+func TestTLSMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		ssl  string
+	}{
+		{"too short", "\x01\x00\x00"},
+		{"overrunning subtype", "\x01\x00\x00\x00\x00\x21\x00\x09TLS"},
+	}
+	for _, tt := range tests {
+		h := &Header{TLVs: []TLV{{Type: TypeSSL, Value: []byte(tt.ssl)}}}
+		if _, ok := h.TLS(); ok {
+			t.Errorf("%s: TLS reported ok", tt.name)
+		}
+	}
+
+	h := &Header{TLVs: []TLV{{Type: TypeSSL, Value: []byte("\x01\x00\x00\x00\x01")}}}
+	if info, ok := h.TLS(); !ok || info.Verified {
+		t.Errorf("nonzero verify: TLS = %+v, %v; want unverified", info, ok)
+	}
+}
+
+// v2Header builds a version 2 header from its version and command byte,
+// family and transport byte, address block and extensions
+func v2Header(command, family byte, block, tlvs []byte) []byte {
+	b := append([]byte{}, signatureV2...)
+	b = append(b, command, family)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(block)+len(tlvs)))
+	b = append(b, block...)
+	return append(b, tlvs...)
+}
+
+// inetBlock returns the address block of 192.0.2.1:56324 to
+// 198.51.100.1:443
+func inetBlock() []byte {
+	b := []byte{192, 0, 2, 1, 198, 51, 100, 1}
+	b = binary.BigEndian.AppendUint16(b, 56324)
+	return binary.BigEndian.AppendUint16(b, 443)
+}
+
+func appendTLV(b []byte, typ byte, value string) []byte {
+	b = append(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(value)))
+	return append(b, value...)
+}
+
+func checkAddr(t *testing.T, name string, addr net.Addr, want string) {
+	t.Helper()
+	if want == "" {
+		if addr != nil {
+			t.Errorf("%s = %v, want nil", name, addr)
+		}
+		return
+	}
+	if addr == nil || addr.String() != want {
+		t.Errorf("%s = %v, want %s", name, addr, want)
+	}
+}
@@ -0,0 +1,149 @@
+package proxyproto
+
+import "encoding/binary"
+
+// TLV is an extension of a version 2 header
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Extension types (PROXY protocol specification, section 2.2)
+const (
+	TypeALPN      = 0x01
+	TypeAuthority = 0x02
+	TypeCRC32C    = 0x03
+	TypeNoop      = 0x04
+	TypeUniqueID  = 0x05
+	TypeSSL       = 0x20
+	TypeNetNS     = 0x30
+)
+
+// Subtypes within a TypeSSL extension
+const (
+	subtypeSSLVersion = 0x21
+	subtypeSSLCN      = 0x22
+	subtypeSSLCipher  = 0x23
+	subtypeSSLSigAlg  = 0x24
+	subtypeSSLKeyAlg  = 0x25
+)
+
+// Client flags of a TypeSSL extension
+const (
+	// ClientSSL is set when the client connected over TLS
+	ClientSSL = 0x01
+
+	// ClientCertConn is set when the client sent a certificate on this
+	// connection
+	ClientCertConn = 0x02
+
+	// ClientCertSession is set when the client sent a certificate at
+	// some point in the TLS session this connection resumed
+	ClientCertSession = 0x04
+)
+
+// TLSInfo describes the TLS connection a proxy terminated, from a TypeSSL
+// extension
+type TLSInfo struct {
+	// Client holds the ClientSSL, ClientCertConn and ClientCertSession
+	// flags
+	Client byte
+
+	// Verified reports whether the client's certificate, if any, was
+	// verified
+	Verified bool
+
+	// Version is the TLS version, e.g. "TLSv1.3"
+	Version string
+
+	// CommonName is the client certificate's subject CN
+	CommonName string
+
+	// Cipher, SignatureAlgorithm and KeyAlgorithm name the cipher suite
+	// and the algorithms of the server's certificate, e.g.
+	// "ECDHE-RSA-AES128-GCM-SHA256", "SHA256" and "RSA2048"
+	Cipher             string
+	SignatureAlgorithm string
+	KeyAlgorithm       string
+}
+
+// parseTLVs decodes the extensions after the address block
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, invalid("truncated extension")
+		}
+		length := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+length {
+			return nil, invalid("extension 0x%02x of %d bytes overruns the header", b[0], length)
+		}
+		tlvs = append(tlvs, TLV{Type: b[0], Value: b[3 : 3+length]})
+		b = b[3+length:]
+	}
+	return tlvs, nil
+}
+
+// TLV returns the value of the first extension of the given type
+func (h *Header) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ALPN returns the application protocol the client negotiated with the
+// proxy, such as "h2", or "" if not sent
+func (h *Header) ALPN() string {
+	value, _ := h.TLV(TypeALPN)
+	return string(value)
+}
+
+// Authority returns the host name the client asked the proxy for, such as
+// its TLS SNI, or "" if not sent
+func (h *Header) Authority() string {
+	value, _ := h.TLV(TypeAuthority)
+	return string(value)
+}
+
+// UniqueID returns the proxy's identifier for the connection, or nil if
+// not sent
+func (h *Header) UniqueID() []byte {
+	value, _ := h.TLV(TypeUniqueID)
+	return value
+}
+
+// TLS returns the TLS details from a TypeSSL extension, reporting false
+// if there is none or it is malformed
+func (h *Header) TLS() (*TLSInfo, bool) {
+	value, ok := h.TLV(TypeSSL)
+	if !ok || len(value) < 5 {
+		return nil, false
+	}
+
+	info := &TLSInfo{
+		Client:   value[0],
+		Verified: binary.BigEndian.Uint32(value[1:5]) == 0,
+	}
+	subs, err := parseTLVs(value[5:])
+	if err != nil {
+		return nil, false
+	}
+	for _, sub := range subs {
+		switch sub.Type {
+		case subtypeSSLVersion:
+			info.Version = string(sub.Value)
+		case subtypeSSLCN:
+			info.CommonName = string(sub.Value)
+		case subtypeSSLCipher:
+			info.Cipher = string(sub.Value)
+		case subtypeSSLSigAlg:
+			info.SignatureAlgorithm = string(sub.Value)
+		case subtypeSSLKeyAlg:
+			info.KeyAlgorithm = string(sub.Value)
+		}
+	}
+	return info, true
+}
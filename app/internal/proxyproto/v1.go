@@ -0,0 +1,79 @@
+package proxyproto
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// prefixV1 starts a version 1 header
+const prefixV1 = "PROXY "
+
+// maxLengthV1 is the longest a version 1 header may be, CRLF included
+const maxLengthV1 = 107
+
+// readV1 reads the rest of a text header, which ends with CRLF. The
+// length isn't known up front, so it is read a byte at a time to leave the
+// data after it unread.
+func readV1(r io.Reader, start []byte) (*Header, error) {
+	line := append(make([]byte, 0, maxLengthV1), start...)
+	var b [1]byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == maxLengthV1 {
+			return nil, invalid("version 1 header longer than %d bytes", maxLengthV1)
+		}
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+	return parseV1(string(line[len(prefixV1) : len(line)-2]))
+}
+
+// parseV1 parses the fields of a text header after "PROXY ", such as
+// "TCP4 192.0.2.1 198.51.100.1 56324 443"
+func parseV1(line string) (*Header, error) {
+	fields := strings.Split(line, " ")
+	h := &Header{Version: 1, Command: CommandProxy}
+
+	switch fields[0] {
+	case "UNKNOWN":
+		// The proxy couldn't tell; anything after it is ignored
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, invalid("unknown protocol %q", fields[0])
+	}
+	if len(fields) != 5 {
+		return nil, invalid("want 5 fields after PROXY, got %d", len(fields))
+	}
+
+	src, err := parseAddrV1(fields[0], fields[1], fields[3])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseAddrV1(fields[0], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+// parseAddrV1 parses an address and port of the given protocol
+func parseAddrV1(protocol, ip, port string) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" || addr.Is4() != (protocol == "TCP4") {
+		return nil, invalid("bad %s address %q", protocol, ip)
+	}
+
+	// Ports are decimal without leading zeros
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || len(port) > 1 && port[0] == '0' {
+		return nil, invalid("bad port %q", port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(n))), nil
+}
@@ -0,0 +1,155 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// signatureV2 starts a version 2 header
+var signatureV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Address families and transport protocols of a version 2 header
+const (
+	familyUnspec = 0x0
+	familyInet   = 0x1
+	familyInet6  = 0x2
+	familyUnix   = 0x3
+
+	transportStream = 0x1
+	transportDgram  = 0x2
+)
+
+// Lengths of the address block for each family
+const (
+	addrLengthInet  = 4 + 4 + 2 + 2
+	addrLengthInet6 = 16 + 16 + 2 + 2
+	addrLengthUnix  = 108 + 108
+)
+
+// crc32c is the checksum of the CRC32C extension
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// readV2 reads the rest of a binary header after its signature
+func readV2(r io.Reader) (*Header, error) {
+	var fixed [4]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	if fixed[0]>>4 != 2 {
+		return nil, invalid("unknown version %d", fixed[0]>>4)
+	}
+
+	h := &Header{Version: 2, Command: Command(fixed[0] & 0x0f)}
+	if h.Command != CommandLocal && h.Command != CommandProxy {
+		return nil, invalid("unknown command %d", h.Command)
+	}
+
+	body := make([]byte, binary.BigEndian.Uint16(fixed[2:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	family, transport := fixed[1]>>4, fixed[1]&0x0f
+	addrLength, err := h.parseAddrs(family, transport, body)
+	if err != nil {
+		return nil, err
+	}
+	if h.TLVs, err = parseTLVs(body[addrLength:]); err != nil {
+		return nil, err
+	}
+
+	if err := h.verifyChecksum(fixed[:], body); err != nil {
+		return nil, err
+	}
+
+	// A local connection's addresses, if any, are the proxy's own
+	if h.Command == CommandLocal {
+		h.Source, h.Destination = nil, nil
+	}
+	return h, nil
+}
+
+// parseAddrs decodes the address block at the start of body and returns
+// its length
+func (h *Header) parseAddrs(family, transport byte, body []byte) (int, error) {
+	var length int
+	switch family {
+	case familyUnspec:
+		return 0, nil
+	case familyInet:
+		length = addrLengthInet
+	case familyInet6:
+		length = addrLengthInet6
+	case familyUnix:
+		length = addrLengthUnix
+	default:
+		return 0, invalid("unknown address family %d", family)
+	}
+	if transport != transportStream && transport != transportDgram {
+		return 0, invalid("unknown transport protocol %d", transport)
+	}
+	if len(body) < length {
+		return 0, invalid("address block of %d bytes, want %d", len(body), length)
+	}
+
+	if family == familyUnix {
+		network := "unix"
+		if transport == transportDgram {
+			network = "unixgram"
+		}
+		h.Source = &net.UnixAddr{Name: unixPath(body[:108]), Net: network}
+		h.Destination = &net.UnixAddr{Name: unixPath(body[108:216]), Net: network}
+		return length, nil
+	}
+
+	size := (length - 4) / 2
+	src, _ := netip.AddrFromSlice(body[:size])
+	dst, _ := netip.AddrFromSlice(body[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(body[2*size:])
+	dstPort := binary.BigEndian.Uint16(body[2*size+2:])
+
+	if transport == transportDgram {
+		h.Source = net.UDPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort))
+		h.Destination = net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort))
+	} else {
+		h.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, srcPort))
+		h.Destination = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, dstPort))
+	}
+	return length, nil
+}
+
+// unixPath returns a NUL-padded socket path
+func unixPath(b []byte) string {
+	path, _, _ := strings.Cut(string(b), "\x00")
+	return path
+}
+
+// verifyChecksum checks the CRC32C extension, if present, which covers
+// the whole header with the checksum itself zeroed
+func (h *Header) verifyChecksum(fixed, body []byte) error {
+	value, ok := h.TLV(TypeCRC32C)
+	if !ok {
+		return nil
+	}
+	if len(value) != 4 {
+		return invalid("CRC32C extension of %d bytes", len(value))
+	}
+	want := binary.BigEndian.Uint32(value)
+
+	// value aliases body, so zero it there for the computation
+	saved := [4]byte(value)
+	clear(value)
+	sum := crc32.Update(0, crc32c, signatureV2)
+	sum = crc32.Update(sum, crc32c, fixed)
+	sum = crc32.Update(sum, crc32c, body)
+	copy(value, saved[:])
+
+	if sum != want {
+		return invalid("CRC32C mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package quic
+
+import "sort"
+
+// byteRange is the half-open range [start, end)
+type byteRange struct {
+	start, end uint64
+}
+
+// rangeSet is a set of integers kept as sorted, non-overlapping and
+// non-adjacent ranges. It tracks received packet numbers and which parts
+// of a stream have been acknowledged or lost.
+type rangeSet []byteRange
+
+// add inserts [start, end), merging it with any ranges it touches
+func (s *rangeSet) add(start, end uint64) {
+	if start >= end {
+		return
+	}
+
+	rs := *s
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].end >= start })
+	j := i
+	for j < len(rs) && rs[j].start <= end {
+		start = min(start, rs[j].start)
+		end = max(end, rs[j].end)
+		j++
+	}
+
+	if i == j {
+		rs = append(rs, byteRange{})
+		copy(rs[i+1:], rs[i:])
+		rs[i] = byteRange{start, end}
+	} else {
+		rs[i] = byteRange{start, end}
+		rs = append(rs[:i+1], rs[j:]...)
+	}
+	*s = rs
+}
+
+// remove deletes [start, end) from the set
+func (s *rangeSet) remove(start, end uint64) {
+	if start >= end {
+		return
+	}
+
+	var out rangeSet
+	for _, r := range *s {
+		if r.end <= start || r.start >= end {
+			out = append(out, r)
+			continue
+		}
+		if r.start < start {
+			out = append(out, byteRange{r.start, start})
+		}
+		if r.end > end {
+			out = append(out, byteRange{end, r.end})
+		}
+	}
+	*s = out
+}
+
+// contains reports whether v is in the set
+func (s rangeSet) contains(v uint64) bool {
+	i := sort.Search(len(s), func(i int) bool { return s[i].end > v })
+	return i < len(s) && s[i].start <= v
+}
+
+// sendBuf holds the data sent on a stream, or at one encryption level in
+// CRYPTO frames, until the peer acknowledges it
+type sendBuf struct {
+	// data holds the bytes from offset base on that are not yet
+	// acknowledged; next is the first offset never sent
+	data []byte
+	base uint64
+	next uint64
+
+	// lost ranges must be sent again; acked ranges above base have
+	// been acknowledged out of order
+	lost  rangeSet
+	acked rangeSet
+
+	// fin is set once the stream has been closed for writing
+	fin      bool
+	finSent  bool
+	finAcked bool
+}
+
+// end returns the offset after the last byte written
+func (b *sendBuf) end() uint64 {
+	return b.base + uint64(len(b.data))
+}
+
+// write appends data to be sent
+func (b *sendBuf) write(p []byte) {
+	b.data = append(b.data, p...)
+}
+
+// pending reports whether anything is waiting to be sent. New data
+// beyond limit does not count.
+func (b *sendBuf) pending(limit uint64) bool {
+	return len(b.lost) > 0 || (b.next < b.end() && b.next < limit) || (b.fin && !b.finSent && b.next == b.end())
+}
+
+// pop takes up to max bytes to send next, lost data first. New data is
+// only sent up to offset limit. isNew says the bytes were never sent
+// before, so count against flow control.
+func (b *sendBuf) pop(max int, limit uint64) (offset uint64, data []byte, fin, isNew, ok bool) {
+	if len(b.lost) > 0 {
+		r := b.lost[0]
+		n := min(r.end-r.start, uint64(max))
+		b.lost.remove(r.start, r.start+n)
+		data = b.data[r.start-b.base : r.start-b.base+n]
+		fin = b.fin && r.start+n == b.end()
+		b.finSent = b.finSent || fin
+		return r.start, data, fin, false, n > 0 || fin
+	}
+
+	if b.next < b.end() && b.next < limit {
+		offset = b.next
+		n := min(b.end()-offset, uint64(max), limit-offset)
+		b.next += n
+		data = b.data[offset-b.base : offset-b.base+n]
+		fin = b.fin && b.next == b.end()
+		b.finSent = b.finSent || fin
+		return offset, data, fin, true, n > 0 || fin
+	}
+
+	if b.fin && !b.finSent && b.next == b.end() {
+		b.finSent = true
+		return b.end(), nil, true, false, true
+	}
+	return 0, nil, false, false, false
+}
+
+// onAck records that a range has been acknowledged and drops data no
+// longer needed
+func (b *sendBuf) onAck(offset, length uint64, fin bool) {
+	b.acked.add(offset, offset+length)
+	b.lost.remove(offset, offset+length)
+	if fin {
+		b.finAcked = true
+	}
+
+	if len(b.acked) > 0 && b.acked[0].start <= b.base {
+		if newBase := b.acked[0].end; newBase > b.base {
+			b.data = b.data[newBase-b.base:]
+			b.base = newBase
+		}
+		b.acked.remove(0, b.base)
+	}
+
+	// Start a fresh array once everything has been acknowledged
+	if len(b.data) == 0 {
+		b.data = nil
+	}
+}
+
+// onLost queues a range to be sent again, except for parts that have
+// been acknowledged since
+func (b *sendBuf) onLost(offset, length uint64, fin bool) {
+	start, end := max(offset, b.base), offset+length
+	if start < end {
+		b.lost.add(start, end)
+		for _, r := range b.acked {
+			b.lost.remove(r.start, r.end)
+		}
+	}
+	if fin && !b.finAcked {
+		b.finSent = false
+	}
+}
+
+// done reports whether all data and the end of the stream have been
+// acknowledged
+func (b *sendBuf) done() bool {
+	return b.fin && b.finAcked && len(b.data) == 0
+}
+
+// recvChunk is data received at an offset
+type recvChunk struct {
+	offset uint64
+	data   []byte
+}
+
+// recvBuf reassembles data received out of order on a stream or at one
+// encryption level
+type recvBuf struct {
+	chunks []recvChunk
+
+	// offset is the next byte to be read; highest is the end of the
+	// furthest data received
+	offset  uint64
+	highest uint64
+
+	finalSize uint64
+	hasFinal  bool
+}
+
+// push stores data received at offset
+func (r *recvBuf) push(offset uint64, data []byte) {
+	end := offset + uint64(len(data))
+	r.highest = max(r.highest, end)
+	if end <= r.offset {
+		return
+	}
+	if offset < r.offset {
+		data = data[r.offset-offset:]
+		offset = r.offset
+	}
+
+	i := sort.Search(len(r.chunks), func(i int) bool { return r.chunks[i].offset > offset })
+	r.chunks = append(r.chunks, recvChunk{})
+	copy(r.chunks[i+1:], r.chunks[i:])
+	r.chunks[i] = recvChunk{offset: offset, data: append([]byte(nil), data...)}
+}
+
+// read copies contiguous data into p
+func (r *recvBuf) read(p []byte) int {
+	n := 0
+	for len(p) > 0 && len(r.chunks) > 0 {
+		c := r.chunks[0]
+		if c.offset > r.offset {
+			break
+		}
+		if c.offset+uint64(len(c.data)) <= r.offset {
+			r.chunks = r.chunks[1:]
+			continue
+		}
+
+		k := copy(p, c.data[r.offset-c.offset:])
+		n += k
+		p = p[k:]
+		r.offset += uint64(k)
+	}
+	return n
+}
+
+// readable returns how many contiguous bytes can be read
+func (r *recvBuf) readable() int {
+	at := r.offset
+	for _, c := range r.chunks {
+		if c.offset > at {
+			break
+		}
+		at = max(at, c.offset+uint64(len(c.data)))
+	}
+	return int(at - r.offset)
+}
+
+// eof reports whether everything up to the final size has been read
+func (r *recvBuf) eof() bool {
+	return r.hasFinal && r.offset == r.finalSize
+}
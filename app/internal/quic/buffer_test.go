@@ -0,0 +1,143 @@
+package quic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRangeSet(t *testing.T) {
+	var s rangeSet
+	s.add(10, 20)
+	s.add(30, 40)
+	s.add(5, 5) // empty
+	if want := (rangeSet{{10, 20}, {30, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("set = %v, want %v", s, want)
+	}
+
+	// Adjacent and overlapping ranges merge
+	s.add(20, 25)
+	s.add(0, 3)
+	s.add(24, 31)
+	if want := (rangeSet{{0, 3}, {10, 40}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("set = %v, want %v", s, want)
+	}
+	s.add(2, 50)
+	if want := (rangeSet{{0, 50}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("set = %v, want %v", s, want)
+	}
+
+	s.remove(10, 20)
+	s.remove(45, 60)
+	if want := (rangeSet{{0, 10}, {20, 45}}); !reflect.DeepEqual(s, want) {
+		t.Fatalf("set = %v, want %v", s, want)
+	}
+
+	for v, want := range map[uint64]bool{0: true, 9: true, 10: false, 19: false, 20: true, 44: true, 45: false} {
+		if s.contains(v) != want {
+			t.Errorf("contains(%d) = %v, want %v", v, !want, want)
+		}
+	}
+}
+
+func TestSendBuf(t *testing.T) {
+	var b sendBuf
+	b.write([]byte("0123456789"))
+
+	// Flow control limits new data
+	offset, data, fin, isNew, ok := b.pop(100, 4)
+	if !ok || offset != 0 || string(data) != "0123" || fin || !isNew {
+		t.Fatalf("pop = %d %q %v %v %v", offset, data, fin, isNew, ok)
+	}
+	if b.pending(4) {
+		t.Error("pending beyond the flow-control limit")
+	}
+
+	b.fin = true
+	offset, data, fin, _, _ = b.pop(3, 100)
+	if offset != 4 || string(data) != "456" || fin {
+		t.Fatalf("pop = %d %q %v", offset, data, fin)
+	}
+	offset, data, fin, _, _ = b.pop(100, 100)
+	if offset != 7 || string(data) != "789" || !fin {
+		t.Fatalf("pop = %d %q %v, want the rest with fin", offset, data, fin)
+	}
+	if b.pending(100) {
+		t.Error("pending after everything was sent")
+	}
+
+	// Lost data is sent again first, except what was acknowledged since
+	b.onLost(0, 4, false)
+	b.onAck(2, 2, false)
+	b.onLost(7, 3, true)
+	offset, data, fin, isNew, _ = b.pop(100, 100)
+	if offset != 0 || string(data) != "01" || fin || isNew {
+		t.Fatalf("pop = %d %q %v %v, want lost 01", offset, data, fin, isNew)
+	}
+	offset, data, fin, _, _ = b.pop(100, 100)
+	if offset != 7 || string(data) != "789" || !fin {
+		t.Fatalf("pop = %d %q %v, want lost 789 with fin", offset, data, fin)
+	}
+
+	// Acknowledging from the start releases the data
+	b.onAck(0, 2, false)
+	if b.base != 4 || string(b.data) != "456789" {
+		t.Errorf("base %d data %q after ack", b.base, b.data)
+	}
+	b.onAck(4, 6, true)
+	if !b.done() || b.data != nil {
+		t.Errorf("done %v data %q after acking everything", b.done(), b.data)
+	}
+}
+
+func TestSendBufEmptyFin(t *testing.T) {
+	var b sendBuf
+	b.fin = true
+	if !b.pending(0) {
+		t.Fatal("fin not pending")
+	}
+	offset, data, fin, _, ok := b.pop(100, 0)
+	if !ok || offset != 0 || len(data) != 0 || !fin {
+		t.Errorf("pop = %d %q %v %v", offset, data, fin, ok)
+	}
+
+	// A lost fin is sent again
+	b.onLost(0, 0, true)
+	if !b.pending(0) {
+		t.Error("lost fin not pending")
+	}
+}
+
+func TestRecvBuf(t *testing.T) {
+	var r recvBuf
+	r.push(5, []byte("56789"))
+	r.push(0, []byte("012"))
+	if n := r.readable(); n != 3 {
+		t.Errorf("readable = %d, want 3 before the gap is filled", n)
+	}
+
+	// Overlapping and duplicate data
+	r.push(2, []byte("234"))
+	r.push(0, []byte("01"))
+	if n := r.readable(); n != 10 {
+		t.Errorf("readable = %d, want 10", n)
+	}
+
+	p := make([]byte, 4)
+	if n := r.read(p); string(p[:n]) != "0123" {
+		t.Errorf("read %q", p[:n])
+	}
+	// Data before the read offset is dropped
+	r.push(0, []byte("0123"))
+	p = make([]byte, 20)
+	if n := r.read(p); string(p[:n]) != "456789" {
+		t.Errorf("read %q", p[:n])
+	}
+	if r.highest != 10 || r.offset != 10 {
+		t.Errorf("highest %d offset %d", r.highest, r.offset)
+	}
+
+	r.finalSize, r.hasFinal = 10, true
+	if !r.eof() {
+		t.Error("not at eof")
+	}
+}
@@ -0,0 +1,538 @@
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// connIDLen is the length of the connection IDs this server issues
+const connIDLen = 8
+
+// recvQueueLen is how many datagrams may wait for a busy connection
+// before further ones are dropped
+const recvQueueLen = 256
+
+// packetSpace is a packet number space (RFC 9000 Section 12.3)
+type packetSpace int
+
+const (
+	spaceInitial packetSpace = iota
+	spaceHandshake
+	spaceApp
+	numSpaces
+)
+
+// connPhase is where a connection is in its life
+type connPhase int
+
+const (
+	phaseHandshake connPhase = iota
+	phaseActive
+
+	// phaseClosing connections have sent CONNECTION_CLOSE and
+	// phaseDraining ones received it; both wait out three PTOs
+	phaseClosing
+	phaseDraining
+	phaseClosed
+)
+
+// Conn is a QUIC connection accepted by a Listener. Its state is guarded
+// by mu and driven by one goroutine that reads packets, sends packets
+// and runs the timers; streams and the methods below wake it as needed.
+type Conn struct {
+	l    *Listener
+	addr netip.AddrPort
+
+	// originalDCID is the ID the client chose for its first packets,
+	// localCID the one issued by this server and peerCID the client's
+	originalDCID []byte
+	localCID     []byte
+	peerCID      []byte
+
+	tls *tls.QUICConn
+
+	recvCh chan []byte
+	wake   chan struct{}
+	done   chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	phase    connPhase
+	err      error
+	created  time.Time
+	lastRecv time.Time
+
+	spaces [numSpaces]*spaceState
+
+	// 1-RTT keys change with key updates; keyPhase is the current phase
+	// bit, prevRead the keys of the previous phase and keyUpdatePN the
+	// first packet number received in the current phase
+	appRead     *keys
+	appWrite    *keys
+	prevRead    *keys
+	nextRead    *keys
+	keyPhase    bool
+	keyUpdatePN uint64
+
+	peerParams    *transportParams
+	idleTimeout   time.Duration
+	connState     tls.ConnectionState
+	handshakeDone bool
+
+	// Until the client's address is validated by a Handshake packet,
+	// at most three times what it sent may be sent back
+	addressValidated bool
+	bytesRecv        int
+	bytesSent        int
+
+	streams       map[uint64]*Stream
+	acceptBidi    []*Stream
+	acceptUni     []*Stream
+	sendQueue     []*Stream
+	maxStreamData []*Stream
+	resets        []*Stream
+
+	// Client-initiated streams, indexed [bidi, uni]: next is the count
+	// opened so far, max the limit advertised and closed the count
+	// finished, which raises the limit
+	nextPeerStreams   [2]uint64
+	maxPeerStreams    [2]uint64
+	closedPeerStreams [2]uint64
+	sendMaxStreams    [2]bool
+	streamLimit       [2]uint64
+
+	// Server-initiated unidirectional streams
+	nextLocalUni uint64
+	peerMaxUni   uint64
+
+	// Connection-level flow control: recvMax is advertised to the peer,
+	// recvHighest the sum of the highest offsets received on all streams
+	// and recvConsumed what has been read
+	recvMax       uint64
+	recvHighest   uint64
+	recvConsumed  uint64
+	sendMaxData   bool
+	peerMaxData   uint64
+	dataSent      uint64
+	pendingCtrl   [][]byte
+	handshakeSent bool
+
+	recovery recovery
+
+	// closeDatagram is resent when packets arrive while closing
+	closeDatagram []byte
+	closeDeadline time.Time
+	closeReplies  int
+}
+
+// spaceState holds the keys and packet numbers of one packet number space
+type spaceState struct {
+	recvKeys  *keys
+	sendKeys  *keys
+	discarded bool
+
+	// received are the packet numbers received, all below recvFloor
+	// being treated as duplicates once old ranges are dropped
+	received     rangeSet
+	recvFloor    uint64
+	largestRecv  int64
+	largestTime  time.Time
+	ackEliciting int
+	ackNeeded    bool
+	ackDeadline  time.Time
+
+	nextPN       uint64
+	largestAcked int64
+	sent         []*sentPacket
+	lastSent     time.Time
+	probe        bool
+
+	crypto     sendBuf
+	cryptoRecv recvBuf
+}
+
+// newConn creates a connection for a client's first Initial packet
+func newConn(l *Listener, addr netip.AddrPort, dcid, scid []byte) (*Conn, error) {
+	localCID := make([]byte, connIDLen)
+	if _, err := rand.Read(localCID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	c := &Conn{
+		l:            l,
+		addr:         addr,
+		originalDCID: append([]byte(nil), dcid...),
+		localCID:     localCID,
+		peerCID:      append([]byte(nil), scid...),
+		recvCh:       make(chan []byte, recvQueueLen),
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+		created:      now,
+		lastRecv:     now,
+		idleTimeout:  l.config.maxIdleTimeout(),
+		streams:      make(map[uint64]*Stream),
+		recvMax:      connWindow,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	c.recovery.init()
+
+	for i := range c.spaces {
+		c.spaces[i] = &spaceState{largestRecv: -1, largestAcked: -1}
+	}
+	clientKeys, serverKeys := initialKeys(dcid)
+	c.spaces[spaceInitial].recvKeys = clientKeys
+	c.spaces[spaceInitial].sendKeys = serverKeys
+
+	c.streamLimit = [2]uint64{uint64(l.config.maxIncomingStreams()), maxPeerUniStreams}
+	c.maxPeerStreams = c.streamLimit
+
+	params := &transportParams{
+		originalDCID:                   c.originalDCID,
+		initialSCID:                    c.localCID,
+		maxIdleTimeout:                 c.idleTimeout,
+		maxUDPPayloadSize:              maxReceiveDatagram,
+		initialMaxData:                 connWindow,
+		initialMaxStreamDataBidiRemote: streamWindow,
+		initialMaxStreamDataUni:        uniStreamWindow,
+		initialMaxStreamsBidi:          c.maxPeerStreams[0],
+		initialMaxStreamsUni:           c.maxPeerStreams[1],
+		disableActiveMigration:         true,
+		activeConnectionIDLimit:        2,
+	}
+
+	tlsConfig := l.config.TLSConfig.Clone()
+	if tlsConfig.MinVersion < tls.VersionTLS13 {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	c.tls = tls.QUICServer(&tls.QUICConfig{TLSConfig: tlsConfig})
+	c.tls.SetTransportParameters(params.marshal())
+	if err := c.tls.Start(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// maxPeerUniStreams is how many unidirectional streams a client may open;
+// HTTP/3 needs three
+const maxPeerUniStreams = 16
+
+// deliver hands a datagram to the connection, dropping it if the
+// connection is too busy
+func (c *Conn) deliver(d []byte) {
+	select {
+	case c.recvCh <- d:
+	default:
+	}
+}
+
+// wakeup asks the connection's goroutine to send what is pending
+func (c *Conn) wakeup() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// broadcast wakes everything waiting on the connection's state
+func (c *Conn) broadcast() {
+	c.mu.Lock()
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// run drives the connection until it is closed
+func (c *Conn) run() {
+	defer c.l.remove(c)
+	defer c.tls.Close()
+
+	// A panic handling the client's packets only costs this connection.
+	// Its state cannot be trusted to build a CONNECTION_CLOSE, so it is
+	// dropped silently and the client times out.
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.QUIC, v, "QUIC connection from %s", c.addr)
+			c.mu.Lock()
+			c.terminate(&TransportError{Code: ErrInternal, Reason: "internal error"})
+			c.mu.Unlock()
+		}
+	}()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		next, closed := c.tick()
+		if closed {
+			return
+		}
+
+		timer.Reset(time.Until(next))
+		select {
+		case d := <-c.recvCh:
+			c.receive(d)
+		case <-c.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// tick runs the timers that are due and sends what is pending, returning
+// when the next timer fires or that the connection is closed
+func (c *Conn) tick() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.onTimers(now)
+	c.flush(now)
+	if c.phase == phaseClosed {
+		return time.Time{}, true
+	}
+	return c.nextDeadline(), false
+}
+
+// receive handles a datagram and whatever else has arrived meanwhile
+func (c *Conn) receive(d []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.handleDatagram(d, time.Now())
+	// Take whatever else has arrived before replying
+	for {
+		select {
+		case d := <-c.recvCh:
+			c.handleDatagram(d, time.Now())
+		default:
+			return
+		}
+	}
+}
+
+// nextDeadline returns when the next timer fires; the caller holds mu
+func (c *Conn) nextDeadline() time.Time {
+	if c.phase == phaseClosing || c.phase == phaseDraining {
+		return c.closeDeadline
+	}
+
+	next := c.lastRecv.Add(c.idleTimeout)
+	if c.phase == phaseHandshake {
+		next = earliest(next, c.created.Add(c.l.config.handshakeTimeout()))
+	}
+	for sp, space := range c.spaces {
+		if space.ackEliciting > 0 && !space.ackDeadline.IsZero() {
+			next = earliest(next, space.ackDeadline)
+		}
+		if deadline, ok := c.ptoDeadline(packetSpace(sp)); ok {
+			next = earliest(next, deadline)
+		}
+	}
+	return next
+}
+
+// earliest returns the earlier of two times
+func earliest(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// onTimers runs every timer that has expired; the caller holds mu
+func (c *Conn) onTimers(now time.Time) {
+	switch c.phase {
+	case phaseClosed:
+		return
+	case phaseClosing, phaseDraining:
+		if !now.Before(c.closeDeadline) {
+			c.terminate(c.err)
+		}
+		return
+	}
+
+	if !now.Before(c.lastRecv.Add(c.idleTimeout)) {
+		c.terminate(ErrIdleTimeout)
+		return
+	}
+	if c.phase == phaseHandshake && !now.Before(c.created.Add(c.l.config.handshakeTimeout())) {
+		c.terminate(ErrHandshakeTimeout)
+		return
+	}
+
+	for sp, space := range c.spaces {
+		if space.ackEliciting > 0 && !space.ackDeadline.IsZero() && !now.Before(space.ackDeadline) {
+			space.ackNeeded = true
+		}
+		if deadline, ok := c.ptoDeadline(packetSpace(sp)); ok && !now.Before(deadline) {
+			c.onPTO(packetSpace(sp))
+		}
+	}
+}
+
+// AcceptStream waits for the client to open a bidirectional stream
+func (c *Conn) AcceptStream(ctx context.Context) (*Stream, error) {
+	return c.accept(ctx, &c.acceptBidi)
+}
+
+// AcceptUniStream waits for the client to open a unidirectional stream
+func (c *Conn) AcceptUniStream(ctx context.Context) (*Stream, error) {
+	return c.accept(ctx, &c.acceptUni)
+}
+
+// accept takes the next stream from a queue, waiting for one if needed
+func (c *Conn) accept(ctx context.Context, queue *[]*Stream) (*Stream, error) {
+	stop := context.AfterFunc(ctx, c.broadcast)
+	defer stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		if len(*queue) > 0 {
+			st := (*queue)[0]
+			*queue = (*queue)[1:]
+			return st, nil
+		}
+		if c.err != nil {
+			return nil, c.err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		c.cond.Wait()
+	}
+}
+
+// errStreamLimit is returned when the client allows no more streams
+var errStreamLimit = errors.New("quic: peer's stream limit reached")
+
+// OpenUniStream opens a unidirectional stream to the client
+func (c *Conn) OpenUniStream() (*Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.nextLocalUni >= c.peerMaxUni {
+		return nil, errStreamLimit
+	}
+
+	id := c.nextLocalUni<<2 | 0x3
+	c.nextLocalUni++
+	st := newStream(c, id, false, true)
+	st.sendMax = c.peerParams.initialMaxStreamDataUni
+	c.streams[id] = st
+	return st, nil
+}
+
+// CloseWithError closes the connection, sending CONNECTION_CLOSE with an
+// application error code. Streams fail from then on.
+func (c *Conn) CloseWithError(code uint64, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.close(&ApplicationError{Code: code, Reason: reason})
+	return nil
+}
+
+// Context returns a context that is cancelled when the connection closes
+func (c *Conn) Context() context.Context {
+	return c.ctx
+}
+
+// ConnectionState returns the TLS state of the connection
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.connState
+}
+
+// RemoteAddr returns the client's address
+func (c *Conn) RemoteAddr() net.Addr {
+	return net.UDPAddrFromAddrPort(c.addr)
+}
+
+// LocalAddr returns the listener's address
+func (c *Conn) LocalAddr() net.Addr {
+	return c.l.Addr()
+}
+
+// close starts closing the connection with err, sending CONNECTION_CLOSE
+// at once; the caller holds mu
+func (c *Conn) close(err error) {
+	if c.phase >= phaseClosing {
+		return
+	}
+
+	// Until the handshake completes the client may lack the keys of any
+	// level, so the frame goes out at every level there are keys for
+	var datagram []byte
+	for sp := spaceInitial; sp < numSpaces; sp++ {
+		if c.sendKeys(sp) == nil {
+			continue
+		}
+		frame := appendConnectionClose(nil, err, sp == spaceApp)
+		datagram = c.appendPacket(datagram, sp, frame)
+	}
+
+	c.closeDatagram = datagram
+	c.send(datagram)
+	c.enterClosing(phaseClosing, err)
+	c.wakeup()
+}
+
+// enterClosing fails every stream and waits three PTOs before forgetting
+// the connection; the caller holds mu
+func (c *Conn) enterClosing(phase connPhase, err error) {
+	c.phase = phase
+	c.err = err
+	c.closeDeadline = time.Now().Add(3 * c.recovery.pto(false, 0))
+	c.cond.Broadcast()
+}
+
+// terminate forgets the connection; the caller holds mu
+func (c *Conn) terminate(err error) {
+	if c.phase == phaseClosed {
+		return
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	c.phase = phaseClosed
+	c.cond.Broadcast()
+	c.cancel()
+	close(c.done)
+
+	for _, st := range c.streams {
+		st.readDeadline.set(time.Time{}, c)
+		st.writeDeadline.set(time.Time{}, c)
+	}
+}
+
+// send writes a datagram to the client; the caller holds mu
+func (c *Conn) send(datagram []byte) {
+	if len(datagram) == 0 {
+		return
+	}
+	c.bytesSent += len(datagram)
+	c.l.conn.WriteToUDPAddrPort(datagram, c.addr)
+}
@@ -0,0 +1,217 @@
+package quic
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// initialSalt derives the Initial keys of QUIC version 1 (RFC 9001
+// Section 5.2)
+var initialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+	0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+// aeadTagLen is the authentication tag added to every packet payload
+const aeadTagLen = 16
+
+// sampleLen is the size of the ciphertext sample for header protection
+const sampleLen = 16
+
+// errDecrypt is returned for a packet that fails authentication
+var errDecrypt = errors.New("quic: packet decryption failed")
+
+// keys protect packets in one direction at one encryption level
+type keys struct {
+	suite  uint16
+	secret []byte
+	aead   cipher.AEAD
+	iv     []byte
+	hp     cipher.Block
+	nonce  [12]byte
+}
+
+// suiteHash returns the hash and AEAD key length of a TLS 1.3 suite
+func suiteHash(suite uint16) (func() hash.Hash, int, error) {
+	switch suite {
+	case tls.TLS_AES_128_GCM_SHA256:
+		return sha256.New, 16, nil
+	case tls.TLS_AES_256_GCM_SHA384:
+		return sha512.New384, 32, nil
+	}
+	return nil, 0, fmt.Errorf("quic: unsupported cipher suite %s", tls.CipherSuiteName(suite))
+}
+
+// newKeys derives packet protection keys from a traffic secret
+func newKeys(suite uint16, secret []byte) (*keys, error) {
+	h, keyLen, err := suiteHash(suite)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(expandLabel(h, secret, "quic key", keyLen))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	hp, err := aes.NewCipher(expandLabel(h, secret, "quic hp", keyLen))
+	if err != nil {
+		return nil, err
+	}
+
+	return &keys{
+		suite:  suite,
+		secret: secret,
+		aead:   aead,
+		iv:     expandLabel(h, secret, "quic iv", 12),
+		hp:     hp,
+	}, nil
+}
+
+// nextKeys derives the keys for the next key phase (RFC 9001 Section 6).
+// Header protection keys do not change.
+func (k *keys) nextKeys() (*keys, error) {
+	h, _, err := suiteHash(k.suite)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := newKeys(k.suite, expandLabel(h, k.secret, "quic ku", len(k.secret)))
+	if err != nil {
+		return nil, err
+	}
+	next.hp = k.hp
+	return next, nil
+}
+
+// initialKeys derives the Initial keys from the client's first
+// destination connection ID
+func initialKeys(dcid []byte) (client, server *keys) {
+	initial, err := hkdf.Extract(sha256.New, dcid, initialSalt)
+	if err != nil {
+		panic(err)
+	}
+
+	client, err = newKeys(tls.TLS_AES_128_GCM_SHA256, expandLabel(sha256.New, initial, "client in", 32))
+	if err != nil {
+		panic(err)
+	}
+	server, err = newKeys(tls.TLS_AES_128_GCM_SHA256, expandLabel(sha256.New, initial, "server in", 32))
+	if err != nil {
+		panic(err)
+	}
+	return client, server
+}
+
+// expandLabel is HKDF-Expand-Label from TLS 1.3 (RFC 8446 Section 7.1)
+// with an empty context
+func expandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len("tls13 ")+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out, err := hkdf.Expand(h, secret, string(info), length)
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// makeNonce combines the IV with a packet number
+func (k *keys) makeNonce(pn uint64) []byte {
+	copy(k.nonce[:], k.iv)
+	for i := 0; i < 8; i++ {
+		k.nonce[len(k.nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+	return k.nonce[:]
+}
+
+// headerMask computes the header protection mask from a ciphertext sample
+func (k *keys) headerMask(sample []byte) [16]byte {
+	var mask [16]byte
+	k.hp.Encrypt(mask[:], sample)
+	return mask
+}
+
+// seal encrypts the payload of a packet in place and protects its
+// header. pkt holds the header, ending in a packet number of pnLen bytes
+// at pnOffset, followed by the payload, and must have room for the tag.
+func (k *keys) seal(pkt []byte, pnOffset, pnLen int, pn uint64) []byte {
+	hdrLen := pnOffset + pnLen
+	sealed := k.aead.Seal(pkt[hdrLen:hdrLen], k.makeNonce(pn), pkt[hdrLen:], pkt[:hdrLen])
+	pkt = pkt[:hdrLen+len(sealed)]
+
+	mask := k.headerMask(pkt[pnOffset+4 : pnOffset+4+sampleLen])
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+	}
+	return pkt
+}
+
+// unprotectHeader removes header protection in place and returns the
+// length and value of the truncated packet number
+func (k *keys) unprotectHeader(pkt []byte, pnOffset int) (int, uint64, error) {
+	if len(pkt) < pnOffset+4+sampleLen {
+		return 0, 0, errDecrypt
+	}
+
+	mask := k.headerMask(pkt[pnOffset+4 : pnOffset+4+sampleLen])
+	if pkt[0]&0x80 != 0 {
+		pkt[0] ^= mask[0] & 0x0f
+	} else {
+		pkt[0] ^= mask[0] & 0x1f
+	}
+
+	pnLen := int(pkt[0]&0x03) + 1
+	var truncated uint64
+	for i := 0; i < pnLen; i++ {
+		pkt[pnOffset+i] ^= mask[1+i]
+		truncated = truncated<<8 | uint64(pkt[pnOffset+i])
+	}
+	return pnLen, truncated, nil
+}
+
+// open decrypts a packet payload in place, authenticating the header
+func (k *keys) open(header, payload []byte, pn uint64) ([]byte, error) {
+	plain, err := k.aead.Open(payload[:0], k.makeNonce(pn), payload, header)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plain, nil
+}
+
+// decodePacketNumber recovers a full packet number from its truncated
+// form and the largest number received so far (RFC 9000 Appendix A.3)
+func decodePacketNumber(largest int64, truncated uint64, pnLen int) uint64 {
+	expected := uint64(largest + 1)
+	win := uint64(1) << (pnLen * 8)
+	hwin := win / 2
+	mask := win - 1
+
+	candidate := (expected &^ mask) | truncated
+	switch {
+	case candidate+hwin <= expected && candidate < 1<<62-win:
+		return candidate + win
+	case candidate > expected+hwin && candidate >= win:
+		return candidate - win
+	}
+	return candidate
+}
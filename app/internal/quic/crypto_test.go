@@ -0,0 +1,216 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"testing"
+)
+
+// Connection ID of the examples in RFC 9001 Appendix A
+const exampleDCID = "8394c8f03e515708"
+
+func TestInitialKeys(t *testing.T) {
+	// RFC 9001 Appendix A.1
+	client, server := initialKeys(unhex(t, exampleDCID))
+
+	tests := []struct {
+		name string
+		k    *keys
+		key  string
+		iv   string
+		hp   string
+	}{
+		{"client", client, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{"server", server, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+	}
+	for _, tt := range tests {
+		h, keyLen, _ := suiteHash(tls.TLS_AES_128_GCM_SHA256)
+		if key := expandLabel(h, tt.k.secret, "quic key", keyLen); !bytes.Equal(key, unhex(t, tt.key)) {
+			t.Errorf("%s key = %x, want %s", tt.name, key, tt.key)
+		}
+		if !bytes.Equal(tt.k.iv, unhex(t, tt.iv)) {
+			t.Errorf("%s iv = %x, want %s", tt.name, tt.k.iv, tt.iv)
+		}
+		if hp := expandLabel(h, tt.k.secret, "quic hp", keyLen); !bytes.Equal(hp, unhex(t, tt.hp)) {
+			t.Errorf("%s hp = %x, want %s", tt.name, hp, tt.hp)
+		}
+	}
+}
+
+func TestHeaderProtection(t *testing.T) {
+	// RFC 9001 Appendix A.2 and A.3
+	client, server := initialKeys(unhex(t, exampleDCID))
+
+	tests := []struct {
+		name      string
+		k         *keys
+		protected string
+		between   string // ciphertext between the packet number and the sample
+		sample    string
+		mask      string
+		header    string
+		pnLen     int
+		pn        uint64
+	}{
+		{
+			name:      "client initial",
+			k:         client,
+			protected: "c000000001088394c8f03e5157080000449e7b9aec34",
+			sample:    "d1b1c98dd7689fb8ec11d242b123dc9b",
+			mask:      "437b9aec36",
+			header:    "c300000001088394c8f03e5157080000449e00000002",
+			pnLen:     4,
+			pn:        2,
+		},
+		{
+			name:      "server initial",
+			k:         server,
+			protected: "cf000000010008f067a5502a4262b5004075c0d9",
+			between:   "5a48",
+			sample:    "2cd0991cd25b0aac406a5816b6394100",
+			mask:      "2ec0d8356a",
+			header:    "c1000000010008f067a5502a4262b50040750001",
+			pnLen:     2,
+			pn:        1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mask := tt.k.headerMask(unhex(t, tt.sample))
+			if !bytes.Equal(mask[:5], unhex(t, tt.mask)) {
+				t.Errorf("mask = %x, want %s", mask[:5], tt.mask)
+			}
+
+			header := unhex(t, tt.protected)
+			pnOffset := len(header) - tt.pnLen
+			pkt := append(append(header, unhex(t, tt.between)...), unhex(t, tt.sample)...)
+			pnLen, pn, err := tt.k.unprotectHeader(pkt, pnOffset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pnLen != tt.pnLen || pn != tt.pn {
+				t.Errorf("packet number %d of %d bytes, want %d of %d", pn, pnLen, tt.pn, tt.pnLen)
+			}
+			if got := pkt[:len(header)]; !bytes.Equal(got, unhex(t, tt.header)) {
+				t.Errorf("header = %x, want %s", got, tt.header)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	client, _ := initialKeys(unhex(t, exampleDCID))
+	// The receiving side derives the same keys
+	peer, _ := initialKeys(unhex(t, exampleDCID))
+
+	header := unhex(t, "c300000001088394c8f03e5157080000449e00000002")
+	pnOffset := len(header) - 4
+	payload := bytes.Repeat([]byte{0}, 40)
+	payload[0] = framePing
+
+	// seal needs room for the tag after the payload
+	packet := func() []byte {
+		pkt := make([]byte, 0, len(header)+len(payload)+aeadTagLen)
+		return append(append(pkt, header...), payload...)
+	}
+
+	sealed := client.seal(packet(), pnOffset, 4, 2)
+	if len(sealed) != len(header)+len(payload)+aeadTagLen {
+		t.Fatalf("sealed %d bytes", len(sealed))
+	}
+	if bytes.Equal(sealed[:len(header)], header) {
+		t.Error("header not protected")
+	}
+
+	pnLen, truncated, err := peer.unprotectHeader(sealed, pnOffset)
+	if err != nil || pnLen != 4 || truncated != 2 {
+		t.Fatalf("unprotectHeader = %d, %d, %v", pnLen, truncated, err)
+	}
+	plain, err := peer.open(sealed[:len(header)], sealed[len(header):], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain, payload) {
+		t.Errorf("payload = %x, want %x", plain, payload)
+	}
+
+	// Any change to the header or payload fails authentication
+	sealed = client.seal(packet(), pnOffset, 4, 3)
+	peer.unprotectHeader(sealed, pnOffset)
+	sealed[len(sealed)-1] ^= 1
+	if _, err := peer.open(sealed[:len(header)], sealed[len(header):], 3); err != errDecrypt {
+		t.Errorf("tampered packet: error = %v, want errDecrypt", err)
+	}
+}
+
+func TestKeyUpdate(t *testing.T) {
+	// RFC 9001 Appendix A.5 gives a key update for ChaCha20, which is not
+	// supported; check the derivation with AES instead
+	_, server := initialKeys(unhex(t, exampleDCID))
+	next, err := server.nextKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(next.secret, server.secret) || bytes.Equal(next.iv, server.iv) {
+		t.Error("next keys are the same as the current ones")
+	}
+	if next.hp != server.hp {
+		t.Error("header protection key changed")
+	}
+
+	h, _, _ := suiteHash(tls.TLS_AES_128_GCM_SHA256)
+	if want := expandLabel(h, server.secret, "quic ku", 32); !bytes.Equal(next.secret, want) {
+		t.Errorf("next secret = %x, want %x", next.secret, want)
+	}
+}
+
+func TestUnsupportedSuite(t *testing.T) {
+	if _, err := newKeys(tls.TLS_CHACHA20_POLY1305_SHA256, make([]byte, 32)); err == nil {
+		t.Error("ChaCha20-Poly1305 accepted")
+	}
+}
+
+func TestDecodePacketNumber(t *testing.T) {
+	tests := []struct {
+		largest   int64
+		truncated uint64
+		pnLen     int
+		want      uint64
+	}{
+		// RFC 9000 Appendix A.3
+		{0xa82f30ea, 0x9b32, 2, 0xa82f9b32},
+		// The first packet of a space
+		{-1, 0, 1, 0},
+		{-1, 2, 4, 2},
+		// Wrapping forwards and backwards around the window
+		{0xff, 0x01, 1, 0x101},
+		{0x101, 0xff, 1, 0xff},
+		{0x80, 0x00, 1, 0x100},
+	}
+	for _, tt := range tests {
+		if got := decodePacketNumber(tt.largest, tt.truncated, tt.pnLen); got != tt.want {
+			t.Errorf("decodePacketNumber(%#x, %#x, %d) = %#x, want %#x", tt.largest, tt.truncated, tt.pnLen, got, tt.want)
+		}
+	}
+}
+
+func TestSealServerInitial(t *testing.T) {
+	// RFC 9001 Appendix A.3
+	_, server := initialKeys(unhex(t, exampleDCID))
+	header := unhex(t, "c1000000010008f067a5502a4262b50040750001")
+	payload := unhex(t, "02000000000600405a020000560303eefce7f7b37ba1d1632e96677825ddf7"+
+		"3988cfc79825df566dc5430b9a045a1200130100002e00330024001d00209d3c"+
+		"940d89690b84d08a60993c144eca684d1081287c834d5311bcf32bb9da1a002b"+
+		"00020304")
+	want := unhex(t, "cf000000010008f067a5502a4262b5004075c0d95a482cd0991cd25b0aac406a"+
+		"5816b6394100f37a1c69797554780bb38cc5a99f5ede4cf73c3ec2493a1839b3"+
+		"dbcba3f6ea46c5b7684df3548e7ddeb9c3bf9c73cc3f3bded74b562bfb19fb84"+
+		"022f8ef4cdd93795d77d06edbb7aaf2f58891850abbdca3d20398c276456cbc4"+
+		"2158407dd074ee")
+
+	pkt := make([]byte, 0, len(header)+len(payload)+aeadTagLen)
+	pkt = append(append(pkt, header...), payload...)
+	if got := server.seal(pkt, len(header)-2, 2, 1); !bytes.Equal(got, want) {
+		t.Errorf("sealed packet\n%x\nwant\n%x", got, want)
+	}
+}
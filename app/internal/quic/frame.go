@@ -0,0 +1,167 @@
+package quic
+
+// Frame types (RFC 9000 Section 19)
+const (
+	framePadding            = 0x00
+	framePing               = 0x01
+	frameAck                = 0x02
+	frameAckECN             = 0x03
+	frameResetStream        = 0x04
+	frameStopSending        = 0x05
+	frameCrypto             = 0x06
+	frameNewToken           = 0x07
+	frameStream             = 0x08
+	frameStreamMax          = 0x0f
+	frameMaxData            = 0x10
+	frameMaxStreamData      = 0x11
+	frameMaxStreamsBidi     = 0x12
+	frameMaxStreamsUni      = 0x13
+	frameDataBlocked        = 0x14
+	frameStreamDataBlocked  = 0x15
+	frameStreamsBlockedBidi = 0x16
+	frameStreamsBlockedUni  = 0x17
+	frameNewConnectionID    = 0x18
+	frameRetireConnectionID = 0x19
+	framePathChallenge      = 0x1a
+	framePathResponse       = 0x1b
+	frameConnectionClose    = 0x1c
+	frameApplicationClose   = 0x1d
+	frameHandshakeDone      = 0x1e
+)
+
+// Bits in the type of a STREAM frame
+const (
+	streamFlagFin = 0x01
+	streamFlagLen = 0x02
+	streamFlagOff = 0x04
+)
+
+// allowedDuringHandshake reports whether a frame type may appear in
+// Initial and Handshake packets
+func allowedDuringHandshake(typ uint64) bool {
+	switch typ {
+	case framePadding, framePing, frameAck, frameAckECN, frameCrypto, frameConnectionClose:
+		return true
+	}
+	return false
+}
+
+// appendCryptoFrame appends a CRYPTO frame
+func appendCryptoFrame(b []byte, offset uint64, data []byte) []byte {
+	b = append(b, frameCrypto)
+	b = AppendVarint(b, offset)
+	b = AppendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// cryptoFrameOverhead is the most a CRYPTO frame adds to its data
+func cryptoFrameOverhead(offset uint64) int {
+	return 1 + VarintLen(offset) + 2
+}
+
+// appendStreamFrame appends a STREAM frame with an explicit length
+func appendStreamFrame(b []byte, id, offset uint64, data []byte, fin bool) []byte {
+	typ := byte(frameStream | streamFlagLen)
+	if offset > 0 {
+		typ |= streamFlagOff
+	}
+	if fin {
+		typ |= streamFlagFin
+	}
+
+	b = append(b, typ)
+	b = AppendVarint(b, id)
+	if offset > 0 {
+		b = AppendVarint(b, offset)
+	}
+	b = AppendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// streamFrameOverhead is the most a STREAM frame adds to its data
+func streamFrameOverhead(id, offset uint64) int {
+	return 1 + VarintLen(id) + VarintLen(offset) + 2
+}
+
+// appendResetStream appends a RESET_STREAM frame
+func appendResetStream(b []byte, id, code, finalSize uint64) []byte {
+	b = append(b, frameResetStream)
+	b = AppendVarint(b, id)
+	b = AppendVarint(b, code)
+	return AppendVarint(b, finalSize)
+}
+
+// appendStopSending appends a STOP_SENDING frame
+func appendStopSending(b []byte, id, code uint64) []byte {
+	b = append(b, frameStopSending)
+	b = AppendVarint(b, id)
+	return AppendVarint(b, code)
+}
+
+// appendMaxData appends a MAX_DATA frame
+func appendMaxData(b []byte, limit uint64) []byte {
+	b = append(b, frameMaxData)
+	return AppendVarint(b, limit)
+}
+
+// appendMaxStreamData appends a MAX_STREAM_DATA frame
+func appendMaxStreamData(b []byte, id, limit uint64) []byte {
+	b = append(b, frameMaxStreamData)
+	b = AppendVarint(b, id)
+	return AppendVarint(b, limit)
+}
+
+// appendMaxStreams appends a MAX_STREAMS frame
+func appendMaxStreams(b []byte, uni bool, limit uint64) []byte {
+	typ := byte(frameMaxStreamsBidi)
+	if uni {
+		typ = frameMaxStreamsUni
+	}
+	b = append(b, typ)
+	return AppendVarint(b, limit)
+}
+
+// appendConnectionClose appends a CONNECTION_CLOSE frame. Application
+// errors may only be sent in 1-RTT packets; elsewhere they are replaced
+// by a transport APPLICATION_ERROR without details.
+func appendConnectionClose(b []byte, err error, oneRTT bool) []byte {
+	if appErr, ok := err.(*ApplicationError); ok {
+		if oneRTT {
+			b = append(b, frameApplicationClose)
+			b = AppendVarint(b, appErr.Code)
+			b = AppendVarint(b, uint64(len(appErr.Reason)))
+			return append(b, appErr.Reason...)
+		}
+		err = &TransportError{Code: ErrApplication}
+	}
+
+	code, reason := ErrInternal, ""
+	if transportErr, ok := err.(*TransportError); ok {
+		code, reason = transportErr.Code, transportErr.Reason
+	}
+	b = append(b, frameConnectionClose)
+	b = AppendVarint(b, uint64(code))
+	b = AppendVarint(b, 0)
+	b = AppendVarint(b, uint64(len(reason)))
+	return append(b, reason...)
+}
+
+// appendAckFrame appends an ACK frame for the received packet numbers,
+// largest first
+func appendAckFrame(b []byte, received rangeSet, delay uint64) []byte {
+	last := received[len(received)-1]
+	b = append(b, frameAck)
+	b = AppendVarint(b, last.end-1)
+	b = AppendVarint(b, delay)
+	b = AppendVarint(b, uint64(len(received)-1))
+	b = AppendVarint(b, last.end-1-last.start)
+
+	smallest := last.start
+	for i := len(received) - 2; i >= 0; i-- {
+		r := received[i]
+		b = AppendVarint(b, smallest-r.end-1)
+		b = AppendVarint(b, r.end-1-r.start)
+		smallest = r.start
+	}
+	return b
+}
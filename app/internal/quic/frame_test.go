@@ -0,0 +1,230 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAppendFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"crypto", appendCryptoFrame(nil, 5, []byte("hi")), "06050268" + "69"},
+		{"stream at offset 0", appendStreamFrame(nil, 4, 0, []byte("ab"), false), "0a04026162"},
+		{"stream with offset and fin", appendStreamFrame(nil, 4, 64, []byte("ab"), true), "0f04404002" + "6162"},
+		{"empty fin", appendStreamFrame(nil, 0, 3, nil, true), "0f000300"},
+		{"reset stream", appendResetStream(nil, 4, 0x10c, 100), "0404410c4064"},
+		{"stop sending", appendStopSending(nil, 8, 0x10c), "0508410c"},
+		{"max data", appendMaxData(nil, 1<<20), "1080100000"},
+		{"max stream data", appendMaxStreamData(nil, 4, 100), "11044064"},
+		{"max streams bidi", appendMaxStreams(nil, false, 100), "124064"},
+		{"max streams uni", appendMaxStreams(nil, true, 3), "1303"},
+	}
+	for _, tt := range tests {
+		if want := unhex(t, tt.want); !bytes.Equal(tt.got, want) {
+			t.Errorf("%s = %x, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestFrameOverhead(t *testing.T) {
+	data := make([]byte, 1000)
+	if got, max := len(appendCryptoFrame(nil, 70000, data))-len(data), cryptoFrameOverhead(70000); got > max {
+		t.Errorf("CRYPTO overhead %d, cryptoFrameOverhead %d", got, max)
+	}
+	if got, max := len(appendStreamFrame(nil, 1<<20, 1<<40, data, true))-len(data), streamFrameOverhead(1<<20, 1<<40); got > max {
+		t.Errorf("STREAM overhead %d, streamFrameOverhead %d", got, max)
+	}
+}
+
+func TestAppendConnectionClose(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		oneRTT bool
+		want   string
+	}{
+		{"transport error", &TransportError{Code: ErrProtocolViolation, Reason: "bad"}, false, "1c0a0003626164"},
+		{"application error in 1-RTT", &ApplicationError{Code: 0x100, Reason: "x"}, true, "1d41000178"},
+		{"application error during handshake", &ApplicationError{Code: 0x100, Reason: "x"}, false, "1c0c0000"},
+		{"other error", errors.New("boom"), true, "1c010000"},
+	}
+	for _, tt := range tests {
+		if got, want := appendConnectionClose(nil, tt.err, tt.oneRTT), unhex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("%s = %x, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAppendAckFrame(t *testing.T) {
+	tests := []struct {
+		name     string
+		received rangeSet
+		delay    uint64
+		want     string
+	}{
+		// Largest 5, one range of 6 packets
+		{"single range", rangeSet{{0, 6}}, 0, "0205000005"},
+		// Largest 9 with 8-9, then 2-4 after a gap of 5-7: the gap is
+		// encoded as one less than the packets missed
+		{"two ranges", rangeSet{{2, 5}, {8, 10}}, 3, "0209030101" + "0202"},
+		{"three ranges", rangeSet{{0, 1}, {3, 4}, {10, 11}}, 0, "020a0002000500" + "0100"},
+	}
+	for _, tt := range tests {
+		if got, want := appendAckFrame(nil, tt.received, tt.delay), unhex(t, tt.want); !bytes.Equal(got, want) {
+			t.Errorf("%s = %x, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedDuringHandshake(t *testing.T) {
+	for _, typ := range []uint64{framePadding, framePing, frameAck, frameAckECN, frameCrypto, frameConnectionClose} {
+		if !allowedDuringHandshake(typ) {
+			t.Errorf("frame type %#x not allowed", typ)
+		}
+	}
+	for _, typ := range []uint64{frameStream, frameMaxData, frameHandshakeDone, frameApplicationClose, frameNewToken} {
+		if allowedDuringHandshake(typ) {
+			t.Errorf("frame type %#x allowed", typ)
+		}
+	}
+}
+
+// appendParam appends a transport parameter with a varint value
+func appendParam(b []byte, id, v uint64) []byte {
+	b = AppendVarint(b, id)
+	b = AppendVarint(b, uint64(VarintLen(v)))
+	return AppendVarint(b, v)
+}
+
+// appendBytesParam appends a transport parameter with a byte string value
+func appendBytesParam(b []byte, id uint64, v []byte) []byte {
+	b = AppendVarint(b, id)
+	b = AppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func TestParseClientParams(t *testing.T) {
+	var b []byte
+	b = appendBytesParam(b, paramInitialSourceConnectionID, []byte{1, 2, 3, 4})
+	b = appendParam(b, paramMaxIdleTimeout, 30000)
+	b = appendParam(b, paramInitialMaxData, 1<<20)
+	b = appendParam(b, paramInitialMaxStreamDataBidiLocal, 1000)
+	b = appendParam(b, paramInitialMaxStreamDataBidiRemote, 2000)
+	b = appendParam(b, paramInitialMaxStreamDataUni, 3000)
+	b = appendParam(b, paramInitialMaxStreamsBidi, 10)
+	b = appendParam(b, paramInitialMaxStreamsUni, 3)
+	b = appendParam(b, paramMaxAckDelay, 10)
+	b = appendBytesParam(b, paramDisableActiveMigration, nil)
+	b = appendBytesParam(b, 0x2a2a, []byte("grease"))
+
+	p, err := parseClientParams(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch {
+	case !bytes.Equal(p.initialSCID, []byte{1, 2, 3, 4}),
+		p.maxIdleTimeout != 30*time.Second,
+		p.initialMaxData != 1<<20,
+		p.initialMaxStreamDataBidiLocal != 1000,
+		p.initialMaxStreamDataBidiRemote != 2000,
+		p.initialMaxStreamDataUni != 3000,
+		p.initialMaxStreamsBidi != 10,
+		p.initialMaxStreamsUni != 3,
+		p.maxAckDelay != 10*time.Millisecond,
+		!p.disableActiveMigration:
+		t.Errorf("parsed %+v", p)
+	}
+
+	// Defaults for what was left out
+	if p.maxUDPPayloadSize != 65527 || p.ackDelayExponent != defaultAckDelayExponent || p.activeConnectionIDLimit != 2 {
+		t.Errorf("defaults %+v", p)
+	}
+}
+
+func TestParseClientParamsErrors(t *testing.T) {
+	scid := appendBytesParam(nil, paramInitialSourceConnectionID, []byte{1})
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"missing initial_source_connection_id", appendParam(nil, paramInitialMaxData, 1)},
+		{"truncated", append(append([]byte{}, scid...), 0x04, 0x05, 0x01)},
+		{"duplicate", appendParam(appendParam(scid, paramInitialMaxData, 1), paramInitialMaxData, 2)},
+		{"server only", appendBytesParam(scid, paramOriginalDestinationConnectionID, []byte{1})},
+		{"stateless reset token", appendBytesParam(scid, paramStatelessResetToken, make([]byte, 16))},
+		{"trailing bytes in value", appendBytesParam(scid, paramInitialMaxData, []byte{1, 2})},
+		{"small max_udp_payload_size", appendParam(scid, paramMaxUDPPayloadSize, 1199)},
+		{"large ack_delay_exponent", appendParam(scid, paramAckDelayExponent, 21)},
+		{"large max_ack_delay", appendParam(scid, paramMaxAckDelay, 1<<14)},
+		{"large stream limit", appendParam(scid, paramInitialMaxStreamsBidi, 1<<60+1)},
+	}
+	for _, tt := range tests {
+		_, err := parseClientParams(tt.b)
+		var te *TransportError
+		if !errors.As(err, &te) || te.Code != ErrTransportParameter {
+			t.Errorf("%s: error = %v, want TRANSPORT_PARAMETER_ERROR", tt.name, err)
+		}
+	}
+}
+
+func TestMarshalParams(t *testing.T) {
+	p := &transportParams{
+		originalDCID:            []byte{9, 9},
+		initialSCID:             []byte{1, 2},
+		maxIdleTimeout:          time.Second,
+		maxUDPPayloadSize:       1452,
+		initialMaxData:          1 << 20,
+		initialMaxStreamsBidi:   100,
+		activeConnectionIDLimit: 2,
+		disableActiveMigration:  true,
+	}
+
+	got := make(map[uint64][]byte)
+	r := parser{b: p.marshal()}
+	for !r.empty() {
+		id := r.varint()
+		got[id] = r.lengthPrefixed()
+	}
+	if r.failed {
+		t.Fatal("malformed parameters")
+	}
+
+	varint := func(b []byte) uint64 {
+		v := parser{b: b}
+		return v.varint()
+	}
+	switch {
+	case !bytes.Equal(got[paramOriginalDestinationConnectionID], p.originalDCID),
+		!bytes.Equal(got[paramInitialSourceConnectionID], p.initialSCID),
+		varint(got[paramMaxIdleTimeout]) != 1000,
+		varint(got[paramMaxUDPPayloadSize]) != 1452,
+		varint(got[paramInitialMaxData]) != 1<<20,
+		varint(got[paramInitialMaxStreamsBidi]) != 100:
+		t.Errorf("marshalled %x", p.marshal())
+	}
+	if v, ok := got[paramDisableActiveMigration]; !ok || len(v) != 0 {
+		t.Errorf("disable_active_migration = %x, %v", v, ok)
+	}
+}
+
+func TestTransportErrorCodeString(t *testing.T) {
+	tests := []struct {
+		code TransportErrorCode
+		want string
+	}{
+		{ErrFlowControl, "FLOW_CONTROL_ERROR"},
+		{ErrNoViablePath, "NO_VIABLE_PATH"},
+		{errCryptoBase + 40, "CRYPTO_ERROR(tls: handshake failure)"},
+		{0x42, "UNKNOWN_ERROR_0x42"},
+	}
+	for _, tt := range tests {
+		if got := tt.code.String(); got != tt.want {
+			t.Errorf("%#x = %q, want %q", uint64(tt.code), got, tt.want)
+		}
+	}
+}
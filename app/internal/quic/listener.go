@@ -0,0 +1,229 @@
+package quic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// maxReceiveDatagram is the max_udp_payload_size advertised to clients
+const maxReceiveDatagram = 1452
+
+// readBufferSize is the buffer each datagram is read into; larger
+// datagrams are truncated and fail to decrypt
+const readBufferSize = 2048
+
+// acceptQueueLen is how many established connections may wait for
+// Accept before further handshakes are refused
+const acceptQueueLen = 128
+
+// Listener accepts QUIC connections on a UDP socket
+type Listener struct {
+	config *Config
+	conn   *net.UDPConn
+
+	acceptCh chan *Conn
+	closed   chan struct{}
+
+	mu      sync.Mutex
+	conns   map[string]*Conn
+	closing bool
+}
+
+// Listen starts accepting QUIC connections on conn. The listener owns
+// conn from then on and closes it once it and all its connections are
+// closed.
+func Listen(conn *net.UDPConn, config *Config) *Listener {
+	l := &Listener{
+		config:   config,
+		conn:     conn,
+		acceptCh: make(chan *Conn, acceptQueueLen),
+		closed:   make(chan struct{}),
+		conns:    make(map[string]*Conn),
+	}
+	go l.readLoop()
+	return l
+}
+
+// Accept waits for a connection that has completed its handshake
+func (l *Listener) Accept(ctx context.Context) (*Conn, error) {
+	select {
+	case c := <-l.acceptCh:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Addr returns the address of the UDP socket
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Close stops accepting connections. Handshakes in progress are refused
+// and connections not yet accepted are closed; accepted ones carry on
+// until they are closed, after which the socket is closed.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closing {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closing = true
+	close(l.closed)
+	conns := make([]*Conn, 0, len(l.conns))
+	for _, c := range l.conns {
+		conns = append(conns, c)
+	}
+	empty := len(l.conns) == 0
+	l.mu.Unlock()
+
+	for {
+		select {
+		case c := <-l.acceptCh:
+			c.CloseWithError(0, "")
+			continue
+		default:
+		}
+		break
+	}
+	for _, c := range conns {
+		c.mu.Lock()
+		if !c.handshakeDone {
+			c.close(&TransportError{Code: ErrConnectionRefused, Reason: "server closing"})
+		}
+		c.mu.Unlock()
+	}
+
+	if empty {
+		return l.conn.Close()
+	}
+	return nil
+}
+
+// readLoop reads datagrams and hands them to their connections
+func (l *Listener) readLoop() {
+	for {
+		buf := make([]byte, readBufferSize)
+		n, addr, err := l.conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n > 0 {
+			l.handleDatagram(buf[:n], addr)
+		}
+	}
+}
+
+// handleDatagram routes a datagram by its destination connection ID,
+// creating a connection for a client's first Initial packet. A datagram
+// that makes the parsing panic is dropped.
+func (l *Listener) handleDatagram(d []byte, addr netip.AddrPort) {
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.QUIC, v, "QUIC datagram from %s", addr)
+		}
+	}()
+
+	var dcid, scid []byte
+	var version uint32
+	if d[0]&0x80 != 0 {
+		p := parser{b: d[1:]}
+		version = p.uint32()
+		dcid = p.bytes(int(p.byte()))
+		scid = p.bytes(int(p.byte()))
+		if p.failed || len(dcid) > 20 || len(scid) > 20 {
+			return
+		}
+	} else if len(d) >= 1+connIDLen {
+		dcid = d[1 : 1+connIDLen]
+	}
+
+	l.mu.Lock()
+	c := l.conns[string(dcid)]
+	if c != nil {
+		l.mu.Unlock()
+		c.deliver(d)
+		return
+	}
+	defer l.mu.Unlock()
+
+	// Packets for unknown connections are dropped, since stateless reset
+	// is not implemented. A client's first packet must be padded to 1200
+	// bytes so that replies cannot amplify spoofed traffic.
+	if d[0]&0x80 == 0 || version == 0 || len(d) < minInitialDatagram || l.closing {
+		return
+	}
+	if version != Version1 {
+		l.conn.WriteToUDPAddrPort(appendVersionNegotiation(nil, scid, dcid), addr)
+		return
+	}
+	if d[0]>>4&0x3 != 0x0 || len(dcid) < 8 {
+		return
+	}
+
+	c, err := newConn(l, addr, dcid, scid)
+	if err != nil {
+		return
+	}
+	l.conns[string(c.originalDCID)] = c
+	l.conns[string(c.localCID)] = c
+	go c.run()
+	c.deliver(d)
+}
+
+// appendVersionNegotiation appends a Version Negotiation packet listing
+// the one version supported (RFC 9000 Section 17.2.1)
+func appendVersionNegotiation(b, dcid, scid []byte) []byte {
+	var first [1]byte
+	rand.Read(first[:])
+	b = append(b, 0x80|first[0])
+	b = binary.BigEndian.AppendUint32(b, 0)
+	b = append(b, byte(len(dcid)))
+	b = append(b, dcid...)
+	b = append(b, byte(len(scid)))
+	b = append(b, scid...)
+	return binary.BigEndian.AppendUint32(b, Version1)
+}
+
+// accepted queues a connection whose handshake completed, reporting
+// false if too many are waiting; the caller holds c.mu
+func (l *Listener) accepted(c *Conn) bool {
+	select {
+	case <-l.closed:
+		return false
+	default:
+	}
+
+	select {
+	case l.acceptCh <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+// remove forgets a closed connection, closing the socket once the
+// listener is closed and no connections remain
+func (l *Listener) remove(c *Conn) {
+	l.mu.Lock()
+	delete(l.conns, string(c.originalDCID))
+	delete(l.conns, string(c.localCID))
+	closeSocket := l.closing && len(l.conns) == 0
+	l.mu.Unlock()
+
+	if closeSocket {
+		l.conn.Close()
+	}
+}
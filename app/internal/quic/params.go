@@ -0,0 +1,166 @@
+package quic
+
+import (
+	"fmt"
+	"time"
+)
+
+// Transport parameter IDs (RFC 9000 Section 18.2)
+const (
+	paramOriginalDestinationConnectionID = 0x00
+	paramMaxIdleTimeout                  = 0x01
+	paramStatelessResetToken             = 0x02
+	paramMaxUDPPayloadSize               = 0x03
+	paramInitialMaxData                  = 0x04
+	paramInitialMaxStreamDataBidiLocal   = 0x05
+	paramInitialMaxStreamDataBidiRemote  = 0x06
+	paramInitialMaxStreamDataUni         = 0x07
+	paramInitialMaxStreamsBidi           = 0x08
+	paramInitialMaxStreamsUni            = 0x09
+	paramAckDelayExponent                = 0x0a
+	paramMaxAckDelay                     = 0x0b
+	paramDisableActiveMigration          = 0x0c
+	paramPreferredAddress                = 0x0d
+	paramActiveConnectionIDLimit         = 0x0e
+	paramInitialSourceConnectionID       = 0x0f
+	paramRetrySourceConnectionID         = 0x10
+)
+
+// Defaults for parameters a peer leaves out
+const (
+	defaultAckDelayExponent = 3
+	defaultMaxAckDelay      = 25 * time.Millisecond
+)
+
+// transportParams are the transport parameters one side sends
+type transportParams struct {
+	originalDCID                   []byte
+	initialSCID                    []byte
+	maxIdleTimeout                 time.Duration
+	maxUDPPayloadSize              uint64
+	initialMaxData                 uint64
+	initialMaxStreamDataBidiLocal  uint64
+	initialMaxStreamDataBidiRemote uint64
+	initialMaxStreamDataUni        uint64
+	initialMaxStreamsBidi          uint64
+	initialMaxStreamsUni           uint64
+	ackDelayExponent               uint64
+	maxAckDelay                    time.Duration
+	disableActiveMigration         bool
+	activeConnectionIDLimit        uint64
+}
+
+// marshal encodes the parameters a server sends
+func (p *transportParams) marshal() []byte {
+	var b []byte
+	appendBytes := func(id uint64, v []byte) {
+		b = AppendVarint(b, id)
+		b = AppendVarint(b, uint64(len(v)))
+		b = append(b, v...)
+	}
+	appendInt := func(id, v uint64) {
+		b = AppendVarint(b, id)
+		b = AppendVarint(b, uint64(VarintLen(v)))
+		b = AppendVarint(b, v)
+	}
+
+	appendBytes(paramOriginalDestinationConnectionID, p.originalDCID)
+	appendBytes(paramInitialSourceConnectionID, p.initialSCID)
+	appendInt(paramMaxIdleTimeout, uint64(p.maxIdleTimeout/time.Millisecond))
+	appendInt(paramMaxUDPPayloadSize, p.maxUDPPayloadSize)
+	appendInt(paramInitialMaxData, p.initialMaxData)
+	appendInt(paramInitialMaxStreamDataBidiLocal, p.initialMaxStreamDataBidiLocal)
+	appendInt(paramInitialMaxStreamDataBidiRemote, p.initialMaxStreamDataBidiRemote)
+	appendInt(paramInitialMaxStreamDataUni, p.initialMaxStreamDataUni)
+	appendInt(paramInitialMaxStreamsBidi, p.initialMaxStreamsBidi)
+	appendInt(paramInitialMaxStreamsUni, p.initialMaxStreamsUni)
+	appendInt(paramActiveConnectionIDLimit, p.activeConnectionIDLimit)
+	if p.disableActiveMigration {
+		appendBytes(paramDisableActiveMigration, nil)
+	}
+	return b
+}
+
+// parseClientParams decodes the parameters sent by a client
+func parseClientParams(data []byte) (*transportParams, error) {
+	p := &transportParams{
+		maxUDPPayloadSize:       65527,
+		ackDelayExponent:        defaultAckDelayExponent,
+		maxAckDelay:             defaultMaxAckDelay,
+		activeConnectionIDLimit: 2,
+	}
+
+	seen := make(map[uint64]bool)
+	r := parser{b: data}
+	for !r.empty() {
+		id := r.varint()
+		value := r.lengthPrefixed()
+		if r.failed {
+			return nil, &TransportError{Code: ErrTransportParameter, Reason: "malformed transport parameters"}
+		}
+		if seen[id] {
+			return nil, &TransportError{Code: ErrTransportParameter, Reason: fmt.Sprintf("duplicate transport parameter 0x%x", id)}
+		}
+		seen[id] = true
+
+		// Only servers send these
+		switch id {
+		case paramOriginalDestinationConnectionID, paramStatelessResetToken, paramPreferredAddress, paramRetrySourceConnectionID:
+			return nil, &TransportError{Code: ErrTransportParameter, Reason: fmt.Sprintf("client sent server-only transport parameter 0x%x", id)}
+		case paramInitialSourceConnectionID:
+			p.initialSCID = value
+			continue
+		case paramDisableActiveMigration:
+			p.disableActiveMigration = true
+			continue
+		}
+
+		v := parser{b: value}
+		n := v.varint()
+		known := true
+		switch id {
+		case paramMaxIdleTimeout:
+			p.maxIdleTimeout = time.Duration(n) * time.Millisecond
+		case paramMaxUDPPayloadSize:
+			p.maxUDPPayloadSize = n
+		case paramInitialMaxData:
+			p.initialMaxData = n
+		case paramInitialMaxStreamDataBidiLocal:
+			p.initialMaxStreamDataBidiLocal = n
+		case paramInitialMaxStreamDataBidiRemote:
+			p.initialMaxStreamDataBidiRemote = n
+		case paramInitialMaxStreamDataUni:
+			p.initialMaxStreamDataUni = n
+		case paramInitialMaxStreamsBidi:
+			p.initialMaxStreamsBidi = n
+		case paramInitialMaxStreamsUni:
+			p.initialMaxStreamsUni = n
+		case paramAckDelayExponent:
+			p.ackDelayExponent = n
+		case paramMaxAckDelay:
+			p.maxAckDelay = time.Duration(n) * time.Millisecond
+		case paramActiveConnectionIDLimit:
+			p.activeConnectionIDLimit = n
+		default:
+			// Unknown parameters are ignored
+			known = false
+		}
+		if known && (v.failed || !v.empty()) {
+			return nil, &TransportError{Code: ErrTransportParameter, Reason: fmt.Sprintf("malformed transport parameter 0x%x", id)}
+		}
+	}
+
+	switch {
+	case p.initialSCID == nil:
+		return nil, &TransportError{Code: ErrTransportParameter, Reason: "missing initial_source_connection_id"}
+	case p.maxUDPPayloadSize < 1200:
+		return nil, &TransportError{Code: ErrTransportParameter, Reason: "max_udp_payload_size below 1200"}
+	case p.ackDelayExponent > 20:
+		return nil, &TransportError{Code: ErrTransportParameter, Reason: "ack_delay_exponent above 20"}
+	case p.maxAckDelay >= 1<<14*time.Millisecond:
+		return nil, &TransportError{Code: ErrTransportParameter, Reason: "max_ack_delay too large"}
+	case p.initialMaxStreamsBidi > 1<<60 || p.initialMaxStreamsUni > 1<<60:
+		return nil, &TransportError{Code: ErrTransportParameter, Reason: "stream limit too large"}
+	}
+	return p, nil
+}
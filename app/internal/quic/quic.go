@@ -0,0 +1,191 @@
+// Package quic implements the server side of QUIC version 1 (RFC 9000)
+// over a UDP socket, with packet protection and the handshake from
+// crypto/tls (RFC 9001). It covers what HTTP/3 needs: bidirectional and
+// unidirectional streams, flow control, acknowledgements, retransmission
+// of lost data and a simple congestion window.
+//
+// It is experimental. Not supported are Retry and address validation
+// tokens, 0-RTT, connection migration, stateless resets, and the
+// ChaCha20-Poly1305 cipher suite.
+package quic
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Version1 is the only QUIC version spoken (RFC 9000)
+const Version1 = 0x00000001
+
+// Defaults used when Config leaves a setting at zero
+const (
+	DefaultMaxIdleTimeout     = 30 * time.Second
+	DefaultHandshakeTimeout   = 10 * time.Second
+	DefaultMaxIncomingStreams = 100
+)
+
+// Config holds the settings for a Listener
+type Config struct {
+	// TLSConfig is used for every handshake. It must offer TLS 1.3 and
+	// list the application protocols in NextProtos.
+	TLSConfig *tls.Config
+
+	// MaxIdleTimeout closes a connection on which nothing was received
+	// for this long; zero uses DefaultMaxIdleTimeout
+	MaxIdleTimeout time.Duration
+
+	// HandshakeTimeout limits how long a handshake may take; zero uses
+	// DefaultHandshakeTimeout
+	HandshakeTimeout time.Duration
+
+	// MaxIncomingStreams limits the bidirectional streams a client may
+	// have open at once; zero uses DefaultMaxIncomingStreams
+	MaxIncomingStreams int64
+}
+
+// maxIdleTimeout returns the configured or default idle timeout
+func (c *Config) maxIdleTimeout() time.Duration {
+	if c.MaxIdleTimeout > 0 {
+		return c.MaxIdleTimeout
+	}
+	return DefaultMaxIdleTimeout
+}
+
+// handshakeTimeout returns the configured or default handshake timeout
+func (c *Config) handshakeTimeout() time.Duration {
+	if c.HandshakeTimeout > 0 {
+		return c.HandshakeTimeout
+	}
+	return DefaultHandshakeTimeout
+}
+
+// maxIncomingStreams returns the configured or default stream limit
+func (c *Config) maxIncomingStreams() int64 {
+	if c.MaxIncomingStreams > 0 {
+		return c.MaxIncomingStreams
+	}
+	return DefaultMaxIncomingStreams
+}
+
+// TransportErrorCode is an error code carried by a CONNECTION_CLOSE frame
+// of type 0x1c
+type TransportErrorCode uint64
+
+// Transport error codes (RFC 9000 Section 20.1)
+const (
+	ErrNoError                TransportErrorCode = 0x00
+	ErrInternal               TransportErrorCode = 0x01
+	ErrConnectionRefused      TransportErrorCode = 0x02
+	ErrFlowControl            TransportErrorCode = 0x03
+	ErrStreamLimit            TransportErrorCode = 0x04
+	ErrStreamState            TransportErrorCode = 0x05
+	ErrFinalSize              TransportErrorCode = 0x06
+	ErrFrameEncoding          TransportErrorCode = 0x07
+	ErrTransportParameter     TransportErrorCode = 0x08
+	ErrConnectionIDLimit      TransportErrorCode = 0x09
+	ErrProtocolViolation      TransportErrorCode = 0x0a
+	ErrInvalidToken           TransportErrorCode = 0x0b
+	ErrApplication            TransportErrorCode = 0x0c
+	ErrCryptoBufferExceeded   TransportErrorCode = 0x0d
+	ErrKeyUpdate              TransportErrorCode = 0x0e
+	ErrAEADLimitReached       TransportErrorCode = 0x0f
+	ErrNoViablePath           TransportErrorCode = 0x10
+	errCryptoBase             TransportErrorCode = 0x100
+	maxTransportErrorCodeName TransportErrorCode = ErrNoViablePath
+)
+
+var transportErrorNames = [...]string{
+	ErrNoError:              "NO_ERROR",
+	ErrInternal:             "INTERNAL_ERROR",
+	ErrConnectionRefused:    "CONNECTION_REFUSED",
+	ErrFlowControl:          "FLOW_CONTROL_ERROR",
+	ErrStreamLimit:          "STREAM_LIMIT_ERROR",
+	ErrStreamState:          "STREAM_STATE_ERROR",
+	ErrFinalSize:            "FINAL_SIZE_ERROR",
+	ErrFrameEncoding:        "FRAME_ENCODING_ERROR",
+	ErrTransportParameter:   "TRANSPORT_PARAMETER_ERROR",
+	ErrConnectionIDLimit:    "CONNECTION_ID_LIMIT_ERROR",
+	ErrProtocolViolation:    "PROTOCOL_VIOLATION",
+	ErrInvalidToken:         "INVALID_TOKEN",
+	ErrApplication:          "APPLICATION_ERROR",
+	ErrCryptoBufferExceeded: "CRYPTO_BUFFER_EXCEEDED",
+	ErrKeyUpdate:            "KEY_UPDATE_ERROR",
+	ErrAEADLimitReached:     "AEAD_LIMIT_REACHED",
+	ErrNoViablePath:         "NO_VIABLE_PATH",
+}
+
+// String returns the code's name from the specification
+func (c TransportErrorCode) String() string {
+	if c <= maxTransportErrorCodeName {
+		return transportErrorNames[c]
+	}
+	if c >= errCryptoBase && c < errCryptoBase+0x100 {
+		return fmt.Sprintf("CRYPTO_ERROR(%s)", tls.AlertError(c-errCryptoBase))
+	}
+	return fmt.Sprintf("UNKNOWN_ERROR_0x%x", uint64(c))
+}
+
+// TransportError closes a connection because of a QUIC protocol problem
+type TransportError struct {
+	Code   TransportErrorCode
+	Reason string
+
+	// Remote is true if the peer closed the connection
+	Remote bool
+}
+
+func (e *TransportError) Error() string {
+	side := "local"
+	if e.Remote {
+		side = "remote"
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("quic: %s error %s", side, e.Code)
+	}
+	return fmt.Sprintf("quic: %s error %s: %s", side, e.Code, e.Reason)
+}
+
+// ApplicationError closes a connection with an error code defined by the
+// application protocol
+type ApplicationError struct {
+	Code   uint64
+	Reason string
+
+	// Remote is true if the peer closed the connection
+	Remote bool
+}
+
+func (e *ApplicationError) Error() string {
+	side := "local"
+	if e.Remote {
+		side = "remote"
+	}
+	return fmt.Sprintf("quic: %s application error 0x%x %s", side, e.Code, e.Reason)
+}
+
+// StreamError is returned by stream reads after the peer reset the
+// stream, and by writes after it asked us to stop sending
+type StreamError struct {
+	StreamID uint64
+	Code     uint64
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("quic: stream %d reset with code 0x%x", e.StreamID, e.Code)
+}
+
+// Errors for connections and streams that ended without an error code
+var (
+	// ErrIdleTimeout ends a connection on which nothing was received for
+	// the idle timeout
+	ErrIdleTimeout = errors.New("quic: idle timeout")
+
+	// ErrHandshakeTimeout ends a connection whose handshake took too long
+	ErrHandshakeTimeout = errors.New("quic: handshake timeout")
+
+	// errStreamClosed is returned by writes after Close or CancelWrite,
+	// and reads after CancelRead
+	errStreamClosed = errors.New("quic: stream closed")
+)
@@ -0,0 +1,355 @@
+package quic
+
+import (
+	"time"
+)
+
+// Loss detection and congestion control constants (RFC 9002)
+const (
+	initialRTT        = 333 * time.Millisecond
+	timerGranularity  = time.Millisecond
+	packetThreshold   = 3
+	maxPTOBackoff     = 10
+	initialWindow     = 10 * maxDatagramSize
+	minimumWindow     = 2 * maxDatagramSize
+	localMaxAckDelay  = 20 * time.Millisecond
+	ackElicitingLimit = 2
+)
+
+// sentKind says what a sentFrame refers to
+type sentKind int
+
+const (
+	sentCrypto sentKind = iota
+	sentStream
+	sentControl
+	sentReset
+	sentMaxData
+	sentMaxStreamData
+	sentMaxStreams
+	sentHandshakeDone
+)
+
+// sentFrame records a frame that must be sent again if its packet is
+// lost, or whose acknowledgement matters
+type sentFrame struct {
+	kind   sentKind
+	stream *Stream
+	offset uint64
+	length uint64
+	fin    bool
+	uni    bool
+
+	// data is the frame itself for sentControl
+	data []byte
+}
+
+// sentPacket is a packet awaiting acknowledgement
+type sentPacket struct {
+	pn           uint64
+	sent         time.Time
+	size         int
+	ackEliciting bool
+	frames       []sentFrame
+}
+
+// recovery holds the RTT estimate and congestion window shared by all
+// packet number spaces
+type recovery struct {
+	hasSample   bool
+	latestRTT   time.Duration
+	smoothedRTT time.Duration
+	rttVar      time.Duration
+	minRTT      time.Duration
+	ptoCount    int
+
+	cwnd          int
+	ssthresh      int
+	bytesInFlight int
+	recoveryStart time.Time
+}
+
+// init sets the estimates used before the first RTT sample
+func (r *recovery) init() {
+	r.smoothedRTT = initialRTT
+	r.rttVar = initialRTT / 2
+	r.cwnd = initialWindow
+	r.ssthresh = 1<<31 - 1
+}
+
+// updateRTT takes an RTT sample (RFC 9002 Section 5)
+func (r *recovery) updateRTT(latest, ackDelay time.Duration) {
+	r.latestRTT = latest
+	if !r.hasSample {
+		r.hasSample = true
+		r.minRTT = latest
+		r.smoothedRTT = latest
+		r.rttVar = latest / 2
+		return
+	}
+
+	r.minRTT = min(r.minRTT, latest)
+	adjusted := latest
+	if adjusted >= r.minRTT+ackDelay {
+		adjusted -= ackDelay
+	}
+	diff := r.smoothedRTT - adjusted
+	if diff < 0 {
+		diff = -diff
+	}
+	r.rttVar = (3*r.rttVar + diff) / 4
+	r.smoothedRTT = (7*r.smoothedRTT + adjusted) / 8
+}
+
+// pto returns the probe timeout, including the peer's ACK delay for
+// application data, before backoff
+func (r *recovery) pto(app bool, maxAckDelay time.Duration) time.Duration {
+	pto := r.smoothedRTT + max(4*r.rttVar, timerGranularity)
+	if app {
+		pto += maxAckDelay
+	}
+	return pto
+}
+
+// onAcked grows the congestion window for an acknowledged packet
+func (r *recovery) onAcked(pkt *sentPacket) {
+	if !pkt.ackEliciting {
+		return
+	}
+	r.bytesInFlight -= pkt.size
+	if !pkt.sent.After(r.recoveryStart) {
+		return
+	}
+	if r.cwnd < r.ssthresh {
+		r.cwnd += pkt.size
+	} else {
+		r.cwnd += maxDatagramSize * pkt.size / r.cwnd
+	}
+}
+
+// onLost shrinks the congestion window once per round trip of losses
+func (r *recovery) onLost(pkt *sentPacket, now time.Time) {
+	if !pkt.ackEliciting {
+		return
+	}
+	r.bytesInFlight -= pkt.size
+	if pkt.sent.After(r.recoveryStart) {
+		r.recoveryStart = now
+		r.ssthresh = max(r.cwnd/2, minimumWindow)
+		r.cwnd = r.ssthresh
+	}
+}
+
+// ptoDeadline returns when the probe timer of a space fires, if it has
+// ack-eliciting packets in flight; the caller holds mu
+func (c *Conn) ptoDeadline(sp packetSpace) (time.Time, bool) {
+	space := c.spaces[sp]
+	if space.discarded || space.lastSent.IsZero() || !hasAckEliciting(space.sent) {
+		return time.Time{}, false
+	}
+	// Application data is not probed until the handshake is done
+	if sp == spaceApp && !c.handshakeDone {
+		return time.Time{}, false
+	}
+
+	pto := c.recovery.pto(sp == spaceApp, c.peerMaxAckDelay())
+	pto <<= min(c.recovery.ptoCount, maxPTOBackoff)
+	return space.lastSent.Add(pto), true
+}
+
+// peerMaxAckDelay returns how long the client may delay acknowledgements
+func (c *Conn) peerMaxAckDelay() time.Duration {
+	if c.peerParams == nil {
+		return defaultMaxAckDelay
+	}
+	return c.peerParams.maxAckDelay
+}
+
+// hasAckEliciting reports whether any of the packets needs acknowledging
+func hasAckEliciting(sent []*sentPacket) bool {
+	for _, pkt := range sent {
+		if pkt.ackEliciting {
+			return true
+		}
+	}
+	return false
+}
+
+// onPTO handles an expired probe timer by sending everything in flight
+// again, with a PING if there is nothing else; the caller holds mu
+func (c *Conn) onPTO(sp packetSpace) {
+	space := c.spaces[sp]
+	c.recovery.ptoCount++
+
+	for _, pkt := range space.sent {
+		if pkt.ackEliciting {
+			c.recovery.bytesInFlight -= pkt.size
+			c.requeue(sp, pkt)
+		}
+	}
+	space.sent = nil
+	space.probe = true
+}
+
+// handleAck processes an ACK frame; the caller holds mu
+func (c *Conn) handleAck(sp packetSpace, p *parser, ecn bool, now time.Time) error {
+	space := c.spaces[sp]
+
+	largest := p.varint()
+	delay := p.varint()
+	count := p.varint()
+	first := p.varint()
+	if p.failed || first > largest {
+		return &TransportError{Code: ErrFrameEncoding, Reason: "invalid ACK frame"}
+	}
+
+	ranges := []byteRange{{largest - first, largest + 1}}
+	smallest := largest - first
+	for i := uint64(0); i < count; i++ {
+		gap := p.varint()
+		length := p.varint()
+		if p.failed || smallest < gap+2 || smallest-gap-2 < length {
+			return &TransportError{Code: ErrFrameEncoding, Reason: "invalid ACK range"}
+		}
+		high := smallest - gap - 2
+		smallest = high - length
+		ranges = append(ranges, byteRange{smallest, high + 1})
+	}
+	if ecn {
+		p.varint()
+		p.varint()
+		p.varint()
+	}
+	if p.failed {
+		return &TransportError{Code: ErrFrameEncoding, Reason: "invalid ACK frame"}
+	}
+	if largest >= space.nextPN {
+		return &TransportError{Code: ErrProtocolViolation, Reason: "ACK for a packet never sent"}
+	}
+
+	acked := func(pn uint64) bool {
+		for _, r := range ranges {
+			if pn >= r.start && pn < r.end {
+				return true
+			}
+		}
+		return false
+	}
+
+	var newlyAcked []*sentPacket
+	remaining := space.sent[:0]
+	for _, pkt := range space.sent {
+		if acked(pkt.pn) {
+			newlyAcked = append(newlyAcked, pkt)
+		} else {
+			remaining = append(remaining, pkt)
+		}
+	}
+	clear(space.sent[len(remaining):])
+	space.sent = remaining
+	if len(newlyAcked) == 0 {
+		return nil
+	}
+
+	if int64(largest) > space.largestAcked {
+		space.largestAcked = int64(largest)
+
+		// Only the largest packet gives an RTT sample
+		last := newlyAcked[len(newlyAcked)-1]
+		if last.pn == largest && last.ackEliciting {
+			ackDelay := time.Duration(0)
+			if sp == spaceApp {
+				exponent := uint64(defaultAckDelayExponent)
+				if c.peerParams != nil {
+					exponent = c.peerParams.ackDelayExponent
+				}
+				ackDelay = min(time.Duration(delay<<exponent)*time.Microsecond, c.peerMaxAckDelay())
+			}
+			c.recovery.updateRTT(now.Sub(last.sent), ackDelay)
+		}
+	}
+
+	for _, pkt := range newlyAcked {
+		c.recovery.onAcked(pkt)
+		c.onPacketAcked(sp, pkt)
+	}
+	c.recovery.ptoCount = 0
+	c.detectLoss(sp, now)
+	return nil
+}
+
+// detectLoss declares packets lost that were sent well before one that
+// has been acknowledged (RFC 9002 Section 6.1); the caller holds mu
+func (c *Conn) detectLoss(sp packetSpace, now time.Time) {
+	space := c.spaces[sp]
+	if space.largestAcked < 0 {
+		return
+	}
+
+	lossDelay := max(c.recovery.latestRTT, c.recovery.smoothedRTT) * 9 / 8
+	lossDelay = max(lossDelay, timerGranularity)
+
+	remaining := space.sent[:0]
+	for _, pkt := range space.sent {
+		lost := int64(pkt.pn) < space.largestAcked &&
+			(uint64(space.largestAcked) >= pkt.pn+packetThreshold || now.Sub(pkt.sent) >= lossDelay)
+		if lost {
+			c.recovery.onLost(pkt, now)
+			c.requeue(sp, pkt)
+		} else {
+			remaining = append(remaining, pkt)
+		}
+	}
+	clear(space.sent[len(remaining):])
+	space.sent = remaining
+}
+
+// onPacketAcked releases what an acknowledged packet carried; the caller
+// holds mu
+func (c *Conn) onPacketAcked(sp packetSpace, pkt *sentPacket) {
+	for _, f := range pkt.frames {
+		switch f.kind {
+		case sentCrypto:
+			c.spaces[sp].crypto.onAck(f.offset, f.length, false)
+		case sentStream:
+			f.stream.send.onAck(f.offset, f.length, f.fin)
+			c.cond.Broadcast()
+			c.maybeForget(f.stream)
+		case sentReset:
+			f.stream.resetAcked = true
+			c.maybeForget(f.stream)
+		}
+	}
+}
+
+// requeue schedules the frames of a lost packet to be sent again; the
+// caller holds mu
+func (c *Conn) requeue(sp packetSpace, pkt *sentPacket) {
+	for _, f := range pkt.frames {
+		switch f.kind {
+		case sentCrypto:
+			c.spaces[sp].crypto.onLost(f.offset, f.length, false)
+		case sentStream:
+			if !f.stream.resetSent {
+				f.stream.send.onLost(f.offset, f.length, f.fin)
+				c.queueStream(f.stream)
+			}
+		case sentControl:
+			c.pendingCtrl = append(c.pendingCtrl, f.data)
+		case sentReset:
+			c.resets = append(c.resets, f.stream)
+		case sentMaxData:
+			c.sendMaxData = true
+		case sentMaxStreamData:
+			c.queueMaxStreamData(f.stream)
+		case sentMaxStreams:
+			if f.uni {
+				c.sendMaxStreams[1] = true
+			} else {
+				c.sendMaxStreams[0] = true
+			}
+		case sentHandshakeDone:
+			c.handshakeSent = false
+		}
+	}
+}
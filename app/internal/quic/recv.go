@@ -0,0 +1,736 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"time"
+)
+
+// maxCryptoBuffer bounds how far ahead of what TLS has consumed CRYPTO
+// data may arrive at one encryption level
+const maxCryptoBuffer = 64 << 10
+
+// maxAckRanges bounds the received packet numbers remembered per space;
+// older ones are treated as duplicates
+const maxAckRanges = 64
+
+// handleDatagram processes a datagram from the client, which may hold
+// several coalesced packets; the caller holds mu
+func (c *Conn) handleDatagram(d []byte, now time.Time) {
+	switch c.phase {
+	case phaseClosed, phaseDraining:
+		return
+	case phaseClosing:
+		// Repeat CONNECTION_CLOSE, less often the more packets arrive
+		c.closeReplies++
+		if c.closeReplies&(c.closeReplies-1) == 0 {
+			c.send(c.closeDatagram)
+		}
+		return
+	}
+
+	c.bytesRecv += len(d)
+	for len(d) > 0 && c.phase < phaseClosing {
+		n, err := c.handlePacket(d, now)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		d = d[n:]
+	}
+}
+
+// handlePacket processes the first packet in d and returns its length.
+// Packets that cannot be decrypted are dropped without an error.
+func (c *Conn) handlePacket(d []byte, now time.Time) (int, error) {
+	if d[0]&0x80 == 0 {
+		return len(d), c.handleShortPacket(d, now)
+	}
+
+	p := parser{b: d[1:]}
+	version := p.uint32()
+	dcid := p.bytes(int(p.byte()))
+	p.bytes(int(p.byte()))
+	if p.failed || version != Version1 || d[0]&0x40 == 0 {
+		return len(d), nil
+	}
+
+	var sp packetSpace
+	switch d[0] >> 4 & 0x3 {
+	case 0x0:
+		sp = spaceInitial
+		p.lengthPrefixed()
+	case 0x2:
+		sp = spaceHandshake
+	case 0x1:
+		// 0-RTT is not accepted; such packets are skipped below
+		sp = numSpaces
+	default:
+		// Clients never send Retry packets
+		return len(d), nil
+	}
+	length := p.varint()
+	if p.failed || length > uint64(len(p.b)) {
+		return len(d), nil
+	}
+	pnOffset := len(d) - len(p.b)
+	end := pnOffset + int(length)
+
+	if sp == numSpaces || !(bytes.Equal(dcid, c.localCID) || bytes.Equal(dcid, c.originalDCID)) {
+		return end, nil
+	}
+	space := c.spaces[sp]
+	if space.discarded || space.recvKeys == nil {
+		return end, nil
+	}
+
+	pkt := d[:end]
+	pnLen, truncated, err := space.recvKeys.unprotectHeader(pkt, pnOffset)
+	if err != nil {
+		return end, nil
+	}
+	pn := decodePacketNumber(space.largestRecv, truncated, pnLen)
+	payload, err := space.recvKeys.open(pkt[:pnOffset+pnLen], pkt[pnOffset+pnLen:], pn)
+	if err != nil {
+		return end, nil
+	}
+	if pkt[0]&0x0c != 0 {
+		return end, &TransportError{Code: ErrProtocolViolation, Reason: "reserved header bits set"}
+	}
+
+	return end, c.handlePayload(sp, pn, payload, now)
+}
+
+// handleShortPacket processes a 1-RTT packet, following key updates
+// started by the client
+func (c *Conn) handleShortPacket(pkt []byte, now time.Time) error {
+	if len(pkt) < 1+connIDLen || !bytes.Equal(pkt[1:1+connIDLen], c.localCID) || c.appRead == nil {
+		return nil
+	}
+
+	pnOffset := 1 + connIDLen
+	pnLen, truncated, err := c.appRead.unprotectHeader(pkt, pnOffset)
+	if err != nil {
+		return nil
+	}
+	space := c.spaces[spaceApp]
+	pn := decodePacketNumber(space.largestRecv, truncated, pnLen)
+
+	k := c.appRead
+	phase := pkt[0]&0x04 != 0
+	update := false
+	if phase != c.keyPhase {
+		switch {
+		case pn < c.keyUpdatePN && c.prevRead != nil:
+			k = c.prevRead
+		case !c.handshakeDone:
+			return &TransportError{Code: ErrKeyUpdate, Reason: "key update before handshake completion"}
+		default:
+			if c.nextRead == nil {
+				if c.nextRead, err = c.appRead.nextKeys(); err != nil {
+					return err
+				}
+			}
+			k = c.nextRead
+			update = true
+		}
+	}
+
+	payload, err := k.open(pkt[:pnOffset+pnLen], pkt[pnOffset+pnLen:], pn)
+	if err != nil {
+		return nil
+	}
+	if pkt[0]&0x18 != 0 {
+		return &TransportError{Code: ErrProtocolViolation, Reason: "reserved header bits set"}
+	}
+
+	if update {
+		next, err := c.appWrite.nextKeys()
+		if err != nil {
+			return err
+		}
+		c.prevRead, c.appRead, c.nextRead = c.appRead, k, nil
+		c.appWrite = next
+		c.keyPhase = phase
+		c.keyUpdatePN = pn
+	}
+
+	return c.handlePayload(spaceApp, pn, payload, now)
+}
+
+// handlePayload processes the frames of a decrypted packet and records
+// its packet number for acknowledgement
+func (c *Conn) handlePayload(sp packetSpace, pn uint64, payload []byte, now time.Time) error {
+	space := c.spaces[sp]
+	if pn < space.recvFloor || space.received.contains(pn) {
+		return nil
+	}
+	if len(payload) == 0 {
+		return &TransportError{Code: ErrProtocolViolation, Reason: "packet without frames"}
+	}
+
+	c.lastRecv = now
+	if sp == spaceHandshake && !c.addressValidated {
+		// A Handshake packet proves the client owns its address
+		c.addressValidated = true
+		c.discardSpace(spaceInitial)
+	}
+
+	ackEliciting := false
+	p := parser{b: payload}
+	for !p.empty() {
+		typ := p.varint()
+		if p.failed {
+			return &TransportError{Code: ErrFrameEncoding, Reason: "invalid frame type"}
+		}
+		if sp != spaceApp && !allowedDuringHandshake(typ) {
+			return &TransportError{Code: ErrProtocolViolation, Reason: "frame not allowed during the handshake"}
+		}
+		switch typ {
+		case framePadding, frameAck, frameAckECN, frameConnectionClose, frameApplicationClose:
+		default:
+			ackEliciting = true
+		}
+
+		if err := c.handleFrame(sp, typ, &p, now); err != nil {
+			return err
+		}
+		if p.failed {
+			return &TransportError{Code: ErrFrameEncoding, Reason: "truncated frame"}
+		}
+	}
+
+	space.received.add(pn, pn+1)
+	if len(space.received) > maxAckRanges {
+		space.recvFloor = space.received[0].end
+		space.received = space.received[1:]
+	}
+	outOfOrder := int64(pn) != space.largestRecv+1
+	if int64(pn) > space.largestRecv {
+		space.largestRecv = int64(pn)
+		space.largestTime = now
+	}
+
+	if ackEliciting {
+		space.ackEliciting++
+		switch {
+		case sp != spaceApp, space.ackEliciting >= ackElicitingLimit, outOfOrder:
+			space.ackNeeded = true
+		case space.ackDeadline.IsZero():
+			space.ackDeadline = now.Add(localMaxAckDelay)
+		}
+	}
+	return nil
+}
+
+// handleFrame processes one frame whose type has been read from p
+func (c *Conn) handleFrame(sp packetSpace, typ uint64, p *parser, now time.Time) error {
+	switch {
+	case typ == framePadding, typ == framePing:
+		return nil
+
+	case typ == frameAck, typ == frameAckECN:
+		return c.handleAck(sp, p, typ == frameAckECN, now)
+
+	case typ == frameResetStream:
+		id, code, finalSize := p.varint(), p.varint(), p.varint()
+		if p.failed {
+			return nil
+		}
+		return c.handleResetStream(id, code, finalSize)
+
+	case typ == frameStopSending:
+		id, code := p.varint(), p.varint()
+		if p.failed {
+			return nil
+		}
+		return c.handleStopSending(id, code)
+
+	case typ == frameCrypto:
+		offset := p.varint()
+		data := p.lengthPrefixed()
+		if p.failed {
+			return nil
+		}
+		return c.handleCrypto(sp, offset, data)
+
+	case typ == frameNewToken:
+		return &TransportError{Code: ErrProtocolViolation, Reason: "NEW_TOKEN from a client"}
+
+	case typ >= frameStream && typ <= frameStreamMax:
+		id := p.varint()
+		var offset uint64
+		if typ&streamFlagOff != 0 {
+			offset = p.varint()
+		}
+		var data []byte
+		if typ&streamFlagLen != 0 {
+			data = p.lengthPrefixed()
+		} else {
+			data = p.bytes(len(p.b))
+		}
+		if p.failed {
+			return nil
+		}
+		return c.handleStream(id, offset, data, typ&streamFlagFin != 0)
+
+	case typ == frameMaxData:
+		if limit := p.varint(); limit > c.peerMaxData {
+			c.peerMaxData = limit
+			for _, st := range c.streams {
+				if st.send.pending(st.sendMax) {
+					c.queueStream(st)
+				}
+			}
+		}
+		return nil
+
+	case typ == frameMaxStreamData:
+		id, limit := p.varint(), p.varint()
+		if p.failed {
+			return nil
+		}
+		if id&0x3 == 0x2 {
+			return &TransportError{Code: ErrStreamState, Reason: "MAX_STREAM_DATA for a receive-only stream"}
+		}
+		st, err := c.peerStream(id)
+		if err != nil || st == nil {
+			return err
+		}
+		st.sendMax = max(st.sendMax, limit)
+		if st.send.pending(st.sendMax) {
+			c.queueStream(st)
+		}
+		return nil
+
+	case typ == frameMaxStreamsBidi, typ == frameMaxStreamsUni:
+		limit := p.varint()
+		if limit > 1<<60 {
+			return &TransportError{Code: ErrFrameEncoding, Reason: "MAX_STREAMS above 2^60"}
+		}
+		// This server opens no bidirectional streams
+		if typ == frameMaxStreamsUni {
+			c.peerMaxUni = max(c.peerMaxUni, limit)
+		}
+		return nil
+
+	case typ == frameDataBlocked, typ == frameStreamsBlockedBidi, typ == frameStreamsBlockedUni:
+		p.varint()
+		return nil
+
+	case typ == frameStreamDataBlocked:
+		p.varint()
+		p.varint()
+		return nil
+
+	case typ == frameNewConnectionID:
+		// Connection migration is disabled, so spare IDs go unused
+		p.varint()
+		p.varint()
+		n := int(p.byte())
+		p.bytes(n)
+		p.bytes(16)
+		if !p.failed && (n < 1 || n > 20) {
+			return &TransportError{Code: ErrFrameEncoding, Reason: "invalid connection ID length"}
+		}
+		return nil
+
+	case typ == frameRetireConnectionID:
+		p.varint()
+		return nil
+
+	case typ == framePathChallenge:
+		data := p.bytes(8)
+		if !p.failed {
+			c.queueControl(append([]byte{framePathResponse}, data...))
+		}
+		return nil
+
+	case typ == framePathResponse:
+		p.bytes(8)
+		return nil
+
+	case typ == frameConnectionClose, typ == frameApplicationClose:
+		code := p.varint()
+		if typ == frameConnectionClose {
+			p.varint()
+		}
+		reason := string(p.lengthPrefixed())
+		if p.failed {
+			return nil
+		}
+
+		var err error = &TransportError{Code: TransportErrorCode(code), Reason: reason, Remote: true}
+		if typ == frameApplicationClose {
+			err = &ApplicationError{Code: code, Reason: reason, Remote: true}
+		}
+		c.enterClosing(phaseDraining, err)
+		return nil
+
+	case typ == frameHandshakeDone:
+		return &TransportError{Code: ErrProtocolViolation, Reason: "HANDSHAKE_DONE from a client"}
+	}
+
+	return &TransportError{Code: ErrFrameEncoding, Reason: "unknown frame type"}
+}
+
+// handleStream stores data received in a STREAM frame
+func (c *Conn) handleStream(id, offset uint64, data []byte, fin bool) error {
+	if id&0x3 == 0x3 {
+		return &TransportError{Code: ErrStreamState, Reason: "STREAM frame for a send-only stream"}
+	}
+	st, err := c.peerStream(id)
+	if err != nil || st == nil {
+		return err
+	}
+
+	end := offset + uint64(len(data))
+	highest := st.recv.highest
+	switch {
+	case end > MaxVarint:
+		return &TransportError{Code: ErrFrameEncoding, Reason: "stream offset too large"}
+	case st.recv.hasFinal && end > st.recv.finalSize,
+		fin && st.recv.hasFinal && end != st.recv.finalSize,
+		fin && end < highest:
+		return &TransportError{Code: ErrFinalSize, Reason: "stream final size changed"}
+	case end > st.recvMax:
+		return &TransportError{Code: ErrFlowControl, Reason: "stream flow control limit exceeded"}
+	}
+	if end > highest {
+		c.recvHighest += end - highest
+		if c.recvHighest > c.recvMax {
+			return &TransportError{Code: ErrFlowControl, Reason: "connection flow control limit exceeded"}
+		}
+	}
+	if fin {
+		st.recv.hasFinal = true
+		st.recv.finalSize = end
+	}
+
+	switch {
+	case st.readClosed:
+		// Reading was cancelled; the data only counts for flow control
+		st.recv.highest = max(highest, end)
+		c.consumed(st, st.recv.highest-highest)
+		st.recv.offset = st.recv.highest
+	case st.readErr == nil:
+		st.recv.push(offset, data)
+		c.cond.Broadcast()
+	}
+	c.maybeForget(st)
+	return nil
+}
+
+// handleResetStream processes the client abandoning a stream
+func (c *Conn) handleResetStream(id, code, finalSize uint64) error {
+	if id&0x3 == 0x3 {
+		return &TransportError{Code: ErrStreamState, Reason: "RESET_STREAM for a send-only stream"}
+	}
+	st, err := c.peerStream(id)
+	if err != nil || st == nil {
+		return err
+	}
+
+	highest := st.recv.highest
+	if finalSize < highest || (st.recv.hasFinal && finalSize != st.recv.finalSize) {
+		return &TransportError{Code: ErrFinalSize, Reason: "stream final size changed"}
+	}
+	if finalSize > st.recvMax {
+		return &TransportError{Code: ErrFlowControl, Reason: "stream flow control limit exceeded"}
+	}
+	c.recvHighest += finalSize - highest
+	if c.recvHighest > c.recvMax {
+		return &TransportError{Code: ErrFlowControl, Reason: "connection flow control limit exceeded"}
+	}
+
+	st.recv.hasFinal = true
+	st.recv.finalSize = finalSize
+	st.recv.highest = finalSize
+	if st.readErr == nil && !st.recv.eof() {
+		st.readErr = &StreamError{StreamID: id, Code: code}
+	}
+	// Nothing more will be read, so all of it counts as consumed
+	c.consumed(st, finalSize-st.recv.offset)
+	st.recv.offset = finalSize
+	st.recv.chunks = nil
+	c.cond.Broadcast()
+	c.maybeForget(st)
+	return nil
+}
+
+// handleStopSending resets a stream the client no longer reads
+func (c *Conn) handleStopSending(id, code uint64) error {
+	if id&0x3 == 0x2 {
+		return &TransportError{Code: ErrStreamState, Reason: "STOP_SENDING for a receive-only stream"}
+	}
+	st, err := c.peerStream(id)
+	if err != nil || st == nil {
+		return err
+	}
+
+	if !st.resetSent && !st.send.done() {
+		st.writeErr = &StreamError{StreamID: id, Code: code}
+		c.resetStream(st, code)
+		c.cond.Broadcast()
+	}
+	return nil
+}
+
+// handleCrypto passes CRYPTO data to TLS in order
+func (c *Conn) handleCrypto(sp packetSpace, offset uint64, data []byte) error {
+	space := c.spaces[sp]
+	buf := &space.cryptoRecv
+	if offset+uint64(len(data)) > buf.offset+maxCryptoBuffer {
+		return &TransportError{Code: ErrCryptoBufferExceeded, Reason: "too much CRYPTO data buffered"}
+	}
+	buf.push(offset, data)
+
+	n := buf.readable()
+	if n == 0 {
+		return nil
+	}
+	in := make([]byte, n)
+	buf.read(in)
+	if err := c.tls.HandleData(tlsLevel(sp), in); err != nil {
+		return cryptoError(err)
+	}
+	return c.processTLSEvents()
+}
+
+// processTLSEvents acts on what TLS produced: keys, handshake data to
+// send, the client's transport parameters and handshake completion
+func (c *Conn) processTLSEvents() error {
+	for {
+		e := c.tls.NextEvent()
+		switch e.Kind {
+		case tls.QUICNoEvent:
+			return nil
+
+		case tls.QUICSetReadSecret, tls.QUICSetWriteSecret:
+			k, err := newKeys(e.Suite, bytes.Clone(e.Data))
+			if err != nil {
+				return &TransportError{Code: errCryptoBase + TransportErrorCode(tlsAlertHandshakeFailure), Reason: err.Error()}
+			}
+			read := e.Kind == tls.QUICSetReadSecret
+			switch e.Level {
+			case tls.QUICEncryptionLevelHandshake:
+				if read {
+					c.spaces[spaceHandshake].recvKeys = k
+				} else {
+					c.spaces[spaceHandshake].sendKeys = k
+				}
+			case tls.QUICEncryptionLevelApplication:
+				if read {
+					c.appRead = k
+				} else {
+					c.appWrite = k
+				}
+			}
+
+		case tls.QUICWriteData:
+			c.spaces[spaceForLevel(e.Level)].crypto.write(e.Data)
+
+		case tls.QUICTransportParameters:
+			params, err := parseClientParams(e.Data)
+			if err != nil {
+				return err
+			}
+			c.peerParams = params
+			c.peerMaxData = params.initialMaxData
+			c.peerMaxUni = params.initialMaxStreamsUni
+			if params.maxIdleTimeout > 0 && params.maxIdleTimeout < c.idleTimeout {
+				c.idleTimeout = params.maxIdleTimeout
+			}
+
+		case tls.QUICHandshakeDone:
+			c.handshakeDone = true
+			c.phase = phaseActive
+			c.connState = c.tls.ConnectionState()
+			c.discardSpace(spaceHandshake)
+			if !c.l.accepted(c) {
+				return &TransportError{Code: ErrConnectionRefused, Reason: "server busy"}
+			}
+		}
+	}
+}
+
+// tlsAlertHandshakeFailure is the TLS handshake_failure alert
+const tlsAlertHandshakeFailure = 40
+
+// cryptoError turns a TLS failure into a CRYPTO_ERROR carrying its alert
+func cryptoError(err error) error {
+	alert := tls.AlertError(tlsAlertHandshakeFailure)
+	errors.As(err, &alert)
+	return &TransportError{Code: errCryptoBase + TransportErrorCode(alert), Reason: err.Error()}
+}
+
+// tlsLevel returns the TLS encryption level of a packet number space
+func tlsLevel(sp packetSpace) tls.QUICEncryptionLevel {
+	switch sp {
+	case spaceInitial:
+		return tls.QUICEncryptionLevelInitial
+	case spaceHandshake:
+		return tls.QUICEncryptionLevelHandshake
+	}
+	return tls.QUICEncryptionLevelApplication
+}
+
+// spaceForLevel returns the packet number space of a TLS encryption level
+func spaceForLevel(level tls.QUICEncryptionLevel) packetSpace {
+	switch level {
+	case tls.QUICEncryptionLevelInitial:
+		return spaceInitial
+	case tls.QUICEncryptionLevelHandshake:
+		return spaceHandshake
+	}
+	return spaceApp
+}
+
+// discardSpace drops the keys and packets in flight of a space that is
+// no longer used; the caller holds mu
+func (c *Conn) discardSpace(sp packetSpace) {
+	space := c.spaces[sp]
+	if space.discarded {
+		return
+	}
+	for _, pkt := range space.sent {
+		if pkt.ackEliciting {
+			c.recovery.bytesInFlight -= pkt.size
+		}
+	}
+	*space = spaceState{discarded: true, largestRecv: -1, largestAcked: -1}
+	c.recovery.ptoCount = 0
+}
+
+// peerStream returns the stream a frame refers to, opening streams the
+// client has started. It returns nil for streams already forgotten.
+func (c *Conn) peerStream(id uint64) (*Stream, error) {
+	if st, ok := c.streams[id]; ok {
+		return st, nil
+	}
+
+	uni := id&0x2 != 0
+	if id&0x1 != 0 {
+		if !uni || id>>2 >= c.nextLocalUni {
+			return nil, &TransportError{Code: ErrStreamState, Reason: "frame for a stream not yet opened"}
+		}
+		return nil, nil
+	}
+
+	dir := 0
+	if uni {
+		dir = 1
+	}
+	n := id >> 2
+	if n < c.nextPeerStreams[dir] {
+		return nil, nil
+	}
+	if n >= c.maxPeerStreams[dir] {
+		return nil, &TransportError{Code: ErrStreamLimit, Reason: "stream limit exceeded"}
+	}
+
+	// Opening a stream opens every lower-numbered one of its type
+	for ; c.nextPeerStreams[dir] <= n; c.nextPeerStreams[dir]++ {
+		sid := c.nextPeerStreams[dir]<<2 | id&0x3
+		st := newStream(c, sid, true, !uni)
+		if uni {
+			c.acceptUni = append(c.acceptUni, st)
+		} else {
+			st.sendMax = c.peerParams.initialMaxStreamDataBidiLocal
+			c.acceptBidi = append(c.acceptBidi, st)
+		}
+		c.streams[sid] = st
+	}
+	c.cond.Broadcast()
+	return c.streams[id], nil
+}
+
+// consumed records that n bytes of a stream were read or discarded and
+// raises the flow-control limits once half a window has been used; the
+// caller holds mu
+func (c *Conn) consumed(st *Stream, n uint64) {
+	if n == 0 {
+		return
+	}
+
+	c.recvConsumed += n
+	if c.recvMax-c.recvConsumed < connWindow/2 {
+		c.recvMax = c.recvConsumed + connWindow
+		c.sendMaxData = true
+		c.wakeup()
+	}
+
+	if !st.recv.hasFinal && !st.readClosed && st.recvMax-st.recv.offset < st.recvWindow/2 {
+		st.recvMax = st.recv.offset + st.recvWindow
+		c.queueMaxStreamData(st)
+	}
+}
+
+// queueMaxStreamData schedules a MAX_STREAM_DATA frame; the caller holds
+// mu
+func (c *Conn) queueMaxStreamData(st *Stream) {
+	if !st.sendMaxData {
+		st.sendMaxData = true
+		c.maxStreamData = append(c.maxStreamData, st)
+	}
+	c.wakeup()
+}
+
+// maybeForget drops a stream that is finished in both directions and lets
+// the client open another in its place; the caller holds mu
+func (c *Conn) maybeForget(st *Stream) {
+	if !st.readDone() || !st.writeDone() {
+		return
+	}
+	if _, ok := c.streams[st.id]; !ok {
+		return
+	}
+	delete(c.streams, st.id)
+	if st.id&0x1 != 0 {
+		return
+	}
+
+	dir := 0
+	if st.id&0x2 != 0 {
+		dir = 1
+	}
+	c.closedPeerStreams[dir]++
+	// Raise the limit in steps of half of it rather than per stream
+	if limit := c.closedPeerStreams[dir] + c.streamLimit[dir]; limit-c.maxPeerStreams[dir] >= max(c.streamLimit[dir]/2, 1) {
+		c.maxPeerStreams[dir] = limit
+		c.sendMaxStreams[dir] = true
+		c.wakeup()
+	}
+}
+
+// queueStream schedules a stream with data to send; the caller holds mu
+func (c *Conn) queueStream(st *Stream) {
+	if !st.queued {
+		st.queued = true
+		c.sendQueue = append(c.sendQueue, st)
+	}
+	c.wakeup()
+}
+
+// queueControl schedules a frame to send; the caller holds mu
+func (c *Conn) queueControl(frame []byte) {
+	c.pendingCtrl = append(c.pendingCtrl, frame)
+	c.wakeup()
+}
+
+// resetStream abandons the sending side of a stream with RESET_STREAM;
+// the caller holds mu
+func (c *Conn) resetStream(st *Stream, code uint64) {
+	if !st.canWrite || st.resetSent || st.send.done() {
+		return
+	}
+	st.resetSent = true
+	st.resetCode = code
+	if st.writeErr == nil {
+		st.writeErr = errStreamClosed
+	}
+	st.send.lost = nil
+	c.resets = append(c.resets, st)
+	c.wakeup()
+}
@@ -0,0 +1,338 @@
+package quic
+
+import (
+	"encoding/binary"
+	"slices"
+	"time"
+)
+
+// maxDatagramSize is the largest datagram sent. Path MTU discovery is
+// not implemented, so it stays within what any IPv4 or IPv6 path carries.
+const maxDatagramSize = 1252
+
+// minInitialDatagram is the size to which datagrams carrying
+// ack-eliciting Initial packets are padded (RFC 9000 Section 14.1)
+const minInitialDatagram = 1200
+
+// minPacketRoom is the least space worth starting a packet in
+const minPacketRoom = 64
+
+// flush sends everything that is pending, as far as congestion control
+// and address validation allow; the caller holds mu
+func (c *Conn) flush(now time.Time) {
+	if c.phase >= phaseClosing {
+		return
+	}
+
+	for {
+		limit := maxDatagramSize
+		if !c.addressValidated {
+			// Send at most three times what the client sent until its
+			// address is validated
+			limit = min(limit, 3*c.bytesRecv-c.bytesSent)
+			if limit < minInitialDatagram {
+				return
+			}
+		}
+
+		datagram := c.buildDatagram(now, limit)
+		if len(datagram) == 0 {
+			return
+		}
+		c.send(datagram)
+	}
+}
+
+// buildDatagram coalesces a packet from each space with something to send
+func (c *Conn) buildDatagram(now time.Time, limit int) []byte {
+	var datagram []byte
+	pad := false
+	last := spaceInitial
+	for sp := spaceInitial; sp < numSpaces; sp++ {
+		if c.sendKeys(sp) == nil {
+			continue
+		}
+		room := limit - len(datagram)
+		if room < minPacketRoom {
+			break
+		}
+
+		n := len(datagram)
+		var ackEliciting bool
+		datagram, ackEliciting = c.buildPacket(datagram, sp, now, room)
+		if len(datagram) > n {
+			last = sp
+			pad = pad || (sp == spaceInitial && ackEliciting)
+		}
+	}
+
+	// Fill the datagram with a packet of PADDING frames
+	if pad && len(datagram) < minInitialDatagram {
+		n := minInitialDatagram - len(datagram) - c.headerLen(last) - aeadTagLen
+		datagram = c.appendPacket(datagram, last, make([]byte, max(n, 1)))
+	}
+	return datagram
+}
+
+// sendKeys returns the keys packets of a space are sent with, or nil if
+// there are none
+func (c *Conn) sendKeys(sp packetSpace) *keys {
+	if sp == spaceApp {
+		return c.appWrite
+	}
+	if c.spaces[sp].discarded {
+		return nil
+	}
+	return c.spaces[sp].sendKeys
+}
+
+// buildPacket appends a packet for a space holding as many pending frames
+// as fit in room, if there is anything to send. It reports whether the
+// packet needs acknowledging.
+func (c *Conn) buildPacket(dst []byte, sp packetSpace, now time.Time, room int) ([]byte, bool) {
+	space := c.spaces[sp]
+	capacity := room - c.headerLen(sp) - aeadTagLen
+	if capacity <= 0 {
+		return dst, false
+	}
+
+	var payload []byte
+	var frames []sentFrame
+	fits := func(n int) bool {
+		return len(payload)+n <= capacity
+	}
+
+	// An ACK goes first so that it always fits
+	ack := space.ackNeeded
+	if space.ackEliciting > 0 || space.ackNeeded {
+		if len(space.received) > 0 {
+			delay := uint64(now.Sub(space.largestTime).Microseconds()) >> defaultAckDelayExponent
+			payload = appendAckFrame(payload, space.received, delay)
+		}
+	}
+	ackLen := len(payload)
+
+	// Beyond the congestion window only probes and ACKs are sent
+	if c.recovery.bytesInFlight < c.recovery.cwnd || space.probe {
+		if sp == spaceApp {
+			payload, frames = c.appendAppFrames(payload, frames, capacity)
+		}
+
+		for fits(cryptoFrameOverhead(space.crypto.next) + 1) {
+			overhead := cryptoFrameOverhead(space.crypto.next)
+			offset, data, _, _, ok := space.crypto.pop(capacity-len(payload)-overhead, MaxVarint)
+			if !ok {
+				break
+			}
+			payload = appendCryptoFrame(payload, offset, data)
+			frames = append(frames, sentFrame{kind: sentCrypto, offset: offset, length: uint64(len(data))})
+		}
+
+		if sp == spaceApp {
+			payload, frames = c.appendStreamFrames(payload, frames, capacity)
+		}
+	}
+
+	ackEliciting := len(payload) > ackLen
+	if space.probe && !ackEliciting && fits(1) {
+		payload = append(payload, framePing)
+		ackEliciting = true
+	}
+	if !ackEliciting && !ack {
+		return dst, false
+	}
+	if len(payload) == 0 {
+		return dst, false
+	}
+
+	if ackLen > 0 {
+		space.ackEliciting = 0
+		space.ackNeeded = false
+		space.ackDeadline = time.Time{}
+	}
+
+	pn := space.nextPN
+	n := len(dst)
+	dst = c.appendPacket(dst, sp, payload)
+	if ackEliciting {
+		pkt := &sentPacket{pn: pn, sent: now, size: len(dst) - n, ackEliciting: true, frames: frames}
+		space.sent = append(space.sent, pkt)
+		space.lastSent = now
+		space.probe = false
+		c.recovery.bytesInFlight += pkt.size
+	}
+	return dst, ackEliciting
+}
+
+// appendAppFrames appends the control frames only sent in 1-RTT packets
+func (c *Conn) appendAppFrames(payload []byte, frames []sentFrame, capacity int) ([]byte, []sentFrame) {
+	fits := func(frame []byte) bool {
+		return len(payload)+len(frame) <= capacity
+	}
+
+	if c.handshakeDone && !c.handshakeSent {
+		payload = append(payload, frameHandshakeDone)
+		frames = append(frames, sentFrame{kind: sentHandshakeDone})
+		c.handshakeSent = true
+	}
+
+	for len(c.resets) > 0 {
+		st := c.resets[0]
+		frame := appendResetStream(nil, st.id, st.resetCode, st.send.next)
+		if !fits(frame) {
+			return payload, frames
+		}
+		payload = append(payload, frame...)
+		frames = append(frames, sentFrame{kind: sentReset, stream: st})
+		c.resets = c.resets[1:]
+	}
+
+	for len(c.pendingCtrl) > 0 {
+		frame := c.pendingCtrl[0]
+		if !fits(frame) {
+			return payload, frames
+		}
+		payload = append(payload, frame...)
+		frames = append(frames, sentFrame{kind: sentControl, data: frame})
+		c.pendingCtrl = c.pendingCtrl[1:]
+	}
+
+	if c.sendMaxData {
+		frame := appendMaxData(nil, c.recvMax)
+		if !fits(frame) {
+			return payload, frames
+		}
+		payload = append(payload, frame...)
+		frames = append(frames, sentFrame{kind: sentMaxData})
+		c.sendMaxData = false
+	}
+
+	for dir, pending := range c.sendMaxStreams {
+		if !pending {
+			continue
+		}
+		frame := appendMaxStreams(nil, dir == 1, c.maxPeerStreams[dir])
+		if !fits(frame) {
+			return payload, frames
+		}
+		payload = append(payload, frame...)
+		frames = append(frames, sentFrame{kind: sentMaxStreams, uni: dir == 1})
+		c.sendMaxStreams[dir] = false
+	}
+
+	for len(c.maxStreamData) > 0 {
+		st := c.maxStreamData[0]
+		if st.recv.hasFinal || st.readClosed {
+			// The client has nothing more to send
+			st.sendMaxData = false
+			c.maxStreamData = c.maxStreamData[1:]
+			continue
+		}
+		frame := appendMaxStreamData(nil, st.id, st.recvMax)
+		if !fits(frame) {
+			return payload, frames
+		}
+		payload = append(payload, frame...)
+		frames = append(frames, sentFrame{kind: sentMaxStreamData, stream: st})
+		st.sendMaxData = false
+		c.maxStreamData = c.maxStreamData[1:]
+	}
+	return payload, frames
+}
+
+// appendStreamFrames appends STREAM frames, taking each queued stream in
+// turn
+func (c *Conn) appendStreamFrames(payload []byte, frames []sentFrame, capacity int) ([]byte, []sentFrame) {
+	for len(c.sendQueue) > 0 {
+		st := c.sendQueue[0]
+		limit := min(st.sendMax, st.send.next+c.peerMaxData-c.dataSent)
+		if st.resetSent || !st.send.pending(limit) {
+			st.queued = false
+			c.sendQueue = c.sendQueue[1:]
+			continue
+		}
+
+		room := capacity - len(payload) - streamFrameOverhead(st.id, st.send.next)
+		if room <= 0 {
+			break
+		}
+		offset, data, fin, isNew, ok := st.send.pop(room, limit)
+		if !ok {
+			st.queued = false
+			c.sendQueue = c.sendQueue[1:]
+			continue
+		}
+		if isNew {
+			c.dataSent += uint64(len(data))
+		}
+		payload = appendStreamFrame(payload, st.id, offset, data, fin)
+		frames = append(frames, sentFrame{kind: sentStream, stream: st, offset: offset, length: uint64(len(data)), fin: fin})
+
+		// Move the stream to the back so that streams share packets
+		c.sendQueue = c.sendQueue[1:]
+		limit = min(st.sendMax, st.send.next+c.peerMaxData-c.dataSent)
+		if st.send.pending(limit) {
+			c.sendQueue = append(c.sendQueue, st)
+		} else {
+			st.queued = false
+		}
+	}
+	return payload, frames
+}
+
+// headerLen returns the length of a packet header in a space, including
+// the four-byte packet number
+func (c *Conn) headerLen(sp packetSpace) int {
+	if sp == spaceApp {
+		return 1 + len(c.peerCID) + 4
+	}
+	n := 1 + 4 + 1 + len(c.peerCID) + 1 + len(c.localCID) + 2 + 4
+	if sp == spaceInitial {
+		n++
+	}
+	return n
+}
+
+// appendPacket appends a protected packet carrying payload, using the
+// next packet number of the space
+func (c *Conn) appendPacket(dst []byte, sp packetSpace, payload []byte) []byte {
+	space := c.spaces[sp]
+	k := c.sendKeys(sp)
+	pn := space.nextPN
+	space.nextPN++
+
+	start := len(dst)
+	if sp == spaceApp {
+		first := byte(0x40 | 0x03)
+		if c.keyPhase {
+			first |= 0x04
+		}
+		dst = append(dst, first)
+		dst = append(dst, c.peerCID...)
+	} else {
+		typ := byte(0x0)
+		if sp == spaceHandshake {
+			typ = 0x2
+		}
+		dst = append(dst, 0xc0|typ<<4|0x03)
+		dst = binary.BigEndian.AppendUint32(dst, Version1)
+		dst = append(dst, byte(len(c.peerCID)))
+		dst = append(dst, c.peerCID...)
+		dst = append(dst, byte(len(c.localCID)))
+		dst = append(dst, c.localCID...)
+		if sp == spaceInitial {
+			// No token
+			dst = append(dst, 0)
+		}
+		// The Length field always takes two bytes
+		length := 4 + len(payload) + aeadTagLen
+		dst = binary.BigEndian.AppendUint16(dst, 0x4000|uint16(length))
+	}
+
+	pnOffset := len(dst) - start
+	dst = binary.BigEndian.AppendUint32(dst, uint32(pn))
+	dst = append(dst, payload...)
+	dst = slices.Grow(dst, aeadTagLen)
+	sealed := k.seal(dst[start:], pnOffset, 4, pn)
+	return dst[:start+len(sealed)]
+}
@@ -0,0 +1,242 @@
+package quic
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Flow-control windows advertised for data a client sends
+const (
+	streamWindow    = 1 << 20
+	uniStreamWindow = 64 << 10
+	connWindow      = 4 << 20
+)
+
+// maxStreamBuffer bounds the unacknowledged data buffered for sending on
+// one stream; Write blocks beyond it
+const maxStreamBuffer = 256 << 10
+
+// Stream is one QUIC stream. Streams opened by the client are
+// bidirectional or, like those opened by the server, unidirectional.
+// Its methods are safe for concurrent use.
+type Stream struct {
+	id   uint64
+	conn *Conn
+
+	// canRead and canWrite say which directions the stream has
+	canRead  bool
+	canWrite bool
+
+	// Receiving side: recvMax is the flow-control limit advertised to
+	// the peer
+	recv         recvBuf
+	recvMax      uint64
+	recvWindow   uint64
+	readErr      error
+	readClosed   bool
+	sendMaxData  bool
+	readDeadline deadlineTimer
+
+	// Sending side: sendMax is the limit the peer advertised
+	send          sendBuf
+	sendMax       uint64
+	writeErr      error
+	resetCode     uint64
+	resetSent     bool
+	resetAcked    bool
+	writeDeadline deadlineTimer
+
+	queued bool
+}
+
+// deadlineTimer wakes waiting readers or writers when a deadline passes
+type deadlineTimer struct {
+	at    time.Time
+	timer *time.Timer
+}
+
+// set changes the deadline; the caller holds the connection's lock
+func (d *deadlineTimer) set(t time.Time, c *Conn) {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.at = t
+	if !t.IsZero() {
+		d.timer = time.AfterFunc(time.Until(t), c.broadcast)
+	}
+	c.cond.Broadcast()
+}
+
+// expired reports whether the deadline has passed
+func (d *deadlineTimer) expired() bool {
+	return !d.at.IsZero() && !time.Now().Before(d.at)
+}
+
+// newStream creates a stream with the given directions
+func newStream(c *Conn, id uint64, canRead, canWrite bool) *Stream {
+	st := &Stream{id: id, conn: c, canRead: canRead, canWrite: canWrite}
+	if !canRead {
+		st.readErr = errStreamClosed
+	}
+	if !canWrite {
+		st.writeErr = errStreamClosed
+	}
+	if canRead {
+		st.recvWindow = streamWindow
+		if !canWrite {
+			st.recvWindow = uniStreamWindow
+		}
+		st.recvMax = st.recvWindow
+	}
+	return st
+}
+
+// ID returns the stream ID
+func (st *Stream) ID() uint64 {
+	return st.id
+}
+
+// Read reads data sent by the peer. It returns io.EOF after the last
+// byte, a *StreamError if the peer reset the stream, and
+// os.ErrDeadlineExceeded once the read deadline passes.
+func (st *Stream) Read(p []byte) (int, error) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		switch {
+		case st.readErr != nil:
+			return 0, st.readErr
+		case st.recv.readable() > 0:
+			n := st.recv.read(p)
+			c.consumed(st, uint64(n))
+			return n, nil
+		case st.recv.eof():
+			c.maybeForget(st)
+			return 0, io.EOF
+		case c.err != nil:
+			return 0, c.err
+		case st.readDeadline.expired():
+			return 0, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+}
+
+// Write queues data to send, blocking while too much is unacknowledged.
+// It fails with a *StreamError if the peer asked us to stop sending, and
+// os.ErrDeadlineExceeded once the write deadline passes.
+func (st *Stream) Write(p []byte) (int, error) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		switch {
+		case st.writeErr != nil:
+			return written, st.writeErr
+		case c.err != nil:
+			return written, c.err
+		case len(st.send.data) < maxStreamBuffer:
+			n := min(len(p), maxStreamBuffer-len(st.send.data))
+			st.send.write(p[:n])
+			written += n
+			p = p[n:]
+			c.queueStream(st)
+			continue
+		case st.writeDeadline.expired():
+			return written, os.ErrDeadlineExceeded
+		}
+		c.cond.Wait()
+	}
+	return written, nil
+}
+
+// Close ends the sending side of the stream once queued data is sent
+func (st *Stream) Close() error {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st.send.fin || st.resetSent {
+		return nil
+	}
+	if st.writeErr != nil {
+		return st.writeErr
+	}
+	if c.err != nil {
+		return c.err
+	}
+	st.send.fin = true
+	st.writeErr = errStreamClosed
+	c.queueStream(st)
+	return nil
+}
+
+// CancelWrite abandons the sending side with RESET_STREAM
+func (st *Stream) CancelWrite(code uint64) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resetStream(st, code)
+}
+
+// CancelRead asks the peer to stop sending with STOP_SENDING and discards
+// anything it sends
+func (st *Stream) CancelRead(code uint64) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if st.readClosed || st.recv.eof() || !st.canRead {
+		return
+	}
+	st.readClosed = true
+	st.readErr = errStreamClosed
+
+	// Data already received or still arriving counts as consumed
+	c.consumed(st, st.recv.highest-st.recv.offset)
+	st.recv.offset = st.recv.highest
+	st.recv.chunks = nil
+
+	if !st.recv.hasFinal && c.err == nil {
+		c.queueControl(appendStopSending(nil, st.id, code))
+	}
+	c.maybeForget(st)
+}
+
+// SetReadDeadline sets when blocked and future reads fail; zero means no
+// deadline
+func (st *Stream) SetReadDeadline(t time.Time) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st.readDeadline.set(t, c)
+}
+
+// SetWriteDeadline sets when blocked and future writes fail; zero means
+// no deadline
+func (st *Stream) SetWriteDeadline(t time.Time) {
+	c := st.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st.writeDeadline.set(t, c)
+}
+
+// readDone reports whether nothing more will be read from the stream
+func (st *Stream) readDone() bool {
+	return !st.canRead || st.readClosed || st.recv.eof() || st.readErr != nil
+}
+
+// writeDone reports whether the sending side has finished, with
+// everything acknowledged or the stream reset
+func (st *Stream) writeDone() bool {
+	return !st.canWrite || st.send.done() || st.resetAcked
+}
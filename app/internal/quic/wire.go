@@ -0,0 +1,135 @@
+package quic
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// MaxVarint is the largest value a variable-length integer can hold
+const MaxVarint = 1<<62 - 1
+
+// AppendVarint appends v in the variable-length integer encoding of RFC
+// 9000 Section 16, using the shortest form
+func AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return binary.BigEndian.AppendUint16(b, uint16(v)|0x4000)
+	case v < 1<<30:
+		return binary.BigEndian.AppendUint32(b, uint32(v)|0x80000000)
+	default:
+		return binary.BigEndian.AppendUint64(b, v|0xc000000000000000)
+	}
+}
+
+// VarintLen returns the number of bytes AppendVarint uses for v
+func VarintLen(v uint64) int {
+	switch {
+	case v < 1<<6:
+		return 1
+	case v < 1<<14:
+		return 2
+	case v < 1<<30:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// ReadVarint reads a variable-length integer. It returns io.EOF if r
+// ends before the first byte and io.ErrUnexpectedEOF if it ends inside.
+func ReadVarint(r io.ByteReader) (uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	v := uint64(first & 0x3f)
+	for n := 1<<(first>>6) - 1; n > 0; n-- {
+		b, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// parser reads wire-format fields from a byte slice. After a read runs
+// past the end every further read returns zero values and failed is set,
+// so a sequence of reads needs one check at the end.
+type parser struct {
+	b      []byte
+	failed bool
+}
+
+// empty reports whether everything has been read
+func (p *parser) empty() bool {
+	return len(p.b) == 0
+}
+
+// byte reads one byte
+func (p *parser) byte() byte {
+	if len(p.b) < 1 {
+		p.failed = true
+		return 0
+	}
+	v := p.b[0]
+	p.b = p.b[1:]
+	return v
+}
+
+// uint32 reads a four-byte big-endian integer
+func (p *parser) uint32() uint32 {
+	b := p.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// varint reads a variable-length integer
+func (p *parser) varint() uint64 {
+	if len(p.b) < 1 {
+		p.failed = true
+		return 0
+	}
+	n := 1 << (p.b[0] >> 6)
+	b := p.bytes(n)
+	if b == nil {
+		return 0
+	}
+
+	v := uint64(b[0] & 0x3f)
+	for _, c := range b[1:] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// bytes reads n bytes, returning a slice of the input
+func (p *parser) bytes(n int) []byte {
+	if n < 0 || len(p.b) < n || p.failed {
+		p.failed = true
+		p.b = nil
+		return nil
+	}
+	v := p.b[:n:n]
+	p.b = p.b[n:]
+	return v
+}
+
+// lengthPrefixed reads a varint length and that many bytes
+func (p *parser) lengthPrefixed() []byte {
+	n := p.varint()
+	if n > uint64(len(p.b)) {
+		p.failed = true
+		p.b = nil
+		return nil
+	}
+	return p.bytes(int(n))
+}
@@ -0,0 +1,107 @@
+package quic
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVarint(t *testing.T) {
+	// RFC 9000 Appendix A.1, plus the boundaries of each length
+	tests := []struct {
+		hex   string
+		value uint64
+		// shortest is false for encodings longer than needed, which are
+		// valid to read but never written
+		shortest bool
+	}{
+		{"c2197c5eff14e88c", 151288809941952652, true},
+		{"9d7f3e7d", 494878333, true},
+		{"7bbd", 15293, true},
+		{"25", 37, true},
+		{"4025", 37, false},
+		{"00", 0, true},
+		{"3f", 63, true},
+		{"4040", 64, true},
+		{"7fff", 16383, true},
+		{"80004000", 16384, true},
+		{"bfffffff", 1<<30 - 1, true},
+		{"c000000040000000", 1 << 30, true},
+		{"ffffffffffffffff", MaxVarint, true},
+	}
+	for _, tt := range tests {
+		b := unhex(t, tt.hex)
+
+		v, err := ReadVarint(bytes.NewReader(b))
+		if err != nil || v != tt.value {
+			t.Errorf("ReadVarint(%s) = %d, %v; want %d", tt.hex, v, err, tt.value)
+		}
+
+		p := parser{b: b}
+		if v := p.varint(); p.failed || !p.empty() || v != tt.value {
+			t.Errorf("parser.varint(%s) = %d, failed %v", tt.hex, v, p.failed)
+		}
+
+		if tt.shortest {
+			if got := AppendVarint(nil, tt.value); !bytes.Equal(got, b) {
+				t.Errorf("AppendVarint(%d) = %x, want %s", tt.value, got, tt.hex)
+			}
+			if n := VarintLen(tt.value); n != len(b) {
+				t.Errorf("VarintLen(%d) = %d, want %d", tt.value, n, len(b))
+			}
+		}
+	}
+}
+
+func TestReadVarintTruncated(t *testing.T) {
+	if _, err := ReadVarint(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("empty: error = %v, want EOF", err)
+	}
+	if _, err := ReadVarint(bytes.NewReader([]byte{0x80, 1})); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated: error = %v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestParser(t *testing.T) {
+	p := parser{b: []byte{7, 0, 0, 1, 2, 0x40, 0x05, 3, 'a', 'b', 'c'}}
+	if b := p.byte(); b != 7 {
+		t.Errorf("byte = %d", b)
+	}
+	if v := p.uint32(); v != 0x102 {
+		t.Errorf("uint32 = %#x", v)
+	}
+	if v := p.varint(); v != 5 {
+		t.Errorf("varint = %d", v)
+	}
+	if b := p.lengthPrefixed(); string(b) != "abc" {
+		t.Errorf("lengthPrefixed = %q", b)
+	}
+	if p.failed || !p.empty() {
+		t.Errorf("failed %v, empty %v", p.failed, p.empty())
+	}
+
+	// Once a read fails, later reads return zero values
+	p = parser{b: []byte{5, 'a', 1}}
+	if b := p.lengthPrefixed(); b != nil || !p.failed {
+		t.Errorf("overrunning lengthPrefixed = %q, failed %v", b, p.failed)
+	}
+	if b := p.byte(); b != 0 {
+		t.Errorf("byte after failure = %d", b)
+	}
+
+	p = parser{b: []byte{0xc0, 1, 2}}
+	if v := p.varint(); v != 0 || !p.failed {
+		t.Errorf("truncated varint = %d, failed %v", v, p.failed)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// connReader reads from a connection and, while a handler runs, watches it
+// in the background so a client disconnect can cancel the request context.
+// A byte read by the background watcher is kept and returned by the next Read.
+type connReader struct {
+	conn net.Conn
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	inRead  bool
+	hasByte bool
+	byteBuf [1]byte
+}
+
+// newConnReader wraps a connection
+func newConnReader(conn net.Conn) *connReader {
+	cr := &connReader{conn: conn}
+	cr.cond = sync.NewCond(&cr.mu)
+	return cr
+}
+
+// Read returns any byte held back by the background watcher before
+// reading from the connection
+func (cr *connReader) Read(p []byte) (int, error) {
+	cr.mu.Lock()
+	if cr.hasByte && len(p) > 0 {
+		p[0] = cr.byteBuf[0]
+		cr.hasByte = false
+		cr.mu.Unlock()
+		return 1, nil
+	}
+	cr.mu.Unlock()
+
+	return cr.conn.Read(p)
+}
+
+// startBackgroundRead watches the connection until abortPendingRead is
+// called, calling cancel if the client goes away. Data that arrives in the
+// meantime, such as a pipelined request, is kept for the next Read.
+func (cr *connReader) startBackgroundRead(cancel context.CancelFunc) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if cr.inRead || cr.hasByte {
+		return
+	}
+	cr.inRead = true
+
+	// Deadlines from reading the request must not end the watch early
+	cr.conn.SetReadDeadline(time.Time{})
+
+	go cr.backgroundRead(cancel)
+}
+
+// backgroundRead blocks on a one-byte read of the connection
+func (cr *connReader) backgroundRead(cancel context.CancelFunc) {
+	n, err := cr.conn.Read(cr.byteBuf[:])
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if n == 1 {
+		cr.hasByte = true
+	} else if !isTimeout(err) {
+		// The client closed the connection or it broke
+		cancel()
+	}
+
+	cr.inRead = false
+	cr.cond.Broadcast()
+}
+
+// abortPendingRead stops the background watcher and waits for it to exit
+func (cr *connReader) abortPendingRead() {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if !cr.inRead {
+		return
+	}
+
+	// A deadline in the past unblocks the pending read
+	cr.conn.SetReadDeadline(time.Unix(1, 0))
+	for cr.inRead {
+		cr.cond.Wait()
+	}
+	cr.conn.SetReadDeadline(time.Time{})
+}
+
+// isTimeout reports whether err is a deadline error
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
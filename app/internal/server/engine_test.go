@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// idleConns is how many idle keep-alive connections BenchmarkEngines holds
+// open. Each uses two file descriptors, one per side, so it is bounded by
+// half the open file limit.
+var idleConns = flag.Int("idleconns", 1000, "idle keep-alive connections for BenchmarkEngines")
+
+// benchRequest is sent on every connection; /echo answers without
+// touching disk
+const benchRequest = "GET /echo/x HTTP/1.1\r\nHost: bench\r\n\r\n"
+
+// BenchmarkEngines compares the connection engines. Each holds -idleconns
+// idle keep-alive connections open and reports the goroutines and memory
+// each costs, which includes the client side of the connection, the same
+// for every engine; ns/op is then the time per request on busy
+// connections alongside them.
+//
+//	go test ./app/internal/server -bench Engines -benchtime 5s -idleconns 5000
+func BenchmarkEngines(b *testing.B) {
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	for _, engine := range []string{config.EngineGoroutine, config.EngineEpoll} {
+		b.Run(engine, func(b *testing.B) {
+			if engine == config.EngineEpoll && runtime.GOOS != "linux" {
+				b.Skipf("%s is only available on Linux", engine)
+			}
+			_, addr := startServer(b, "-engine", engine)
+
+			goroutinesBefore, memBefore := measure()
+			idle := openIdle(b, addr, *idleConns)
+			// Give the server a moment to settle the last connections
+			time.Sleep(200 * time.Millisecond)
+			goroutinesAfter, memAfter := measure()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				conn, err := net.Dial("tcp", addr)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				defer conn.Close()
+
+				buf := make([]byte, 1024)
+				for pb.Next() {
+					if err := roundTrip(conn, buf); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+
+			// Reported last, as ResetTimer discards metrics
+			b.ReportMetric(float64(goroutinesAfter-goroutinesBefore)/float64(len(idle)), "goroutines/idle")
+			b.ReportMetric(float64(int64(memAfter)-int64(memBefore))/float64(len(idle)), "B/idle")
+		})
+	}
+}
+
+// measure returns the goroutine count and memory in use after a GC
+func measure() (int, uint64) {
+	// Goroutines of an earlier run may still be exiting
+	time.Sleep(100 * time.Millisecond)
+	runtime.GC()
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return runtime.NumGoroutine(), m.HeapInuse + m.StackInuse
+}
+
+// openIdle opens n connections and sends one request on each, leaving
+// them idle with nothing but the connection itself on the client side.
+// They are closed when the benchmark ends.
+func openIdle(b *testing.B, addr string, n int) []net.Conn {
+	b.Helper()
+	conns := make([]net.Conn, n)
+	b.Cleanup(func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	})
+
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	// Bound how many connections are being opened at once
+	for range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 1024)
+			for !failed.Load() {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+				conn, err := net.Dial("tcp", addr)
+				if err == nil {
+					conns[i] = conn
+					err = roundTrip(conn, buf)
+				}
+				if err != nil {
+					b.Errorf("opening connection %d: %v", i, err)
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if failed.Load() {
+		b.FailNow()
+	}
+	return conns
+}
+
+// roundTrip sends the request and reads the 200 response to it
+func roundTrip(conn net.Conn, buf []byte) error {
+	if _, err := io.WriteString(conn, benchRequest); err != nil {
+		return err
+	}
+
+	var response []byte
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		response = append(response, buf[:n]...)
+		head, body, found := bytes.Cut(response, []byte("\r\n\r\n"))
+		if !found {
+			continue
+		}
+		if !bytes.HasPrefix(head, []byte("HTTP/1.1 200 ")) {
+			status, _, _ := bytes.Cut(head, []byte("\r\n"))
+			return fmt.Errorf("unexpected response %q", status)
+		}
+		if len(body) >= len("x") {
+			return nil
+		}
+	}
+}
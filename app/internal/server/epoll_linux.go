@@ -0,0 +1,296 @@
+//go:build linux
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// pollBatch is how many readiness events one epoll_wait returns at most
+const pollBatch = 256
+
+// pollSweepInterval is how often parked connections are checked for
+// having been idle too long, and so how late an idle timeout may fire
+const pollSweepInterval = time.Second
+
+// wakeID marks events on the pipe used to stop the poller
+const wakeID = 0
+
+// readers holds the read buffers of connections that are not reading,
+// so parked connections don't keep one each
+var readers = sync.Pool{
+	New: func() any { return bufio.NewReader(nil) },
+}
+
+// newReader returns a pooled read buffer for a connection
+func newReader(cr *connReader) *bufio.Reader {
+	reader := readers.Get().(*bufio.Reader)
+	reader.Reset(cr)
+	return reader
+}
+
+// poller is the epoll engine. Idle plaintext HTTP/1 connections are
+// registered with an epoll instance and cost no goroutine or read buffer
+// until they become readable, when they are served on the worker pool.
+//
+// Connections are registered one-shot under an ID rather than their file
+// descriptor, so an event for a connection closed meanwhile, whose
+// descriptor may already be reused, cannot be mistaken for another one.
+type poller struct {
+	s       *Server
+	epfd    int
+	wake    [2]int // pipe that interrupts epoll_wait on stop
+	workers *workerPool
+
+	mu     sync.Mutex
+	parked map[uint64]*http1Conn
+	nextID uint64
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newPoller creates the epoll instance and starts waiting for events and
+// the given number of workers; zero uses GOMAXPROCS
+func newPoller(s *Server, workers int) (*poller, error) {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("epoll: %w", err)
+	}
+
+	p := &poller{
+		s:      s,
+		epfd:   epfd,
+		parked: make(map[uint64]*http1Conn),
+		nextID: wakeID + 1,
+		done:   make(chan struct{}),
+	}
+	if err := syscall.Pipe2(p.wake[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		syscall.Close(epfd)
+		return nil, fmt.Errorf("epoll: %w", err)
+	}
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN}
+	setEventID(&event, wakeID)
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, p.wake[0], &event); err != nil {
+		p.closeFDs()
+		return nil, fmt.Errorf("epoll: %w", err)
+	}
+
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p.workers = newWorkerPool(workers)
+
+	go p.run()
+	return p, nil
+}
+
+// parkNew parks a newly accepted plaintext connection until its first
+// request arrives
+func (p *poller) parkNew(raw net.Conn, listener *Listener) bool {
+	return p.park(&http1Conn{
+		raw:      raw,
+		conn:     raw,
+		listener: listener,
+		cr:       newConnReader(raw),
+		first:    true,
+	}, p.s.Config())
+}
+
+// park hands an idle connection to the poller, returning its read buffer
+// to the pool. It reports false, leaving the connection untouched, if the
+// connection cannot be polled.
+func (p *poller) park(c *http1Conn, cfg *config.Config) bool {
+	sc, ok := c.raw.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	// The buffer is released before the connection is published, since
+	// from then on an event may hand it to a worker
+	reader := c.reader
+	c.reader = nil
+	if reader != nil {
+		reader.Reset(nil)
+		readers.Put(reader)
+	}
+
+	p.mu.Lock()
+	id := p.nextID
+	p.nextID++
+	c.pollID = id
+	c.idleDeadline = deadline(time.Now(), idleTimeout(cfg))
+	p.parked[id] = c
+	p.mu.Unlock()
+
+	// Shutdown closes the parked connection rather than the socket, and
+	// the connection must be tracked before an event can wake it
+	p.s.untrackConn(c.raw)
+	p.s.trackConn(parkedConn{p, c}, stateIdle)
+
+	// The descriptor stays registered, disarmed, after a one-shot event,
+	// so a connection parked before is rearmed rather than added
+	event := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT}
+	setEventID(&event, id)
+	ctlErr := rc.Control(func(fd uintptr) {
+		err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_MOD, int(fd), &event)
+		if err == syscall.ENOENT {
+			err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, int(fd), &event)
+		}
+	})
+	if ctlErr != nil || err != nil {
+		p.mu.Lock()
+		delete(p.parked, id)
+		p.mu.Unlock()
+		p.s.untrackConn(parkedConn{p, c})
+		p.s.trackConn(c.raw, stateIdle)
+		if reader != nil {
+			c.reader = newReader(c.cr)
+		}
+		return false
+	}
+	return true
+}
+
+// unpark takes a connection back from the poller, reporting false if it
+// was not parked under id
+func (p *poller) unpark(id uint64) (*http1Conn, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c, ok := p.parked[id]
+	if ok {
+		delete(p.parked, id)
+	}
+	return c, ok
+}
+
+// parkedConn is how Shutdown sees a parked connection, which it closes as
+// idle
+type parkedConn struct {
+	p *poller
+	c *http1Conn
+}
+
+// Close closes the connection. If an event woke it meanwhile, closing the
+// socket makes the worker serving it stop.
+func (pc parkedConn) Close() error {
+	if _, ok := pc.p.unpark(pc.c.pollID); ok {
+		pc.p.s.limiter.release(pc.c.raw.RemoteAddr())
+	}
+	return pc.c.raw.Close()
+}
+
+// run waits for parked connections to become readable and serves them on
+// the worker pool, closing ones idle for too long, until stop
+func (p *poller) run() {
+	defer close(p.done)
+
+	events := make([]syscall.EpollEvent, pollBatch)
+	nextSweep := time.Now().Add(pollSweepInterval)
+	for {
+		n, err := syscall.EpollWait(p.epfd, events, int(pollSweepInterval/time.Millisecond))
+		if err != nil && err != syscall.EINTR {
+			log.Printf("Error waiting for epoll events: %v", err)
+			return
+		}
+
+		for _, event := range events[:max(n, 0)] {
+			id := eventID(&event)
+			if id == wakeID {
+				return
+			}
+			if c, ok := p.unpark(id); ok {
+				p.workers.submit(func() { p.resume(c) })
+			}
+		}
+
+		if now := time.Now(); !now.Before(nextSweep) {
+			p.closeIdle(now)
+			nextSweep = now.Add(pollSweepInterval)
+		}
+	}
+}
+
+// resume serves a connection that became readable, as the goroutine of a
+// connection would
+func (p *poller) resume(c *http1Conn) {
+	// A panic in the protocol code only costs this connection
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.Connection, v, "connection from %s", c.conn.RemoteAddr())
+			p.s.closeConn(c.raw)
+		}
+	}()
+
+	p.s.untrackConn(parkedConn{p, c})
+	c.reader = newReader(c.cr)
+
+	if !p.s.serveHTTP1(c) {
+		p.s.closeConn(c.raw)
+	}
+}
+
+// closeIdle closes parked connections whose idle timeout has passed
+func (p *poller) closeIdle(now time.Time) {
+	var expired []*http1Conn
+
+	p.mu.Lock()
+	for id, c := range p.parked {
+		if !c.idleDeadline.IsZero() && now.After(c.idleDeadline) {
+			delete(p.parked, id)
+			expired = append(expired, c)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, c := range expired {
+		p.s.untrackConn(parkedConn{p, c})
+		p.s.limiter.release(c.raw.RemoteAddr())
+		c.raw.Close()
+	}
+}
+
+// stop ends the event loop and the workers once they finish their tasks.
+// Parked connections are left to Shutdown.
+func (p *poller) stop() {
+	p.stopOnce.Do(func() {
+		syscall.Write(p.wake[1], []byte{0})
+		<-p.done
+		p.workers.stop()
+		p.closeFDs()
+	})
+}
+
+// closeFDs closes the epoll instance and wake pipe
+func (p *poller) closeFDs() {
+	syscall.Close(p.wake[0])
+	syscall.Close(p.wake[1])
+	syscall.Close(p.epfd)
+}
+
+// setEventID stores id as an event's user data, which the kernel hands
+// back with readiness events; Fd and Pad make up its 64 bits
+func setEventID(event *syscall.EpollEvent, id uint64) {
+	event.Fd = int32(uint32(id))
+	event.Pad = int32(uint32(id >> 32))
+}
+
+// eventID returns the ID stored with setEventID
+func eventID(event *syscall.EpollEvent) uint64 {
+	return uint64(uint32(event.Fd)) | uint64(uint32(event.Pad))<<32
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// poller is the epoll engine, which is only available on Linux
+type poller struct{}
+
+// newPoller fails outside Linux
+func newPoller(s *Server, workers int) (*poller, error) {
+	return nil, errors.New("epoll: the epoll engine is only available on Linux")
+}
+
+// parkNew never parks a connection
+func (p *poller) parkNew(raw net.Conn, listener *Listener) bool {
+	return false
+}
+
+// park never parks a connection
+func (p *poller) park(c *http1Conn, cfg *config.Config) bool {
+	return false
+}
+
+// stop does nothing
+func (p *poller) stop() {}
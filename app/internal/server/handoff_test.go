@@ -0,0 +1,232 @@
+//go:build unix
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// envTestChild tells the test binary to run as a server for the handoff
+// tests
+const envTestChild = "SERVER_TEST_CHILD"
+
+// TestHandoffChild is the server process the handoff tests start, serving
+// with the arguments after "--" until it is killed
+func TestHandoffChild(t *testing.T) {
+	if os.Getenv(envTestChild) != "1" {
+		t.Skip("run by the handoff tests")
+	}
+
+	// systemd sets LISTEN_PID once it knows the pid, which the test
+	// starting this process can't
+	if os.Getenv(envSystemdFDs) != "" {
+		os.Setenv(envSystemdPID, strconv.Itoa(os.Getpid()))
+	}
+
+	args := os.Args[slices.Index(os.Args, "--")+1:]
+	cfg, err := config.LoadArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listeners, err := ListenAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NotifyReady(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Serve(listeners...)
+}
+
+// startChild runs TestHandoffChild with args and env, passing it files as
+// descriptors 3 onwards, and waits until it reports that it is serving
+func startChild(t *testing.T, files []*os.File, env []string, args ...string) {
+	t.Helper()
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readyReader.Close()
+
+	var output bytes.Buffer
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestHandoffChild$", "--"}, args...)...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = append(os.Environ(), append(env,
+		envTestChild+"=1",
+		envReadyFD+"="+strconv.Itoa(3+len(files)),
+	)...)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	readyReader.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := readyReader.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("child not ready: %v\n%s", err, output.Bytes())
+	}
+}
+
+// listenFile opens a loopback TCP listener and returns its address and a
+// descriptor for it to hand over. The test keeps the listener open until
+// it ends, so a child can only serve on the address by inheriting it.
+func listenFile(t *testing.T) (string, *os.File) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	file, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return l.Addr().String(), file
+}
+
+func TestListenerHandoff(t *testing.T) {
+	addr, file := listenFile(t)
+	extraAddr, extraFile := listenFile(t)
+	_, unusedFile := listenFile(t)
+
+	// The sockets are handed over by listener name, and one no longer
+	// configured is closed
+	fds, err := json.Marshal(map[string]int{
+		"tcp://" + addr:      3,
+		"extra":              4,
+		"tcp://127.0.0.1:99": 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startChild(t, []*os.File{file, extraFile, unusedFile}, []string{envListenFDs + "=" + string(fds)},
+		"-listen", "tcp://"+addr, "-listen", "tcp://"+extraAddr+"?name=extra")
+
+	for _, addr := range []string{addr, extraAddr} {
+		response := exchange(t, addr, "GET /echo/handoff HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+		if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+			t.Errorf("%s: %q", addr, got)
+		}
+	}
+}
+
+func TestSystemdActivation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// status for GET / and GET /echo/a on each socket
+		web, admin [2]string
+	}{
+		{
+			name:  "every socket",
+			web:   [2]string{"HTTP/1.1 200 OK", "HTTP/1.1 200 OK"},
+			admin: [2]string{"HTTP/1.1 200 OK", "HTTP/1.1 200 OK"},
+		},
+		{
+			// Sockets are named by LISTEN_FDNAMES or by index
+			name:  "listeners",
+			args:  []string{"-listen", "systemd://web", "-listen", "systemd://1?routes=/echo/"},
+			web:   [2]string{"HTTP/1.1 200 OK", "HTTP/1.1 200 OK"},
+			admin: [2]string{"HTTP/1.1 404 Not Found", "HTTP/1.1 200 OK"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webAddr, webFile := listenFile(t)
+			adminAddr, adminFile := listenFile(t)
+			startChild(t, []*os.File{webFile, adminFile},
+				[]string{envSystemdFDs + "=2", envSystemdFDNames + "=web:admin"}, tt.args...)
+
+			for _, socket := range []struct {
+				addr   string
+				status [2]string
+			}{{webAddr, tt.web}, {adminAddr, tt.admin}} {
+				for i, path := range []string{"/", "/echo/a"} {
+					response := exchange(t, socket.addr, "GET "+path+" HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+					if got := statusLine(response); got != socket.status[i] {
+						t.Errorf("%s %s: %q, want %q", socket.addr, path, got, socket.status[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSystemdSocketsForOtherProcess(t *testing.T) {
+	// The variables are cleared even when they are meant for another
+	// process, so they aren't passed on to children
+	t.Setenv(envSystemdPID, "1")
+	t.Setenv(envSystemdFDs, "2")
+	t.Setenv(envSystemdFDNames, "web:admin")
+	files, err := systemdSockets()
+	if err != nil || files != nil {
+		t.Errorf("systemdSockets = %v, %v; want none", files, err)
+	}
+	for _, name := range []string{envSystemdPID, envSystemdFDs, envSystemdFDNames} {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s left set", name)
+		}
+	}
+
+	t.Setenv(envSystemdPID, strconv.Itoa(os.Getpid()))
+	t.Setenv(envSystemdFDs, "x")
+	if _, err := systemdSockets(); err == nil {
+		t.Errorf("%s=x: no error", envSystemdFDs)
+	}
+}
+
+func TestInheritedListenersErrors(t *testing.T) {
+	for _, value := range []string{
+		"not json",
+		`["tcp://127.0.0.1:4221"]`,
+		`{"tcp://127.0.0.1:4221": "3"}`,
+		`{"tcp://127.0.0.1:4221": 2}`,
+		`{"tcp://127.0.0.1:4221": -1}`,
+	} {
+		t.Setenv(envListenFDs, value)
+		if files, err := inheritedListeners(); err == nil {
+			t.Errorf("%s=%s: got %v, want an error", envListenFDs, value, files)
+		}
+		// The variable is cleared either way
+		if _, ok := os.LookupEnv(envListenFDs); ok {
+			t.Errorf("%s=%s left set", envListenFDs, value)
+		}
+	}
+}
+
+func TestNotifyReadyErrors(t *testing.T) {
+	for _, value := range []string{"x", "2", "-1"} {
+		t.Setenv(envReadyFD, value)
+		if err := NotifyReady(); err == nil {
+			t.Errorf("%s=%s: no error", envReadyFD, value)
+		}
+	}
+
+	// Without a parent waiting there is nothing to do
+	os.Unsetenv(envReadyFD)
+	if err := NotifyReady(); err != nil {
+		t.Errorf("NotifyReady without a parent = %v", err)
+	}
+}
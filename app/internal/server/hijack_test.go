@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/handlers"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// hijacked is a connection a test handler took with Hijack
+type hijacked struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+func TestHijack(t *testing.T) {
+	srv, addr := startServer(t, "-max-conns", "1")
+	taken := make(chan hijacked, 1)
+	fallback := handlers.New(srv.Config())
+	setHandler(srv, func(w *http.ResponseWriter, request *http.Request) {
+		if request.Path != "/raw" {
+			fallback.HandleRequest(w, request)
+			return
+		}
+		conn, rw, err := w.Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		taken <- hijacked{conn, rw}
+	})
+
+	client, r := dial(t, addr)
+	io.WriteString(client, "GET /raw HTTP/1.1\r\nHost: test\r\n\r\nafter the request")
+	var h hijacked
+	select {
+	case h = <-taken:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not run")
+	}
+	defer h.conn.Close()
+
+	// The server no longer tracks or counts the connection, so another
+	// fits under -max-conns 1
+	waitUntil(t, "the connection to be released", func() bool {
+		srv.mu.Lock()
+		tracked := len(srv.conns)
+		srv.mu.Unlock()
+		total, perIP := srv.limiter.counts()
+		return tracked == 0 && total == 0 && len(perIP) == 0
+	})
+	response := exchange(t, addr, "GET /echo/a HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("second connection: %q", got)
+	}
+
+	// Bytes sent after the request are the handler's to read, and the
+	// server writes no response of its own
+	buf := make([]byte, len("after the request"))
+	if _, err := io.ReadFull(h.rw, buf); err != nil || string(buf) != "after the request" {
+		t.Errorf("handler read %q, %v", buf, err)
+	}
+	h.rw.WriteString("raw bytes")
+	h.rw.Flush()
+	buf = make([]byte, len("raw bytes"))
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "raw bytes" {
+		t.Errorf("client read %q, %v", buf, err)
+	}
+
+	// Shutdown neither waits for nor closes it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	if _, err := io.WriteString(h.conn, "still open"); err != nil {
+		t.Errorf("writing after Shutdown: %v", err)
+	}
+	buf = make([]byte, len("still open"))
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != "still open" {
+		t.Errorf("client read %q, %v after Shutdown", buf, err)
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2"
+)
+
+// serveHTTP2 serves a connection that has switched to HTTP/2, by ALPN,
+// prior knowledge or an h2c upgrade. For an upgrade, request is the
+// upgrading request and settings the client's decoded HTTP2-Settings.
+func (s *Server) serveHTTP2(raw, conn net.Conn, reader *bufio.Reader, listener *Listener, request *http.Request, settings []byte) {
+	cfg := s.Config()
+	proxy := proxyHeader(conn)
+	addr := remoteAddr(conn)
+
+	h2 := &http2.Server{
+		Handler: func(stream http.ResponseStream, request *http.Request) {
+			request.Proxy = proxy
+			request.RemoteAddr = addr
+			s.serveStream(listener, stream, request)
+		},
+		IdleTimeout:        idleTimeout(cfg),
+		WriteTimeout:       cfg.WriteTimeout,
+		MaxRequestBodySize: cfg.MaxRequestBodySize,
+	}
+
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
+	s.trackConn(raw, stateIdle)
+	err := h2.ServeConn(conn, http2.ServeConnOpts{
+		Context:         s.baseCtx,
+		Reader:          reader,
+		TLS:             tlsState,
+		Upgrade:         request,
+		UpgradeSettings: settings,
+		Shutdown:        s.shutdownCh,
+		StateHook: func(active bool) {
+			if active {
+				s.trackConn(raw, stateActive)
+			} else {
+				s.trackConn(raw, stateIdle)
+			}
+		},
+	})
+	if err != nil {
+		log.Printf("HTTP/2 connection from %s ended: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// serveStream handles one HTTP/2 or HTTP/3 request the way
+// handleConnection handles an HTTP/1 one
+func (s *Server) serveStream(listener *Listener, stream http.ResponseStream, request *http.Request) {
+	st := s.current()
+
+	request, cancel := withRequestContext(request.Context(), request)
+	defer cancel()
+
+	w := http.NewStreamResponseWriter(stream, request, st.config.ServerName)
+	w.Header().Set(http.HeaderRequestID, http.RequestIDFrom(request.Context()))
+	if listener.altSvc != "" && request.ProtoMajor < 3 {
+		w.Header().Set(http.HeaderAltSvc, listener.altSvc)
+	}
+
+	s.serveRequest(st, listener.Config, w, request)
+
+	if err := w.Finish(); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// hasHTTP2Preface reports whether the connection starts with the HTTP/2
+// client preface. It only waits for more bytes while those seen so far
+// match, so short HTTP/1 requests are not held up.
+func hasHTTP2Preface(reader *bufio.Reader) bool {
+	for n := 1; n <= len(http2.ClientPreface); n++ {
+		peeked, err := reader.Peek(n)
+		if err != nil || peeked[n-1] != http2.ClientPreface[n-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// h2cSettings returns the decoded HTTP2-Settings of a request asking to
+// upgrade to cleartext HTTP/2, and whether it is such a request
+func h2cSettings(request *http.Request) ([]byte, bool) {
+	if !request.IsUpgrade("h2c") {
+		return nil, false
+	}
+
+	value, ok := request.Headers[http.HeaderHTTP2Settings]
+	if !ok || !hasConnectionOption(request, http.HeaderHTTP2Settings) {
+		return nil, false
+	}
+
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, false
+	}
+	return settings, true
+}
+
+// hasConnectionOption reports whether the Connection field lists option
+func hasConnectionOption(request *http.Request, option string) bool {
+	for _, part := range strings.Split(request.Headers[http.HeaderConnection], ",") {
+		if strings.EqualFold(strings.TrimSpace(part), option) {
+			return true
+		}
+	}
+	return false
+}
+
+// switchToH2C answers an h2c upgrade request with 101 Switching Protocols
+func switchToH2C(conn net.Conn, serverName string) error {
+	w := http.NewResponseWriter(conn, nil, serverName)
+	w.Header().Set(http.HeaderConnection, "Upgrade")
+	w.Header().Set(http.HeaderUpgrade, "h2c")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	return w.Finish()
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http3"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// altSvcMaxAge is how long clients may remember that HTTP/3 is available
+const altSvcMaxAge = 24 * 60 * 60
+
+// altSvc returns the Alt-Svc value advertising HTTP/3 on addr's port
+func altSvc(addr net.Addr) string {
+	port := 0
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		port = udp.Port
+	}
+	return http3.NextProto + `=":` + strconv.Itoa(port) + `"; ma=` + strconv.Itoa(altSvcMaxAge)
+}
+
+// newQUICTLSConfig derives the TLS settings for HTTP/3 from those of the
+// TCP listeners: QUIC always uses TLS 1.3 and negotiates only h3
+func newQUICTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	quicTLS := tlsConfig.Clone()
+	quicTLS.MinVersion = tls.VersionTLS13
+	quicTLS.NextProtos = []string{http3.NextProto}
+	return quicTLS
+}
+
+// quicTLSConfigForClient returns the HTTP/3 TLS settings current when a
+// handshake starts, so reloads apply to new connections
+func (s *Server) quicTLSConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tlsConfig := s.current().quicTLS
+	if tlsConfig == nil {
+		return nil, errors.New("HTTP/3 is not configured")
+	}
+	return tlsConfig, nil
+}
+
+// quicConfig returns the QUIC settings for HTTP/3 listeners
+func (s *Server) quicConfig() *quic.Config {
+	cfg := s.Config()
+	return &quic.Config{
+		TLSConfig:        &tls.Config{GetConfigForClient: s.quicTLSConfigForClient},
+		MaxIdleTimeout:   idleTimeout(cfg),
+		HandshakeTimeout: readHeaderTimeout(cfg),
+	}
+}
+
+// quicConn lets Shutdown close a QUIC connection like a TCP one
+type quicConn struct {
+	*quic.Conn
+}
+
+// Close closes the connection with H3_NO_ERROR
+func (c quicConn) Close() error {
+	return c.CloseWithError(uint64(http3.ErrCodeNo), "")
+}
+
+// acceptQUIC accepts HTTP/3 connections on one listener until shutdown
+func (s *Server) acceptQUIC(listener *Listener) {
+	for {
+		conn, err := listener.quic.Accept(s.baseCtx)
+		if err != nil {
+			if s.shuttingDown.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error accepting QUIC connection on %s: %v", listener.Config.Name, err)
+			continue
+		}
+
+		cfg := s.Config()
+		if limit := s.limiter.acquire(conn.RemoteAddr(), cfg.MaxConns, cfg.MaxConnsPerIP); limit != "" {
+			s.logRejection(conn.RemoteAddr(), limit)
+			conn.CloseWithError(uint64(http3.ErrCodeExcessiveLoad), "too many connections")
+			continue
+		}
+
+		s.trackConn(quicConn{conn}, stateIdle)
+		go s.serveHTTP3(conn, listener)
+	}
+}
+
+// serveHTTP3 serves an established QUIC connection
+func (s *Server) serveHTTP3(conn *quic.Conn, listener *Listener) {
+	tracked := quicConn{conn}
+	defer s.limiter.release(conn.RemoteAddr())
+	defer s.untrackConn(tracked)
+
+	// A panic in the protocol code only costs this connection
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.Connection, v, "HTTP/3 connection from %s", conn.RemoteAddr())
+			conn.CloseWithError(uint64(http3.ErrCodeInternal), "")
+		}
+	}()
+
+	cfg := s.Config()
+	h3 := &http3.Server{
+		Handler: func(stream http.ResponseStream, request *http.Request) {
+			request.RemoteAddr = conn.RemoteAddr().String()
+			s.serveStream(listener, stream, request)
+		},
+		WriteTimeout:       cfg.WriteTimeout,
+		MaxRequestBodySize: cfg.MaxRequestBodySize,
+	}
+
+	tlsState := conn.ConnectionState()
+	err := h3.ServeConn(conn, http3.ServeConnOpts{
+		Context:  s.baseCtx,
+		TLS:      &tlsState,
+		Shutdown: s.shutdownCh,
+		StateHook: func(active bool) {
+			if active {
+				s.trackConn(tracked, stateActive)
+			} else {
+				s.trackConn(tracked, stateIdle)
+			}
+		},
+	})
+	if err != nil {
+		log.Printf("HTTP/3 connection from %s ended: %v", conn.RemoteAddr(), err)
+	}
+}
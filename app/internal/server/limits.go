@@ -0,0 +1,210 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// limitRetryAfter is the Retry-After, in seconds, sent to connections
+// over a limit
+const limitRetryAfter = "1"
+
+// maxRejecting bounds how many connections over a limit are answered at
+// once; beyond it they are closed without a response
+const maxRejecting = 64
+
+// rejectTimeout limits answering a connection over a limit
+const rejectTimeout = time.Second
+
+// rejectDrainLimit is how much of a rejected client's request is read so
+// that closing the connection doesn't reset it before the 503 arrives
+const rejectDrainLimit = 64 << 10
+
+// Delays between retries when Accept fails, doubling from the minimum
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// connLimiter counts open connections, in total and per client IP
+type connLimiter struct {
+	mu    sync.Mutex
+	total int
+	perIP map[netip.Addr]int
+}
+
+// acquire counts a new connection from addr unless that would exceed
+// maxConns in total or maxPerIP from its IP, in which case it returns the
+// name of the limit. Zero limits are unlimited. Connections are counted
+// even without limits so that limits added by a reload apply at once.
+func (l *connLimiter) acquire(addr net.Addr, maxConns, maxPerIP int) string {
+	ip, hasIP := clientIP(addr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxConns > 0 && l.total >= maxConns {
+		return "max-conns"
+	}
+	if hasIP && maxPerIP > 0 && l.perIP[ip] >= maxPerIP {
+		return "max-conns-per-ip"
+	}
+
+	l.total++
+	if hasIP {
+		if l.perIP == nil {
+			l.perIP = make(map[netip.Addr]int)
+		}
+		l.perIP[ip]++
+	}
+	return ""
+}
+
+// move counts a connection counted as from addr as coming from addr to
+// instead, and returns the name of the limit it is now over, if any
+func (l *connLimiter) move(from, to net.Addr, maxPerIP int) string {
+	fromIP, fromHasIP := clientIP(from)
+	toIP, toHasIP := clientIP(to)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if fromHasIP {
+		if l.perIP[fromIP] <= 1 {
+			delete(l.perIP, fromIP)
+		} else {
+			l.perIP[fromIP]--
+		}
+	}
+	if !toHasIP {
+		return ""
+	}
+	if l.perIP == nil {
+		l.perIP = make(map[netip.Addr]int)
+	}
+	l.perIP[toIP]++
+	if maxPerIP > 0 && l.perIP[toIP] > maxPerIP {
+		return "max-conns-per-ip"
+	}
+	return ""
+}
+
+// release stops counting a connection from addr
+func (l *connLimiter) release(addr net.Addr) {
+	ip, hasIP := clientIP(addr)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if hasIP {
+		if l.perIP[ip] <= 1 {
+			delete(l.perIP, ip)
+		} else {
+			l.perIP[ip]--
+		}
+	}
+}
+
+// clientIP returns the IP address of a TCP or UDP peer; Unix socket peers
+// have none
+func clientIP(addr net.Addr) (netip.Addr, bool) {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	default:
+		return netip.Addr{}, false
+	}
+
+	parsed, ok := netip.AddrFromSlice(ip)
+	return parsed.Unmap(), ok
+}
+
+// admit counts a new TCP connection against the limits, rejecting it if
+// it is over one. A connection from a load balancer is held to the per-IP
+// limit only once its PROXY header names the client.
+func (s *Server) admit(conn net.Conn, lc config.Listener) bool {
+	cfg := s.Config()
+	maxPerIP := cfg.MaxConnsPerIP
+	if expectsProxyHeader(lc, cfg, conn) {
+		maxPerIP = 0
+	}
+	limit := s.limiter.acquire(conn.RemoteAddr(), cfg.MaxConns, maxPerIP)
+	if limit == "" {
+		return true
+	}
+
+	s.logRejection(conn.RemoteAddr(), limit)
+	s.reject(conn, lc)
+	return false
+}
+
+// reject answers a connection over a limit with a 503 and closes it.
+// Plaintext connections get the response at once, without their request
+// being read; TLS connections are closed, since a handshake is too costly
+// to spend on them.
+func (s *Server) reject(conn net.Conn, lc config.Listener) {
+	if lc.TLS || s.rejecting.Add(1) > maxRejecting {
+		if !lc.TLS {
+			s.rejecting.Add(-1)
+		}
+		conn.Close()
+		return
+	}
+
+	go func() {
+		defer s.rejecting.Add(-1)
+		defer conn.Close()
+
+		conn.SetDeadline(time.Now().Add(rejectTimeout))
+		w := http.NewResponseWriter(conn, nil, s.Config().ServerName)
+		w.Header().Set(http.HeaderRetryAfter, limitRetryAfter)
+		w.Header().Set(http.HeaderContentLength, "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if err := w.Finish(); err != nil {
+			return
+		}
+
+		// Closing with unread data would reset the connection and could
+		// discard the response before the client reads it
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		io.Copy(io.Discard, io.LimitReader(conn, rejectDrainLimit))
+	}()
+}
+
+// logRejection logs a connection rejected by a limit, at most once a
+// second so a flood doesn't flood the log too
+func (s *Server) logRejection(addr net.Addr, limit string) {
+	now := time.Now().Unix()
+	last := s.rejectionLogged.Load()
+	if last != now && s.rejectionLogged.CompareAndSwap(last, now) {
+		log.Printf("Rejecting connections over the %s limit, such as from %s", limit, addr)
+	}
+}
+
+// acceptBackoff returns how long to wait after a failed Accept, given the
+// previous wait
+func acceptBackoff(previous time.Duration) time.Duration {
+	if previous == 0 {
+		return minAcceptBackoff
+	}
+	return min(previous*2, maxAcceptBackoff)
+}
+
+// isClosed reports whether err says the listener was closed
+func isClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpAddr returns a TCP address with port 1234
+func tcpAddr(ip string) net.Addr {
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(netip.MustParseAddr(ip), 1234))
+}
+
+// counts returns the limiter's total and per-IP counts
+func (l *connLimiter) counts() (int, map[netip.Addr]int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	perIP := make(map[netip.Addr]int, len(l.perIP))
+	for ip, n := range l.perIP {
+		perIP[ip] = n
+	}
+	return l.total, perIP
+}
+
+// expectCounts fails the test unless the limiter holds total connections,
+// perIP of them from each address given
+func expectCounts(t *testing.T, l *connLimiter, total int, perIP map[string]int) {
+	t.Helper()
+	gotTotal, gotPerIP := l.counts()
+	if gotTotal != total {
+		t.Errorf("total %d, want %d", gotTotal, total)
+	}
+	if len(gotPerIP) != len(perIP) {
+		t.Errorf("per-IP counts %v, want %v", gotPerIP, perIP)
+		return
+	}
+	for ip, n := range perIP {
+		if gotPerIP[netip.MustParseAddr(ip)] != n {
+			t.Errorf("per-IP counts %v, want %v", gotPerIP, perIP)
+			return
+		}
+	}
+}
+
+func TestConnLimiterGlobal(t *testing.T) {
+	var l connLimiter
+	a, b := tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2")
+	unix := &net.UnixAddr{Name: "/run/drizzle.sock", Net: "unix"}
+
+	for _, addr := range []net.Addr{a, b} {
+		if limit := l.acquire(addr, 3, 0); limit != "" {
+			t.Fatalf("acquire from %s over %s", addr, limit)
+		}
+	}
+	// Unix socket peers count towards the total only
+	if limit := l.acquire(unix, 3, 0); limit != "" {
+		t.Fatalf("acquire from a Unix socket over %s", limit)
+	}
+	expectCounts(t, &l, 3, map[string]int{"192.0.2.1": 1, "192.0.2.2": 1})
+
+	if limit := l.acquire(a, 3, 0); limit != "max-conns" {
+		t.Errorf("acquire over the limit = %q, want max-conns", limit)
+	}
+	if limit := l.acquire(unix, 3, 0); limit != "max-conns" {
+		t.Errorf("acquire from a Unix socket over the limit = %q, want max-conns", limit)
+	}
+	expectCounts(t, &l, 3, map[string]int{"192.0.2.1": 1, "192.0.2.2": 1})
+
+	l.release(unix)
+	if limit := l.acquire(a, 3, 0); limit != "" {
+		t.Errorf("acquire after a release over %s", limit)
+	}
+	expectCounts(t, &l, 3, map[string]int{"192.0.2.1": 2, "192.0.2.2": 1})
+
+	for _, addr := range []net.Addr{a, a, b} {
+		l.release(addr)
+	}
+	expectCounts(t, &l, 0, nil)
+}
+
+func TestConnLimiterPerIP(t *testing.T) {
+	var l connLimiter
+	a, b := tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2")
+	// An IPv4-mapped IPv6 address is the same client
+	mapped := tcpAddr("::ffff:192.0.2.1")
+
+	if limit := l.acquire(a, 0, 2); limit != "" {
+		t.Fatalf("first acquire over %s", limit)
+	}
+	if limit := l.acquire(mapped, 0, 2); limit != "" {
+		t.Fatalf("second acquire over %s", limit)
+	}
+	if limit := l.acquire(a, 0, 2); limit != "max-conns-per-ip" {
+		t.Errorf("third acquire = %q, want max-conns-per-ip", limit)
+	}
+	if limit := l.acquire(b, 0, 2); limit != "" {
+		t.Errorf("acquire from another IP over %s", limit)
+	}
+	expectCounts(t, &l, 3, map[string]int{"192.0.2.1": 2, "192.0.2.2": 1})
+
+	// A limit lowered by a reload applies to new connections at once
+	if limit := l.acquire(b, 0, 1); limit != "max-conns-per-ip" {
+		t.Errorf("acquire under a lower limit = %q, want max-conns-per-ip", limit)
+	}
+
+	l.release(mapped)
+	if limit := l.acquire(a, 0, 2); limit != "" {
+		t.Errorf("acquire after a release over %s", limit)
+	}
+	for _, addr := range []net.Addr{a, a, b} {
+		l.release(addr)
+	}
+	expectCounts(t, &l, 0, nil)
+}
+
+func TestConnLimiterMove(t *testing.T) {
+	var l connLimiter
+	balancer := tcpAddr("10.0.0.1")
+	client, other := tcpAddr("192.0.2.1"), tcpAddr("192.0.2.2")
+
+	// Connections from a load balancer are admitted without a per-IP limit
+	// and held to it once the PROXY header names the client
+	for range 3 {
+		if limit := l.acquire(balancer, 0, 0); limit != "" {
+			t.Fatalf("acquire from the balancer over %s", limit)
+		}
+	}
+	expectCounts(t, &l, 3, map[string]int{"10.0.0.1": 3})
+
+	if limit := l.move(balancer, client, 1); limit != "" {
+		t.Errorf("first move over %s", limit)
+	}
+	if limit := l.move(balancer, client, 1); limit != "max-conns-per-ip" {
+		t.Errorf("second move = %q, want max-conns-per-ip", limit)
+	}
+	if limit := l.move(balancer, other, 1); limit != "" {
+		t.Errorf("move to another client over %s", limit)
+	}
+	// A connection over the limit is counted as the client's until it is
+	// released, which is what the caller does next
+	expectCounts(t, &l, 3, map[string]int{"192.0.2.1": 2, "192.0.2.2": 1})
+
+	l.release(client)
+	l.release(client)
+	l.release(other)
+	expectCounts(t, &l, 0, nil)
+
+	// A PROXY header without an address, such as from a Unix socket,
+	// leaves the connection counted in the total only
+	l.acquire(balancer, 0, 0)
+	unix := &net.UnixAddr{Name: "@", Net: "unix"}
+	if limit := l.move(balancer, unix, 1); limit != "" {
+		t.Errorf("move to a Unix socket over %s", limit)
+	}
+	expectCounts(t, &l, 1, nil)
+	l.release(unix)
+	expectCounts(t, &l, 0, nil)
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	want := []time.Duration{
+		5 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond,
+		80 * time.Millisecond, 160 * time.Millisecond, 320 * time.Millisecond, 640 * time.Millisecond,
+		time.Second, time.Second,
+	}
+	var backoff time.Duration
+	for i, w := range want {
+		if backoff = acceptBackoff(backoff); backoff != w {
+			t.Errorf("retry %d: backoff %v, want %v", i+1, backoff, w)
+		}
+	}
+}
+
+func TestConnLimitResponse(t *testing.T) {
+	srv, addr := startServer(t, "-max-conns", "1")
+
+	// The first connection is admitted and stays open
+	conn, r := dial(t, addr)
+	io.WriteString(conn, "GET /echo/a HTTP/1.1\r\nHost: test\r\n\r\n")
+	if resp := readResponse(t, r); resp.status != "HTTP/1.1 200 OK" {
+		t.Fatalf("first connection: %q", resp.status)
+	}
+
+	// The next gets a 503 without its request being read
+	rejected := exchange(t, addr, "")
+	if got := statusLine(rejected); got != "HTTP/1.1 503 Service Unavailable" {
+		t.Errorf("second connection: %q", got)
+	}
+	if !strings.Contains(rejected, "\r\nRetry-After: 1\r\n") {
+		t.Errorf("no Retry-After in %q", rejected)
+	}
+
+	// Closing the first frees its slot
+	conn.Close()
+	waitUntil(t, "the first connection to be released", func() bool {
+		total, _ := srv.limiter.counts()
+		return total == 0
+	})
+	response := exchange(t, addr, "GET /echo/b HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("after the first closed: %q", got)
+	}
+}
+
+func TestConnLimitPerIPWithProxyHeader(t *testing.T) {
+	srv, addr := startServer(t, "-max-conns-per-ip", "1", "-proxy-protocol", "-proxy-protocol-trusted", "127.0.0.1")
+	proxied := func(client, request string) string {
+		return "PROXY TCP4 " + client + " 192.0.2.100 5000 80\r\n" + request
+	}
+
+	// Every connection comes from 127.0.0.1, but only those from the same
+	// client count against each other
+	conn, r := dial(t, addr)
+	io.WriteString(conn, proxied("192.0.2.1", "GET /echo/a HTTP/1.1\r\nHost: test\r\n\r\n"))
+	if resp := readResponse(t, r); resp.status != "HTTP/1.1 200 OK" {
+		t.Fatalf("first connection: %q", resp.status)
+	}
+
+	response := exchange(t, addr, proxied("192.0.2.2", "GET /echo/b HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n"))
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("another client: %q", got)
+	}
+	response = exchange(t, addr, proxied("192.0.2.1", "GET /echo/c HTTP/1.1\r\nHost: test\r\n\r\n"))
+	if got := statusLine(response); got != "HTTP/1.1 503 Service Unavailable" {
+		t.Errorf("same client: %q", got)
+	}
+
+	// Nothing is left counted, under the balancer's address or the
+	// clients', once every connection is closed
+	conn.Close()
+	waitUntil(t, "every connection to be released", func() bool {
+		total, perIP := srv.limiter.counts()
+		return total == 0 && len(perIP) == 0
+	})
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
+)
+
+// Listener is a listening socket together with its per-listener settings
+type Listener struct {
+	net.Listener
+	Config config.Listener
+
+	// reusePort are further SO_REUSEPORT sockets on the same address,
+	// each accepted by a loop of its own
+	reusePort []net.Listener
+
+	// packetConn is the UDP socket serving HTTP/3 on the same port, or
+	// nil if HTTP/3 is not served; quic serves it once Serve starts
+	packetConn *net.UDPConn
+	quic       *quic.Listener
+
+	// altSvc advertises HTTP/3 in responses sent over TCP
+	altSvc string
+}
+
+// Close closes the listening socket and stops accepting HTTP/3
+// connections. Established HTTP/3 connections carry on until closed.
+func (l *Listener) Close() error {
+	err := l.Listener.Close()
+	for _, socket := range l.reusePort {
+		socket.Close()
+	}
+	if l.quic != nil {
+		l.quic.Close()
+	} else if l.packetConn != nil {
+		l.packetConn.Close()
+	}
+	return err
+}
+
+// sockets returns every listening socket of the listener
+func (l *Listener) sockets() []net.Listener {
+	return append([]net.Listener{l.Listener}, l.reusePort...)
+}
+
+// ListenAll opens every configured listener. Sockets handed over by a
+// parent process or passed in by systemd are reused; others are bound. If
+// no listeners are configured and systemd passed sockets, all of those are
+// used, as are the systemd sockets a parent handed over on a restart, and
+// otherwise a single TCP listener on the configured Address.
+func ListenAll(cfg *config.Config) ([]*Listener, error) {
+	inherited, err := inheritedListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	activated, err := systemdSockets()
+	if err != nil {
+		return nil, err
+	}
+
+	specs := cfg.EffectiveListeners()
+	if len(cfg.Listeners) == 0 {
+		if len(activated) > 0 {
+			specs = activated.listeners()
+		} else if handedOver := inheritedSystemdListeners(inherited); len(handedOver) > 0 {
+			specs = handedOver
+		}
+	}
+
+	listeners := make([]*Listener, 0, len(specs))
+	for _, spec := range specs {
+		l, err := listen(spec, inherited, activated, cfg.Sockets)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listener := &Listener{Listener: l, Config: spec}
+		listeners = append(listeners, listener)
+
+		// Further SO_REUSEPORT sockets bind the address the first one got,
+		// which matters for port 0
+		if spec.Network == config.NetworkTCP {
+			for i := 1; i < cfg.Sockets.ReusePort; i++ {
+				socket, err := listenReusePort(spec, i, l.Addr().String(), inherited, cfg.Sockets)
+				if err != nil {
+					closeListeners(listeners)
+					return nil, err
+				}
+				listener.reusePort = append(listener.reusePort, socket)
+			}
+		}
+
+		// HTTP/3 runs on the UDP port matching a TLS listener's TCP port
+		if addr, ok := l.Addr().(*net.TCPAddr); ok && cfg.HTTP3 && spec.TLS {
+			listener.packetConn, err = listenQUIC(spec, addr, inherited)
+			if err != nil {
+				closeListeners(listeners)
+				return nil, err
+			}
+		}
+	}
+
+	// Anything handed over but no longer configured is not needed
+	for name, file := range inherited {
+		log.Printf("Closing inherited listener %s, it is no longer configured", name)
+		file.Close()
+	}
+
+	return listeners, nil
+}
+
+// inheritedSystemdListeners returns a listener spec for every socket
+// activated by systemd that a parent process handed over. systemd's
+// environment is only meant for the process it started, so a restarted
+// child learns of the sockets from their names alone.
+func inheritedSystemdListeners(inherited map[string]*os.File) []config.Listener {
+	var specs []config.Listener
+	for name := range inherited {
+		socket, ok := strings.CutPrefix(name, config.NetworkSystemd+"://")
+		if !ok {
+			continue
+		}
+		specs = append(specs, config.Listener{
+			Name:    name,
+			Network: config.NetworkSystemd,
+			Address: socket,
+		})
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// listen opens a single listener
+func listen(spec config.Listener, inherited map[string]*os.File, activated systemdFiles, opts config.SocketOptions) (net.Listener, error) {
+	if file, ok := inherited[spec.Name]; ok {
+		delete(inherited, spec.Name)
+		return fileListener(file, spec)
+	}
+
+	switch spec.Network {
+	case config.NetworkTCP:
+		return listenTCP(spec.Address, opts)
+
+	case config.NetworkUnix:
+		return listenUnix(spec)
+
+	case config.NetworkSystemd:
+		file, ok := activated.lookup(spec.Address)
+		if !ok {
+			return nil, fmt.Errorf("listener %s: no socket %q passed by systemd", spec.Name, spec.Address)
+		}
+		return fileListener(file, spec)
+	}
+
+	return nil, fmt.Errorf("listener %s: unknown network %q", spec.Name, spec.Network)
+}
+
+// listenReusePort opens the i-th extra SO_REUSEPORT socket of a TCP
+// listener on address, reusing one handed over by a parent process
+func listenReusePort(spec config.Listener, i int, address string, inherited map[string]*os.File, opts config.SocketOptions) (net.Listener, error) {
+	name := reusePortName(spec.Name, i)
+	if file, ok := inherited[name]; ok {
+		delete(inherited, name)
+		return fileListener(file, spec)
+	}
+	return listenTCP(address, opts)
+}
+
+// listenQUIC opens the UDP socket for HTTP/3 on a TLS listener's address,
+// reusing one handed over by a parent process
+func listenQUIC(spec config.Listener, addr *net.TCPAddr, inherited map[string]*os.File) (*net.UDPConn, error) {
+	name := quicListenerName(spec.Name)
+	if file, ok := inherited[name]; ok {
+		delete(inherited, name)
+		defer file.Close()
+
+		conn, err := net.FilePacketConn(file)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: cannot use inherited QUIC socket: %v", spec.Name, err)
+		}
+		udp, ok := conn.(*net.UDPConn)
+		if !ok {
+			conn.Close()
+			return nil, fmt.Errorf("listener %s: inherited QUIC socket is not UDP", spec.Name)
+		}
+		return udp, nil
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone})
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to UDP %s for HTTP/3: %v", addr, err)
+	}
+	return udp, nil
+}
+
+// quicListenerName is the name a listener's UDP socket is handed over
+// under on restart
+func quicListenerName(name string) string {
+	return "quic:" + name
+}
+
+// fileListener turns an inherited descriptor into a listener
+func fileListener(file *os.File, spec config.Listener) (net.Listener, error) {
+	defer file.Close()
+
+	l, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("listener %s: cannot use inherited socket: %v", spec.Name, err)
+	}
+	return l, nil
+}
+
+// listenUnix binds a Unix domain socket, replacing a stale socket file left
+// by a process that is no longer running, and applies the configured mode
+func listenUnix(spec config.Listener) (net.Listener, error) {
+	if info, err := os.Lstat(spec.Address); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", spec.Address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("listener %s: socket %s is in use", spec.Name, spec.Address)
+		}
+		os.Remove(spec.Address)
+	}
+
+	l, err := net.Listen("unix", spec.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to %s: %v", spec.Address, err)
+	}
+
+	if spec.Mode != 0 {
+		if err := os.Chmod(spec.Address, spec.Mode); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("listener %s: %w", spec.Name, err)
+		}
+	}
+
+	return l, nil
+}
+
+// closeListeners closes listeners opened so far after a failure
+func closeListeners(listeners []*Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// errNoFile is returned for listeners that cannot be handed over
+var errNoFile = errors.New("listener does not support handoff")
+
+// listenerFile duplicates a listener's or UDP socket's descriptor for a
+// child process
+func listenerFile(l any) (*os.File, error) {
+	filer, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, errNoFile
+	}
+	return filer.File()
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenerRoutes(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "drizzle.sock")
+	_, addrs := startListeners(t,
+		"-listen", "tcp://127.0.0.1:0?name=public",
+		"-listen", "tcp://127.0.0.1:0?name=internal&routes=/echo/,/user-agent",
+		"-listen", "unix://"+socket+"?mode=0600&routes=/echo/",
+	)
+	addrs[2] = socket
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("socket mode %04o, want 0600", mode)
+	}
+
+	tests := []struct {
+		listener int
+		path     string
+		status   string
+	}{
+		{0, "/", "HTTP/1.1 200 OK"},
+		{0, "/echo/a", "HTTP/1.1 200 OK"},
+		{1, "/echo/a", "HTTP/1.1 200 OK"},
+		{1, "/user-agent", "HTTP/1.1 200 OK"},
+		{1, "/", "HTTP/1.1 404 Not Found"},
+		{1, "/files/a", "HTTP/1.1 404 Not Found"},
+		{2, "/echo/a", "HTTP/1.1 200 OK"},
+		{2, "/user-agent", "HTTP/1.1 404 Not Found"},
+	}
+	for _, tt := range tests {
+		network := "tcp"
+		if tt.listener == 2 {
+			network = "unix"
+		}
+		response := exchangeOn(t, network, addrs[tt.listener], "GET "+tt.path+" HTTP/1.1\r\nHost: test\r\nUser-Agent: test\r\nConnection: close\r\n\r\n")
+		if got := statusLine(response); got != tt.status {
+			t.Errorf("listener %d, %s: %q, want %q", tt.listener, tt.path, got, tt.status)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/proxyproto"
+)
+
+// proxyConn is a connection that started with a PROXY header. It reports
+// the addresses from the header rather than the load balancer's, so the
+// client's address shows up in logs and hijacked connections.
+type proxyConn struct {
+	net.Conn
+	header *proxyproto.Header
+}
+
+// RemoteAddr returns the client's address
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// expectsProxyHeader reports whether a connection must start with a PROXY
+// header: it arrived on a PROXY protocol listener from a trusted load
+// balancer, or over a Unix socket, where the file mode decides who may
+// connect. Other connections are served as they are.
+func expectsProxyHeader(lc config.Listener, cfg *config.Config, raw net.Conn) bool {
+	if !lc.ProxyProtocol {
+		return false
+	}
+	ip, ok := clientIP(raw.RemoteAddr())
+	if !ok {
+		return true
+	}
+	return cfg.ProxyProtocolTrusted.Contains(ip)
+}
+
+// readProxyHeader reads the PROXY header a connection starts with, within
+// the read header timeout, and returns the connection reporting its
+// addresses
+func (s *Server) readProxyHeader(raw net.Conn) (net.Conn, error) {
+	raw.SetReadDeadline(deadline(time.Now(), readHeaderTimeout(s.Config())))
+	header, err := proxyproto.Read(raw)
+	raw.SetReadDeadline(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: raw, header: header}, nil
+}
+
+// proxyHeader returns the PROXY header of a connection, possibly TLS over
+// a proxyConn, or nil if it had none
+func proxyHeader(conn net.Conn) *proxyproto.Header {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	if pc, ok := conn.(*proxyConn); ok {
+		return pc.header
+	}
+	return nil
+}
+
+// remoteAddr returns the address of a connection's peer as a string, or
+// "" if it has none
+func remoteAddr(conn net.Conn) string {
+	if addr := conn.RemoteAddr(); addr != nil {
+		return addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"log"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// runHandler runs the handler for a request. A panic is recovered so it
+// only costs its own request: the stack is logged with the request ID and
+// the response aborted with a 500, which closes the connection or resets
+// the stream if the header was already sent.
+func runHandler(st *state, w *http.ResponseWriter, request *http.Request) {
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		panics.Report(panics.Handler, v, "%s %s (request %s)",
+			request.Method, request.Path, http.RequestIDFrom(request.Context()))
+		if err := w.Abort(http.StatusInternalServerError); err != nil {
+			log.Printf("Error writing panic response: %v", err)
+		}
+	}()
+
+	st.handlers.HandleRequest(w, request)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/handlers"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+)
+
+// handlerPanics returns how many handler panics have been counted
+func handlerPanics() int64 {
+	count, _ := expvar.Get("panics").(*expvar.Map).Get(panics.Handler).(*expvar.Int)
+	if count == nil {
+		return 0
+	}
+	return count.Value()
+}
+
+func TestHandlerPanic(t *testing.T) {
+	srv, addr := startServer(t, "-admin-token", testAdminToken)
+	fallback := handlers.New(srv.Config())
+	setHandler(srv, func(w *http.ResponseWriter, request *http.Request) {
+		switch request.Path {
+		case "/panic":
+			panic("test panic")
+		case "/panic-after-header":
+			w.Header().Set(http.HeaderContentLength, "10")
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("part"))
+			w.Flush()
+			panic("test panic")
+		default:
+			fallback.HandleRequest(w, request)
+		}
+	})
+	before := handlerPanics()
+
+	// A panic before the header is sent becomes a 500, and the
+	// connection is closed even though the client asked to keep it
+	conn, r := dial(t, addr)
+	io.WriteString(conn, "GET /panic HTTP/1.1\r\nHost: test\r\n\r\n")
+	resp := readResponse(t, r)
+	if resp.status != "HTTP/1.1 500 Internal Server Error" {
+		t.Errorf("status %q, want a 500", resp.status)
+	}
+	expectClosed(t, conn)
+
+	// After the header, the response is cut short by closing the
+	// connection
+	response := exchange(t, addr, "GET /panic-after-header HTTP/1.1\r\nHost: test\r\n\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("status %q after the header", got)
+	}
+	if _, body, _ := strings.Cut(response, "\r\n\r\n"); body != "part" {
+		t.Errorf("body %q, want the part written before the panic", body)
+	}
+
+	// Only the request is lost
+	response = exchange(t, addr, "GET /echo/ok HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("request after the panics: %q", got)
+	}
+
+	if got := handlerPanics() - before; got != 2 {
+		t.Errorf("counted %d handler panics, want 2", got)
+	}
+
+	// The count is served with the other expvar variables
+	conn, r = dial(t, addr)
+	io.WriteString(conn, "GET /admin/metrics HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer "+testAdminToken+"\r\n\r\n")
+	resp = readResponse(t, r)
+	var metrics struct {
+		Panics map[string]int64 `json:"panics"`
+	}
+	if err := json.Unmarshal([]byte(resp.body), &metrics); err != nil {
+		t.Fatalf("metrics %q: %v", resp.body, err)
+	}
+	if got := metrics.Panics[panics.Handler]; got != handlerPanics() {
+		t.Errorf("metrics report %d handler panics, want %d", got, handlerPanics())
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/handlers"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// handler serves requests; it is a *handlers.Handlers except in tests
+type handler interface {
+	HandleRequest(w *http.ResponseWriter, request *http.Request)
+}
+
+// state is a configuration together with the handlers built from it.
+// Requests hold on to the state they started with, so a reload only
+// affects requests that arrive after it.
+type state struct {
+	config   *config.Config
+	handlers handler
+
+	// tls is nil unless certificates are configured
+	tls *tls.Config
+
+	// quicTLS is the variant of tls for HTTP/3, nil unless it is enabled
+	quicTLS *tls.Config
+}
+
+// newState builds the handlers and TLS settings for a configuration
+func (s *Server) newState(cfg *config.Config) (*state, error) {
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	h := handlers.New(cfg)
+	h.SetReloadFunc(s.ReloadConfig)
+
+	st := &state{config: cfg, handlers: h, tls: tlsConfig}
+	if tlsConfig != nil && cfg.HTTP3 {
+		st.quicTLS = newQUICTLSConfig(tlsConfig)
+	}
+	return st, nil
+}
+
+// current returns the state for new requests
+func (s *Server) current() *state {
+	return s.state.Load()
+}
+
+// Config returns the configuration in effect for new requests
+func (s *Server) Config() *config.Config {
+	return s.current().config
+}
+
+// Reload validates cfg and swaps it in for new requests. In-flight requests
+// finish on the configuration they started with. The listening address and
+// listeners cannot change without a restart, so they are kept.
+func (s *Server) Reload(cfg *config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	old := s.current().config
+	if cfg.Address != old.Address {
+		log.Printf("Address change to %s needs a restart, still listening on %s", cfg.Address, old.Address)
+		cfg.Address = old.Address
+	}
+	if strings.Join(cfg.Listeners.Values(), " ") != strings.Join(old.Listeners.Values(), " ") {
+		log.Printf("Listener changes need a restart, keeping the current listeners")
+		cfg.Listeners = old.Listeners
+	}
+	if cfg.HTTP3 != old.HTTP3 {
+		log.Printf("Turning HTTP/3 on or off needs a restart, keeping http3=%t", old.HTTP3)
+		cfg.HTTP3 = old.HTTP3
+	}
+	// Keepalive and TCP_NODELAY apply to new connections; the other
+	// socket options are set on the listening sockets
+	sockets := old.Sockets
+	sockets.TCPKeepAlive, sockets.TCPNoDelay = cfg.Sockets.TCPKeepAlive, cfg.Sockets.TCPNoDelay
+	if cfg.Sockets != sockets {
+		log.Printf("Listening socket option changes need a restart, keeping the current ones")
+		cfg.Sockets = sockets
+	}
+	if cfg.Engine != old.Engine || cfg.Workers != old.Workers {
+		log.Printf("Connection engine changes need a restart, keeping engine=%s workers=%d", old.Engine, old.Workers)
+		cfg.Engine, cfg.Workers = old.Engine, old.Workers
+	}
+	if !cfg.TLSEnabled() && s.servesTLS() {
+		return errors.New("TLS listeners need certificates until restarted")
+	}
+
+	st, err := s.newState(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.state.Store(st)
+	return nil
+}
+
+// servesTLS reports whether any listener serves TLS
+func (s *Server) servesTLS() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, listener := range s.listeners {
+		if listener.Config.TLS {
+			return true
+		}
+	}
+	return false
+}
+
+// ReloadConfig reads the configuration again from its sources and applies
+// it. On failure the error is logged and the old configuration stays.
+func (s *Server) ReloadConfig() error {
+	cfg, err := config.Load()
+	if err == nil {
+		err = s.Reload(cfg)
+	}
+	if err != nil {
+		log.Printf("Configuration reload failed, keeping the current configuration: %v", err)
+		return fmt.Errorf("reload failed: %w", err)
+	}
+
+	log.Printf("Configuration reloaded")
+	return nil
+}
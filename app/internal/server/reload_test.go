@@ -0,0 +1,117 @@
+package server
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// loadConfig parses args as command-line flags
+func loadConfig(t *testing.T, args ...string) *config.Config {
+	t.Helper()
+	cfg, err := config.LoadArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// uploadHead is the head of a POST with a body of n bytes
+func uploadHead(n int) string {
+	return "POST /files/a HTTP/1.1\r\nHost: test\r\nConnection: close\r\nContent-Length: " + strconv.Itoa(n) + "\r\n\r\n"
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	srv, addr := startServer(t, "-directory", dir, "-max-request-body", "16")
+	body := strings.Repeat("x", 100)
+
+	response := exchange(t, addr, uploadHead(100)+body)
+	if got := statusLine(response); got != "HTTP/1.1 413 Content Too Large" {
+		t.Fatalf("before the reload: %q", got)
+	}
+
+	if err := srv.Reload(loadConfig(t, "-directory", dir, "-max-request-body", "1000")); err != nil {
+		t.Fatal(err)
+	}
+	response = exchange(t, addr, uploadHead(100)+body)
+	if got := statusLine(response); got != "HTTP/1.1 201 Created" {
+		t.Errorf("after the reload: %q", got)
+	}
+}
+
+func TestReloadInFlight(t *testing.T) {
+	dir := t.TempDir()
+	srv, addr := startServer(t, "-directory", dir, "-max-request-body", "1000")
+
+	// A request runs on the configuration current when it arrived, which
+	// is fixed by the time its connection is active, though a reload
+	// lowers the limit before its body arrives
+	conn, r := dial(t, addr)
+	io.WriteString(conn, uploadHead(100))
+	waitUntil(t, "the request to be read", func() bool {
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		for _, state := range srv.conns {
+			if state == stateActive {
+				return true
+			}
+		}
+		return false
+	})
+
+	if err := srv.Reload(loadConfig(t, "-directory", dir, "-max-request-body", "16")); err != nil {
+		t.Fatal(err)
+	}
+	response := exchange(t, addr, uploadHead(100)+strings.Repeat("x", 100))
+	if got := statusLine(response); got != "HTTP/1.1 413 Content Too Large" {
+		t.Errorf("new request: %q", got)
+	}
+
+	io.WriteString(conn, strings.Repeat("x", 100))
+	if resp := readResponse(t, r); resp.status != "HTTP/1.1 201 Created" {
+		t.Errorf("request in flight: %q", resp.status)
+	}
+}
+
+func TestReloadKeepsRestartSettings(t *testing.T) {
+	srv, _ := startServer(t)
+	old := srv.Config()
+
+	cfg := loadConfig(t, "-address", "127.0.0.1:1", "-workers", "3", "-server-name", "reloaded")
+	if err := srv.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := srv.Config()
+	if got != cfg {
+		t.Fatal("Reload did not swap the configuration")
+	}
+	if got.ServerName != "reloaded" {
+		t.Errorf("server name %q, want the reloaded one", got.ServerName)
+	}
+	// Settings that need a restart keep their old values
+	if got.Address != old.Address {
+		t.Errorf("address %q, want %q", got.Address, old.Address)
+	}
+	if got.Workers != old.Workers {
+		t.Errorf("workers %d, want %d", got.Workers, old.Workers)
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	srv, _ := startServer(t)
+	old := srv.current()
+
+	cfg := loadConfig(t)
+	cfg.MaxRequestBodySize = 0
+	if err := srv.Reload(cfg); err == nil {
+		t.Error("invalid configuration accepted")
+	}
+	if srv.current() != old {
+		t.Error("state swapped after a failed reload")
+	}
+}
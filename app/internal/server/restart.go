@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// Environment variables used to hand the listening sockets to a new process
+const (
+	// envListenFDs maps listener names to inherited descriptors in the
+	// child, as a JSON object
+	envListenFDs = "DRIZZLE_LISTEN_FDS"
+
+	// envReadyFD names the pipe the child writes to once it is serving
+	envReadyFD = "DRIZZLE_READY_FD"
+)
+
+// restartReadyTimeout is how long the old process waits for the new one
+const restartReadyTimeout = 30 * time.Second
+
+// inheritedListeners returns the listener descriptors handed over by a
+// parent process, keyed by listener name, and clears the variable so they
+// are not passed on to further children
+func inheritedListeners() (map[string]*os.File, error) {
+	value := os.Getenv(envListenFDs)
+	if value == "" {
+		return nil, nil
+	}
+	os.Unsetenv(envListenFDs)
+
+	var fds map[string]int
+	if err := json.Unmarshal([]byte(value), &fds); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", envListenFDs, err)
+	}
+
+	files := make(map[string]*os.File, len(fds))
+	for name, fd := range fds {
+		if fd < 3 {
+			return nil, fmt.Errorf("invalid %s: bad descriptor %d for %s", envListenFDs, fd, name)
+		}
+		files[name] = os.NewFile(uintptr(fd), "inherited-"+name)
+	}
+	return files, nil
+}
+
+// NotifyReady tells the parent process, if any, that this process is
+// serving and the parent can drain and exit
+func NotifyReady() error {
+	fd, ok, err := inheritedFD(envReadyFD)
+	if err != nil || !ok {
+		return err
+	}
+
+	pipe := os.NewFile(fd, "ready-pipe")
+	defer pipe.Close()
+
+	if _, err := pipe.Write([]byte{1}); err != nil {
+		return fmt.Errorf("error signalling readiness: %w", err)
+	}
+	return nil
+}
+
+// inheritedFD reads a descriptor number from the environment and clears
+// the variable so it is not passed on to further children
+func inheritedFD(name string) (uintptr, bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, false, nil
+	}
+	os.Unsetenv(name)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 3 {
+		return 0, false, fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return uintptr(fd), true, nil
+}
+
+// Restart starts a new copy of the current binary with the same arguments,
+// passing it the listening sockets, and waits until it reports that it is
+// serving. On error the new process has exited or been killed and this
+// server should keep running.
+func (s *Server) Restart() error {
+	s.mu.Lock()
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	// ExtraFiles start at descriptor 3 in the child
+	var extraFiles []*os.File
+	defer func() {
+		for _, file := range extraFiles {
+			file.Close()
+		}
+	}()
+
+	fds := make(map[string]int, len(listeners))
+	for _, listener := range listeners {
+		file, err := listenerFile(listener.Listener)
+		if err != nil {
+			return fmt.Errorf("error duplicating listener %s: %w", listener.Config.Name, err)
+		}
+		fds[listener.Config.Name] = 3 + len(extraFiles)
+		extraFiles = append(extraFiles, file)
+
+		for i, socket := range listener.reusePort {
+			file, err := listenerFile(socket)
+			if err != nil {
+				return fmt.Errorf("error duplicating listener %s: %w", listener.Config.Name, err)
+			}
+			fds[reusePortName(listener.Config.Name, i+1)] = 3 + len(extraFiles)
+			extraFiles = append(extraFiles, file)
+		}
+
+		if listener.packetConn != nil {
+			file, err := listenerFile(listener.packetConn)
+			if err != nil {
+				return fmt.Errorf("error duplicating QUIC socket of %s: %w", listener.Config.Name, err)
+			}
+			fds[quicListenerName(listener.Config.Name)] = 3 + len(extraFiles)
+			extraFiles = append(extraFiles, file)
+		}
+	}
+
+	encoded, err := json.Marshal(fds)
+	if err != nil {
+		return fmt.Errorf("error encoding listeners: %w", err)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("error creating ready pipe: %w", err)
+	}
+	defer readyReader.Close()
+
+	readyFD := 3 + len(extraFiles)
+	extraFiles = append(extraFiles, readyWriter)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error locating executable: %w", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = extraFiles
+	cmd.Env = append(os.Environ(), envListenFDs+"="+string(encoded), envReadyFD+"="+strconv.Itoa(readyFD))
+
+	err = cmd.Start()
+	// The child holds its own copies; ours must be closed to see EOF
+	for _, file := range extraFiles {
+		file.Close()
+	}
+	extraFiles = nil
+	if err != nil {
+		return fmt.Errorf("error starting new process: %w", err)
+	}
+
+	log.Printf("Started new process %d, waiting for it to become ready", cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := io.ReadFull(readyReader, buf); err != nil {
+			ready <- errors.New("new process exited before becoming ready")
+			return
+		}
+		ready <- nil
+	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(restartReadyTimeout):
+		err = errors.New("timed out waiting for new process")
+		cmd.Process.Kill()
+	}
+
+	if err != nil {
+		// Reap the failed child so it doesn't linger as a zombie
+		if waitErr := cmd.Wait(); waitErr != nil {
+			err = fmt.Errorf("%v: %v", err, waitErr)
+		}
+		return err
+	}
+
+	// The new process now serves on the same socket files, which must
+	// not be removed when this process closes its listeners. The method
+	// is asserted rather than *net.UnixListener because the plan9 port's
+	// UnixListener lacks SetUnlinkOnClose.
+	for _, listener := range listeners {
+		if unix, ok := listener.Listener.(interface{ SetUnlinkOnClose(bool) }); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+
+	// The new process outlives this one, so stop tracking it
+	cmd.Process.Release()
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package server
+
+// soReusePort is SO_REUSEPORT, which package syscall lacks on some
+// architectures
+const soReusePort = 0xf
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// Run serves until the process is told to stop.
+//
+// SIGINT and SIGTERM drain connections and return. On Unix, SIGHUP
+// reloads the configuration, and SIGUSR2 starts a new copy of the binary
+// on the same listening sockets; once it is ready this process drains and
+// returns, and if it fails this process keeps serving.
+func Run(cfg *config.Config) error {
+	listeners, err := ListenAll(cfg)
+	if err != nil {
+		return err
+	}
+
+	srv, err := New(cfg)
+	if err != nil {
+		closeListeners(listeners)
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(listeners...)
+	}()
+
+	for _, listener := range listeners {
+		protocol := "HTTP"
+		if listener.Config.TLS {
+			protocol = "HTTPS"
+		}
+		if n := len(listener.reusePort); n > 0 {
+			log.Printf("Serving %s on %s (%s, %d SO_REUSEPORT sockets, pid %d)", protocol, listener.Config.Name, listener.Addr(), n+1, os.Getpid())
+		} else {
+			log.Printf("Serving %s on %s (%s, pid %d)", protocol, listener.Config.Name, listener.Addr(), os.Getpid())
+		}
+		if listener.packetConn != nil {
+			log.Printf("Serving HTTP/3 on %s (udp %s, pid %d)", listener.Config.Name, listener.packetConn.LocalAddr(), os.Getpid())
+		}
+	}
+
+	// Let a parent process waiting on a restart know it can exit
+	if err := NotifyReady(); err != nil {
+		log.Printf("Error notifying parent: %v", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	if reloadSignal != nil {
+		signal.Notify(signals, reloadSignal, restartSignal)
+	}
+	defer signal.Stop(signals)
+
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case sig := <-signals:
+			switch sig {
+			case reloadSignal:
+				log.Printf("Received %s, reloading configuration", sig)
+				srv.ReloadConfig()
+			case restartSignal:
+				log.Printf("Received %s, handing over to a new process", sig)
+				if err := srv.Restart(); err != nil {
+					log.Printf("Restart failed, continuing to serve: %v", err)
+					continue
+				}
+				log.Printf("New process is ready, shutting down")
+				break wait
+			default:
+				log.Printf("Received %s, shutting down", sig)
+				break wait
+			}
+		}
+	}
+
+	// Drain in-flight requests, up to the configured deadline
+	ctx, cancel := context.WithTimeout(context.Background(), srv.Config().ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown incomplete: %v", err)
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, ErrServerClosed) {
+		return err
+	}
+
+	log.Printf("Server stopped")
+	return nil
+}
@@ -1,62 +1,539 @@
 package server
 
 import (
-	"fmt"
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
 	"log"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
-	"github.com/codecrafters-io/http-server-starter-go/app/internal/handlers"
 	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/panics"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/quic"
 )
 
+// ErrServerClosed is returned by Start after Shutdown has been called
+var ErrServerClosed = errors.New("server closed")
+
 // Server represents the HTTP server
 type Server struct {
-	config   *config.Config
-	handlers *handlers.Handlers
+	// state holds the configuration and handlers for new requests and is
+	// swapped as a whole on reload
+	state atomic.Pointer[state]
+
+	// tlsConfig serves TLS listeners, taking its settings from state
+	tlsConfig *tls.Config
+
+	mu        sync.Mutex
+	listeners []*Listener
+	conns     map[io.Closer]connState
+
+	shuttingDown atomic.Bool
+
+	// limiter counts open connections against the connection limits;
+	// rejecting counts connections being answered with a 503 for being
+	// over one, and rejectionLogged is when that was last logged
+	limiter         connLimiter
+	rejecting       atomic.Int32
+	rejectionLogged atomic.Int64
+
+	// poller parks idle connections when the epoll engine is in use and
+	// is nil otherwise
+	poller *poller
+
+	// shutdownCh is closed when shutdown starts, telling HTTP/2
+	// connections to finish gracefully
+	shutdownCh chan struct{}
+
+	// baseCtx is the parent of every request context and is cancelled
+	// when Shutdown gives up on in-flight requests
+	baseCtx    context.Context
+	cancelBase context.CancelFunc
 }
 
 // New creates a new server instance
-func New(cfg *config.Config) *Server {
-	return &Server{
-		config:   cfg,
-		handlers: handlers.New(cfg),
+func New(cfg *config.Config) (*Server, error) {
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+
+	s := &Server{
+		conns:      make(map[io.Closer]connState),
+		shutdownCh: make(chan struct{}),
+		baseCtx:    baseCtx,
+		cancelBase: cancelBase,
 	}
+	s.tlsConfig = &tls.Config{GetConfigForClient: s.tlsConfigForClient}
+
+	st, err := s.newState(cfg)
+	if err != nil {
+		cancelBase()
+		return nil, err
+	}
+	s.state.Store(st)
+
+	if cfg.Engine == config.EngineEpoll {
+		if s.poller, err = newPoller(s, cfg.Workers); err != nil {
+			cancelBase()
+			return nil, err
+		}
+	}
+
+	return s, nil
 }
 
-// Start begins listening and serving HTTP requests
+// Start begins listening and serving HTTP requests. It blocks until the
+// server is shut down, in which case it returns ErrServerClosed.
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", s.config.Address)
+	listeners, err := ListenAll(s.Config())
 	if err != nil {
-		return fmt.Errorf("failed to bind to %s: %v", s.config.Address, err)
+		return err
 	}
 
+	return s.Serve(listeners...)
+}
+
+// Serve accepts connections on existing listeners, such as ones inherited
+// from a previous process. It blocks like Start.
+func (s *Server) Serve(listeners ...*Listener) error {
+	s.mu.Lock()
+	if s.shuttingDown.Load() {
+		s.mu.Unlock()
+		closeListeners(listeners)
+		return ErrServerClosed
+	}
+	for _, listener := range listeners {
+		if listener.packetConn != nil {
+			listener.quic = quic.Listen(listener.packetConn, s.quicConfig())
+			listener.altSvc = altSvc(listener.packetConn.LocalAddr())
+		}
+	}
+	s.listeners = append(s.listeners, listeners...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, listener := range listeners {
+		for _, socket := range listener.sockets() {
+			wg.Add(1)
+			go func(socket net.Listener) {
+				defer wg.Done()
+				s.acceptLoop(listener, socket)
+			}(socket)
+		}
+
+		if listener.quic != nil {
+			wg.Add(1)
+			go func(listener *Listener) {
+				defer wg.Done()
+				s.acceptQUIC(listener)
+			}(listener)
+		}
+	}
+	wg.Wait()
+
+	return ErrServerClosed
+}
+
+// acceptLoop accepts connections on one of a listener's sockets until
+// shutdown
+func (s *Server) acceptLoop(listener *Listener, socket net.Listener) {
+	var backoff time.Duration
 	for {
-		conn, err := listener.Accept()
+		conn, err := socket.Accept()
 		if err != nil {
-			log.Printf("Error accepting connection: %v", err)
+			if s.shuttingDown.Load() || isClosed(err) {
+				return
+			}
+
+			// Errors such as running out of file descriptors persist for a
+			// while, so wait before trying again rather than spinning
+			backoff = acceptBackoff(backoff)
+			log.Printf("Error accepting connection on %s: %v; retrying in %v", listener.Config.Name, err, backoff)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+
+		if !s.admit(conn, listener.Config) {
 			continue
 		}
+		tuneConn(conn, s.Config().Sockets)
+		s.trackConn(conn, stateIdle)
+		if s.poller != nil && !listener.Config.TLS && !listener.Config.ProxyProtocol && s.poller.parkNew(conn, listener) {
+			continue
+		}
+		go s.handleConnection(conn, listener)
+	}
+}
+
+// http1Conn is an HTTP/1 connection together with what reading its next
+// request needs
+type http1Conn struct {
+	raw      net.Conn
+	conn     net.Conn // raw, or the TLS connection over it
+	tls      *tls.ConnectionState
+	listener *Listener
+	cr       *connReader
+	reader   *bufio.Reader
 
-		go s.handleConnection(conn)
+	// first is set until the first request, which may be an HTTP/2 preface
+	first bool
+
+	// pollID and idleDeadline are set while the epoll engine has the
+	// connection parked
+	pollID       uint64
+	idleDeadline time.Time
+}
+
+// handleConnection processes requests on a client connection until either
+// side asks to close it. listener is the one the connection arrived on.
+func (s *Server) handleConnection(raw net.Conn, listener *Listener) {
+	// A panic in the protocol code only costs this connection, which the
+	// deferred close below has closed by the time it is recovered
+	defer func() {
+		if v := recover(); v != nil {
+			panics.Report(panics.Connection, v, "connection from %s", raw.RemoteAddr())
+		}
+	}()
+
+	// A hijacked or parked connection is no longer this goroutine's to close
+	released := false
+	defer func() {
+		if !released {
+			s.closeConn(raw)
+		}
+	}()
+
+	// A trusted load balancer sends the client's address first
+	conn := raw
+	if expectsProxyHeader(listener.Config, s.Config(), raw) {
+		var err error
+		if conn, err = s.readProxyHeader(raw); err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("PROXY header error from %s: %v", raw.RemoteAddr(), err)
+			}
+			return
+		}
+
+		// The connection is tracked and counted as the client's from now
+		// on, so it is held to the per-IP limit
+		balancer := raw.RemoteAddr()
+		s.untrackConn(raw)
+		raw = conn
+		s.trackConn(raw, stateIdle)
+		if limit := s.limiter.move(balancer, raw.RemoteAddr(), s.Config().MaxConnsPerIP); limit != "" {
+			s.logRejection(raw.RemoteAddr(), limit)
+			s.untrackConn(raw)
+			s.limiter.release(raw.RemoteAddr())
+			released = true
+			s.reject(raw, listener.Config)
+			return
+		}
 	}
+
+	var connState *tls.ConnectionState
+	if listener.Config.TLS {
+		tlsConn, err := s.handshake(conn)
+		if err != nil {
+			return
+		}
+		state := tlsConn.ConnectionState()
+		conn, connState = tlsConn, &state
+	}
+
+	cr := newConnReader(conn)
+	reader := bufio.NewReader(cr)
+
+	if connState != nil && connState.NegotiatedProtocol == http2.NextProto {
+		s.serveHTTP2(raw, conn, reader, listener, nil, nil)
+		return
+	}
+
+	released = s.serveHTTP1(&http1Conn{
+		raw:      raw,
+		conn:     conn,
+		tls:      connState,
+		listener: listener,
+		cr:       cr,
+		reader:   reader,
+		first:    true,
+	})
+}
+
+// closeConn closes a connection and stops counting it
+func (s *Server) closeConn(raw net.Conn) {
+	s.untrackConn(raw)
+	s.limiter.release(raw.RemoteAddr())
+	raw.Close()
 }
 
-// handleConnection processes a single client connection
-func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
+// serveHTTP1 serves requests on an HTTP/1 connection. It returns false
+// once the connection should be closed, or true if it lives on without
+// this goroutine: hijacked by a handler, or parked by the epoll engine
+// until its next request arrives.
+func (s *Server) serveHTTP1(c *http1Conn) bool {
+	raw, conn, cr, reader := c.raw, c.conn, c.cr, c.reader
+	lc := c.listener.Config
+
+	for ; ; c.first = false {
+		// Wait for the next request while idle, so Shutdown can close
+		// the connection without interrupting a request
+		conn.SetReadDeadline(deadline(time.Now(), idleTimeout(s.Config())))
+		s.trackConn(raw, stateIdle)
+		if _, err := reader.Peek(1); err != nil {
+			return false
+		}
 
-	// Set read deadline to prevent hanging connections
-	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		// Each request runs entirely on the configuration current when it
+		// arrived, even if a reload happens meanwhile
+		st := s.current()
 
-	// Parse the request
-	request, err := http.ParseRequest(conn)
-	if err != nil {
-		log.Printf("Error parsing request: %v", err)
+		// Cleartext HTTP/2 with prior knowledge starts with its preface
+		if c.first && !lc.TLS && st.config.HTTP2 && hasHTTP2Preface(reader) {
+			s.serveHTTP2(raw, conn, reader, c.listener, nil, nil)
+			return false
+		}
+		s.trackConn(raw, stateActive)
+
+		// Read timeouts are measured from the first byte of the request
+		start := time.Now()
+
+		conn.SetReadDeadline(deadline(start, readHeaderTimeout(st.config)))
+		request, err := http.ParseRequestHead(reader)
+		if err != nil {
+			s.handleParseError(st, conn, err)
+			return false
+		}
+
+		conn.SetReadDeadline(deadline(start, st.config.ReadTimeout))
+		if err := request.ReadBody(reader, st.config.MaxRequestBodySize); err != nil {
+			s.handleParseError(st, conn, err)
+			return false
+		}
+		request.TLS = c.tls
+		request.Proxy = proxyHeader(conn)
+		request.RemoteAddr = remoteAddr(conn)
+
+		// The request is answered over HTTP/2 if it asks to upgrade
+		if !lc.TLS && st.config.HTTP2 {
+			if settings, ok := h2cSettings(request); ok {
+				conn.SetWriteDeadline(deadline(time.Now(), st.config.WriteTimeout))
+				if err := switchToH2C(conn, st.config.ServerName); err != nil {
+					log.Printf("Error writing response: %v", err)
+					return false
+				}
+				s.serveHTTP2(raw, conn, reader, c.listener, request, settings)
+				return false
+			}
+		}
+
+		// Give the request a context that ends if the client goes away
+		request, cancel := withRequestContext(s.baseCtx, request)
+
+		// Route and handle the request
+		conn.SetWriteDeadline(deadline(time.Now(), st.config.WriteTimeout))
+		w := http.NewResponseWriter(conn, request, st.config.ServerName)
+		w.Header().Set(http.HeaderRequestID, http.RequestIDFrom(request.Context()))
+		if c.listener.altSvc != "" {
+			w.Header().Set(http.HeaderAltSvc, c.listener.altSvc)
+		}
+		if s.shuttingDown.Load() {
+			w.Header().Set(http.HeaderConnection, "close")
+		}
+		w.SetUpgrader(func(hijack bool) (net.Conn, *bufio.Reader) {
+			// The new protocol reads the connection itself, with no deadlines
+			cr.abortPendingRead()
+			conn.SetDeadline(time.Time{})
+			if hijack {
+				s.untrackConn(raw)
+				s.limiter.release(raw.RemoteAddr())
+			}
+			return conn, reader
+		})
+
+		// Only watch for a disconnect when no pipelined request is buffered
+		if reader.Buffered() == 0 {
+			cr.startBackgroundRead(cancel)
+		}
+		s.serveRequest(st, lc, w, request)
+		cr.abortPendingRead()
+		cancel()
+
+		if w.Hijacked() {
+			return true
+		}
+
+		if err := w.Finish(); err != nil {
+			log.Printf("Error writing response: %v", err)
+			return false
+		}
+
+		if !w.KeepAlive() || s.shuttingDown.Load() {
+			return false
+		}
+
+		// The epoll engine holds idle plaintext connections without a
+		// goroutine until the next request arrives
+		if s.poller != nil && !lc.TLS && reader.Buffered() == 0 && s.poller.park(c, st.config) {
+			return true
+		}
+	}
+}
+
+// withRequestContext gives a request a cancellable context derived from
+// parent, carrying its request ID and the user named by a verified client
+// certificate
+func withRequestContext(parent context.Context, request *http.Request) (*http.Request, context.CancelFunc) {
+	ctx := http.WithRequestID(parent, http.RequestID(request))
+	if cert := request.ClientCertificate(); cert != nil {
+		// A verified client certificate identifies the user
+		ctx = http.WithUser(ctx, cert.Subject.CommonName)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return request.WithContext(ctx), cancel
+}
+
+// plaintextOnTLSBody answers a plaintext request sent to a TLS listener
+const plaintextOnTLSBody = "Client sent an HTTP request to an HTTPS server.\n"
+
+// handshake performs the TLS handshake on a new connection, limited by the
+// read header timeout
+func (s *Server) handshake(conn net.Conn) (*tls.Conn, error) {
+	tlsConn := tls.Server(conn, s.tlsConfig)
+
+	conn.SetDeadline(deadline(time.Now(), readHeaderTimeout(s.Config())))
+	if err := tlsConn.Handshake(); err != nil {
+		// Clients that connect and go away, like health checks, are not worth logging
+		if !errors.Is(err, io.EOF) {
+			log.Printf("TLS handshake error from %s: %v", conn.RemoteAddr(), err)
+		}
+
+		// Tell plaintext clients what went wrong
+		var recordErr tls.RecordHeaderError
+		if errors.As(err, &recordErr) && recordErr.Conn != nil {
+			w := http.NewResponseWriter(recordErr.Conn, nil, s.Config().ServerName)
+			w.Header().Set(http.HeaderContentType, http.ContentTypePlain)
+			w.Header().Set(http.HeaderContentLength, strconv.Itoa(len(plaintextOnTLSBody)))
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(plaintextOnTLSBody))
+			w.Finish()
+		}
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// serveRequest runs the handler for a request, abandoning it with a 503
+// if it runs past its deadline or a 500 if it panics. Paths the listener
+// does not serve get a 404, and requests without the client certificate a
+// policy asks for a 403.
+func (s *Server) serveRequest(st *state, lc config.Listener, w *http.ResponseWriter, request *http.Request) {
+	request.ResolveClient(st.config.TrustedProxies.Trusts)
+
+	if !lc.Allows(request.Path) {
+		w.Header().Set(http.HeaderContentLength, "0")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if !st.config.ClientCertAllowed(request.Method, request.Path, request.ClientCertificate()) {
+		log.Printf("Client certificate policy denied %s %s (client %q)", request.Method, request.Path, http.UserFrom(request.Context()))
+		w.Header().Set(http.HeaderContentLength, "0")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	timeout := st.config.HandlerTimeoutFor(request.Path)
+	if timeout <= 0 {
+		runHandler(st, w, request)
 		return
 	}
 
-	// Route and handle the request
-	s.handlers.HandleRequest(conn, request)
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+	request = request.WithContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runHandler(st, w, request)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Printf("Handler for %s %s timed out after %v", request.Method, request.Path, timeout)
+		if err := w.Abort(http.StatusServiceUnavailable); err != nil {
+			log.Printf("Error writing timeout response: %v", err)
+		}
+	}
+}
+
+// handleParseError answers a request that could not be parsed when the
+// error says how, and logs anything other than a client going away
+func (s *Server) handleParseError(st *state, conn net.Conn, err error) {
+	// A client closing an idle connection is not an error
+	if errors.Is(err, io.EOF) {
+		return
+	}
+
+	log.Printf("Error parsing request from %s: %v", conn.RemoteAddr(), err)
+
+	status := http.Status(0)
+	var protocolErr *http.ProtocolError
+	switch {
+	case errors.As(err, &protocolErr):
+		status = protocolErr.Status
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		// The client was too slow sending the request
+		status = http.StatusRequestTimeout
+	default:
+		return
+	}
+
+	conn.SetWriteDeadline(deadline(time.Now(), st.config.WriteTimeout))
+	w := http.NewResponseWriter(conn, nil, st.config.ServerName)
+	w.Header().Set(http.HeaderContentLength, "0")
+	w.WriteHeader(status)
+	if err := w.Finish(); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// readHeaderTimeout returns the limit for reading request headers
+func readHeaderTimeout(cfg *config.Config) time.Duration {
+	if cfg.ReadHeaderTimeout > 0 {
+		return cfg.ReadHeaderTimeout
+	}
+	return cfg.ReadTimeout
+}
+
+// idleTimeout returns the limit for waiting on the next request
+func idleTimeout(cfg *config.Config) time.Duration {
+	if cfg.IdleTimeout > 0 {
+		return cfg.IdleTimeout
+	}
+	return cfg.ReadTimeout
+}
+
+// deadline returns the time timeout after from, or no deadline for a
+// non-positive timeout
+func deadline(from time.Time, timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return from.Add(timeout)
 }
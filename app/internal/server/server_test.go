@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/handlers"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// startServer serves on a loopback port with the configuration args give
+// until the test ends and returns the server and its address
+func startServer(tb testing.TB, args ...string) (*Server, string) {
+	tb.Helper()
+	srv, addrs := startListeners(tb, append([]string{"-address", "127.0.0.1:0"}, args...)...)
+	return srv, addrs[0]
+}
+
+// startListeners serves with the configuration args give until the test
+// ends and returns the server and the address of each listener
+func startListeners(tb testing.TB, args ...string) (*Server, []string) {
+	tb.Helper()
+	cfg, err := config.LoadArgs(args)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	listeners, err := ListenAll(cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		closeListeners(listeners)
+		tb.Fatal(err)
+	}
+	go srv.Serve(listeners...)
+	tb.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+
+	addrs := make([]string, len(listeners))
+	for i, listener := range listeners {
+		addrs[i] = listener.Addr().String()
+	}
+	return srv, addrs
+}
+
+// exchange sends request on a new connection and returns everything the
+// server sends back until it closes the connection
+func exchange(t *testing.T, addr, request string) string {
+	t.Helper()
+	return exchangeOn(t, "tcp", addr, request)
+}
+
+// exchangeOn is exchange over a network other than TCP
+func exchangeOn(t *testing.T, network, addr, request string) string {
+	t.Helper()
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("reading response: %v", err)
+	}
+	return string(response)
+}
+
+// testResponse is a response read by readResponse
+type testResponse struct {
+	status string
+	header map[string]string // lower-case names
+	body   string
+}
+
+// dial connects to addr, closing the connection when the test ends
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+// readResponse reads one response with a Content-Length body, leaving the
+// connection open for the next
+func readResponse(t *testing.T, r *bufio.Reader) *testResponse {
+	t.Helper()
+	resp := &testResponse{header: make(map[string]string)}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading response: %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if resp.status == "" {
+			resp.status = line
+			continue
+		}
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		resp.header[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+
+	n, _ := strconv.Atoi(resp.header["content-length"])
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		t.Fatalf("reading response body: %v", err)
+	}
+	resp.body = string(body)
+	return resp
+}
+
+// waitUntil polls cond until it holds, failing the test after five seconds
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for start := time.Now(); !cond(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// testAdminToken is the admin token servers started for setReloadFunc use
+const testAdminToken = "test-token"
+
+// reloadRequest is a POST /admin/reload request with testAdminToken
+const reloadRequest = "POST /admin/reload HTTP/1.1\r\nHost: test\r\nAuthorization: Bearer " + testAdminToken + "\r\n"
+
+// setReloadFunc makes POST /admin/reload on srv, which must have been
+// started with -admin-token testAdminToken, run reload instead of
+// reloading. It gives tests a handler that blocks or panics on demand.
+func setReloadFunc(srv *Server, reload func() error) {
+	st := *srv.current()
+	h := handlers.New(st.config)
+	h.SetReloadFunc(reload)
+	st.handlers = h
+	srv.state.Store(&st)
+}
+
+// handlerFunc is a handler for tests
+type handlerFunc func(w *http.ResponseWriter, request *http.Request)
+
+// HandleRequest calls f
+func (f handlerFunc) HandleRequest(w *http.ResponseWriter, request *http.Request) {
+	f(w, request)
+}
+
+// setHandler makes srv serve every request with f
+func setHandler(srv *Server, f handlerFunc) {
+	st := *srv.current()
+	st.handlers = f
+	srv.state.Store(&st)
+}
+
+// statusLine returns the first line of a response
+func statusLine(response string) string {
+	line, _, _ := strings.Cut(response, "\r\n")
+	return line
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	_, addr := startServer(t, "-directory", t.TempDir(), "-max-request-body", "16")
+
+	tests := []struct {
+		name          string
+		contentLength string
+		body          string
+		status        string
+	}{
+		{"within the limit", "5", "hello", "HTTP/1.1 201 Created"},
+		{"over the limit", "17", strings.Repeat("x", 17), "HTTP/1.1 413 Content Too Large"},
+		{"huge", "1000000000000000000", "", "HTTP/1.1 413 Content Too Large"},
+		{"negative", "-5", "", "HTTP/1.1 400 Bad Request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := exchange(t, addr, "POST /files/upload HTTP/1.1\r\nHost: test\r\nConnection: close\r\n"+
+				"Content-Length: "+tt.contentLength+"\r\n\r\n"+tt.body)
+			if got := statusLine(response); got != tt.status {
+				t.Errorf("status %q, want %q", got, tt.status)
+			}
+		})
+	}
+}
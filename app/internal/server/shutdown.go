@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+)
+
+// connState describes what a tracked connection is doing
+type connState int
+
+const (
+	// stateIdle connections are waiting for the next request
+	stateIdle connState = iota
+
+	// stateActive connections are reading a request or writing a response
+	stateActive
+)
+
+// shutdownPollInterval is how often Shutdown checks for drained connections
+const shutdownPollInterval = 50 * time.Millisecond
+
+// trackConn records the state of a TCP or QUIC connection
+func (s *Server) trackConn(conn io.Closer, state connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[conn] = state
+}
+
+// untrackConn forgets a closed connection
+func (s *Server) untrackConn(conn io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
+
+// Shutdown stops accepting connections, closes idle keep-alive connections
+// and waits for active requests to finish. If ctx expires first the
+// remaining requests' contexts are cancelled, their connections closed and
+// the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.shuttingDown.CompareAndSwap(false, true) {
+		close(s.shutdownCh)
+	}
+	defer s.cancelBase()
+	if s.poller != nil {
+		// Runs after the parked connections have been closed as idle
+		defer s.poller.stop()
+	}
+
+	s.mu.Lock()
+	for _, listener := range s.listeners {
+		listener.Close()
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			closed := s.closeAllConns()
+			log.Printf("Shutdown deadline reached, closed %d active connections", closed)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns closes connections waiting for a request and reports
+// whether no connections remain
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == stateIdle {
+			conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// closeAllConns closes every remaining connection and returns how many there were
+func (s *Server) closeAllConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	closed := len(s.conns)
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+
+	return closed
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingReload returns a reload func that signals started and then
+// blocks until release is called, which happens when the test ends if not
+// before
+func blockingReload(t *testing.T) (reload func() error, started chan struct{}, release func()) {
+	started, unblock := make(chan struct{}, 1), make(chan struct{})
+	var once sync.Once
+	release = func() { once.Do(func() { close(unblock) }) }
+	t.Cleanup(release)
+	return func() error {
+		started <- struct{}{}
+		<-unblock
+		return nil
+	}, started, release
+}
+
+// expectClosed fails the test unless the server closes conn without
+// sending anything more
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("read %d bytes, error %v; want the connection closed", n, err)
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	srv, addr := startServer(t, "-admin-token", testAdminToken)
+	reload, started, release := blockingReload(t)
+	setReloadFunc(srv, reload)
+
+	idle, idleReader := dial(t, addr)
+	io.WriteString(idle, "GET /echo/a HTTP/1.1\r\nHost: test\r\n\r\n")
+	if resp := readResponse(t, idleReader); resp.status != "HTTP/1.1 200 OK" {
+		t.Fatalf("idle connection: %q", resp.status)
+	}
+
+	active, activeReader := dial(t, addr)
+	io.WriteString(active, reloadRequest+"\r\n")
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
+	// The idle connection is closed at once and no new ones are accepted
+	if _, err := idleReader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("idle connection read error %v, want EOF", err)
+	}
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Error("new connection accepted during shutdown")
+	}
+
+	// Shutdown waits for the active request
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(3 * shutdownPollInterval):
+	}
+
+	release()
+	if resp := readResponse(t, activeReader); resp.status != "HTTP/1.1 200 OK" {
+		t.Errorf("active request: %q", resp.status)
+	}
+	// and closes its connection after the response
+	if _, err := activeReader.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("active connection read error %v after the response, want EOF", err)
+	}
+
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return once drained")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	srv, addr := startServer(t, "-admin-token", testAdminToken)
+	reload, started, _ := blockingReload(t)
+	setReloadFunc(srv, reload)
+
+	active, _ := dial(t, addr)
+	io.WriteString(active, reloadRequest+"\r\n")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+
+	// The request still in flight loses its connection
+	expectClosed(t, active)
+}
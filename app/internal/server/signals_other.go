@@ -0,0 +1,12 @@
+//go:build !unix
+
+package server
+
+import "os"
+
+// There are no signals for reloading or restarting outside Unix; use
+// POST /admin/reload to reload the configuration
+var (
+	reloadSignal  os.Signal
+	restartSignal os.Signal
+)
@@ -0,0 +1,15 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignal reloads the configuration and restartSignal hands the
+// listening sockets over to a new process
+var (
+	reloadSignal  os.Signal = syscall.SIGHUP
+	restartSignal os.Signal = syscall.SIGUSR2
+)
@@ -0,0 +1,18 @@
+//go:build !unix && !windows
+
+package server
+
+import (
+	"errors"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// setBufferOptions fails, since socket options cannot be set on this
+// platform; configuration validation rejects the buffer sizes first
+func setBufferOptions(fd int, opts config.SocketOptions) error {
+	if opts.ReadBuffer > 0 || opts.WriteBuffer > 0 {
+		return errors.ErrUnsupported
+	}
+	return nil
+}
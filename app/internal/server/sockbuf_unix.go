@@ -0,0 +1,26 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// setBufferOptions sets the kernel buffer sizes of a socket; accepted
+// connections inherit them from the listening socket
+func setBufferOptions(fd int, opts config.SocketOptions) error {
+	if opts.ReadBuffer > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, opts.ReadBuffer); err != nil {
+			return os.NewSyscallError("setsockopt SO_RCVBUF", err)
+		}
+	}
+	if opts.WriteBuffer > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_SNDBUF, opts.WriteBuffer); err != nil {
+			return os.NewSyscallError("setsockopt SO_SNDBUF", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// listenTCP binds a TCP listening socket with the configured options.
+// Keepalive is left to tuneConn so it follows reloads.
+func listenTCP(address string, opts config.SocketOptions) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: -1}
+	if opts.Listening() {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			if err := c.Control(func(fd uintptr) {
+				sockErr = setListenOptions(int(fd), opts)
+			}); err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+
+	l, err := lc.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind to %s: %v", address, err)
+	}
+	return l, nil
+}
+
+// tuneConn applies the per-connection options to an accepted TCP
+// connection. Go enables TCP_NODELAY and keepalive by default on sockets
+// it accepts, including ones on inherited listeners, so both are set
+// explicitly.
+func tuneConn(conn net.Conn, opts config.SocketOptions) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	if !opts.TCPNoDelay {
+		tcp.SetNoDelay(false)
+	}
+	if opts.TCPKeepAlive > 0 {
+		tcp.SetKeepAliveConfig(net.KeepAliveConfig{
+			Enable:   true,
+			Idle:     opts.TCPKeepAlive,
+			Interval: opts.TCPKeepAlive,
+		})
+	} else {
+		tcp.SetKeepAlive(false)
+	}
+}
+
+// reusePortName is the name the i-th extra SO_REUSEPORT socket of a
+// listener is handed over under on restart
+func reusePortName(name string, i int) string {
+	return name + "#" + strconv.Itoa(i)
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package server
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// tcpFastOpen is TCP_FASTOPEN, which package syscall lacks on some
+// architectures
+const tcpFastOpen = 0x17
+
+// setListenOptions applies the options of a listening socket before it
+// is bound
+func setListenOptions(fd int, opts config.SocketOptions) error {
+	if opts.ReusePort > 1 {
+		if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+			return os.NewSyscallError("setsockopt SO_REUSEPORT", err)
+		}
+	}
+	if opts.TCPFastOpen > 0 {
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, tcpFastOpen, opts.TCPFastOpen); err != nil {
+			return os.NewSyscallError("setsockopt TCP_FASTOPEN", err)
+		}
+	}
+	if opts.TCPDeferAccept > 0 {
+		// The kernel takes whole seconds
+		seconds := int((opts.TCPDeferAccept + time.Second - 1) / time.Second)
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds); err != nil {
+			return os.NewSyscallError("setsockopt TCP_DEFER_ACCEPT", err)
+		}
+	}
+	return setBufferOptions(fd, opts)
+}
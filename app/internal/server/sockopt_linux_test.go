@@ -0,0 +1,164 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// sockopt reads an integer socket option of conn, which is a connection
+// or listener from package net
+func sockopt(t *testing.T, conn syscall.Conn, level, opt int) int {
+	t.Helper()
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return value
+}
+
+// acceptedConn returns the server side of a new loopback TCP connection
+func acceptedConn(t *testing.T) *net.TCPConn {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.(*net.TCPConn)
+}
+
+func TestTuneConn(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      config.SocketOptions
+		noDelay   bool
+		keepAlive int // seconds, 0 for none
+	}{
+		{"defaults", config.SocketOptions{TCPNoDelay: true, TCPKeepAlive: config.DefaultTCPKeepAlive}, true, 15},
+		{"Nagle and a long keepalive", config.SocketOptions{TCPKeepAlive: time.Minute}, false, 60},
+		{"no keepalive", config.SocketOptions{TCPNoDelay: true}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := acceptedConn(t)
+			tuneConn(conn, tt.opts)
+
+			if got := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY) != 0; got != tt.noDelay {
+				t.Errorf("TCP_NODELAY %v, want %v", got, tt.noDelay)
+			}
+			if got := sockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE) != 0; got != (tt.keepAlive > 0) {
+				t.Errorf("SO_KEEPALIVE %v, want %v", got, tt.keepAlive > 0)
+			}
+			if tt.keepAlive == 0 {
+				return
+			}
+			for _, opt := range []struct {
+				name string
+				opt  int
+			}{{"TCP_KEEPIDLE", syscall.TCP_KEEPIDLE}, {"TCP_KEEPINTVL", syscall.TCP_KEEPINTVL}} {
+				if got := sockopt(t, conn, syscall.IPPROTO_TCP, opt.opt); got != tt.keepAlive {
+					t.Errorf("%s %d, want %d", opt.name, got, tt.keepAlive)
+				}
+			}
+		})
+	}
+
+	// Other connections, such as Unix sockets, are left alone
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	tuneConn(server, config.SocketOptions{TCPKeepAlive: time.Second})
+}
+
+func TestSetListenOptions(t *testing.T) {
+	opts := config.SocketOptions{
+		ReusePort:      2,
+		TCPFastOpen:    16,
+		TCPDeferAccept: 1500 * time.Millisecond,
+		ReadBuffer:     64 << 10,
+		WriteBuffer:    64 << 10,
+	}
+	l, err := listenTCP("127.0.0.1:0", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	tcp := l.(*net.TCPListener)
+
+	if got := sockopt(t, tcp, syscall.SOL_SOCKET, soReusePort); got != 1 {
+		t.Errorf("SO_REUSEPORT %d, want 1", got)
+	}
+	if got := sockopt(t, tcp, syscall.IPPROTO_TCP, tcpFastOpen); got != 16 {
+		t.Errorf("TCP_FASTOPEN %d, want 16", got)
+	}
+	// The kernel rounds the seconds, themselves rounded up, to its
+	// retransmission schedule
+	if got := sockopt(t, tcp, syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT); got < 2 {
+		t.Errorf("TCP_DEFER_ACCEPT %d, want at least 2", got)
+	}
+	// and doubles buffer sizes for its bookkeeping
+	for _, opt := range []struct {
+		name string
+		opt  int
+	}{{"SO_RCVBUF", syscall.SO_RCVBUF}, {"SO_SNDBUF", syscall.SO_SNDBUF}} {
+		if got := sockopt(t, tcp, syscall.SOL_SOCKET, opt.opt); got < 64<<10 {
+			t.Errorf("%s %d, want at least %d", opt.name, got, 64<<10)
+		}
+	}
+
+	// Without listening options the socket is left as Go creates it
+	plain, err := listenTCP("127.0.0.1:0", config.SocketOptions{TCPNoDelay: true, TCPKeepAlive: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if got := sockopt(t, plain.(*net.TCPListener), syscall.SOL_SOCKET, soReusePort); got != 0 {
+		t.Errorf("SO_REUSEPORT %d on a plain socket", got)
+	}
+}
+
+func TestReusePortListeners(t *testing.T) {
+	cfg := loadConfig(t, "-address", "127.0.0.1:0", "-reuseport", "3")
+	listeners, err := ListenAll(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeListeners(listeners)
+
+	// The extra sockets bind the port the first one got
+	sockets := listeners[0].sockets()
+	if len(sockets) != 3 {
+		t.Fatalf("%d sockets, want 3", len(sockets))
+	}
+	for _, socket := range sockets[1:] {
+		if socket.Addr().String() != sockets[0].Addr().String() {
+			t.Errorf("socket on %s, want %s", socket.Addr(), sockets[0].Addr())
+		}
+	}
+}
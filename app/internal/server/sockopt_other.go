@@ -0,0 +1,12 @@
+//go:build !linux
+
+package server
+
+import "github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+
+// setListenOptions applies the options of a listening socket before it
+// is bound. Only the buffer sizes are supported outside Linux, and not on
+// every platform, which configuration validation enforces.
+func setListenOptions(fd int, opts config.SocketOptions) error {
+	return setBufferOptions(fd, opts)
+}
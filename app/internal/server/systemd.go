@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+// Environment variables set by systemd for socket activation
+const (
+	envSystemdPID     = "LISTEN_PID"
+	envSystemdFDs     = "LISTEN_FDS"
+	envSystemdFDNames = "LISTEN_FDNAMES"
+)
+
+// systemdFirstFD is the first descriptor passed by systemd
+const systemdFirstFD = 3
+
+// systemdSocket is one descriptor passed by systemd
+type systemdSocket struct {
+	name string
+	file *os.File
+}
+
+// systemdFiles are the sockets passed by systemd, in order
+type systemdFiles []systemdSocket
+
+// systemdSockets returns the sockets passed by systemd socket activation,
+// or none if the process was not socket-activated. The environment is
+// cleared so the sockets are not passed on to child processes.
+func systemdSockets() (systemdFiles, error) {
+	pid := os.Getenv(envSystemdPID)
+	count := os.Getenv(envSystemdFDs)
+	names := os.Getenv(envSystemdFDNames)
+
+	os.Unsetenv(envSystemdPID)
+	os.Unsetenv(envSystemdFDs)
+	os.Unsetenv(envSystemdFDNames)
+
+	// The variables are meant for this process only
+	if count == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %s: %q", envSystemdFDs, count)
+	}
+
+	nameList := strings.Split(names, ":")
+	files := make(systemdFiles, 0, n)
+	for i := 0; i < n; i++ {
+		name := strconv.Itoa(i)
+		if names != "" && i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+
+		fd := uintptr(systemdFirstFD + i)
+		files = append(files, systemdSocket{name: name, file: os.NewFile(fd, "systemd-"+name)})
+	}
+
+	return files, nil
+}
+
+// lookup returns the socket with the given name or index
+func (sf systemdFiles) lookup(name string) (*os.File, bool) {
+	for i, socket := range sf {
+		if socket.name == name || strconv.Itoa(i) == name {
+			return socket.file, true
+		}
+	}
+	return nil, false
+}
+
+// listeners returns a listener spec for every passed socket
+func (sf systemdFiles) listeners() []config.Listener {
+	specs := make([]config.Listener, 0, len(sf))
+	for _, socket := range sf {
+		specs = append(specs, config.Listener{
+			Name:    config.NetworkSystemd + "://" + socket.name,
+			Network: config.NetworkSystemd,
+			Address: socket.name,
+		})
+	}
+	return specs
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+)
+
+func TestTimeoutFallbacks(t *testing.T) {
+	tests := []struct {
+		name                     string
+		cfg                      config.Config
+		wantReadHeader, wantIdle time.Duration
+	}{
+		{"read timeout only", config.Config{ReadTimeout: 5 * time.Second}, 5 * time.Second, 5 * time.Second},
+		{"own timeouts", config.Config{ReadTimeout: 5 * time.Second, ReadHeaderTimeout: time.Second, IdleTimeout: time.Minute}, time.Second, time.Minute},
+		{"none", config.Config{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readHeaderTimeout(&tt.cfg); got != tt.wantReadHeader {
+				t.Errorf("readHeaderTimeout = %v, want %v", got, tt.wantReadHeader)
+			}
+			if got := idleTimeout(&tt.cfg); got != tt.wantIdle {
+				t.Errorf("idleTimeout = %v, want %v", got, tt.wantIdle)
+			}
+		})
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := deadline(from, time.Second); !got.Equal(from.Add(time.Second)) {
+		t.Errorf("deadline = %v", got)
+	}
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if got := deadline(from, timeout); !got.IsZero() {
+			t.Errorf("deadline for %v = %v, want none", timeout, got)
+		}
+	}
+}
+
+func TestReadTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		request string
+	}{
+		{
+			"headers",
+			[]string{"-read-header-timeout", "100ms", "-read-timeout", "10s"},
+			"GET /echo/a HTTP/1.1\r\nHost: te",
+		},
+		{
+			"headers under the read timeout",
+			[]string{"-read-header-timeout", "0", "-read-timeout", "100ms"},
+			"GET /echo/a HTTP/1.1\r\n",
+		},
+		{
+			"body",
+			[]string{"-read-header-timeout", "10s", "-read-timeout", "100ms"},
+			"POST /files/a HTTP/1.1\r\nHost: test\r\nContent-Length: 10\r\n\r\nhi",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, addr := startServer(t, append(tt.args, "-directory", t.TempDir())...)
+
+			// The client stalls part way through the request
+			start := time.Now()
+			response := exchange(t, addr, tt.request)
+			if got := statusLine(response); got != "HTTP/1.1 408 Request Timeout" {
+				t.Errorf("status %q, want a 408", got)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("answered after %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	_, addr := startServer(t, "-idle-timeout", "100ms", "-read-timeout", "10s")
+
+	conn, r := dial(t, addr)
+	io.WriteString(conn, "GET /echo/a HTTP/1.1\r\nHost: test\r\n\r\n")
+	if resp := readResponse(t, r); resp.status != "HTTP/1.1 200 OK" {
+		t.Fatalf("first request: %q", resp.status)
+	}
+
+	// A keep-alive connection without a next request is closed quietly
+	start := time.Now()
+	expectClosed(t, conn)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("closed after %v, before the idle timeout", elapsed)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	srv, addr := startServer(t, "-admin-token", testAdminToken, "-route-timeout", "/admin/=100ms")
+	reload, _, _ := blockingReload(t)
+	setReloadFunc(srv, reload)
+
+	// The handler is abandoned with a 503 and the connection closed
+	response := exchange(t, addr, reloadRequest+"\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 503 Service Unavailable" {
+		t.Errorf("status %q, want a 503", got)
+	}
+
+	// Routes without a timeout are unaffected
+	response = exchange(t, addr, "GET /echo/a HTTP/1.1\r\nHost: test\r\nConnection: close\r\n\r\n")
+	if got := statusLine(response); got != "HTTP/1.1 200 OK" {
+		t.Errorf("other route: %q", got)
+	}
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/config"
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http2"
+)
+
+// certCheckInterval is how often certificate files are checked for changes
+const certCheckInterval = time.Second
+
+// devCertValidity is how long a generated development certificate is valid
+const devCertValidity = 365 * 24 * time.Hour
+
+// certStore holds the certificates for TLS listeners and reloads them when
+// their files change
+type certStore struct {
+	pairs []config.CertPair
+
+	mu       sync.Mutex
+	certs    []*tls.Certificate
+	modTimes []time.Time
+	checked  time.Time
+
+	// dev is the generated development certificate, if enabled
+	dev *tls.Certificate
+}
+
+// newCertStore loads the configured certificates
+func newCertStore(cfg *config.Config) (*certStore, error) {
+	cs := &certStore{
+		pairs:    cfg.TLSCertificates,
+		certs:    make([]*tls.Certificate, len(cfg.TLSCertificates)),
+		modTimes: make([]time.Time, len(cfg.TLSCertificates)),
+		checked:  time.Now(),
+	}
+
+	for i, pair := range cs.pairs {
+		cert, modTime, err := loadCertPair(pair)
+		if err != nil {
+			return nil, err
+		}
+		cs.certs[i] = cert
+		cs.modTimes[i] = modTime
+	}
+
+	if cfg.DevTLS {
+		dev, err := devCertificate()
+		if err != nil {
+			return nil, err
+		}
+		cs.dev = dev
+	}
+
+	return cs, nil
+}
+
+// getCertificate picks the certificate for a handshake: the first one
+// valid for the client's SNI name and algorithms, or the first one if
+// none is
+func (cs *certStore) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := cs.current()
+	if len(certs) == 0 {
+		return nil, errors.New("no TLS certificates configured")
+	}
+
+	for _, cert := range certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return certs[0], nil
+}
+
+// current returns the certificates, first reloading any whose files
+// changed since the last check
+func (cs *certStore) current() []*tls.Certificate {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if time.Since(cs.checked) >= certCheckInterval {
+		cs.checked = time.Now()
+		cs.reloadChanged()
+	}
+
+	certs := make([]*tls.Certificate, 0, len(cs.certs)+1)
+	certs = append(certs, cs.certs...)
+	if cs.dev != nil {
+		certs = append(certs, cs.dev)
+	}
+	return certs
+}
+
+// reloadChanged reloads certificates whose files were modified. A pair
+// that fails to load, for example while only one of its files has been
+// replaced, keeps its old certificate and is tried again on the next check.
+func (cs *certStore) reloadChanged() {
+	for i, pair := range cs.pairs {
+		modTime, err := pairModTime(pair)
+		if err != nil || modTime.Equal(cs.modTimes[i]) {
+			continue
+		}
+
+		cert, modTime, err := loadCertPair(pair)
+		if err != nil {
+			log.Printf("Error reloading certificate, keeping the current one: %v", err)
+			continue
+		}
+
+		cs.certs[i] = cert
+		cs.modTimes[i] = modTime
+		log.Printf("Reloaded certificate %s", pair.CertFile)
+	}
+}
+
+// loadCertPair reads a certificate and key, returning them with the later
+// of the two files' modification times
+func loadCertPair(pair config.CertPair) (*tls.Certificate, time.Time, error) {
+	modTime, err := pairModTime(pair)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("error loading certificate %s: %w", pair.CertFile, err)
+	}
+
+	// Parse the leaf now rather than on every handshake
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("error parsing certificate %s: %w", pair.CertFile, err)
+		}
+		cert.Leaf = leaf
+	}
+
+	return &cert, modTime, nil
+}
+
+// pairModTime returns the later modification time of a pair's files
+func pairModTime(pair config.CertPair) (time.Time, error) {
+	certInfo, err := os.Stat(pair.CertFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(pair.KeyFile)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading key: %w", err)
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+	return certInfo.ModTime(), nil
+}
+
+// devCert is generated once per process so reloads keep serving the same
+// certificate
+var devCert struct {
+	once sync.Once
+	cert *tls.Certificate
+	err  error
+}
+
+// devCertificate returns a self-signed certificate for localhost
+func devCertificate() (*tls.Certificate, error) {
+	devCert.once.Do(func() {
+		devCert.cert, devCert.err = generateDevCertificate()
+		if devCert.err == nil {
+			log.Printf("Generated a self-signed certificate for localhost; do not use -dev-tls in production")
+		}
+	})
+	return devCert.cert, devCert.err
+}
+
+// generateDevCertificate creates a self-signed ECDSA certificate for
+// localhost, 127.0.0.1 and ::1
+func generateDevCertificate() (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"drizzle development"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(devCertValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// newTLSConfig builds the TLS settings for a configuration, or returns nil
+// if TLS is not enabled
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+
+	certs, err := newCertStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     cfg.TLSVersion(),
+		GetCertificate: certs.getCertificate,
+		NextProtos:     []string{"http/1.1"},
+	}
+	if cfg.HTTP2 {
+		tlsConfig.NextProtos = []string{http2.NextProto, "http/1.1"}
+	}
+	if len(cfg.TLSCipherSuites) > 0 {
+		tlsConfig.CipherSuites = cfg.TLSCipherSuites.IDs()
+	}
+
+	if cfg.TLSClientAuth != config.ClientAuthNone {
+		pool, err := loadCAPool(cfg.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.TLSClientAuth == config.ClientAuthRequired {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// loadCAPool reads a PEM bundle of CA certificates
+func loadCAPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA bundle %s", file)
+	}
+	return pool, nil
+}
+
+// tlsConfigForClient returns the TLS settings current when a handshake
+// starts, so reloads apply to new connections
+func (s *Server) tlsConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	tlsConfig := s.current().tls
+	if tlsConfig == nil {
+		return nil, errors.New("TLS is not configured")
+	}
+	return tlsConfig, nil
+}
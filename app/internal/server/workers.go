@@ -0,0 +1,46 @@
+package server
+
+import "sync"
+
+// workerPool runs tasks on a fixed set of long-lived goroutines, so that
+// serving a burst of requests doesn't start a goroutine, and grow its
+// stack, for each one
+type workerPool struct {
+	tasks chan func()
+	wg    sync.WaitGroup
+}
+
+// newWorkerPool starts n workers
+func newWorkerPool(n int) *workerPool {
+	p := &workerPool{tasks: make(chan func())}
+	p.wg.Add(n)
+	for range n {
+		go p.work()
+	}
+	return p
+}
+
+// work runs tasks until the pool is stopped
+func (p *workerPool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		task()
+	}
+}
+
+// submit runs task on an idle worker. If every worker is busy it runs on
+// a goroutine of its own instead, since a handler that blocks, such as a
+// long poll, must not hold up requests on other connections.
+func (p *workerPool) submit(task func()) {
+	select {
+	case p.tasks <- task:
+	default:
+		go task()
+	}
+}
+
+// stop lets the workers exit once their current tasks are done; submit
+// must not be called afterwards
+func (p *workerPool) stop() {
+	close(p.tasks)
+}
@@ -0,0 +1,238 @@
+// Package sse streams Server-Sent Events, the text/event-stream format
+// browsers read with EventSource, over a ResponseWriter.
+package sse
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// DefaultHeartbeat is how often an idle stream gets a comment unless
+// configured otherwise
+const DefaultHeartbeat = 15 * time.Second
+
+// ErrInvalidField is returned for an event ID or name containing a line
+// break or NUL, which would corrupt the stream
+var ErrInvalidField = errors.New("sse: line break or NUL in event field")
+
+// ErrClosed is returned by Send after Close
+var ErrClosed = errors.New("sse: stream closed")
+
+// Event is a single event. Empty fields are left out.
+type Event struct {
+	// ID becomes the client's last event ID, which it sends back in
+	// Last-Event-ID when it reconnects
+	ID string
+
+	// Event names the event type; empty means "message"
+	Event string
+
+	// Data is the payload; each line is sent as a data field of its own
+	Data string
+
+	// Retry tells the client how long to wait before reconnecting
+	Retry time.Duration
+}
+
+// Options configures a stream
+type Options struct {
+	// Heartbeat is how often a comment is sent while no events are, so
+	// proxies and load balancers don't close an idle stream. Zero uses
+	// DefaultHeartbeat and a negative value sends none.
+	Heartbeat time.Duration
+
+	// WriteTimeout limits each write to the client; zero means no limit
+	WriteTimeout time.Duration
+}
+
+// Writer sends events to one client. Its methods are safe for concurrent
+// use.
+type Writer struct {
+	w            *http.ResponseWriter
+	lastEventID  string
+	writeTimeout time.Duration
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+
+	// heartbeat fires when the stream has been idle for the interval
+	heartbeat *time.Timer
+	interval  time.Duration
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewWriter starts an event stream in response to request, sending the
+// header at once. Close must be called before the handler returns.
+func NewWriter(w *http.ResponseWriter, request *http.Request, opts *Options) (*Writer, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	sw := &Writer{
+		w:            w,
+		lastEventID:  request.Headers[http.HeaderLastEventID],
+		writeTimeout: opts.WriteTimeout,
+		interval:     opts.Heartbeat,
+		done:         make(chan struct{}),
+	}
+	if sw.interval == 0 {
+		sw.interval = DefaultHeartbeat
+	}
+
+	header := w.Header()
+	header.Set(http.HeaderContentType, http.ContentTypeEventStream)
+	header.Set(http.HeaderCacheControl, "no-cache")
+	header.Del(http.HeaderContentLength)
+	w.WriteHeader(http.StatusOK)
+
+	sw.mu.Lock()
+	err := sw.flush()
+	sw.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if sw.interval > 0 {
+		sw.heartbeat = time.NewTimer(sw.interval)
+		sw.wg.Add(1)
+		go sw.sendHeartbeats(request)
+	}
+	return sw, nil
+}
+
+// LastEventID returns the ID of the last event the client received before
+// reconnecting, from Last-Event-ID, so the stream can resume after it. It
+// is empty for a new stream.
+func (sw *Writer) LastEventID() string {
+	return sw.lastEventID
+}
+
+// Send writes an event and flushes it to the client
+func (sw *Writer) Send(event Event) error {
+	if !validField(event.ID) || !validField(event.Event) {
+		return ErrInvalidField
+	}
+
+	var b strings.Builder
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Event != "" {
+		b.WriteString("event: " + event.Event + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+	if event.Data != "" {
+		data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(event.Data)
+		for _, line := range strings.Split(data, "\n") {
+			b.WriteString("data: " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+
+	return sw.write(b.String())
+}
+
+// Comment writes a comment line, which clients ignore
+func (sw *Writer) Comment(text string) error {
+	if !validField(text) {
+		return ErrInvalidField
+	}
+	return sw.write(": " + text + "\n\n")
+}
+
+// Close stops the heartbeats and waits for any in progress. The response
+// itself ends when the handler returns.
+func (sw *Writer) Close() {
+	sw.mu.Lock()
+	if sw.closed {
+		sw.mu.Unlock()
+		return
+	}
+	sw.closed = true
+	close(sw.done)
+	sw.mu.Unlock()
+
+	sw.wg.Wait()
+}
+
+// write sends part of the stream and flushes it, pushing back the
+// heartbeat
+func (sw *Writer) write(s string) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrClosed
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+
+	sw.setDeadline()
+	if _, err := sw.w.Write([]byte(s)); err != nil {
+		sw.err = err
+		return err
+	}
+	if err := sw.flush(); err != nil {
+		return err
+	}
+
+	if sw.heartbeat != nil {
+		sw.heartbeat.Reset(sw.interval)
+	}
+	return nil
+}
+
+// flush sends buffered data to the client; the caller holds sw.mu
+func (sw *Writer) flush() error {
+	sw.setDeadline()
+	if err := sw.w.Flush(); err != nil {
+		sw.err = err
+		return err
+	}
+	return nil
+}
+
+// setDeadline gives the next write the write timeout, replacing the
+// server's deadline for the whole response; the caller holds sw.mu
+func (sw *Writer) setDeadline() {
+	var deadline time.Time
+	if sw.writeTimeout > 0 {
+		deadline = time.Now().Add(sw.writeTimeout)
+	}
+	sw.w.SetWriteDeadline(deadline)
+}
+
+// sendHeartbeats writes a comment whenever the stream has been idle for
+// the heartbeat interval, until Close or the request ends
+func (sw *Writer) sendHeartbeats(request *http.Request) {
+	defer sw.wg.Done()
+	defer sw.heartbeat.Stop()
+
+	for {
+		select {
+		case <-sw.heartbeat.C:
+			if err := sw.write(":\n\n"); err != nil {
+				return
+			}
+		case <-sw.done:
+			return
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+// validField reports whether a value fits on a single line of the stream
+func validField(value string) bool {
+	return !strings.ContainsAny(value, "\r\n\x00")
+}
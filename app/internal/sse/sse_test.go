@@ -0,0 +1,259 @@
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// testStream is a Writer over one end of a pipe and the events read from
+// the other
+type testStream struct {
+	sw     *Writer
+	header string
+	events chan string
+}
+
+// newTestStream starts a stream for a request with headers, reading the
+// response header and then each event, without its blank line, into
+// events
+func newTestStream(t *testing.T, headers map[string]string, opts *Options) *testStream {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	ts := &testStream{events: make(chan string, 16)}
+	headerRead := make(chan string, 1)
+	go func() {
+		defer close(ts.events)
+		r := bufio.NewReader(client)
+		var header strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(headerRead)
+				return
+			}
+			if line == "\r\n" {
+				break
+			}
+			header.WriteString(line)
+		}
+		headerRead <- header.String()
+
+		// The body is chunked, and an event may span chunks
+		var pending string
+		for {
+			chunk, err := readChunk(r)
+			if err != nil {
+				return
+			}
+			pending += chunk
+			for {
+				event, rest, found := strings.Cut(pending, "\n\n")
+				if !found {
+					break
+				}
+				ts.events <- event
+				pending = rest
+			}
+		}
+	}()
+
+	request := &http.Request{
+		Method:     "GET",
+		Path:       "/events",
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Headers:    headers,
+	}
+	w := http.NewResponseWriter(server, request, "test")
+	sw, err := NewWriter(w, request, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sw.Close)
+	ts.sw = sw
+	ts.header = <-headerRead
+	return ts
+}
+
+// readChunk reads one chunk of a chunked body
+func readChunk(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+	if err != nil {
+		return "", err
+	}
+	if size == 0 {
+		return "", io.EOF
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data[:size]), nil
+}
+
+// next returns the next event, failing the test if none arrives in time
+func (ts *testStream) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case event, ok := <-ts.events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return ""
+	}
+}
+
+func TestNewWriterHeader(t *testing.T) {
+	ts := newTestStream(t, map[string]string{}, &Options{Heartbeat: -1})
+	for _, line := range []string{
+		"HTTP/1.1 200 OK\r\n",
+		"Content-Type: text/event-stream\r\n",
+		"Cache-Control: no-cache\r\n",
+		"Transfer-Encoding: chunked\r\n",
+	} {
+		if !strings.Contains(ts.header, line) {
+			t.Errorf("no %q in header %q", line, ts.header)
+		}
+	}
+	if strings.Contains(ts.header, "Content-Length") {
+		t.Errorf("Content-Length in header %q", ts.header)
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name  string
+		event Event
+		want  string
+	}{
+		{"data", Event{Data: "hello"}, "data: hello\n"},
+		{"every field", Event{ID: "7", Event: "update", Data: "x", Retry: 3 * time.Second}, "id: 7\nevent: update\nretry: 3000\ndata: x\n"},
+		{"retry in milliseconds", Event{Retry: 1500 * time.Millisecond}, "retry: 1500\n"},
+		{"multi-line data", Event{Data: "a\nb\nc"}, "data: a\ndata: b\ndata: c\n"},
+		{"CRLF and CR line breaks", Event{Data: "a\r\nb\rc"}, "data: a\ndata: b\ndata: c\n"},
+		{"empty lines", Event{Data: "a\n\nb\n"}, "data: a\ndata: \ndata: b\ndata: \n"},
+	}
+	ts := newTestStream(t, map[string]string{}, &Options{Heartbeat: -1})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ts.sw.Send(tt.event); err != nil {
+				t.Fatal(err)
+			}
+			// The event's blank line ends it
+			if got := ts.next(t) + "\n"; got != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendInvalidField(t *testing.T) {
+	ts := newTestStream(t, map[string]string{}, &Options{Heartbeat: -1})
+	for _, event := range []Event{
+		{ID: "1\n2", Data: "x"},
+		{ID: "1\r", Data: "x"},
+		{ID: "1\x002", Data: "x"},
+		{Event: "a\nb", Data: "x"},
+	} {
+		if err := ts.sw.Send(event); !errors.Is(err, ErrInvalidField) {
+			t.Errorf("Send(%+v) = %v, want ErrInvalidField", event, err)
+		}
+	}
+	if err := ts.sw.Comment("a\nb"); !errors.Is(err, ErrInvalidField) {
+		t.Errorf("Comment with a line break = %v, want ErrInvalidField", err)
+	}
+
+	// Nothing was written, so the next event is the first the client sees
+	if err := ts.sw.Send(Event{Data: "ok"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ts.next(t); got != "data: ok" {
+		t.Errorf("next event %q", got)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	ts := newTestStream(t, map[string]string{http.HeaderLastEventID: "41"}, &Options{Heartbeat: -1})
+	if got := ts.sw.LastEventID(); got != "41" {
+		t.Errorf("LastEventID = %q, want 41", got)
+	}
+
+	ts = newTestStream(t, map[string]string{}, &Options{Heartbeat: -1})
+	if got := ts.sw.LastEventID(); got != "" {
+		t.Errorf("LastEventID of a new stream = %q", got)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ts := newTestStream(t, map[string]string{}, &Options{Heartbeat: 20 * time.Millisecond})
+	start := time.Now()
+	if got := ts.next(t); got != ":" {
+		t.Fatalf("first event %q, want a heartbeat", got)
+	}
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Errorf("heartbeat after %v, before the interval", elapsed)
+	}
+
+	// Events push the heartbeat back, and it keeps firing after them
+	if err := ts.sw.Send(Event{Data: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	for got := ts.next(t); got != "data: x"; got = ts.next(t) {
+		if got != ":" {
+			t.Fatalf("unexpected event %q", got)
+		}
+	}
+	if got := ts.next(t); got != ":" {
+		t.Errorf("event after the data %q, want a heartbeat", got)
+	}
+}
+
+func TestSendAfterClose(t *testing.T) {
+	ts := newTestStream(t, map[string]string{}, &Options{Heartbeat: 10 * time.Millisecond})
+	ts.sw.Close()
+	// Closing twice is harmless
+	ts.sw.Close()
+
+	if err := ts.sw.Send(Event{Data: "x"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Send after Close = %v, want ErrClosed", err)
+	}
+	if err := ts.sw.Comment("x"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Comment after Close = %v, want ErrClosed", err)
+	}
+
+	// No heartbeats follow, though one written just before Close may still
+	// be on its way to the channel
+	select {
+	case event := <-ts.events:
+		if event != ":" {
+			t.Errorf("event after Close %q", event)
+		}
+		select {
+		case event := <-ts.events:
+			t.Errorf("event after Close %q", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	case <-time.After(50 * time.Millisecond):
+	}
+}
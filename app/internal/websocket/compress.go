@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+	"sync"
+)
+
+// extensionDeflate is the name of the permessage-deflate extension
+const extensionDeflate = "permessage-deflate"
+
+// minCompressSize is the smallest message WriteMessage compresses; below
+// it the deflate overhead outweighs the savings
+const minCompressSize = 64
+
+// windowSize is the LZ77 window of compress/flate, and the most a peer's
+// messages can refer back to
+const windowSize = 32 << 10
+
+// deflateTail ends a compressed message: the empty stored block that
+// peers strip from each message, then an empty final block so the reader
+// sees the end of the stream
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+// flateWriters reuses compressors, which are expensive to allocate. Every
+// message starts from a reset compressor, so no context carries over.
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// negotiateDeflate picks the first permessage-deflate offer this side can
+// accept and returns the response parameters. Each message is compressed
+// on its own, so server_no_context_takeover is always answered. Peers may
+// keep their context and use any window, since decompression keeps a full
+// window of history, but this side cannot shrink its own window.
+func negotiateDeflate(header string) (string, bool) {
+	for _, offer := range strings.Split(header, ",") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != extensionDeflate {
+			continue
+		}
+		if acceptableDeflateParams(params[1:]) {
+			return extensionDeflate + "; server_no_context_takeover", true
+		}
+	}
+	return "", false
+}
+
+// acceptableDeflateParams checks the parameters of one offer
+func acceptableDeflateParams(params []string) bool {
+	seen := make(map[string]bool)
+	for _, param := range params {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(param), "=")
+		name = strings.TrimSpace(name)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if seen[name] {
+			return false
+		}
+		seen[name] = true
+
+		switch name {
+		case "server_no_context_takeover", "client_no_context_takeover":
+			if hasValue {
+				return false
+			}
+		case "server_max_window_bits":
+			// compress/flate always uses the full window
+			if value != "15" {
+				return false
+			}
+		case "client_max_window_bits":
+			if hasValue && !validWindowBits(value) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validWindowBits reports whether value is a window size from 8 to 15
+func validWindowBits(value string) bool {
+	return len(value) == 1 && value[0] >= '8' && value[0] <= '9' ||
+		len(value) == 2 && value[0] == '1' && value[1] >= '0' && value[1] <= '5'
+}
+
+// inflater decompresses a peer's messages, keeping the last window of
+// output so messages may refer back into earlier ones
+type inflater struct {
+	reader io.ReadCloser
+	dict   []byte
+}
+
+// decompress returns the payload of a compressed message, failing with
+// CloseMessageTooBig beyond limit bytes
+func (inf *inflater) decompress(payload []byte, limit int64) ([]byte, error) {
+	src := io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail))
+	if inf.reader == nil {
+		inf.reader = flate.NewReaderDict(src, inf.dict)
+	} else if err := inf.reader.(flate.Resetter).Reset(src, inf.dict); err != nil {
+		return nil, err
+	}
+
+	out, err := io.ReadAll(io.LimitReader(inf.reader, limit+1))
+	if err != nil {
+		return nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid compressed data"}
+	}
+	if int64(len(out)) > limit {
+		return nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	inf.dict = append(inf.dict, out...)
+	if len(inf.dict) > windowSize {
+		inf.dict = append(inf.dict[:0], inf.dict[len(inf.dict)-windowSize:]...)
+	}
+	return out, nil
+}
@@ -0,0 +1,394 @@
+package websocket
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// MessageType is the kind of a data message
+type MessageType int
+
+// Data message types
+const (
+	TextMessage   MessageType = opText
+	BinaryMessage MessageType = opBinary
+)
+
+// fragmentSize is the payload size at which a message being written is
+// sent as a frame before the rest of it is known
+const fragmentSize = 32 << 10
+
+// Errors returned when writing
+var (
+	// ErrCloseSent is returned by writes after a close frame was sent
+	ErrCloseSent = errors.New("websocket: close frame already sent")
+
+	// ErrControlTooLong is returned for ping and close payloads over 125 bytes
+	ErrControlTooLong = errors.New("websocket: control frame payload too long")
+
+	// errWriterClosed is returned by writes to a closed message writer
+	errWriterClosed = errors.New("websocket: message writer closed")
+)
+
+// Conn is a WebSocket connection on the server side.
+//
+// One goroutine at a time may read messages and one at a time may write
+// them; Ping and CloseWithStatus may be called concurrently with both.
+type Conn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	subprotocol string
+	compress    bool
+	readLimit   int64
+
+	// readErr ends reading for good once set
+	readErr  error
+	inflater inflater
+
+	// writeMu guards the writer and keeps frames whole
+	writeMu   sync.Mutex
+	writer    *bufio.Writer
+	closeSent bool
+}
+
+// newConn wraps a connection whose handshake has completed
+func newConn(conn net.Conn, rw *bufio.ReadWriter, subprotocol string, compress bool, readLimit int64) *Conn {
+	return &Conn{
+		conn:        conn,
+		reader:      rw.Reader,
+		writer:      rw.Writer,
+		subprotocol: subprotocol,
+		compress:    compress,
+		readLimit:   readLimit,
+	}
+}
+
+// Subprotocol returns the subprotocol chosen in the handshake, or "" if none
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Compressed reports whether permessage-deflate was negotiated
+func (c *Conn) Compressed() bool {
+	return c.compress
+}
+
+// NetConn returns the underlying connection, for example to set deadlines
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// Close closes the underlying connection without a closing handshake
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// ReadMessage returns the next data message, answering pings and skipping
+// pongs on the way. Once the peer sends a close frame, which is echoed, or
+// breaks the protocol, which closes the connection with a matching status,
+// it returns a *CloseError and every later call returns it too.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	if c.readErr != nil {
+		return 0, nil, c.readErr
+	}
+
+	typ, data, err := c.readMessage()
+	if err != nil {
+		var closeErr *CloseError
+		if errors.As(err, &closeErr) {
+			// Answer the peer's close, or tell it what it did wrong
+			code := closeErr.Code
+			if code == CloseNoStatus {
+				code = 0
+			}
+			c.writeClose(code, closeErr.Reason)
+		}
+		c.readErr = err
+		return 0, nil, err
+	}
+	return typ, data, nil
+}
+
+// readMessage reads the frames of one data message
+func (c *Conn) readMessage() (MessageType, []byte, error) {
+	var opcode byte
+	var compressed bool
+	var payload []byte
+
+	for {
+		h, err := readFrameHeader(c.reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !h.masked {
+			return 0, nil, protocolError("unmasked client frame")
+		}
+		if h.rsv1 && (!c.compress || isControl(h.opcode) || h.opcode == opContinuation) {
+			return 0, nil, protocolError("unexpected RSV1 bit")
+		}
+
+		if isControl(h.opcode) {
+			if err := c.handleControl(h); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		if h.opcode == opContinuation {
+			if opcode == 0 {
+				return 0, nil, protocolError("continuation frame outside a message")
+			}
+		} else {
+			if opcode != 0 {
+				return 0, nil, protocolError("new message inside a fragmented one")
+			}
+			opcode = h.opcode
+			compressed = h.rsv1
+		}
+
+		if h.length > c.readLimit-int64(len(payload)) {
+			return 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+		}
+		start := len(payload)
+		payload = append(payload, make([]byte, h.length)...)
+		if _, err := io.ReadFull(c.reader, payload[start:]); err != nil {
+			return 0, nil, unexpectedEOF(err)
+		}
+		maskBytes(h.mask, 0, payload[start:])
+
+		if h.fin {
+			break
+		}
+	}
+
+	if compressed {
+		var err error
+		if payload, err = c.inflater.decompress(payload, c.readLimit); err != nil {
+			return 0, nil, err
+		}
+	}
+	if opcode == opText && !utf8.Valid(payload) {
+		return 0, nil, &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8 in text message"}
+	}
+	return MessageType(opcode), payload, nil
+}
+
+// handleControl reads a control frame's payload and acts on it
+func (c *Conn) handleControl(h frameHeader) error {
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return unexpectedEOF(err)
+	}
+	maskBytes(h.mask, 0, payload)
+
+	switch h.opcode {
+	case opPing:
+		err := c.writeControl(opPong, payload)
+		if errors.Is(err, ErrCloseSent) {
+			return nil
+		}
+		return err
+	case opPong:
+		// Pongs answer pings sent with Ping, or are unsolicited heartbeats
+		return nil
+	}
+
+	// A close frame carries an optional status code and reason
+	switch {
+	case len(payload) == 0:
+		return &CloseError{Code: CloseNoStatus, Remote: true}
+	case len(payload) == 1:
+		return protocolError("truncated close frame")
+	}
+	code := StatusCode(binary.BigEndian.Uint16(payload))
+	reason := payload[2:]
+	if !validCloseCode(code) {
+		return protocolError("invalid close code")
+	}
+	if !utf8.Valid(reason) {
+		return &CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8 in close reason"}
+	}
+	return &CloseError{Code: code, Reason: string(reason), Remote: true}
+}
+
+// WriteMessage sends a data message in a single frame, compressed if
+// permessage-deflate was negotiated and the message is large enough to
+// benefit
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if c.compress && len(data) >= minCompressSize {
+		w := c.newMessageWriter(typ, true)
+		w.Write(data)
+		return w.Close()
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.writeFrame(true, false, byte(typ), data)
+}
+
+// NextWriter returns a writer for a message sent in fragments as it is
+// written, compressed if permessage-deflate was negotiated. The message
+// ends when the writer is closed, and no other message may be written
+// until then.
+func (c *Conn) NextWriter(typ MessageType) io.WriteCloser {
+	return c.newMessageWriter(typ, c.compress)
+}
+
+// Ping sends a ping with an application payload of up to 125 bytes
+func (c *Conn) Ping(data []byte) error {
+	return c.writeControl(opPing, data)
+}
+
+// CloseWithStatus starts the closing handshake. The peer's answering
+// close frame is returned by ReadMessage as a *CloseError, after which the
+// connection should be closed.
+func (c *Conn) CloseWithStatus(code StatusCode, reason string) error {
+	if len(reason)+2 > maxControlPayload {
+		return ErrControlTooLong
+	}
+	return c.writeClose(code, reason)
+}
+
+// writeClose sends a close frame with code and reason, or with no
+// payload if code is zero
+func (c *Conn) writeClose(code StatusCode, reason string) error {
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		payload = append(payload, reason...)
+		if len(payload) > maxControlPayload {
+			payload = payload[:maxControlPayload]
+		}
+	}
+	return c.writeControl(opClose, payload)
+}
+
+// writeControl sends a control frame
+func (c *Conn) writeControl(opcode byte, payload []byte) error {
+	if len(payload) > maxControlPayload {
+		return ErrControlTooLong
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.writeFrame(true, false, opcode, payload)
+}
+
+// writeFrame sends a frame; the caller holds c.writeMu
+func (c *Conn) writeFrame(fin, rsv1 bool, opcode byte, payload []byte) error {
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == opClose {
+		c.closeSent = true
+	}
+
+	header := appendFrameHeader(make([]byte, 0, 10), fin, rsv1, opcode, len(payload))
+	c.writer.Write(header)
+	c.writer.Write(payload)
+	return c.writer.Flush()
+}
+
+// messageWriter sends a message as frames of up to fragmentSize as it is
+// written, compressing it if asked to
+type messageWriter struct {
+	c       *Conn
+	opcode  byte
+	rsv1    bool
+	payload payloadBuffer
+	flate   *flate.Writer
+	closed  bool
+	err     error
+}
+
+// payloadBuffer collects payload that has not been sent yet
+type payloadBuffer struct {
+	b []byte
+}
+
+// Write implements io.Writer
+func (p *payloadBuffer) Write(b []byte) (int, error) {
+	p.b = append(p.b, b...)
+	return len(b), nil
+}
+
+// newMessageWriter starts a message
+func (c *Conn) newMessageWriter(typ MessageType, compress bool) *messageWriter {
+	w := &messageWriter{c: c, opcode: byte(typ), rsv1: compress}
+	if compress {
+		w.flate = flateWriters.Get().(*flate.Writer)
+		w.flate.Reset(&w.payload)
+	}
+	return w
+}
+
+// Write adds to the message, sending frames once enough is buffered
+func (w *messageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	if w.flate != nil {
+		w.flate.Write(p)
+	} else {
+		w.payload.Write(p)
+	}
+
+	// A compressed message's last four bytes may be the stripped tail
+	keep := 0
+	if w.flate != nil {
+		keep = 4
+	}
+	for len(w.payload.b)-keep >= fragmentSize && w.err == nil {
+		w.err = w.send(false, w.payload.b[:fragmentSize])
+		w.payload.b = w.payload.b[fragmentSize:]
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return len(p), nil
+}
+
+// Close sends the rest of the message in its final frame
+func (w *messageWriter) Close() error {
+	if w.closed {
+		return errWriterClosed
+	}
+	w.closed = true
+
+	if w.flate != nil {
+		w.flate.Flush()
+		flateWriters.Put(w.flate)
+		w.flate = nil
+
+		// A sync flush ends with an empty stored block, which is left out
+		// on the wire (RFC 7692 Section 7.2.1)
+		w.payload.b = w.payload.b[:len(w.payload.b)-4]
+	}
+	if w.err != nil {
+		return w.err
+	}
+	return w.send(true, w.payload.b)
+}
+
+// send writes one frame of the message
+func (w *messageWriter) send(fin bool, payload []byte) error {
+	w.c.writeMu.Lock()
+	defer w.c.writeMu.Unlock()
+
+	err := w.c.writeFrame(fin, w.rsv1, w.opcode, payload)
+	w.opcode = opContinuation
+	w.rsv1 = false
+	return err
+}
@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Opcodes (RFC 6455 Section 5.2)
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// Bits of the first two header bytes
+const (
+	finBit  = 0x80
+	rsv1Bit = 0x40
+	rsv2Bit = 0x20
+	rsv3Bit = 0x10
+	maskBit = 0x80
+)
+
+// maxControlPayload is the largest payload a control frame may carry
+const maxControlPayload = 125
+
+// frameHeader is the decoded header of a frame
+type frameHeader struct {
+	fin    bool
+	rsv1   bool
+	opcode byte
+	length int64
+	masked bool
+	mask   [4]byte
+}
+
+// isControl reports whether an opcode is a control frame's
+func isControl(opcode byte) bool {
+	return opcode&0x8 != 0
+}
+
+// readFrameHeader reads and checks the header of the next frame
+func readFrameHeader(r *bufio.Reader) (frameHeader, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return frameHeader{}, err
+	}
+
+	h := frameHeader{
+		fin:    b[0]&finBit != 0,
+		rsv1:   b[0]&rsv1Bit != 0,
+		opcode: b[0] & 0x0f,
+		masked: b[1]&maskBit != 0,
+		length: int64(b[1] &^ maskBit),
+	}
+	if b[0]&(rsv2Bit|rsv3Bit) != 0 {
+		return h, protocolError("reserved bits set")
+	}
+	switch h.opcode {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return h, protocolError(fmt.Sprintf("unknown opcode 0x%x", h.opcode))
+	}
+
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(r, b[:2]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(r, b[:8]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		length := binary.BigEndian.Uint64(b[:8])
+		if length>>63 != 0 {
+			return h, protocolError("invalid payload length")
+		}
+		h.length = int64(length)
+	}
+
+	if isControl(h.opcode) {
+		if !h.fin {
+			return h, protocolError("fragmented control frame")
+		}
+		if h.length > maxControlPayload {
+			return h, protocolError("control frame too long")
+		}
+	}
+
+	if h.masked {
+		if _, err := io.ReadFull(r, h.mask[:]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+	}
+	return h, nil
+}
+
+// unexpectedEOF reports the end of the connection inside a frame as such
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendFrameHeader appends the header of an unmasked frame, as the
+// server sends them
+func appendFrameHeader(b []byte, fin, rsv1 bool, opcode byte, length int) []byte {
+	first := opcode
+	if fin {
+		first |= finBit
+	}
+	if rsv1 {
+		first |= rsv1Bit
+	}
+
+	switch {
+	case length < 126:
+		return append(b, first, byte(length))
+	case length <= 0xffff:
+		b = append(b, first, 126)
+		return binary.BigEndian.AppendUint16(b, uint16(length))
+	default:
+		b = append(b, first, 127)
+		return binary.BigEndian.AppendUint64(b, uint64(length))
+	}
+}
+
+// maskBytes applies a masking key to b, which starts pos bytes into the
+// payload, and returns the position after it
+func maskBytes(mask [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= mask[(pos+i)&3]
+	}
+	return (pos + len(b)) & 3
+}
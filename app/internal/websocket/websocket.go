@@ -0,0 +1,206 @@
+// Package websocket implements the WebSocket protocol (RFC 6455) on top of
+// an HTTP/1.1 connection taken over with ResponseWriter.Upgrade, with the
+// permessage-deflate extension (RFC 7692).
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/http-server-starter-go/app/internal/http"
+)
+
+// DefaultReadLimit bounds the size of a received message unless
+// configured otherwise
+const DefaultReadLimit = 16 << 20
+
+// Header fields of the opening handshake
+const (
+	headerKey        = "sec-websocket-key"
+	headerVersion    = "sec-websocket-version"
+	headerProtocol   = "sec-websocket-protocol"
+	headerExtensions = "sec-websocket-extensions"
+	headerAccept     = "sec-websocket-accept"
+)
+
+// acceptGUID is appended to the client's key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned by Accept for requests that are not a valid
+// opening handshake; the client has been sent an error response
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// StatusCode is the status code of a close frame
+type StatusCode int
+
+// Close status codes (RFC 6455 Section 7.4.1)
+const (
+	CloseNormal             StatusCode = 1000
+	CloseGoingAway          StatusCode = 1001
+	CloseProtocolError      StatusCode = 1002
+	CloseUnsupportedData    StatusCode = 1003
+	CloseNoStatus           StatusCode = 1005
+	CloseAbnormal           StatusCode = 1006
+	CloseInvalidPayload     StatusCode = 1007
+	ClosePolicyViolation    StatusCode = 1008
+	CloseMessageTooBig      StatusCode = 1009
+	CloseMandatoryExtension StatusCode = 1010
+	CloseInternalError      StatusCode = 1011
+)
+
+// validCloseCode reports whether a peer may send code in a close frame.
+// 1012 to 1014 are registered with IANA after RFC 6455, and 3000 to 4999
+// are for libraries and applications.
+func validCloseCode(code StatusCode) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// CloseError is returned by ReadMessage once the connection has closed.
+// Remote says whether the peer sent the close frame; otherwise the peer
+// broke the protocol and this side closed with Code.
+type CloseError struct {
+	Code   StatusCode
+	Reason string
+	Remote bool
+}
+
+// Error implements the error interface
+func (e *CloseError) Error() string {
+	side := "local"
+	if e.Remote {
+		side = "remote"
+	}
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: %s close %d", side, e.Code)
+	}
+	return fmt.Sprintf("websocket: %s close %d: %s", side, e.Code, e.Reason)
+}
+
+// protocolError fails the connection with a protocol error status
+func protocolError(reason string) *CloseError {
+	return &CloseError{Code: CloseProtocolError, Reason: reason}
+}
+
+// IsCloseError reports whether err is a clean close of the connection:
+// the peer sent a close frame with one of codes, or with any code if none
+// are given
+func IsCloseError(err error, codes ...StatusCode) bool {
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || !closeErr.Remote {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if closeErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Options configures the connections Accept creates
+type Options struct {
+	// Subprotocols the handler speaks, most preferred first; the first
+	// one the client also offers is chosen
+	Subprotocols []string
+
+	// Compression enables permessage-deflate if the client offers it
+	Compression bool
+
+	// ReadLimit bounds the size of a received message; zero uses
+	// DefaultReadLimit
+	ReadLimit int64
+}
+
+// IsWebSocketRequest reports whether a request asks to open a WebSocket
+func IsWebSocketRequest(request *http.Request) bool {
+	return request.Method == http.GET && request.IsUpgrade("websocket")
+}
+
+// Accept completes the opening handshake and takes over the connection.
+// A request that is not a valid handshake is answered with 400 or 426 and
+// ErrBadHandshake returned.
+func Accept(w *http.ResponseWriter, request *http.Request, opts *Options) (*Conn, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if !IsWebSocketRequest(request) {
+		w.Header().Set(http.HeaderConnection, "Upgrade")
+		w.Header().Set(http.HeaderUpgrade, "websocket")
+		return nil, reject(w, http.StatusUpgradeRequired, "expected a WebSocket handshake")
+	}
+	if request.Headers[headerVersion] != "13" {
+		w.Header().Set(headerVersion, "13")
+		return nil, reject(w, http.StatusUpgradeRequired, "unsupported WebSocket version")
+	}
+	key := request.Headers[headerKey]
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, reject(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	subprotocol := selectSubprotocol(opts.Subprotocols, request.Headers[headerProtocol])
+	if subprotocol != "" {
+		w.Header().Set(headerProtocol, subprotocol)
+	}
+
+	compress := false
+	if opts.Compression {
+		if response, ok := negotiateDeflate(request.Headers[headerExtensions]); ok {
+			w.Header().Set(headerExtensions, response)
+			compress = true
+		}
+	}
+
+	w.Header().Set(headerAccept, acceptKey(key))
+	netConn, rw, err := w.Upgrade("websocket")
+	if err != nil {
+		return nil, err
+	}
+
+	readLimit := opts.ReadLimit
+	if readLimit <= 0 {
+		readLimit = DefaultReadLimit
+	}
+	return newConn(netConn, rw, subprotocol, compress, readLimit), nil
+}
+
+// reject answers a failed handshake and returns ErrBadHandshake
+func reject(w *http.ResponseWriter, status http.Status, reason string) error {
+	body := reason + "\n"
+	w.Header().Set(http.HeaderContentType, http.ContentTypePlain)
+	w.Header().Set(http.HeaderContentLength, strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+	return fmt.Errorf("%w: %s", ErrBadHandshake, reason)
+}
+
+// acceptKey computes Sec-WebSocket-Accept for a client's key
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// selectSubprotocol picks the first of supported that the client offers
+func selectSubprotocol(supported []string, offered string) string {
+	for _, protocol := range supported {
+		for _, candidate := range strings.Split(offered, ",") {
+			if strings.TrimSpace(candidate) == protocol {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSelectSubprotocol(t *testing.T) {
+	tests := []struct {
+		supported []string
+		offered   string
+		want      string
+	}{
+		{[]string{"chat"}, "chat", "chat"},
+		// This side's preference wins over the client's order
+		{[]string{"v2", "v1"}, "v1, v2", "v2"},
+		{[]string{"v2", "v1"}, "v1,x", "v1"},
+		{[]string{"chat"}, "chatty, superchat", ""},
+		{nil, "chat", ""},
+		{[]string{"chat"}, "", ""},
+	}
+	for _, tt := range tests {
+		if got := selectSubprotocol(tt.supported, tt.offered); got != tt.want {
+			t.Errorf("selectSubprotocol(%q, %q) = %q, want %q", tt.supported, tt.offered, got, tt.want)
+		}
+	}
+}
+
+func TestReadFrameHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		length int64
+		err    bool
+	}{
+		{"7-bit length", []byte{0x82, 0x85, 1, 2, 3, 4}, 5, false},
+		{"16-bit length", []byte{0x82, 0xfe, 0x01, 0x00, 1, 2, 3, 4}, 256, false},
+		{"64-bit length", []byte{0x82, 0xff, 0, 0, 0, 0, 0, 1, 0, 0, 1, 2, 3, 4}, 65536, false},
+		{"64-bit length with the top bit set", []byte{0x82, 0xff, 0x80, 0, 0, 0, 0, 0, 0, 0}, 0, true},
+		{"truncated length", []byte{0x82, 0xfe, 0x01}, 0, true},
+		{"truncated mask", []byte{0x82, 0x85, 1, 2}, 0, true},
+	}
+	for _, tt := range tests {
+		h, err := readFrameHeader(bufio.NewReader(bytes.NewReader(tt.header)))
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if err == nil && (h.length != tt.length || h.mask != [4]byte{1, 2, 3, 4}) {
+			t.Errorf("%s: length %d mask %v", tt.name, h.length, h.mask)
+		}
+	}
+}
+
+func TestAppendFrameHeader(t *testing.T) {
+	tests := []struct {
+		length int
+		want   []byte
+	}{
+		{125, []byte{0x81, 125}},
+		{126, []byte{0x81, 126, 0, 126}},
+		{0xffff, []byte{0x81, 126, 0xff, 0xff}},
+		{0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		if got := appendFrameHeader(nil, true, false, opText, tt.length); !bytes.Equal(got, tt.want) {
+			t.Errorf("length %d: header %x, want %x", tt.length, got, tt.want)
+		}
+	}
+	if got := appendFrameHeader(nil, false, true, opBinary, 0); !bytes.Equal(got, []byte{0x42, 0}) {
+		t.Errorf("RSV1 without FIN: header %x", got)
+	}
+}
+
+func TestMaskBytes(t *testing.T) {
+	mask := [4]byte{1, 2, 3, 4}
+	data := []byte("abcdefg")
+	want := bytes.Clone(data)
+	maskBytes(mask, 0, want)
+
+	// Masking in pieces continues from where the last piece ended
+	got := bytes.Clone(data)
+	pos := maskBytes(mask, 0, got[:3])
+	if pos = maskBytes(mask, pos, got[3:]); pos != 3 {
+		t.Errorf("position %d, want 3", pos)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("masked in pieces %x, want %x", got, want)
+	}
+
+	maskBytes(mask, 0, got)
+	if string(got) != "abcdefg" {
+		t.Errorf("unmasked %q", got)
+	}
+}
+
+func TestIsCloseError(t *testing.T) {
+	remote := &CloseError{Code: CloseGoingAway, Remote: true}
+	local := &CloseError{Code: CloseProtocolError}
+	switch {
+	case !IsCloseError(remote):
+		t.Error("remote close not a close error")
+	case !IsCloseError(remote, CloseNormal, CloseGoingAway):
+		t.Error("remote close with a listed code not a close error")
+	case IsCloseError(remote, CloseNormal):
+		t.Error("remote close with another code is a close error")
+	case IsCloseError(local):
+		t.Error("local close is a close error")
+	case IsCloseError(errors.New("EOF")):
+		t.Error("other error is a close error")
+	}
+
+	if got := remote.Error(); got != "websocket: remote close 1001" {
+		t.Errorf("Error() = %q", got)
+	}
+	if got := local.Error(); got != "websocket: local close 1002" {
+		t.Errorf("Error() = %q", got)
+	}
+}
+
+func TestControlTooLong(t *testing.T) {
+	c := &Conn{}
+	if err := c.Ping(make([]byte, 126)); err != ErrControlTooLong {
+		t.Errorf("Ping error = %v", err)
+	}
+	if err := c.CloseWithStatus(CloseNormal, strings.Repeat("x", 124)); err != ErrControlTooLong {
+		t.Errorf("CloseWithStatus error = %v", err)
+	}
+}